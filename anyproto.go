@@ -0,0 +1,127 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WithTypeResolver configures DecodeProto to unpack the google.protobuf.Any
+// values of the messages with the types of the resolver, e.g. a
+// protoregistry.Types of the messages that the caller expects. A packed
+// message is flattened like any other, beside its "@type" column. An Any whose
+// type is not found is written as its "@type" and the base64 of its raw
+// "value", as protojson writes bytes. The default resolver is
+// protoregistry.GlobalTypes. Decode ignores this option.
+func WithTypeResolver(resolver protoregistry.MessageTypeResolver) DecodeOption {
+	return func(dec *decoder) {
+		dec.types = resolver
+	}
+}
+
+// isAny will return true if the message is google.protobuf.Any.
+func isAny(desc protoreflect.MessageDescriptor) bool {
+	return desc.FullName() == "google.protobuf.Any"
+}
+
+// clearAnys will clear the Any fields of the message and of its nested
+// messages, other than the well-known types.
+func clearAnys(msg protoreflect.Message) {
+	var anys []protoreflect.FieldDescriptor
+
+	msg.Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+		switch {
+		case fd.IsMap():
+			child := fd.MapValue().Message()
+
+			switch {
+			case child == nil, isWellKnownType(child) && !isAny(child):
+			case isAny(child):
+				anys = append(anys, fd)
+			default:
+				value.Map().Range(func(_ protoreflect.MapKey, elem protoreflect.Value) bool {
+					clearAnys(elem.Message())
+
+					return true
+				})
+			}
+		case fd.Message() == nil:
+		case isAny(fd.Message()):
+			anys = append(anys, fd)
+		case isWellKnownType(fd.Message()):
+		case fd.IsList():
+			for i := 0; i < value.List().Len(); i++ {
+				clearAnys(value.List().Get(i).Message())
+			}
+		default:
+			clearAnys(value.Message())
+		}
+
+		return true
+	})
+
+	for _, fd := range anys {
+		msg.Clear(fd)
+	}
+}
+
+// anyValue will return the protojson value of the Any message, with the
+// packed message unpacked by the type resolver.
+func (dec *decoder) anyValue(msg protoreflect.Message) (*structpb.Value, error) {
+	fields := msg.Descriptor().Fields()
+	url := msg.Get(fields.ByName("type_url")).String()
+	data := msg.Get(fields.ByName("value")).Bytes()
+
+	obj := &structpb.Struct{Fields: map[string]*structpb.Value{"@type": structpb.NewStringValue(url)}}
+
+	resolver := dec.types
+	if resolver == nil {
+		resolver = protoregistry.GlobalTypes
+	}
+
+	msgType, err := resolver.FindMessageByURL(url)
+	if errors.Is(err, protoregistry.NotFound) {
+		obj.Fields["value"] = structpb.NewStringValue(base64.StdEncoding.EncodeToString(data))
+
+		return structpb.NewStructValue(obj), nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %q: %w", url, err)
+	}
+
+	packed := msgType.New()
+	if err := proto.Unmarshal(data, packed.Interface()); err != nil {
+		return nil, fmt.Errorf("failed to unpack %q: %w", url, err)
+	}
+
+	value, err := dec.protoValue(packed)
+	if err != nil {
+		return nil, err
+	}
+
+	// As in protojson, the well-known types are written under "value",
+	// and the fields of other messages beside "@type".
+	if packedObj := value.GetStructValue(); packedObj != nil && !isWellKnownType(packed.Descriptor()) {
+		for key, field := range packedObj.GetFields() {
+			obj.Fields[key] = field
+		}
+	} else {
+		obj.Fields["value"] = value
+	}
+
+	return structpb.NewStructValue(obj), nil
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/anypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+func TestWithTypeResolver(t *testing.T) {
+	t.Parallel()
+
+	desc := paymentDescriptor(t)
+	bankDesc := desc.Fields().ByName("bank_transfer").Message()
+
+	bank := dynamicpb.NewMessage(bankDesc)
+	bank.Set(bankDesc.Fields().ByName("iban"), protoreflect.ValueOfString("DE89"))
+
+	details, err := anypb.New(bank)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payment := dynamicpb.NewMessage(desc)
+	payment.Set(desc.Fields().ByName("id"), protoreflect.ValueOfString("1"))
+	payment.Set(desc.Fields().ByName("details"), protoreflect.ValueOfMessage(details.ProtoReflect()))
+
+	types := new(protoregistry.Types)
+	if err := types.RegisterMessage(dynamicpb.NewMessageType(bankDesc)); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		msgs []*dynamicpb.Message
+		opts []DecodeOption
+		want [][]string
+	}{
+		{
+			name: "known type",
+			msgs: []*dynamicpb.Message{payment},
+			opts: []DecodeOption{WithTypeResolver(types)},
+			want: [][]string{
+				{"card", "details.@type", "details.iban", "id"},
+				{"", "type.googleapis.com/test.Bank", "DE89", "1"},
+			},
+		},
+		{
+			name: "unknown type",
+			msgs: []*dynamicpb.Message{payment},
+			want: [][]string{
+				{"card", "details.@type", "details.value", "id"},
+				{"", "type.googleapis.com/test.Bank", "CgRERTg5", "1"},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := DecodeProto(tcase.msgs, tcase.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err = NewListWriter(&dst, WithAlphabetizeHeaders()).Write(context.Background(), list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestDecodeProtoAny(t *testing.T) {
+	t.Parallel()
+
+	timestamp, err := anypb.New(timestamppb.New(time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := DecodeProto([]*anypb.Any{timestamp})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	if err := NewListWriter(&dst, WithAlphabetizeHeaders()).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"@type", "value"},
+		{"type.googleapis.com/google.protobuf.Timestamp", "2023-01-02T03:04:05Z"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %q, want %q", dst.records, want)
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	// ErrUnknownArrayPolicy is returned when an array policy name cannot
+	// be parsed.
+	ErrUnknownArrayPolicy = fmt.Errorf("unknown array policy")
+
+	// ErrInvalidArrayPolicy is returned when the array policy cannot be
+	// applied, e.g. ArrayPolicyChildTable without WithChildTables.
+	ErrInvalidArrayPolicy = fmt.Errorf("invalid array policy")
+)
+
+// ArrayPolicy is how arrays are written, set by WithArrayPolicy. For example,
+// the record {"id": 1, "tags": ["a", "b"], "items": [{"sku": "x"}, {"sku": "y"}]}
+// is written as:
+//
+//	ArrayPolicyAuto:       id=1, tags=[a,b], items.sku=x; items.sku=y
+//	ArrayPolicyInline:     id=1, tags=[a,b], items=[{"sku":"x"},{"sku":"y"}]
+//	ArrayPolicyExplode:    id=1, tags=a, items.sku=x; tags=b, items.sku=y
+//	ArrayPolicyIndex:      id=1, tags[0]=a, tags[1]=b, items[0].sku=x, items[1].sku=y
+//	ArrayPolicyJSONString: id=1, tags=["a","b"], items=[{"sku":"x"},{"sku":"y"}]
+//	ArrayPolicyChildTable: _id=1, id=1, tags=[a,b]; and the child table "items"
+//
+// where ";" separates the rows of the record.
+type ArrayPolicy int32
+
+const (
+	// ArrayPolicyAuto writes the scalar elements of an array to a single
+	// bracketed cell, e.g. "[a,b]", and explodes the objects in an array
+	// into successive rows. It is the default.
+	ArrayPolicyAuto ArrayPolicy = iota
+
+	// ArrayPolicyInline writes every array to a single bracketed cell,
+	// with the objects and arrays among its elements written as JSON.
+	ArrayPolicyInline
+
+	// ArrayPolicyExplode writes every element of an array to successive
+	// rows, scalars in the column of the array and objects in the columns
+	// of their fields.
+	ArrayPolicyExplode
+
+	// ArrayPolicyIndex writes every element of an array to its own
+	// columns, whose paths have the index of the element, e.g. "tags[0]"
+	// or "items[1].sku", so that a record is always written to one row.
+	ArrayPolicyIndex
+
+	// ArrayPolicyJSONString writes every array to a single cell of JSON.
+	ArrayPolicyJSONString
+
+	// ArrayPolicyChildTable moves the arrays of objects to child tables,
+	// and writes the other arrays as ArrayPolicyAuto does. It is set by
+	// WithChildTables, which must be used to open the child tables.
+	ArrayPolicyChildTable
+)
+
+var arrayPolicyNames = map[ArrayPolicy]string{
+	ArrayPolicyAuto:       "auto",
+	ArrayPolicyInline:     "inline",
+	ArrayPolicyExplode:    "explode",
+	ArrayPolicyIndex:      "index",
+	ArrayPolicyJSONString: "jsonString",
+	ArrayPolicyChildTable: "childTable",
+}
+
+// String returns the name of the array policy.
+func (p ArrayPolicy) String() string {
+	if name, ok := arrayPolicyNames[p]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ArrayPolicy(%d)", p)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p ArrayPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that array policies
+// can be given by name in a Config.
+func (p *ArrayPolicy) UnmarshalText(text []byte) error {
+	for policy, name := range arrayPolicyNames {
+		if name == string(text) {
+			*p = policy
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownArrayPolicy, text)
+}
+
+// WithArrayPolicy configures how the ListWriter writes arrays. WithExplodeDepth
+// limits the policies that explode arrays into rows, ArrayPolicyAuto,
+// ArrayPolicyExplode, and ArrayPolicyChildTable.
+func WithArrayPolicy(policy ArrayPolicy) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.arrayPolicy = policy
+	}
+}
+
+// withArrayPolicy sets how arrays are added.
+func withArrayPolicy(policy ArrayPolicy) columnsOpt {
+	return func(cols *columns) {
+		cols.arrayPolicy = policy
+	}
+}
+
+// writeInlineScalar will write the scalar element of an inline array.
+func writeInlineScalar(buf *strings.Builder, value *structpb.Value) error {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_StringValue:
+		buf.WriteString(valType.StringValue)
+	case *structpb.Value_NumberValue:
+		buf.WriteString(fmt.Sprintf("%f", valType.NumberValue))
+	case *structpb.Value_BoolValue:
+		buf.WriteString(fmt.Sprintf("%t", valType.BoolValue))
+	case *structpb.Value_NullValue:
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedValueType, valType)
+	}
+
+	return nil
+}
+
+// addInline will add the list at the given row as a single bracketed cell.
+func (cols *columns) addInline(path string, list *structpb.ListValue, row int) (int, error) {
+	if len(list.GetValues()) == 0 {
+		return 1, nil
+	}
+
+	var buf strings.Builder
+
+	buf.WriteString("[")
+
+	for i, value := range list.GetValues() {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+
+		var err error
+
+		switch value.Kind.(type) {
+		case *structpb.Value_StructValue, *structpb.Value_ListValue:
+			var data []byte
+			if data, err = json.Marshal(value.AsInterface()); err == nil {
+				buf.Write(data)
+			}
+		default:
+			err = writeInlineScalar(&buf, value)
+		}
+
+		if err != nil {
+			return 0, withPathSegment(err, pathSegment{index: i, isIndex: true})
+		}
+	}
+
+	buf.WriteString("]")
+
+	col, err := cols.setData(path, row, structpb.NewStringValue(buf.String()))
+	if err != nil {
+		return 0, err
+	}
+
+	col.stats.observe(structpb.NewListValue(list))
+
+	return 1, nil
+}
+
+// addExploded will add the elements of the list to successive rows, starting at
+// the given row, returning the number of rows that they occupy.
+func (cols *columns) addExploded(path string, list *structpb.ListValue, row int) (int, error) {
+	height := 0
+
+	cols.depth++
+	defer func() { cols.depth-- }()
+
+	for i, value := range list.GetValues() {
+		n, err := cols.addField(path, value, row+height)
+		if err != nil {
+			return 0, withPathSegment(err, pathSegment{index: i, isIndex: true})
+		}
+
+		height += n
+	}
+
+	if height == 0 {
+		height = 1
+	}
+
+	return height, nil
+}
+
+// addIndexed will add each element of the list to the columns at its indexed
+// path.
+func (cols *columns) addIndexed(path string, list *structpb.ListValue, row int) (int, error) {
+	for i, value := range list.GetValues() {
+		if _, err := cols.addField(fmt.Sprintf("%s[%d]", path, i), value, row); err != nil {
+			return 0, withPathSegment(err, pathSegment{index: i, isIndex: true})
+		}
+	}
+
+	return 1, nil
+}
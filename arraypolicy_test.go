@@ -0,0 +1,133 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteArrayPolicy(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"id": 1, "tags": ["a", "b"], "items": [{"sku": "x"}, {"sku": "y"}]},
+		{"id": 2, "tags": [], "mixed": ["c", {"sku": "z"}, true]}
+	]`)
+
+	for _, tcase := range []struct {
+		policy ArrayPolicy
+		want   [][]string
+	}{
+		{
+			policy: ArrayPolicyAuto,
+			want: [][]string{
+				{"id", "items.sku", "mixed", "mixed.sku", "tags"},
+				{"1.000000", "x", "", "", "[a,b]"},
+				{"", "y", "", "", ""},
+				{"2.000000", "", "[c,true]", "z", ""},
+			},
+		},
+		{
+			policy: ArrayPolicyInline,
+			want: [][]string{
+				{"id", "items", "mixed", "tags"},
+				{"1.000000", `[{"sku":"x"},{"sku":"y"}]`, "", "[a,b]"},
+				{"2.000000", "", `[c,{"sku":"z"},true]`, ""},
+			},
+		},
+		{
+			policy: ArrayPolicyExplode,
+			want: [][]string{
+				{"id", "items.sku", "mixed", "mixed.sku", "tags"},
+				{"1.000000", "x", "", "", "a"},
+				{"", "y", "", "", "b"},
+				{"2.000000", "", "c", "", ""},
+				{"", "", "", "z", ""},
+				{"", "", "true", "", ""},
+			},
+		},
+		{
+			policy: ArrayPolicyIndex,
+			want: [][]string{
+				{"id", "items[0].sku", "items[1].sku", "mixed[0]", "mixed[1].sku", "mixed[2]", "tags[0]", "tags[1]"},
+				{"1.000000", "x", "y", "", "", "", "a", "b"},
+				{"2.000000", "", "", "c", "z", "true", "", ""},
+			},
+		},
+		{
+			policy: ArrayPolicyJSONString,
+			want: [][]string{
+				{"id", "items", "mixed", "tags"},
+				{"1.000000", `[{"sku":"x"},{"sku":"y"}]`, "", `["a","b"]`},
+				{"2.000000", "", `["c",{"sku":"z"},true]`, "[]"},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.policy.String(), func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err = NewListWriter(&dst, WithAlphabetizeHeaders(), WithArrayPolicy(tcase.policy)).
+				Write(context.Background(), list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestWriteArrayPolicyChildTable(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1, "items": [{"sku": "x"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewListWriter(&recordWriter{}, WithArrayPolicy(ArrayPolicyChildTable)).
+		Write(context.Background(), list)
+	if !errors.Is(err, ErrInvalidArrayPolicy) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidArrayPolicy)
+	}
+
+	// A later policy replaces the child tables.
+	open := func(string) (Writer, error) {
+		t.Fatal("unexpected child table")
+
+		return nil, nil
+	}
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithAlphabetizeHeaders(), WithChildTables(open),
+		WithArrayPolicy(ArrayPolicyJSONString)).Write(context.Background(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"id", "items"}, {"1.000000", `[{"sku":"x"}]`}}
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
@@ -0,0 +1,70 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// asciiReplacement replaces the characters of a header that have no ASCII
+// transliteration.
+const asciiReplacement = '_'
+
+// asciiFolds are the transliterations of the letters that do not decompose
+// into an ASCII letter and combining marks.
+var asciiFolds = map[rune]string{
+	'ß': "ss", 'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'Ø': "O", 'ø': "o",
+	'Ł': "L", 'ł': "l", 'Đ': "D", 'đ': "d", 'Ð': "D", 'ð': "d", 'Þ': "TH",
+	'þ': "th", 'ı': "i",
+}
+
+// WithASCIIHeaders configures the ListWriter to write the header in printable
+// ASCII, for the ingestion systems that reject other column names. Accented
+// letters lose their accents, e.g. "é" is written as "e", compatibility
+// characters such as ligatures and full-width letters are written as their
+// ASCII equivalents, and a few other letters are transliterated, e.g. "ß" as
+// "ss". Any other character, control character, or invalid byte is replaced
+// with "_". Only the header is changed; the cells are written as they are.
+func WithASCIIHeaders() ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.asciiHeaders = true
+	}
+}
+
+// asciiHeader will transliterate the header to printable ASCII.
+func asciiHeader(header string) string {
+	var builder strings.Builder
+
+	builder.Grow(len(header))
+
+	for _, r := range norm.NFKD.String(header) {
+		if r >= ' ' && r <= '~' {
+			builder.WriteRune(r)
+
+			continue
+		}
+
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+
+		if fold, ok := asciiFolds[r]; ok {
+			builder.WriteString(fold)
+
+			continue
+		}
+
+		builder.WriteRune(asciiReplacement)
+	}
+
+	return builder.String()
+}
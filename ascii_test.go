@@ -0,0 +1,84 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestASCIIHeader(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		header string
+		want   string
+	}{
+		{header: "name", want: "name"},
+		{header: "café", want: "cafe"},
+		{header: "Ångström", want: "Angstrom"},
+		{header: "straße", want: "strasse"},
+		{header: "ﬁle", want: "file"},
+		{header: "ＩＤ", want: "ID"},
+		{header: "名前", want: "__"},
+		{header: "tab\there", want: "tab_here"},
+		{header: "bad\xffbyte", want: "bad_byte"},
+	} {
+		if got := asciiHeader(tcase.header); got != tcase.want {
+			t.Errorf("asciiHeader(%q) = %q, want %q", tcase.header, got, tcase.want)
+		}
+	}
+}
+
+func TestWithASCIIHeaders(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"prénom": "José", "âge": {"année": 1}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithASCIIHeaders(), WithAlphabetizeHeaders(), WithRounding(0, RoundHalfUp)).
+		Write(context.Background(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"prenom", "age.annee"}, {"José", "1"}}
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %q, want %q", dst.records, want)
+	}
+}
+
+func TestEncoderASCIIHeaders(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, WithASCIIHeaders(), WithRepeatHeader(nil), WithRounding(0, RoundHalfUp))
+
+	for _, data := range []string{`[{"é": 1}]`, `[{"é": 2, "ü": 3}]`} {
+		list, err := Decode(DecodeTypeJSON, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := buf.String(), "e\n1\ne,u\n2,3\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrEncoderClosed is returned when a list is written to an AsyncEncoder after
+// it has been closed.
+var ErrEncoderClosed = fmt.Errorf("encoder is closed")
+
+// AsyncEncoder writes lists with an Encoder in a background goroutine, so that
+// the caller, e.g. a request handler, can return before the lists have been
+// written. Write only enqueues the list, and any error from encoding it is
+// deferred: it is returned by the next call to Write, and by Close. Once an
+// error has occurred, the lists still in the queue are discarded.
+//
+// The lists are encoded in the order that they are enqueued, with a
+// background context, since the context given to Write usually ends when the
+// caller returns.
+type AsyncEncoder struct {
+	encoder *Encoder
+	queue   chan *structpb.ListValue
+	done    chan struct{}
+
+	// mu guards closed, and is held for reading while a list is
+	// enqueued, so that the queue is not closed during a send.
+	mu     sync.RWMutex
+	closed bool
+
+	// closeOnce closes the Encoder after the last list is encoded.
+	closeOnce sync.Once
+
+	errMu sync.Mutex
+	err   error
+}
+
+// NewAsyncEncoder creates an AsyncEncoder that encodes with the Encoder, and
+// starts its background goroutine. Up to "queue" lists are buffered before
+// Write blocks. Close must be called to stop the goroutine.
+func NewAsyncEncoder(encoder *Encoder, queue int) *AsyncEncoder {
+	if queue < 0 {
+		queue = 0
+	}
+
+	async := &AsyncEncoder{
+		encoder: encoder,
+		queue:   make(chan *structpb.ListValue, queue),
+		done:    make(chan struct{}),
+	}
+
+	go async.run()
+
+	return async
+}
+
+// run encodes the enqueued lists until the queue is closed.
+func (async *AsyncEncoder) run() {
+	defer close(async.done)
+
+	for list := range async.queue {
+		if async.deferredErr() != nil {
+			continue
+		}
+
+		if err := async.encoder.Encode(context.Background(), list); err != nil {
+			async.errMu.Lock()
+			async.err = err
+			async.errMu.Unlock()
+		}
+	}
+}
+
+// deferredErr will return the error from encoding a list, if one occurred.
+func (async *AsyncEncoder) deferredErr() error {
+	async.errMu.Lock()
+	defer async.errMu.Unlock()
+
+	return async.err
+}
+
+// Write enqueues the list to be encoded, blocking while the queue is full
+// until the context is done. It returns the error from encoding an earlier
+// list, if one occurred, and ErrEncoderClosed after Close.
+func (async *AsyncEncoder) Write(ctx context.Context, list *structpb.ListValue) error {
+	async.mu.RLock()
+	defer async.mu.RUnlock()
+
+	if async.closed {
+		return ErrEncoderClosed
+	}
+
+	if err := async.deferredErr(); err != nil {
+		return err
+	}
+
+	select {
+	case async.queue <- list:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("failed to enqueue list: %w", ctx.Err())
+	}
+}
+
+// Close waits for the enqueued lists to be encoded, which flushes them, and
+// then closes the Encoder, which ends the compressed stream if WithZstd is
+// used. It returns the error from encoding the lists, if one occurred, or from
+// closing the Encoder. Calling Close again returns the same error.
+func (async *AsyncEncoder) Close() error {
+	async.mu.Lock()
+
+	if !async.closed {
+		async.closed = true
+		close(async.queue)
+	}
+
+	async.mu.Unlock()
+
+	<-async.done
+
+	async.closeOnce.Do(func() {
+		err := async.encoder.Close()
+
+		async.errMu.Lock()
+		defer async.errMu.Unlock()
+
+		if async.err == nil {
+			async.err = err
+		}
+	})
+
+	return async.deferredErr()
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// failingWriter is an io.Writer that always fails.
+type failingWriter struct{}
+
+var errFailingWriter = errors.New("write failed")
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errFailingWriter
+}
+
+func TestAsyncEncoder(t *testing.T) {
+	t.Parallel()
+
+	const lists = 20
+
+	var buf bytes.Buffer
+
+	async := NewAsyncEncoder(NewEncoder(&buf), 4)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < lists; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			list, err := structpb.NewList([]any{map[string]any{"n": i}})
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if err := async.Write(context.Background(), list); err != nil {
+				t.Errorf("failed to write list: %v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	if err := async.Close(); err != nil {
+		t.Fatalf("failed to close: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != lists+1 {
+		t.Fatalf("got %d lines, want %d", len(lines), lists+1)
+	}
+
+	list, err := structpb.NewList([]any{map[string]any{"n": 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := async.Write(context.Background(), list); !errors.Is(err, ErrEncoderClosed) {
+		t.Fatalf("got error %v, want %v", err, ErrEncoderClosed)
+	}
+}
+
+func TestAsyncEncoderDeferredError(t *testing.T) {
+	t.Parallel()
+
+	async := NewAsyncEncoder(NewEncoder(failingWriter{}), 0)
+
+	list, err := structpb.NewList([]any{map[string]any{"n": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := async.Write(context.Background(), list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := async.Close(); !errors.Is(err, errFailingWriter) {
+		t.Fatalf("got error %v, want %v", err, errFailingWriter)
+	}
+
+	if err := async.Close(); !errors.Is(err, errFailingWriter) {
+		t.Fatalf("got error %v on second close, want %v", err, errFailingWriter)
+	}
+}
+
+func TestAsyncEncoderCanceled(t *testing.T) {
+	t.Parallel()
+
+	// The reader never reads, so the encoder blocks on the first list and
+	// the unbuffered queue stays full.
+	reader, writer := io.Pipe()
+
+	async := NewAsyncEncoder(NewEncoder(writer), 0)
+
+	list, err := structpb.NewList([]any{map[string]any{"n": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := async.Write(context.Background(), list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := async.Write(ctx, list); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	reader.Close()
+
+	if err := async.Close(); !errors.Is(err, io.ErrClosedPipe) {
+		t.Fatalf("got error %v, want %v", err, io.ErrClosedPipe)
+	}
+}
+
+func TestAsyncEncoderClosesEncoder(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	async := NewAsyncEncoder(NewEncoder(&buf, WithZstd()), 1)
+
+	list, err := structpb.NewList([]any{map[string]any{"n": 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := async.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := async.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := decompressZstd(t, buf.Bytes(), true), "n\n1.000000\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
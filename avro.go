@@ -0,0 +1,269 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+)
+
+// avroBlockRows is the number of rows buffered per Avro data block. The first
+// block is also used to infer the schema.
+const avroBlockRows = 1000
+
+// invalidAvroNameChars matches the characters that are not allowed in Avro
+// names.
+var invalidAvroNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// AvroWriter is a Writer that writes records to an Avro Object Container
+// File. The schema is a record of nullable fields inferred from the first
+// block of rows: integers become "long", numbers "double", true/false
+// "boolean", and everything else "string". Empty cells are written as null.
+// Since later rows may not match the inferred type, e.g. an id of "A1" after a
+// thousand numeric ids, the fields that are not strings are unions that also
+// accept a string, and such cells are written as strings.
+//
+// Headers are sanitized into valid Avro names, e.g. "foo.bar" becomes
+// "foo_bar", and the original header is kept as the field's doc.
+type AvroWriter struct {
+	writer io.Writer
+	name   string
+	header []string
+	types  []ColumnType
+	rows   [][]string
+	sync   []byte
+}
+
+// NewAvroWriter creates an AvroWriter that writes to "writer", using "name" as
+// the name of the Avro record schema. Flush must be called after the last
+// record is written.
+func NewAvroWriter(writer io.Writer, name string) *AvroWriter {
+	return &AvroWriter{writer: writer, name: name}
+}
+
+// avroName will sanitize the string into a valid Avro name.
+func avroName(str string) string {
+	name := invalidAvroNameChars.ReplaceAllString(str, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	return name
+}
+
+// avroType will return the Avro primitive type for the cell type.
+func avroType(typ ColumnType) string {
+	switch typ {
+	case ColumnTypeInt:
+		return "long"
+	case ColumnTypeFloat:
+		return "double"
+	case ColumnTypeBool:
+		return "boolean"
+	case ColumnTypeString:
+		fallthrough
+	default:
+		return "string"
+	}
+}
+
+func appendAvroLong(buf []byte, num int64) []byte {
+	return binary.AppendVarint(buf, num)
+}
+
+func appendAvroBytes(buf []byte, data []byte) []byte {
+	buf = appendAvroLong(buf, int64(len(data)))
+
+	return append(buf, data...)
+}
+
+// schema will return the Avro schema as JSON.
+func (w *AvroWriter) schema() ([]byte, error) {
+	type field struct {
+		Name    string   `json:"name"`
+		Doc     string   `json:"doc"`
+		Type    []string `json:"type"`
+		Default any      `json:"default"`
+	}
+
+	fields := make([]field, len(w.header))
+	used := make(map[string]bool)
+	suffixes := make(map[string]int)
+
+	for i, header := range w.header {
+		name := avroName(header)
+
+		// Disambiguate headers that sanitize to the same name, with a
+		// suffix that is not itself the name of another header.
+		for base := name; used[name]; {
+			suffixes[base]++
+			name = fmt.Sprintf("%s_%d", base, suffixes[base])
+		}
+
+		used[name] = true
+
+		typ := []string{"null", avroType(w.types[i])}
+		if w.types[i] != ColumnTypeString {
+			typ = append(typ, avroType(ColumnTypeString))
+		}
+
+		fields[i] = field{Name: name, Doc: header, Type: typ}
+	}
+
+	schema, err := json.Marshal(map[string]any{
+		"type":   "record",
+		"name":   avroName(w.name),
+		"fields": fields,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal avro schema: %w", err)
+	}
+
+	return schema, nil
+}
+
+// writeHeader will infer the schema and write the container file header.
+func (w *AvroWriter) writeHeader() error {
+	w.types = make([]ColumnType, len(w.header))
+	for i := range w.header {
+		w.types[i] = inferCellType(w.rows, i)
+	}
+
+	schema, err := w.schema()
+	if err != nil {
+		return err
+	}
+
+	w.sync = make([]byte, 16) //nolint:gomnd
+	if _, err := rand.Read(w.sync); err != nil {
+		return fmt.Errorf("failed to generate avro sync marker: %w", err)
+	}
+
+	buf := []byte("Obj\x01")
+
+	// The file metadata is a map with one block of two entries.
+	buf = appendAvroLong(buf, 2) //nolint:gomnd
+	buf = appendAvroBytes(buf, []byte("avro.schema"))
+	buf = appendAvroBytes(buf, schema)
+	buf = appendAvroBytes(buf, []byte("avro.codec"))
+	buf = appendAvroBytes(buf, []byte("null"))
+	buf = appendAvroLong(buf, 0)
+	buf = append(buf, w.sync...)
+
+	if _, err := w.writer.Write(buf); err != nil {
+		return fmt.Errorf("failed to write avro header: %w", err)
+	}
+
+	return nil
+}
+
+// appendAvroCell will append the cell to the union of null, the given type,
+// and string, writing the cells that are not of the given type as strings.
+func appendAvroCell(buf []byte, cell string, typ ColumnType) []byte {
+	if cell == "" {
+		return appendAvroLong(buf, 0)
+	}
+
+	if !cellConforms(cell, typ) {
+		buf = appendAvroLong(buf, 2) //nolint:gomnd
+
+		return appendAvroBytes(buf, []byte(cell))
+	}
+
+	buf = appendAvroLong(buf, 1)
+
+	switch typ {
+	case ColumnTypeInt:
+		num, _ := strconv.ParseInt(cell, 10, 64)
+		buf = appendAvroLong(buf, num)
+	case ColumnTypeFloat:
+		num, _ := strconv.ParseFloat(cell, 64)
+		buf = binary.LittleEndian.AppendUint64(buf, math.Float64bits(num))
+	case ColumnTypeBool:
+		if cell == "true" {
+			buf = append(buf, 1)
+		} else {
+			buf = append(buf, 0)
+		}
+	case ColumnTypeString:
+		buf = appendAvroBytes(buf, []byte(cell))
+	}
+
+	return buf
+}
+
+// Write stores the first record as the header and buffers the rest, writing
+// them in blocks.
+func (w *AvroWriter) Write(record []string) error {
+	if w.header == nil {
+		w.header = append([]string{}, record...)
+
+		return nil
+	}
+
+	w.rows = append(w.rows, append([]string{}, record...))
+
+	if len(w.rows) < avroBlockRows {
+		return nil
+	}
+
+	return w.Flush()
+}
+
+// Flush writes the container file header, if it has not been written, and
+// any buffered rows as a data block.
+func (w *AvroWriter) Flush() error {
+	if w.header == nil {
+		return nil
+	}
+
+	if w.sync == nil {
+		if err := w.writeHeader(); err != nil {
+			return err
+		}
+	}
+
+	if len(w.rows) == 0 {
+		return nil
+	}
+
+	var data []byte
+
+	for _, row := range w.rows {
+		for i, typ := range w.types {
+			cell := ""
+			if i < len(row) {
+				cell = row[i]
+			}
+
+			data = appendAvroCell(data, cell, typ)
+		}
+	}
+
+	var block bytes.Buffer
+
+	block.Write(appendAvroLong(nil, int64(len(w.rows))))
+	block.Write(appendAvroBytes(nil, data))
+	block.Write(w.sync)
+
+	if _, err := w.writer.Write(block.Bytes()); err != nil {
+		return fmt.Errorf("failed to write avro block: %w", err)
+	}
+
+	w.rows = w.rows[:0]
+
+	return nil
+}
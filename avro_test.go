@@ -0,0 +1,222 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// avroReader decodes the Avro binary encoding for tests.
+type avroReader struct {
+	t   *testing.T
+	buf *bytes.Reader
+}
+
+func (r avroReader) long() int64 {
+	num, err := binary.ReadVarint(r.buf)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+
+	return num
+}
+
+func (r avroReader) bytes() []byte {
+	data := make([]byte, r.long())
+	if _, err := r.buf.Read(data); err != nil {
+		r.t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestAvroWriter(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": "1", "score": 1.5, "ok": "true", "geo": {"zip": "02134"}},
+		{"id": "2", "score": null, "ok": "false", "geo": {"zip": "10001"}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	writer := NewAvroWriter(&buf, "users")
+	if err := NewListWriter(writer, WithAlphabetizeHeaders()).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rdr := avroReader{t: t, buf: bytes.NewReader(buf.Bytes())}
+
+	magic := make([]byte, 4)
+	if _, err := rdr.buf.Read(magic); err != nil || string(magic) != "Obj\x01" {
+		t.Fatalf("got magic %q, want %q", magic, "Obj\x01")
+	}
+
+	meta := make(map[string]string)
+	for n := rdr.long(); n > 0; n-- {
+		meta[string(rdr.bytes())] = string(rdr.bytes())
+	}
+
+	if rdr.long() != 0 {
+		t.Fatal("expected end of metadata map")
+	}
+
+	var schema struct {
+		Name   string `json:"name"`
+		Fields []struct {
+			Name string   `json:"name"`
+			Doc  string   `json:"doc"`
+			Type []string `json:"type"`
+		} `json:"fields"`
+	}
+
+	if err := json.Unmarshal([]byte(meta["avro.schema"]), &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	gotTypes := make(map[string]string)
+	for _, field := range schema.Fields {
+		gotTypes[field.Name] = field.Type[1]
+	}
+
+	wantTypes := map[string]string{"geo_zip": "string", "id": "long", "ok": "boolean", "score": "double"}
+	if schema.Name != "users" || !reflect.DeepEqual(gotTypes, wantTypes) {
+		t.Fatalf("got schema %+v, want types %v", schema, wantTypes)
+	}
+
+	sync := make([]byte, 16)
+	rdr.buf.Read(sync) //nolint:errcheck
+
+	if count := rdr.long(); count != 2 {
+		t.Fatalf("got block count %d, want 2", count)
+	}
+
+	block := avroReader{t: t, buf: bytes.NewReader(rdr.bytes())}
+
+	// Decode the rows in header order: geo.zip, id, ok, score.
+	var got []any
+
+	for i := 0; i < 2; i++ {
+		for _, typ := range []string{"string", "long", "boolean", "double"} {
+			if block.long() == 0 {
+				got = append(got, nil)
+
+				continue
+			}
+
+			switch typ {
+			case "string":
+				got = append(got, string(block.bytes()))
+			case "long":
+				got = append(got, block.long())
+			case "boolean":
+				b, _ := block.buf.ReadByte()
+				got = append(got, b == 1)
+			case "double":
+				bits := make([]byte, 8)
+				block.buf.Read(bits) //nolint:errcheck
+				got = append(got, math.Float64frombits(binary.LittleEndian.Uint64(bits)))
+			}
+		}
+	}
+
+	want := []any{"02134", int64(1), true, 1.5, "10001", int64(2), false, nil}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got rows %v, want %v", got, want)
+	}
+}
+
+func TestAvroWriterTypeMismatch(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	writer := NewAvroWriter(&buf, "test")
+
+	_ = writer.Write([]string{"id"})
+	_ = writer.Write([]string{"1"})
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Contains(buf.Bytes(), []byte(`"type":["null","long","string"]`)) {
+		t.Fatalf("got schema without a string branch in %q", buf.Bytes())
+	}
+
+	block := buf.Len()
+
+	_ = writer.Write([]string{"A1"})
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	rdr := avroReader{t: t, buf: bytes.NewReader(buf.Bytes()[block:])}
+
+	if count := rdr.long(); count != 1 {
+		t.Fatalf("got block count %d, want 1", count)
+	}
+
+	data := avroReader{t: t, buf: bytes.NewReader(rdr.bytes())}
+
+	if branch, cell := data.long(), string(data.bytes()); branch != 2 || cell != "A1" {
+		t.Fatalf("got branch %d with %q, want branch 2 with %q", branch, cell, "A1")
+	}
+}
+
+func TestAvroWriterNames(t *testing.T) {
+	t.Parallel()
+
+	writer := NewAvroWriter(&bytes.Buffer{}, "test")
+
+	_ = writer.Write([]string{"a_1", "a", "a", "a.1"})
+	_ = writer.Write([]string{"1", "2", "3", "4"})
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := writer.schema()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var schema struct {
+		Fields []struct {
+			Name string `json:"name"`
+		} `json:"fields"`
+	}
+
+	if err := json.Unmarshal(data, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, field := range schema.Fields {
+		got = append(got, field.Name)
+	}
+
+	if want := []string{"a_1", "a", "a_2", "a_1_1"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got names %v, want %v", got, want)
+	}
+}
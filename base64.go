@@ -0,0 +1,134 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	// ErrInvalidBase64 is returned when a cell of a column decoded by
+	// WithBase64Decode is not base64.
+	ErrInvalidBase64 = fmt.Errorf("invalid base64")
+
+	// ErrUnknownBase64Output is returned when a base64 output name cannot
+	// be parsed.
+	ErrUnknownBase64Output = fmt.Errorf("unknown base64 output")
+)
+
+// Base64Output is how WithBase64Decode writes the decoded bytes of a column.
+type Base64Output int32
+
+const (
+	// Base64OutputText writes the bytes as UTF-8 text, replacing invalid
+	// sequences with U+FFFD. It is the default.
+	Base64OutputText Base64Output = iota
+
+	// Base64OutputHex writes the bytes in lowercase hex, e.g. for hashes
+	// and binary identifiers.
+	Base64OutputHex
+)
+
+var base64OutputNames = map[Base64Output]string{
+	Base64OutputText: "text",
+	Base64OutputHex:  "hex",
+}
+
+// String returns the name of the base64 output.
+func (b Base64Output) String() string {
+	if name, ok := base64OutputNames[b]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Base64Output(%d)", b)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (b Base64Output) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that base64 outputs
+// can be given by name in a Config.
+func (b *Base64Output) UnmarshalText(text []byte) error {
+	for output, name := range base64OutputNames {
+		if name == string(text) {
+			*b = output
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownBase64Output, text)
+}
+
+// WithBase64Decode configures the ListWriter to decode the strings of the
+// columns from base64, as protojson writes the bytes fields of protobuf
+// messages, in the standard or URL-safe alphabet, with or without padding. The
+// bytes of every cell of a column are written as "output" says, so that a
+// column is either all text or all hex. Strings that are not base64 fail the
+// write with ErrInvalidBase64, unless a warning handler is configured, in
+// which case they are reported to the handler and written unchanged. Values
+// that are not strings are written as usual.
+func WithBase64Decode(output Base64Output, columns ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if listWriter.base64Columns == nil {
+			listWriter.base64Columns = make(map[string]Base64Output, len(columns))
+		}
+
+		for _, column := range columns {
+			listWriter.base64Columns[column] = output
+		}
+	}
+}
+
+// base64Replacer maps the URL-safe alphabet to the standard one.
+var base64Replacer = strings.NewReplacer("-", "+", "_", "/")
+
+// decodeBase64 will decode the string as unpadded standard base64, after
+// mapping the URL-safe alphabet and removing any padding.
+func decodeBase64(str string) ([]byte, error) {
+	str = strings.TrimRight(base64Replacer.Replace(str), "=")
+
+	return base64.RawStdEncoding.DecodeString(str)
+}
+
+// decodeBase64Value will return the string value of the decoded bytes of a
+// string value, as text or hex.
+func (w *ListWriter) decodeBase64Value(path string, output Base64Output,
+	value *structpb.Value,
+) (*structpb.Value, error) {
+	str, ok := value.Kind.(*structpb.Value_StringValue)
+	if !ok {
+		return value, nil
+	}
+
+	data, err := decodeBase64(str.StringValue)
+	if err != nil {
+		err = fmt.Errorf("%w: column %q: %v", ErrInvalidBase64, path, err)
+		if w.warn == nil {
+			return nil, err
+		}
+
+		w.warn(err)
+
+		return value, nil
+	}
+
+	if output == Base64OutputHex {
+		return structpb.NewStringValue(hex.EncodeToString(data)), nil
+	}
+
+	return structpb.NewStringValue(strings.ToValidUTF8(string(data), "\uFFFD")), nil
+}
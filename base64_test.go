@@ -0,0 +1,122 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWithBase64Decode(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		data   string
+		output Base64Output
+		opts   []ListWriterOption
+		want   [][]string
+		err    error
+	}{
+		{
+			name: "text",
+			data: `[{"payload": "aGVsbG8gd29ybGQ=", "other": "aGk="}]`,
+			want: [][]string{{"other", "payload"}, {"aGk=", "hello world"}},
+		},
+		{
+			name: "invalid utf-8 as text",
+			data: `[{"payload": "cafe"}]`,
+			want: [][]string{{"payload"}, {"q\uFFFD"}},
+		},
+		{
+			name:   "hex",
+			data:   `[{"payload": "AP8Q"}, {"payload": "aGk="}]`,
+			output: Base64OutputHex,
+			want:   [][]string{{"payload"}, {"00ff10"}, {"6869"}},
+		},
+		{
+			name:   "url-safe without padding",
+			data:   `[{"payload": "-_8"}]`,
+			output: Base64OutputHex,
+			want:   [][]string{{"payload"}, {"fbff"}},
+		},
+		{
+			name: "not a string",
+			data: `[{"payload": null}, {"payload": true}]`,
+			want: [][]string{{"payload"}, {""}, {"true"}},
+		},
+		{
+			name: "invalid",
+			data: `[{"payload": "not base64!"}]`,
+			err:  ErrInvalidBase64,
+		},
+		{
+			name: "invalid with warning",
+			data: `[{"payload": "not base64!"}]`,
+			opts: []ListWriterOption{WithWarningHandler(func(error) {})},
+			want: [][]string{{"payload"}, {"not base64!"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders(), WithBase64Decode(tcase.output, "payload")},
+				tcase.opts...)
+
+			err = NewListWriter(&dst, opts...).Write(context.Background(), list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestBase64OutputText(t *testing.T) {
+	t.Parallel()
+
+	for output := range base64OutputNames {
+		text, err := output.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got Base64Output
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != output {
+			t.Fatalf("got %v, want %v", got, output)
+		}
+	}
+
+	var output Base64Output
+	if err := output.UnmarshalText([]byte("binary")); !errors.Is(err, ErrUnknownBase64Output) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownBase64Output)
+	}
+}
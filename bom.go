@@ -0,0 +1,72 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+var (
+	bomUTF8    = []byte{0xef, 0xbb, 0xbf}
+	bomUTF16BE = []byte{0xfe, 0xff}
+	bomUTF16LE = []byte{0xff, 0xfe}
+)
+
+// utf16Order will return the byte order of UTF-16 data, and the length of its
+// byte order mark, or nil if the data is not UTF-16. Without a mark, UTF-16 is
+// detected as RFC 4627 does, by the zero byte next to the first character,
+// which in JSON is always ASCII.
+func utf16Order(data []byte) (binary.ByteOrder, int) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return binary.BigEndian, len(bomUTF16BE)
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return binary.LittleEndian, len(bomUTF16LE)
+	case len(data) >= 2 && data[0] == 0 && data[1] != 0:
+		return binary.BigEndian, 0
+	case len(data) >= 2 && data[0] != 0 && data[1] == 0:
+		return binary.LittleEndian, 0
+	}
+
+	return nil, 0
+}
+
+// toUTF8 will strip the byte order mark from the data, and transcode it from
+// UTF-16 to UTF-8 if it is UTF-16.
+func toUTF8(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, bomUTF8) {
+		return data[len(bomUTF8):], nil
+	}
+
+	order, bom := utf16Order(data)
+	if order == nil {
+		return data, nil
+	}
+
+	data = data[bom:]
+	if len(data)%2 != 0 {
+		return nil, invalidJSON(fmt.Errorf("utf-16 input has an odd length of %d bytes", len(data)))
+	}
+
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		units[i] = order.Uint16(data[2*i:])
+	}
+
+	out := make([]byte, 0, len(units))
+	for _, r := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, r)
+	}
+
+	return out, nil
+}
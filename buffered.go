@@ -0,0 +1,73 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// DefaultFlushThreshold is the number of bytes that a BufferedWriter holds
+// before it flushes, when no threshold is given.
+const DefaultFlushThreshold = 64 << 10
+
+// BufferedWriter buffers the bytes written to an io.Writer, and writes them
+// through only when more than the threshold is buffered, or on Flush or Close.
+// It suits high-rate streams, such as an Encoder that flushes its CSV writer
+// after every list, or a csv.Writer flushed after every row, which would
+// otherwise issue a write to the underlying file or connection each time.
+//
+// The Flush of a csv.Writer only writes into the BufferedWriter, so the
+// BufferedWriter must be closed, or flushed, once the stream is written. A
+// BufferedWriter is not safe for concurrent use.
+type BufferedWriter struct {
+	writer *bufio.Writer
+	dst    io.Writer
+}
+
+// NewBufferedWriter creates a BufferedWriter that writes to "w" once more than
+// "threshold" bytes are buffered. If "threshold" is not positive,
+// DefaultFlushThreshold is used.
+func NewBufferedWriter(w io.Writer, threshold int) *BufferedWriter {
+	if threshold <= 0 {
+		threshold = DefaultFlushThreshold
+	}
+
+	return &BufferedWriter{writer: bufio.NewWriterSize(w, threshold), dst: w}
+}
+
+// Write buffers "p", writing the buffer through when it is full.
+func (bw *BufferedWriter) Write(p []byte) (int, error) {
+	return bw.writer.Write(p)
+}
+
+// Buffered returns the number of bytes that have not been written through.
+func (bw *BufferedWriter) Buffered() int {
+	return bw.writer.Buffered()
+}
+
+// Flush writes the buffered bytes through.
+func (bw *BufferedWriter) Flush() error {
+	return bw.writer.Flush()
+}
+
+// Close flushes the buffered bytes, and then closes the underlying writer if it
+// is an io.Closer.
+func (bw *BufferedWriter) Close() error {
+	if err := bw.writer.Flush(); err != nil {
+		return fmt.Errorf("failed to flush: %w", err)
+	}
+
+	if closer, ok := bw.dst.(io.Closer); ok {
+		return closer.Close()
+	}
+
+	return nil
+}
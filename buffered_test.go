@@ -0,0 +1,107 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"strings"
+	"testing"
+)
+
+// countingWriter counts the writes made to it, and closes.
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+	closed bool
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+
+	return w.Buffer.Write(p)
+}
+
+func (w *countingWriter) Close() error {
+	w.closed = true
+
+	return nil
+}
+
+func TestBufferedWriter(t *testing.T) {
+	t.Parallel()
+
+	var dst countingWriter
+
+	buffered := NewBufferedWriter(&dst, 64)
+	csvWriter := csv.NewWriter(buffered)
+
+	for i := 0; i < 20; i++ {
+		if err := csvWriter.Write([]string{"a", "b", "c"}); err != nil {
+			t.Fatal(err)
+		}
+
+		// Flushing the CSV writer after every row does not write
+		// through.
+		csvWriter.Flush()
+	}
+
+	if dst.writes == 0 || dst.writes >= 20 {
+		t.Fatalf("got %d writes through, want fewer than one per row", dst.writes)
+	}
+
+	if buffered.Buffered() == 0 || buffered.Buffered() > 64 {
+		t.Fatalf("got %d bytes buffered, want up to the threshold", buffered.Buffered())
+	}
+
+	if err := buffered.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !dst.closed {
+		t.Fatal("expected the underlying writer to be closed")
+	}
+
+	if got, want := dst.Len(), 20*len("a,b,c\n"); got != want {
+		t.Fatalf("got %d bytes, want %d", got, want)
+	}
+}
+
+func TestBufferedWriterEncoder(t *testing.T) {
+	t.Parallel()
+
+	var dst countingWriter
+
+	buffered := NewBufferedWriter(&dst, 0)
+	enc := NewEncoder(buffered)
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1}, {"id": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if dst.writes != 0 {
+		t.Fatalf("got %d writes through before Flush, want 0", dst.writes)
+	}
+
+	if err := buffered.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := dst.String(), "id\n"+strings.Repeat("1.000000\n2.000000\n", 10); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrHighCardinality is the warning reported when a column has more distinct
+// values than the limit set by WithCardinalityLimit.
+var ErrHighCardinality = fmt.Errorf("high cardinality")
+
+// WithCardinalityLimit configures the ListWriter to count the distinct values
+// of each column, in ColumnStats.Distinct, and to report a warning that wraps
+// ErrHighCardinality to the handler of WithWarningHandler when a column has
+// more than "n" distinct values. This catches ID-like columns that are
+// mistaken for categories, e.g. by WithGroupBy. Values are counted until the
+// limit is exceeded, so the memory held is bounded by the limit. The Encoder
+// counts the values of each list separately.
+func WithCardinalityLimit(n int) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.cardinalityLimit = n
+	}
+}
+
+// distinctValue is a scalar value that can be used as a map key.
+type distinctValue struct {
+	kind Kind
+	str  string
+	num  float64
+}
+
+// distinct will return the key of the scalar value.
+func distinct(value *structpb.Value) distinctValue {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_StringValue:
+		return distinctValue{kind: KindString, str: valType.StringValue}
+	case *structpb.Value_NumberValue:
+		return distinctValue{kind: KindNumber, num: valType.NumberValue}
+	case *structpb.Value_BoolValue:
+		if valType.BoolValue {
+			return distinctValue{kind: KindBool, num: 1}
+		}
+
+		return distinctValue{kind: KindBool}
+	}
+
+	return distinctValue{kind: kindOf(value)}
+}
+
+// withCardinalityLimit sets the number of distinct values of a column after
+// which "onExceed" is called with its header, or 0 to not count them.
+func withCardinalityLimit(limit int, onExceed func(header string)) columnsOpt {
+	return func(cols *columns) {
+		cols.cardinalityLimit = limit
+		cols.onCardinality = onExceed
+	}
+}
+
+// observeDistinct will count the non-null value among the distinct values of
+// the column, until there are more than the limit.
+func (cols *columns) observeDistinct(col *column, value *structpb.Value) {
+	if col.stats.Distinct > cols.cardinalityLimit {
+		return
+	}
+
+	if _, ok := value.Kind.(*structpb.Value_NullValue); ok {
+		return
+	}
+
+	if col.distinct == nil {
+		col.distinct = make(map[distinctValue]struct{})
+	}
+
+	key := distinct(value)
+	if _, ok := col.distinct[key]; ok {
+		return
+	}
+
+	col.distinct[key] = struct{}{}
+	col.stats.Distinct++
+
+	if col.stats.Distinct > cols.cardinalityLimit {
+		col.distinct = nil
+
+		if cols.onCardinality != nil {
+			cols.onCardinality(col.header)
+		}
+	}
+}
+
+// warnCardinality will report that the column has exceeded the cardinality
+// limit.
+func (w *ListWriter) warnCardinality(header string) {
+	if w.warn != nil {
+		w.warn(fmt.Errorf("%w: column %q has more than %d distinct values",
+			ErrHighCardinality, header, w.cardinalityLimit))
+	}
+}
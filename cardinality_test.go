@@ -0,0 +1,69 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCardinalityLimit(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": "a", "status": "open", "flag": true},
+		{"id": "b", "status": "open", "flag": false},
+		{"id": "c", "status": null, "flag": true},
+		{"id": "d", "status": "closed", "flag": 1}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		dst      recordWriter
+		warnings []error
+		stats    map[string]ColumnStats
+	)
+
+	err = NewListWriter(&dst, WithCardinalityLimit(2),
+		WithWarningHandler(func(warning error) {
+			warnings = append(warnings, warning)
+		}),
+		WithFooter(func(table Table) []string {
+			stats = table.Stats
+
+			return nil
+		}),
+	).Write(context.Background(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 2 {
+		t.Fatalf("got warnings %v, want one for each of id and flag", warnings)
+	}
+
+	for _, warning := range warnings {
+		if !errors.Is(warning, ErrHighCardinality) {
+			t.Fatalf("got warning %v, want %v", warning, ErrHighCardinality)
+		}
+	}
+
+	distinct := map[string]int{}
+	for header, columnStats := range stats {
+		distinct[header] = columnStats.Distinct
+	}
+
+	if want := map[string]int{"id": 3, "status": 2, "flag": 3}; !reflect.DeepEqual(distinct, want) {
+		t.Fatalf("got distinct %v, want %v", distinct, want)
+	}
+}
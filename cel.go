@@ -0,0 +1,246 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/google/cel-go/cel"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrInvalidExpression is returned when a CEL expression given to WithFilter or
+// WithComputedColumn cannot be compiled.
+var ErrInvalidExpression = fmt.Errorf("invalid expression")
+
+// celItem is the name of the variable that holds the record in a CEL
+// expression.
+const celItem = "item"
+
+// compileCEL will compile the CEL expression, which refers to the record as
+// "item", into a program.
+func compileCEL(expr string) (cel.Program, error) {
+	env, err := cel.NewEnv(cel.Variable(celItem, cel.DynType))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cel environment: %w", err)
+	}
+
+	ast, issues := env.Compile(expr)
+	if issues != nil && issues.Err() != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidExpression, expr, issues.Err())
+	}
+
+	program, err := env.Program(ast)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q: %v", ErrInvalidExpression, expr, err)
+	}
+
+	return program, nil
+}
+
+// celExpr is a compiled CEL expression, or the error from compiling it.
+type celExpr struct {
+	expr    string
+	program cel.Program
+	err     error
+}
+
+func newCELExpr(expr string) *celExpr {
+	program, err := compileCEL(expr)
+
+	return &celExpr{expr: expr, program: program, err: err}
+}
+
+// eval will evaluate the expression against the record.
+func (ce *celExpr) eval(record *structpb.Value) (*structpb.Value, error) {
+	var item any = record
+	if obj := record.GetStructValue(); obj != nil {
+		item = obj
+	}
+
+	out, _, err := ce.program.Eval(map[string]any{celItem: item})
+	if err != nil {
+		return nil, fmt.Errorf("failed to evaluate %q: %w", ce.expr, err)
+	}
+
+	native, err := out.ConvertToNative(reflect.TypeOf(&structpb.Value{}))
+	if err != nil {
+		return nil, fmt.Errorf("failed to convert the result of %q: %w", ce.expr, err)
+	}
+
+	value, ok := native.(*structpb.Value)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedValueType, native)
+	}
+
+	return value, nil
+}
+
+// computedColumn is a column whose cells are computed by a CEL expression.
+type computedColumn struct {
+	name string
+	expr *celExpr
+}
+
+// WithFilter configures the ListWriter to only write the records for which the
+// CEL expression is true, e.g. "item.age > 18", where "item" is the record.
+// Records are filtered before they are flattened. If the expression fails to
+// evaluate for a record, e.g. because a field is missing, the write fails, or,
+// if a warning handler is set with WithWarningHandler, the failure is reported
+// to the handler and the record is left out. If the expression cannot be
+// compiled, writes fail with ErrInvalidExpression.
+func WithFilter(expr string) ListWriterOption {
+	compiled := newCELExpr(expr)
+
+	return func(listWriter *ListWriter) {
+		listWriter.filters = append(listWriter.filters, compiled)
+	}
+}
+
+// WithComputedColumn configures the ListWriter to add a field called "name"
+// to each record with the value of the CEL expression, e.g.
+// `item.first + " " + item.last`, where "item" is the record. Computed columns
+// are added in the order they are configured, before the field mask is
+// applied, and may produce objects and lists that are flattened like any other
+// field. Top-level values that are not objects are not given computed columns.
+// If the expression fails to evaluate for a record, the write fails, or, if a
+// warning handler is set with WithWarningHandler, the failure is reported to
+// the handler and the cell is left empty. If the expression cannot be compiled,
+// writes fail with ErrInvalidExpression.
+func WithComputedColumn(name, expr string) ListWriterOption {
+	compiled := &computedColumn{name: name, expr: newCELExpr(expr)}
+
+	return func(listWriter *ListWriter) {
+		listWriter.computed = append(listWriter.computed, compiled)
+	}
+}
+
+// keep will return true if the record passes all of the filters.
+func (w *ListWriter) keep(index int, record *structpb.Value) (bool, error) {
+	for _, filter := range w.filters {
+		out, err := filter.eval(record)
+		if err == nil {
+			if _, ok := out.Kind.(*structpb.Value_BoolValue); !ok {
+				err = fmt.Errorf("%w: filter %q is not a bool", ErrInvalidExpression, filter.expr)
+			}
+		}
+
+		if err != nil {
+			err = fmt.Errorf("record %d: %w", index, err)
+			if w.rejects != nil {
+				return false, w.reject(record, err)
+			}
+
+			if w.warn == nil {
+				return false, err
+			}
+
+			w.warn(err)
+
+			return false, nil
+		}
+
+		if !out.GetBoolValue() {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// compute will return a copy of the record with the computed columns added, or
+// nil if the record was rejected.
+func (w *ListWriter) compute(index int, record *structpb.Value) (*structpb.Value, error) {
+	obj := record.GetStructValue()
+	if obj == nil {
+		return record, nil
+	}
+
+	fields := make(map[string]*structpb.Value, len(obj.GetFields())+len(w.computed))
+	for key, value := range obj.GetFields() {
+		fields[key] = value
+	}
+
+	computed := structpb.NewStructValue(&structpb.Struct{Fields: fields})
+
+	for _, column := range w.computed {
+		value, err := column.expr.eval(computed)
+		if err != nil {
+			err = fmt.Errorf("record %d: column %q: %w", index, column.name, err)
+			if w.rejects != nil {
+				return nil, w.reject(record, err)
+			}
+
+			if w.warn == nil {
+				return nil, err
+			}
+
+			w.warn(err)
+
+			continue
+		}
+
+		fields[column.name] = value
+	}
+
+	return computed, nil
+}
+
+// celErr will return the first error from compiling the CEL expressions.
+func (w *ListWriter) celErr() error {
+	for _, filter := range w.filters {
+		if filter.err != nil {
+			return filter.err
+		}
+	}
+
+	for _, column := range w.computed {
+		if column.expr.err != nil {
+			return column.expr.err
+		}
+	}
+
+	return nil
+}
+
+// applyCEL will filter the records of the list and add the computed columns.
+func (w *ListWriter) applyCEL(list *structpb.ListValue) (*structpb.ListValue, error) {
+	if err := w.celErr(); err != nil {
+		return nil, err
+	}
+
+	out := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(list.GetValues()))}
+
+	for i, record := range list.GetValues() {
+		keep, err := w.keep(i, record)
+		if err != nil {
+			return nil, err
+		}
+
+		if !keep {
+			continue
+		}
+
+		if len(w.computed) > 0 {
+			if record, err = w.compute(i, record); err != nil {
+				return nil, err
+			}
+
+			// The record was rejected.
+			if record == nil {
+				continue
+			}
+		}
+
+		out.Values = append(out.Values, record)
+	}
+
+	return out, nil
+}
@@ -0,0 +1,134 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCEL(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		opts    []ListWriterOption
+		want    [][]string
+		wantErr bool
+	}{
+		{
+			name: "filter",
+			data: `[{"name": "a", "age": 20}, {"name": "b", "age": 10}]`,
+			opts: []ListWriterOption{WithFilter("item.age > 18")},
+			want: [][]string{{"age", "name"}, {"20.000000", "a"}},
+		},
+		{
+			name: "computed columns see earlier columns",
+			data: `[{"first": "Ada", "last": "Lovelace"}]`,
+			opts: []ListWriterOption{
+				WithComputedColumn("full", `item.first + " " + item.last`),
+				WithComputedColumn("size", `size(item.full)`),
+			},
+			want: [][]string{{"first", "full", "last", "size"}, {"Ada", "Ada Lovelace", "Lovelace", "12.000000"}},
+		},
+		{
+			name: "computed object",
+			data: `[{"id": 1}]`,
+			opts: []ListWriterOption{WithComputedColumn("meta", `{"ok": true}`)},
+			want: [][]string{{"id", "meta.ok"}, {"1.000000", "true"}},
+		},
+		{
+			name:    "missing field",
+			data:    `[{"name": "a"}]`,
+			opts:    []ListWriterOption{WithFilter("item.age > 18")},
+			wantErr: true,
+		},
+		{
+			name:    "invalid expression",
+			data:    `[{"name": "a"}]`,
+			opts:    []ListWriterOption{WithFilter("item.age >")},
+			wantErr: true,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+
+			err = NewListWriter(&dst, opts...).Write(context.Background(), list)
+			if (err != nil) != tcase.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tcase.wantErr)
+			}
+
+			if tcase.wantErr {
+				return
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestWriteInvalidExpression(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"name": "a"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = NewListWriter(&recordWriter{}, WithComputedColumn("x", "item.name +")).Write(context.Background(), list)
+	if !errors.Is(err, ErrInvalidExpression) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidExpression)
+	}
+}
+
+func TestWriteCELWarning(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"name": "a", "age": 20}, {"name": "b"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		dst      recordWriter
+		warnings []error
+	)
+
+	listWriter := NewListWriter(&dst, WithAlphabetizeHeaders(), WithFilter("item.age > 18"),
+		WithWarningHandler(func(err error) {
+			warnings = append(warnings, err)
+		}))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][]string{{"age", "name"}, {"20.000000", "a"}}; !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+
+	if len(warnings) != 1 {
+		t.Fatalf("got %d warnings, want 1", len(warnings))
+	}
+}
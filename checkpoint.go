@@ -0,0 +1,222 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Checkpoint is the progress of an Encoder through its input.
+type Checkpoint struct {
+	// Records is the number of input records that have been written,
+	// which is the index of the next record to write.
+	Records int64 `json:"records"`
+
+	// Header is the header that has been written.
+	Header []string `json:"header"`
+
+	// Offset is the number of bytes that had been written to the output
+	// when the checkpoint was saved.
+	Offset int64 `json:"offset"`
+}
+
+// CheckpointStore persists the Checkpoint of an Encoder.
+type CheckpointStore interface {
+	// Load returns the last saved checkpoint, or nil if there is none.
+	Load(ctx context.Context) (*Checkpoint, error)
+
+	// Save replaces the saved checkpoint.
+	Save(ctx context.Context, checkpoint *Checkpoint) error
+}
+
+// WithCheckpoint configures the Encoder to save a Checkpoint to "store" after
+// each list is written and flushed, so that an export that is interrupted can
+// be resumed by a new Encoder that appends to the same output. If the store
+// has a checkpoint when the Encoder writes its first list, the header is not
+// written again and the records that were already written are skipped, so the
+// input must be replayed from the start in the same order.
+//
+// Output written after the checkpoint was saved, e.g. rows flushed before the
+// process crashed, or a row it crashed in the middle of, is removed first by
+// truncating the output to the checkpoint's Offset, if it has a
+// Truncate(int64) error method like *os.File, or by seeking to the Offset if
+// it is an io.Seeker. Any other output must be truncated to the Offset by the
+// caller before it is resumed. A WithZstd stream cannot be resumed, since the
+// stream that was interrupted is never ended.
+func WithCheckpoint(store CheckpointStore) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.checkpoint = store
+	}
+}
+
+// FileCheckpointStore is a CheckpointStore that keeps the checkpoint as JSON in
+// a file.
+type FileCheckpointStore struct {
+	path string
+}
+
+// NewFileCheckpointStore creates a FileCheckpointStore that keeps the
+// checkpoint in the file at "path".
+func NewFileCheckpointStore(path string) *FileCheckpointStore {
+	return &FileCheckpointStore{path: path}
+}
+
+// Load returns the checkpoint in the file, or nil if the file does not exist.
+func (store *FileCheckpointStore) Load(_ context.Context) (*Checkpoint, error) {
+	data, err := os.ReadFile(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+
+	checkpoint := &Checkpoint{}
+	if err := json.Unmarshal(data, checkpoint); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal checkpoint: %w", err)
+	}
+
+	return checkpoint, nil
+}
+
+// Save writes the checkpoint to a temporary file, syncs it, and renames it over
+// the file, so that a crash does not leave a partial checkpoint.
+func (store *FileCheckpointStore) Save(_ context.Context, checkpoint *Checkpoint) error {
+	data, err := json.Marshal(checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to marshal checkpoint: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(store.path), filepath.Base(store.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed to create checkpoint: %w", err)
+	}
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to write checkpoint: %w", err)
+	}
+
+	// The data must be on disk before the rename, or a crash could
+	// leave an empty checkpoint in place of the last one.
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to sync checkpoint: %w", err)
+	}
+
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+
+		return fmt.Errorf("failed to close checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), store.path); err != nil {
+		return fmt.Errorf("failed to replace checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+// resume will load the checkpoint, if there is one, the first time it is
+// called, and return the list without the records that have already been
+// written.
+func (enc *Encoder) resume(ctx context.Context, list *structpb.ListValue) (*structpb.ListValue, error) {
+	store := enc.listWriter.checkpoint
+
+	if !enc.resumed {
+		enc.resumed = true
+
+		checkpoint, err := store.Load(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load checkpoint: %w", err)
+		}
+
+		if checkpoint != nil {
+			if err := enc.rewind(checkpoint.Offset); err != nil {
+				return nil, err
+			}
+
+			enc.skip = checkpoint.Records
+			enc.header = checkpoint.Header
+			enc.written = checkpoint.Records
+		}
+	}
+
+	values := list.GetValues()
+
+	skip := enc.skip - enc.records
+	if skip <= 0 {
+		return list, nil
+	}
+
+	if skip > int64(len(values)) {
+		skip = int64(len(values))
+	}
+
+	enc.records += skip
+
+	return &structpb.ListValue{Values: values[skip:]}, nil
+}
+
+// truncater is an output that can be truncated, such as an *os.File.
+type truncater interface {
+	Truncate(size int64) error
+}
+
+// rewind will remove the output written after the offset of a checkpoint.
+func (enc *Encoder) rewind(offset int64) error {
+	out := enc.output.writer
+
+	if file, ok := out.(truncater); ok {
+		if err := file.Truncate(offset); err != nil {
+			return writerFailed(fmt.Errorf("failed to truncate output to checkpoint: %w", err))
+		}
+	}
+
+	if seeker, ok := out.(io.Seeker); ok {
+		if _, err := seeker.Seek(offset, io.SeekStart); err != nil {
+			return writerFailed(fmt.Errorf("failed to seek output to checkpoint: %w", err))
+		}
+	}
+
+	enc.output.offset = offset
+
+	return nil
+}
+
+// saveCheckpoint will count the records of a list that has been written and
+// save the checkpoint, if there is a store.
+func (enc *Encoder) saveCheckpoint(ctx context.Context, records int64) error {
+	enc.records += records
+
+	store := enc.listWriter.checkpoint
+	if store == nil {
+		return nil
+	}
+
+	checkpoint := &Checkpoint{Records: enc.records, Header: enc.header, Offset: enc.output.offset}
+	if err := store.Save(ctx, checkpoint); err != nil {
+		return fmt.Errorf("failed to save checkpoint: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEncoderCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	batches := []string{
+		`[{"id": "1"}, {"id": "2"}]`,
+		`[{"id": "3"}, {"id": "4"}]`,
+		`[{"id": "5"}]`,
+	}
+
+	encode := func(enc *Encoder, batches []string) {
+		t.Helper()
+
+		for _, batch := range batches {
+			list, err := Decode(DecodeTypeJSON, []byte(batch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := enc.Encode(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	ctx := context.Background()
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoint.json"))
+
+	var buf bytes.Buffer
+
+	// The first export is interrupted after the first batch.
+	encode(NewEncoder(&buf, WithCheckpoint(store)), batches[:1])
+
+	checkpoint, err := store.Load(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (&Checkpoint{Records: 2, Header: []string{"id"}, Offset: 7}); !reflect.DeepEqual(checkpoint, want) {
+		t.Fatalf("got checkpoint %+v, want %+v", checkpoint, want)
+	}
+
+	// The resumed export replays the input from the start.
+	encode(NewEncoder(&buf, WithCheckpoint(store)), batches)
+
+	if got, want := buf.String(), "id\n1\n2\n3\n4\n5\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// A checkpoint can also fall within a list.
+	if err := store.Save(ctx, &Checkpoint{Records: 3, Header: []string{"id"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	buf.Reset()
+	encode(NewEncoder(&buf, WithCheckpoint(store)), batches)
+
+	if got, want := buf.String(), "4\n5\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncoderCheckpointTruncates(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "out.csv")
+	store := NewFileCheckpointStore(filepath.Join(dir, "checkpoint.json"))
+
+	encode := func(batches ...string) {
+		t.Helper()
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		enc := NewEncoder(file, WithCheckpoint(store))
+
+		for _, batch := range batches {
+			list, err := Decode(DecodeTypeJSON, []byte(batch))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := enc.Encode(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	encode(`[{"id": "1"}, {"id": "2"}]`)
+
+	// The process crashed after flushing a row and part of another, but
+	// before saving the checkpoint.
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := file.WriteString("3\n4"); err != nil {
+		t.Fatal(err)
+	}
+
+	file.Close()
+
+	encode(`[{"id": "1"}, {"id": "2"}]`, `[{"id": "3"}, {"id": "4"}]`)
+
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "id\n1\n2\n3\n4\n"; string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestFileCheckpointStoreMissing(t *testing.T) {
+	t.Parallel()
+
+	store := NewFileCheckpointStore(filepath.Join(t.TempDir(), "missing.json"))
+
+	checkpoint, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if checkpoint != nil {
+		t.Fatalf("got checkpoint %+v, want nil", checkpoint)
+	}
+}
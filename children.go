@@ -0,0 +1,179 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// IDColumn is the header of the generated key of each row when
+	// WithChildTables is used.
+	IDColumn = "_id"
+
+	// ParentIDColumn is the header of the column in a child table that
+	// holds the IDColumn of the row it was nested in.
+	ParentIDColumn = "_parent_id"
+)
+
+// WithChildTables configures the ListWriter to normalize arrays of objects into
+// child tables, instead of writing the objects to successive rows. Each array
+// is written to the Writer returned by "open" for its table, which is named by
+// the flattened path of the array, e.g. "items" for the parent's "items" field
+// or "items.parts" for the "parts" field of those items. The child tables are
+// written after the parent table, in order of their names, and "open" is called
+// once per table and Write.
+//
+// Every row of the parent and child tables gets a generated IDColumn, numbered
+// from 1 within its table, and every child row gets a ParentIDColumn with the
+// ID of the row it belongs to. Arrays that are empty or hold anything but
+// objects are written to the parent as usual.
+//
+// Child tables are written with the same formatting options as the parent, but
+// WithFooter, WithGroupBy, and WithSortBy only apply to the parent table. It
+// sets the array policy to ArrayPolicyChildTable. The Encoder does not write
+// child tables: Encode returns ErrInvalidArrayPolicy with this option.
+func WithChildTables(open func(table string) (Writer, error)) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.openChild = open
+		listWriter.arrayPolicy = ArrayPolicyChildTable
+	}
+}
+
+// isObjectArray will return true if the value is a non-empty array of objects.
+func isObjectArray(value *structpb.Value) bool {
+	list := value.GetListValue()
+	if len(list.GetValues()) == 0 {
+		return false
+	}
+
+	for _, elem := range list.GetValues() {
+		if elem.GetStructValue() == nil {
+			return false
+		}
+	}
+
+	return true
+}
+
+// childSplitter moves the arrays of objects out of records into child tables.
+type childSplitter struct {
+	tables map[string]*structpb.ListValue
+	ids    map[string]int
+	keys   *keyEscaper
+}
+
+// nextID will return the next ID of the table.
+func (split *childSplitter) nextID(table string) *structpb.Value {
+	split.ids[table]++
+
+	return structpb.NewStringValue(strconv.Itoa(split.ids[table]))
+}
+
+// normalize will return a copy of the object at "prefix" within a row of the
+// table, with its arrays of objects moved to the child tables of the row "id".
+func (split *childSplitter) normalize(table, prefix string, obj *structpb.Struct,
+	id *structpb.Value,
+) *structpb.Struct {
+	fields := make(map[string]*structpb.Value, len(obj.GetFields()))
+
+	for key, value := range obj.GetFields() {
+		path := joinPath(prefix, split.keys.escapeKey(key))
+
+		switch {
+		case value.GetStructValue() != nil:
+			nested := split.normalize(table, path, value.GetStructValue(), id)
+			fields[key] = structpb.NewStructValue(nested)
+		case isObjectArray(value):
+			child := joinPath(table, path)
+
+			if split.tables[child] == nil {
+				split.tables[child] = &structpb.ListValue{}
+			}
+
+			for _, elem := range value.GetListValue().GetValues() {
+				childID := split.nextID(child)
+
+				row := split.normalize(child, "", elem.GetStructValue(), childID)
+				row.Fields[IDColumn] = childID
+				row.Fields[ParentIDColumn] = id
+
+				split.tables[child].Values = append(split.tables[child].Values, structpb.NewStructValue(row))
+			}
+		default:
+			fields[key] = value
+		}
+	}
+
+	return &structpb.Struct{Fields: fields}
+}
+
+// splitChildren will return the list with the arrays of objects moved into
+// child tables, keyed by name, which is made of keys escaped by "keys". The
+// records of the original list are not modified.
+func splitChildren(list *structpb.ListValue, keys *keyEscaper) (*structpb.ListValue, map[string]*structpb.ListValue) {
+	split := &childSplitter{
+		tables: make(map[string]*structpb.ListValue),
+		ids:    make(map[string]int),
+		keys:   keys,
+	}
+
+	out := &structpb.ListValue{Values: make([]*structpb.Value, len(list.GetValues()))}
+
+	for i, record := range list.GetValues() {
+		id := split.nextID("")
+
+		row := split.normalize("", "", record.GetStructValue(), id)
+		row.Fields[IDColumn] = id
+
+		out.Values[i] = structpb.NewStructValue(row)
+	}
+
+	return out, split.tables
+}
+
+// writeChildren writes each child table to the writer opened for it.
+func (w *ListWriter) writeChildren(ctx context.Context, tables map[string]*structpb.ListValue) error {
+	names := make([]string, 0, len(tables))
+	for name := range tables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		writer, err := w.openChild(name)
+		if err != nil {
+			return fmt.Errorf("failed to open child table %q: %w", name, err)
+		}
+
+		// The child is written with the formatting of the parent, but
+		// without the options that need the parent's whole table.
+		child := *w
+		child.writer = writer
+		child.footer = nil
+		child.groupBy = nil
+		child.sortBy = nil
+		child.sidecar = nil
+		child.registry = nil
+		child.nullThresholds = nil
+		child.recordSizes = nil
+
+		if err := child.writeList(ctx, tables[name]); err != nil {
+			return fmt.Errorf("failed to write child table %q: %w", name, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,105 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWithChildTables(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"order": "a", "tags": [1, 2], "items": [
+			{"sku": "x", "parts": [{"n": "p1"}, {"n": "p2"}]},
+			{"sku": "y"}
+		]},
+		{"order": "b", "ship": {"lines": [{"sku": "z"}]}, "items": []}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var parent recordWriter
+
+	children := make(map[string]*recordWriter)
+
+	open := func(table string) (Writer, error) {
+		children[table] = &recordWriter{}
+
+		return children[table], nil
+	}
+
+	listWriter := NewListWriter(&parent, WithAlphabetizeHeaders(), WithChildTables(open))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string][][]string{
+		"": {
+			{"_id", "order", "tags"},
+			{"1", "a", "[1.000000,2.000000]"},
+			{"2", "b", ""},
+		},
+		"items": {
+			{"_id", "_parent_id", "sku"},
+			{"1", "1", "x"},
+			{"2", "1", "y"},
+		},
+		"items.parts": {
+			{"_id", "_parent_id", "n"},
+			{"1", "1", "p1"},
+			{"2", "1", "p2"},
+		},
+		"ship.lines": {
+			{"_id", "_parent_id", "sku"},
+			{"1", "2", "z"},
+		},
+	}
+
+	got := map[string][][]string{"": parent.records}
+	for table, writer := range children {
+		got[table] = writer.records
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestEncoderChildTables(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1, "items": [{"x": 1}, {"x": 2}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opened := false
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, WithChildTables(func(string) (Writer, error) {
+		opened = true
+
+		return &recordWriter{}, nil
+	}))
+
+	if err := enc.Encode(context.Background(), list); !errors.Is(err, ErrInvalidArrayPolicy) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidArrayPolicy)
+	}
+
+	if opened || buf.Len() != 0 {
+		t.Fatalf("got %q written and opened %v, want nothing", buf.String(), opened)
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WithProgress configures Encoder.WriteChunks to call "progress" after each
+// chunk is written and flushed, with the number of records of the list that
+// have been written so far and the number in the list.
+func WithProgress(progress func(written, total int)) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.progress = progress
+	}
+}
+
+// WriteChunks writes the list in chunks of "chunkSize" records, each encoded
+// as if it were a list given to Encode. The CSV writer is flushed after each
+// chunk, and the checkpoint is saved if WithCheckpoint is used, so the rows of
+// a very large list reach the output as they are written rather than at the
+// end, and the rows of the chunks that were written survive a crash. Options
+// that see one list at a time, such as WithNullThreshold, see one chunk at a
+// time. A "chunkSize" of less than one writes the list as a single chunk.
+func (enc *Encoder) WriteChunks(ctx context.Context, list *structpb.ListValue, chunkSize int) error {
+	values := list.GetValues()
+	if chunkSize < 1 {
+		chunkSize = len(values)
+	}
+
+	for start := 0; start < len(values); start += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		end := start + chunkSize
+		if end > len(values) {
+			end = len(values)
+		}
+
+		if err := enc.Encode(ctx, &structpb.ListValue{Values: values[start:end]}); err != nil {
+			return fmt.Errorf("failed to write chunk at record %d: %w", start, err)
+		}
+
+		if enc.listWriter.progress != nil {
+			enc.listWriter.progress(end, len(values))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestEncoderWriteChunks(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"a": 1}, {"a": 2}, {"a": 3}, {"a": 4}, {"a": 5}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name      string
+		chunkSize int
+		want      [][]int
+	}{
+		{name: "chunks", chunkSize: 2, want: [][]int{{2, 5}, {4, 5}, {5, 5}}},
+		{name: "larger than list", chunkSize: 10, want: [][]int{{5, 5}}},
+		{name: "single chunk", chunkSize: 0, want: [][]int{{5, 5}}},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				buf      bytes.Buffer
+				progress [][]int
+			)
+
+			enc := NewEncoder(&buf, WithRounding(0, RoundHalfUp),
+				WithProgress(func(written, total int) {
+					// The rows of each chunk are flushed before
+					// its progress is reported.
+					if lines := strings.Count(buf.String(), "\n"); lines != written+1 {
+						t.Errorf("got %d lines after %d records", lines, written)
+					}
+
+					progress = append(progress, []int{written, total})
+				}))
+
+			if err := enc.WriteChunks(context.Background(), list, tcase.chunkSize); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := buf.String(), "a\n1\n2\n3\n4\n5\n"; got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+
+			if !reflect.DeepEqual(progress, tcase.want) {
+				t.Fatalf("got progress %v, want %v", progress, tcase.want)
+			}
+		})
+	}
+}
+
+func TestEncoderWriteChunksCanceled(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"a": 1}, {"a": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, WithRounding(0, RoundHalfUp), WithProgress(func(int, int) { cancel() }))
+
+	if err := enc.WriteChunks(ctx, list, 1); !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	if got, want := buf.String(), "a\n1\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/alpstable/csvpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// dryRun will describe what converting the list would write, without
+// converting it.
+func dryRun(out io.Writer, list *structpb.ListValue, writerOpts []csvpb.ListWriterOption) error {
+	plan, err := csvpb.NewListWriter(nil, writerOpts...).Plan(list)
+	if err != nil {
+		return err
+	}
+
+	buf := bufio.NewWriter(out)
+	writePlan(buf, "", plan)
+
+	if err := buf.Flush(); err != nil {
+		return fmt.Errorf("failed to write plan: %w", err)
+	}
+
+	return nil
+}
+
+// writePlan will write the plan, and the plans of its child tables, with each
+// line prefixed by "indent".
+func writePlan(out io.Writer, indent string, plan *csvpb.WritePlan) {
+	fmt.Fprintf(out, "%scolumns: %s\n", indent, strings.Join(plan.Header, ", "))
+	fmt.Fprintf(out, "%srows: %d from %d records\n", indent, plan.Rows, plan.Records)
+
+	if len(plan.Transforms) > 0 {
+		fmt.Fprintf(out, "%stransforms:\n", indent)
+
+		for _, transform := range plan.Transforms {
+			fmt.Fprintf(out, "%s  %s\n", indent, transform)
+		}
+	}
+
+	names := make([]string, 0, len(plan.ChildTables))
+	for name := range plan.ChildTables {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(out, "%schild table %s:\n", indent, name)
+		writePlan(out, indent+"  ", plan.ChildTables[name])
+	}
+}
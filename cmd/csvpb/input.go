@@ -0,0 +1,109 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/alpstable/csvpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// stdinSource is the source of records read from stdin.
+const stdinSource = "-"
+
+// expandInputs will expand the glob patterns in the arguments. Arguments that
+// are not patterns are kept as they are, so that a missing file is reported
+// when it is read.
+func expandInputs(args []string) ([]string, error) {
+	var inputs []string
+
+	for _, arg := range args {
+		matches, err := filepath.Glob(arg)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", arg, err)
+		}
+
+		if len(matches) == 0 {
+			matches = []string{arg}
+		}
+
+		inputs = append(inputs, matches...)
+	}
+
+	return inputs, nil
+}
+
+// stampSource will set the source column of each record to "source". Records
+// that are not objects are first wrapped in one, as the ListWriter would.
+func stampSource(list *structpb.ListValue, column, source string) {
+	sourceValue := structpb.NewStringValue(source)
+
+	for i, value := range list.GetValues() {
+		record := value.GetStructValue()
+		if record == nil {
+			record = &structpb.Struct{
+				Fields: map[string]*structpb.Value{csvpb.DefaultScalarColumn: value},
+			}
+
+			list.Values[i] = structpb.NewStructValue(record)
+		}
+
+		if record.Fields == nil {
+			record.Fields = make(map[string]*structpb.Value, 1)
+		}
+
+		record.Fields[column] = sourceValue
+	}
+}
+
+// readInputs will decode the JSON in the files named by the arguments, or in
+// stdin if there are none, and concatenate the records.
+func readInputs(args []string, stdin io.Reader, sourceColumn string) (*structpb.ListValue, error) {
+	inputs, err := expandInputs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(inputs) == 0 {
+		inputs = []string{stdinSource}
+	}
+
+	all := &structpb.ListValue{}
+
+	for _, input := range inputs {
+		var data []byte
+
+		if input == stdinSource {
+			data, err = io.ReadAll(stdin)
+		} else {
+			data, err = os.ReadFile(input)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read input: %w", err)
+		}
+
+		list, err := csvpb.Decode(csvpb.DecodeTypeJSON, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", input, err)
+		}
+
+		if sourceColumn != "" {
+			stampSource(list, sourceColumn, input)
+		}
+
+		all.Values = append(all.Values, list.GetValues()...)
+	}
+
+	return all, nil
+}
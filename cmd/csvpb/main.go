@@ -0,0 +1,194 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// csvpb converts JSON to CSV.
+//
+// Usage:
+//
+//	csvpb [flags] [file ...]
+//
+// The JSON is read from the files, or from stdin if no file is given, and the
+// CSV is written to stdout unless -out is set. Files may be given as glob
+// patterns, such as "data/*.json". The records of all of the files are written
+// as one CSV, with the union of their headers, and -source-column adds a column
+// with the file each row came from. With -dry-run, the columns, the number of
+// rows, and the transforms of the CSV are described instead of writing it.
+//
+// With -watch, csvpb instead polls a directory and converts each JSON file that
+// is new or modified to a CSV file in the -out directory, once the file has
+// stopped changing for the -debounce period. Each conversion is logged to
+// stderr.
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/alpstable/csvpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if err := run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		if !errors.Is(err, flag.ErrHelp) {
+			fmt.Fprintln(os.Stderr, "csvpb:", err)
+		}
+
+		stop()
+		os.Exit(1)
+	}
+}
+
+// options are the command line flags.
+type options struct {
+	out         string
+	pretty      bool
+	preview     int
+	dryRun      bool
+	alphabetize bool
+	watch       string
+	interval    time.Duration
+	debounce    time.Duration
+
+	sourceColumn string
+}
+
+func parseFlags(args []string, stderr io.Writer) (*options, []string, error) {
+	opts := &options{}
+
+	flags := flag.NewFlagSet("csvpb", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	flags.StringVar(&opts.out, "out", "", "write to this file instead of stdout")
+	flags.BoolVar(&opts.pretty, "pretty", false, "write aligned columns for reading in a terminal")
+	flags.IntVar(&opts.preview, "preview", 0,
+		"show the first `N` rows and the inferred schema instead of converting")
+	flags.BoolVar(&opts.dryRun, "dry-run", false,
+		"describe the columns, rows, and transforms that would be written instead of converting")
+	flags.BoolVar(&opts.alphabetize, "alphabetize", false, "alphabetize the headers")
+	flags.StringVar(&opts.sourceColumn, "source-column", "",
+		"add a column with this `name` holding the file each row came from")
+	flags.StringVar(&opts.watch, "watch", "", "convert JSON files in this `directory` as they change")
+	flags.DurationVar(&opts.interval, "interval", time.Second, "how often to poll the watched directory")
+	flags.DurationVar(&opts.debounce, "debounce", 500*time.Millisecond,
+		"how long a watched file must be unchanged before it is converted")
+
+	if err := flags.Parse(args); err != nil {
+		return nil, nil, err
+	}
+
+	return opts, flags.Args(), nil
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	opts, args, err := parseFlags(args, stderr)
+	if err != nil {
+		return err
+	}
+
+	var writerOpts []csvpb.ListWriterOption
+	if opts.alphabetize {
+		writerOpts = append(writerOpts, csvpb.WithAlphabetizeHeaders())
+	}
+
+	if opts.watch != "" {
+		return watch(ctx, opts, args, stderr, writerOpts)
+	}
+
+	list, err := readInputs(args, stdin, opts.sourceColumn)
+	if err != nil {
+		return err
+	}
+
+	if opts.out == "" {
+		return write(ctx, stdout, list, opts, writerOpts)
+	}
+
+	file, err := os.Create(opts.out)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+
+	if err := write(ctx, file, list, opts, writerOpts); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close output: %w", err)
+	}
+
+	return nil
+}
+
+// watch will run the watch mode until the context is canceled.
+func watch(ctx context.Context, opts *options, args []string, log io.Writer,
+	writerOpts []csvpb.ListWriterOption,
+) error {
+	if len(args) > 0 {
+		return fmt.Errorf("input files cannot be given with -watch")
+	}
+
+	if opts.out == "" {
+		return fmt.Errorf("-out must be set to the output directory with -watch")
+	}
+
+	if opts.interval <= 0 {
+		return fmt.Errorf("-interval must be positive")
+	}
+
+	if err := os.MkdirAll(opts.out, 0o755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+
+	watcher := newWatcher(opts.watch, opts.out, opts.debounce, log,
+		csvpb.WithListWriterOptions(writerOpts...))
+
+	return watcher.watch(ctx, opts.interval)
+}
+
+// write will write the list to "out" in the form selected by the flags.
+func write(ctx context.Context, out io.Writer, list *structpb.ListValue, opts *options,
+	writerOpts []csvpb.ListWriterOption,
+) error {
+	if opts.dryRun {
+		return dryRun(out, list, writerOpts)
+	}
+
+	if opts.preview > 0 {
+		return preview(ctx, out, list, opts.preview, writerOpts)
+	}
+
+	if opts.pretty {
+		prettyWriter := csvpb.NewPrettyWriter(out, csvpb.WithColor(csvpb.ColorAuto))
+		if err := csvpb.NewListWriter(prettyWriter, writerOpts...).Write(ctx, list); err != nil {
+			return err
+		}
+
+		return prettyWriter.Flush()
+	}
+
+	csvWriter := csv.NewWriter(out)
+	if err := csvpb.NewListWriter(csvWriter, writerOpts...).Write(ctx, list); err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+
+	return csvWriter.Error()
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	t.Parallel()
+
+	const input = `[{"id":1,"name":"a"},{"id":2,"name":"b"},{"id":3.5,"name":"c"}]`
+
+	for _, tcase := range []struct {
+		name string
+		args []string
+		want string
+	}{
+		{
+			name: "csv",
+			args: []string{"-alphabetize"},
+			want: "id,name\n1.000000,a\n2.000000,b\n3.500000,c\n",
+		},
+		{
+			name: "pretty",
+			args: []string{"-alphabetize", "-pretty"},
+			want: "id        name\n1.000000  a\n2.000000  b\n3.500000  c\n",
+		},
+		{
+			name: "preview",
+			args: []string{"-alphabetize", "-preview", "2"},
+			want: "id        name\n1.000000  a\n2.000000  b\n" +
+				"\n2 of 3 rows\n\n" +
+				"column  type\nid      float\nname    string\n",
+		},
+		{
+			name: "dry run",
+			args: []string{"-alphabetize", "-dry-run"},
+			want: "columns: id, name\nrows: 3 from 3 records\n",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var stdout, stderr bytes.Buffer
+
+			err := run(context.Background(), tcase.args, strings.NewReader(input), &stdout, &stderr)
+			if err != nil {
+				t.Fatalf("run failed: %v", err)
+			}
+
+			if got := stdout.String(); got != tcase.want {
+				t.Fatalf("got:\n%s\nwant:\n%s", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestRunInputs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.json")
+	second := filepath.Join(dir, "b.json")
+
+	if err := os.WriteFile(first, []byte(`[{"id":1},{"id":2}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(second, []byte(`[{"id":3,"name":"c"},"d"]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	args := []string{"-alphabetize", "-source-column", "file", filepath.Join(dir, "*.json")}
+	if err := run(context.Background(), args, strings.NewReader(""), &stdout, &stderr); err != nil {
+		t.Fatalf("run failed: %v", err)
+	}
+
+	want := "file,id,name,value\n" +
+		first + ",1.000000,,\n" +
+		first + ",2.000000,,\n" +
+		second + ",3.000000,c,\n" +
+		second + ",,,d\n"
+
+	if got := stdout.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/alpstable/csvpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// preview will write the first "n" rows of the list as aligned columns,
+// followed by the schema inferred from all of the rows.
+func preview(ctx context.Context, out io.Writer, list *structpb.ListValue, n int,
+	writerOpts []csvpb.ListWriterOption,
+) error {
+	var table csvpb.Table
+
+	collect := csvpb.WriterFunc(func(record []string) error {
+		if table.Header == nil {
+			table.Header = record
+		} else {
+			table.Rows = append(table.Rows, record)
+		}
+
+		return nil
+	})
+
+	if err := csvpb.NewListWriter(collect, writerOpts...).Write(ctx, list); err != nil {
+		return err
+	}
+
+	rows := table.Rows
+	if len(rows) > n {
+		rows = rows[:n]
+	}
+
+	prettyWriter := csvpb.NewPrettyWriter(out, csvpb.WithColor(csvpb.ColorAuto))
+
+	for _, record := range append([][]string{table.Header}, rows...) {
+		if err := prettyWriter.Write(record); err != nil {
+			return err
+		}
+	}
+
+	if err := prettyWriter.Flush(); err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(out, "\n%d of %d rows\n\n", len(rows), len(table.Rows)); err != nil {
+		return fmt.Errorf("failed to write preview: %w", err)
+	}
+
+	schemaWriter := csvpb.NewPrettyWriter(out)
+	if err := schemaWriter.Write([]string{"column", "type"}); err != nil {
+		return err
+	}
+
+	for _, column := range csvpb.InferSchema(table).Columns {
+		if err := schemaWriter.Write([]string{column.Name, column.Type.String()}); err != nil {
+			return err
+		}
+	}
+
+	return schemaWriter.Flush()
+}
@@ -0,0 +1,161 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/alpstable/csvpb"
+)
+
+// watchedFile is the last seen state of a JSON file in the watched directory.
+type watchedFile struct {
+	modTime time.Time
+	size    int64
+
+	// changed is when the file was first seen with this state.
+	changed   time.Time
+	converted bool
+}
+
+// watcher polls a directory and converts JSON files that are new or modified
+// once they have stopped changing for the debounce period.
+type watcher struct {
+	dir         string
+	outDir      string
+	debounce    time.Duration
+	convertOpts []csvpb.ConvertOption
+	log         io.Writer
+	files       map[string]*watchedFile
+}
+
+func newWatcher(dir, outDir string, debounce time.Duration, log io.Writer,
+	convertOpts ...csvpb.ConvertOption,
+) *watcher {
+	return &watcher{
+		dir:         dir,
+		outDir:      outDir,
+		debounce:    debounce,
+		convertOpts: convertOpts,
+		log:         log,
+		files:       make(map[string]*watchedFile),
+	}
+}
+
+// scan will update the state of the JSON files in the directory at "now" and
+// return the paths of the files that are ready to convert, in order.
+func (w *watcher) scan(now time.Time) ([]string, error) {
+	entries, err := os.ReadDir(w.dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read watched directory: %w", err)
+	}
+
+	present := make(map[string]bool, len(entries))
+
+	var ready []string
+
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.EqualFold(filepath.Ext(entry.Name()), ".json") {
+			continue
+		}
+
+		info, err := entry.Info()
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat watched file: %w", err)
+		}
+
+		path := filepath.Join(w.dir, entry.Name())
+		present[path] = true
+
+		file, ok := w.files[path]
+		if !ok || !file.modTime.Equal(info.ModTime()) || file.size != info.Size() {
+			file = &watchedFile{modTime: info.ModTime(), size: info.Size(), changed: now}
+			w.files[path] = file
+		}
+
+		if !file.converted && now.Sub(file.changed) >= w.debounce {
+			ready = append(ready, path)
+		}
+	}
+
+	for path := range w.files {
+		if !present[path] {
+			delete(w.files, path)
+		}
+	}
+
+	sort.Strings(ready)
+
+	return ready, nil
+}
+
+// convert will convert the ready files and log the result for each one. A
+// file that fails is not retried until it is modified again.
+func (w *watcher) convert(ctx context.Context, ready []string) {
+	if len(ready) == 0 {
+		return
+	}
+
+	failed := make(map[string]error)
+
+	err := csvpb.ConvertFiles(ctx, ready, w.outDir, w.convertOpts...)
+
+	var convertErrs csvpb.ConvertErrors
+	if errors.As(err, &convertErrs) {
+		for _, convertErr := range convertErrs {
+			failed[convertErr.Input] = convertErr.Err
+		}
+	}
+
+	for _, path := range ready {
+		w.files[path].converted = true
+
+		if err, ok := failed[path]; ok {
+			fmt.Fprintf(w.log, "failed %s: %v\n", path, err)
+
+			continue
+		}
+
+		fmt.Fprintf(w.log, "converted %s\n", path)
+	}
+}
+
+// watch will poll the directory every "interval" until the context is
+// canceled.
+func (w *watcher) watch(ctx context.Context, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ready, err := w.scan(time.Now())
+		if err != nil {
+			return err
+		}
+
+		w.convert(ctx, ready)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
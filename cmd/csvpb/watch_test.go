@@ -0,0 +1,95 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	dir := t.TempDir()
+	outDir := t.TempDir()
+
+	var log bytes.Buffer
+
+	watcher := newWatcher(dir, outDir, time.Second, &log)
+
+	input := filepath.Join(dir, "a.json")
+	if err := os.WriteFile(input, []byte(`[{"a":1}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that are not JSON are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "b.txt"), []byte("x"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+
+	scan := func(now time.Time, want ...string) {
+		t.Helper()
+
+		ready, err := watcher.scan(now)
+		if err != nil {
+			t.Fatalf("scan failed: %v", err)
+		}
+
+		if len(ready) != len(want) || (len(want) > 0 && ready[0] != want[0]) {
+			t.Fatalf("got ready %q, want %q", ready, want)
+		}
+
+		watcher.convert(ctx, ready)
+	}
+
+	// The file is not converted until it has been unchanged for the
+	// debounce period, and then only once.
+	scan(start)
+	scan(start.Add(500 * time.Millisecond))
+	scan(start.Add(time.Second), input)
+	scan(start.Add(2 * time.Second))
+
+	got, err := os.ReadFile(filepath.Join(outDir, "a.csv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := "a\n1.000000\n"; string(got) != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// A modified file is converted again after the debounce period.
+	if err := os.WriteFile(input, []byte(`[{"a":1},{"a":2}]`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	scan(start.Add(3 * time.Second))
+	scan(start.Add(4*time.Second), input)
+
+	// A file that fails is logged, and not retried until it is modified.
+	if err := os.WriteFile(input, []byte(`{`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	scan(start.Add(5 * time.Second))
+	scan(start.Add(6*time.Second), input)
+	scan(start.Add(7 * time.Second))
+
+	wantLog := "converted " + input + "\nconverted " + input + "\nfailed " + input + ": "
+	if !bytes.HasPrefix(log.Bytes(), []byte(wantLog)) {
+		t.Fatalf("got log %q, want prefix %q", log.String(), wantLog)
+	}
+}
@@ -0,0 +1,173 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrUncoercible is returned when a value cannot be coerced to the kind
+// requested by WithCoercion.
+var ErrUncoercible = fmt.Errorf("value cannot be coerced")
+
+// parseBool will interpret the value as a boolean. Numbers must be 0 or 1, and
+// strings must be understood by strconv.ParseBool or be "yes" or "no" in any
+// case.
+func parseBool(value *structpb.Value) (bool, bool) {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_BoolValue:
+		return valType.BoolValue, true
+	case *structpb.Value_NumberValue:
+		switch valType.NumberValue {
+		case 0:
+			return false, true
+		case 1:
+			return true, true
+		}
+	case *structpb.Value_StringValue:
+		switch {
+		case strings.EqualFold(valType.StringValue, "yes"):
+			return true, true
+		case strings.EqualFold(valType.StringValue, "no"):
+			return false, true
+		}
+
+		b, err := strconv.ParseBool(valType.StringValue)
+		if err == nil {
+			return b, true
+		}
+	}
+
+	return false, false
+}
+
+// coerceBool will coerce the value to a boolean cell.
+func coerceBool(value *structpb.Value) (string, error) {
+	if b, ok := parseBool(value); ok {
+		return strconv.FormatBool(b), nil
+	}
+
+	return "", fmt.Errorf("%w: %v to %s", ErrUncoercible, value.AsInterface(), KindBool)
+}
+
+// parseNumber will interpret the value as a number. Booleans are 1 or 0, and
+// strings must be parsable as floats.
+func parseNumber(value *structpb.Value) (float64, bool) {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_NumberValue:
+		return valType.NumberValue, true
+	case *structpb.Value_BoolValue:
+		if valType.BoolValue {
+			return 1, true
+		}
+
+		return 0, true
+	case *structpb.Value_StringValue:
+		num, err := strconv.ParseFloat(valType.StringValue, 64)
+		if err == nil {
+			return num, true
+		}
+	}
+
+	return 0, false
+}
+
+// coerceNumber will coerce the value to a number cell.
+func coerceNumber(value *structpb.Value) (string, error) {
+	if num, ok := parseNumber(value); ok {
+		return formatValue(structpb.NewNumberValue(num)), nil
+	}
+
+	return "", fmt.Errorf("%w: %v to %s", ErrUncoercible, value.AsInterface(), KindNumber)
+}
+
+// coerce will format the value as a cell of the given kind. Null values are
+// always written as empty cells.
+func coerce(value *structpb.Value, kind Kind) (string, error) {
+	if _, ok := value.Kind.(*structpb.Value_NullValue); ok {
+		return "", nil
+	}
+
+	switch kind {
+	case KindString:
+		// Numbers are written without trailing zeros, so that e.g.
+		// zip codes are written as they were given.
+		if num, ok := value.Kind.(*structpb.Value_NumberValue); ok {
+			return strconv.FormatFloat(num.NumberValue, 'f', -1, 64), nil
+		}
+
+		return formatValue(value), nil
+	case KindNumber:
+		return coerceNumber(value)
+	case KindBool:
+		return coerceBool(value)
+	case KindUnknown, KindNull, KindStruct, KindList:
+		fallthrough
+	default:
+		return "", fmt.Errorf("%w: to %s", ErrUncoercible, kind)
+	}
+}
+
+// WithCoercion configures the ListWriter to write the cells of the column as
+// the given kind, which must be KindString, KindNumber, or KindBool. Cells
+// that cannot be coerced fail the write with ErrUncoercible, unless a warning
+// handler is configured, in which case they are reported to the handler and
+// written unchanged.
+func WithCoercion(column string, to Kind) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if listWriter.coercions == nil {
+			listWriter.coercions = make(map[string]Kind)
+		}
+
+		listWriter.coercions[column] = to
+	}
+}
+
+// WithBoolColumns configures the ListWriter to write the cells of the columns
+// as booleans, recognizing true and false, 1 and 0, "yes" and "no", and the
+// strings understood by strconv.ParseBool, such as "TRUE" and "f". It is the
+// same as WithCoercion with KindBool for each column.
+func WithBoolColumns(columns ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		for _, column := range columns {
+			WithCoercion(column, KindBool)(listWriter)
+		}
+	}
+}
+
+// boolFormat is the rendering of boolean cells.
+type boolFormat struct {
+	trueCell  string
+	falseCell string
+}
+
+// WithBoolFormat configures the ListWriter to write boolean cells, including
+// those coerced with WithCoercion or WithBoolColumns, as "trueCell" and
+// "falseCell" instead of "true" and "false", e.g. "Y" and "N".
+func WithBoolFormat(trueCell, falseCell string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.boolFormat = &boolFormat{trueCell: trueCell, falseCell: falseCell}
+	}
+}
+
+// appendBool will append the cell for the boolean in the configured format.
+func (w *ListWriter) appendBool(buf []byte, b bool) []byte {
+	switch {
+	case w.boolFormat == nil:
+		return strconv.AppendBool(buf, b)
+	case b:
+		return append(buf, w.boolFormat.trueCell...)
+	default:
+		return append(buf, w.boolFormat.falseCell...)
+	}
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCoercion(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"zip": 94016, "active": "1", "count": "3", "geo": {"zip": 10001}},
+		{"zip": "02134", "active": 0, "count": true, "geo": {"zip": null}}
+	]`)
+
+	opts := []ListWriterOption{
+		WithAlphabetizeHeaders(),
+		WithCoercion("zip", KindString),
+		WithCoercion("geo.zip", KindString),
+		WithCoercion("active", KindBool),
+		WithCoercion("count", KindNumber),
+	}
+
+	list, err := Decode(DecodeTypeJSON, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"active", "count", "geo.zip", "zip"},
+		{"true", "3.000000", "10001", "94016"},
+		{"false", "1.000000", "", "02134"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
+
+func TestWriteCoercionUncoercible(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`{"active": "maybe"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithCoercion("active", KindBool)).Write(context.Background(), list)
+	if !errors.Is(err, ErrUncoercible) {
+		t.Fatalf("got error %v, want %v", err, ErrUncoercible)
+	}
+
+	var warnings []error
+
+	warn := func(err error) { warnings = append(warnings, err) }
+
+	err = NewListWriter(&dst, WithCoercion("active", KindBool), WithWarningHandler(warn)).
+		Write(context.Background(), list)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrUncoercible) {
+		t.Fatalf("got warnings %v, want one %v", warnings, ErrUncoercible)
+	}
+
+	if got := dst.records[len(dst.records)-1]; !reflect.DeepEqual(got, []string{"maybe"}) {
+		t.Fatalf("got %v, want [maybe]", got)
+	}
+}
+
+func TestWriteBoolColumns(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"a": "true", "b": true},
+		{"a": "TRUE", "b": false},
+		{"a": 1, "b": null},
+		{"a": 0},
+		{"a": "yes"},
+		{"a": "No"},
+		{"a": null}
+	]`)
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "default format",
+			opts: []ListWriterOption{WithBoolColumns("a")},
+			want: [][]string{
+				{"a", "b"},
+				{"true", "true"},
+				{"true", "false"},
+				{"true", ""},
+				{"false", ""},
+				{"true", ""},
+				{"false", ""},
+				{"", ""},
+			},
+		},
+		{
+			name: "custom format",
+			opts: []ListWriterOption{WithBoolColumns("a"), WithBoolFormat("Y", "N")},
+			want: [][]string{
+				{"a", "b"},
+				{"Y", "Y"},
+				{"Y", "N"},
+				{"Y", ""},
+				{"N", ""},
+				{"Y", ""},
+				{"N", ""},
+				{"", ""},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "strings"
+
+// WithColumnGroups configures the ListWriter to write the columns of each
+// group before those of the next, in the order they are given within the
+// group, and every other column after the groups in alphabetical order, e.g.
+// the identifiers first, then the metrics, then everything else. A name that
+// is an object rather than a column places all of the columns flattened from
+// it, in alphabetical order. Columns of the groups that are not in the data
+// are left out.
+func WithColumnGroups(groups ...[]string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.columnGroups = groups
+	}
+}
+
+// columnRank is the position of a column in the groups.
+type columnRank struct {
+	group, index int
+}
+
+// columnRanker will return the position of a column in the groups, and false
+// if it is in none of them.
+func columnRanker(groups [][]string) func(header string) (columnRank, bool) {
+	ranks := make(map[string]columnRank)
+
+	for i, group := range groups {
+		for j, name := range group {
+			if _, ok := ranks[name]; !ok {
+				ranks[name] = columnRank{group: i, index: j}
+			}
+		}
+	}
+
+	return func(header string) (columnRank, bool) {
+		for path := header; ; {
+			if rank, ok := ranks[path]; ok {
+				return rank, true
+			}
+
+			dot := strings.LastIndex(path, ".")
+			if dot < 0 {
+				return columnRank{}, false
+			}
+
+			path = path[:dot]
+		}
+	}
+}
+
+// headerLess will return the ordering of the header set by WithColumnGroups or
+// WithAlphabetizeHeaders, or nil if the header is written in the order the
+// columns are first seen.
+func (w *ListWriter) headerLess() func(a, b string) bool {
+	if len(w.columnGroups) == 0 {
+		if w.alphabetizeHeaders {
+			return func(a, b string) bool { return a < b }
+		}
+
+		return nil
+	}
+
+	rank := columnRanker(w.columnGroups)
+
+	return func(a, b string) bool {
+		rankA, okA := rank(a)
+		rankB, okB := rank(b)
+
+		switch {
+		case okA != okB:
+			return okA
+		case okA && rankA != rankB:
+			if rankA.group != rankB.group {
+				return rankA.group < rankB.group
+			}
+
+			return rankA.index < rankB.index
+		default:
+			return a < b
+		}
+	}
+}
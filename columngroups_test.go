@@ -0,0 +1,74 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWithColumnGroups(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "groups",
+			data: `[{"z": 1, "amount": 2, "id": 3, "b": 4, "count": 5}]`,
+			opts: []ListWriterOption{WithColumnGroups([]string{"id"}, []string{"count", "amount"})},
+			want: [][]string{{"id", "count", "amount", "b", "z"}, {"3", "5", "2", "4", "1"}},
+		},
+		{
+			name: "objects",
+			data: `[{"user": {"name": "a", "email": "b"}, "id": 1, "tag": "c"}]`,
+			opts: []ListWriterOption{WithColumnGroups([]string{"id", "user"})},
+			want: [][]string{{"id", "user.email", "user.name", "tag"}, {"1", "b", "a", "c"}},
+		},
+		{
+			name: "missing columns",
+			data: `[{"b": 1, "a": 2}]`,
+			opts: []ListWriterOption{WithColumnGroups([]string{"id", "b"})},
+			want: [][]string{{"b", "a"}, {"1", "2"}},
+		},
+		{
+			name: "different keys",
+			data: `[{"z": 1, "id": 2}, {"a": 3}]`,
+			opts: []ListWriterOption{WithColumnGroups([]string{"id"})},
+			want: [][]string{{"id", "a", "z"}, {"2", "", "1"}, {"", "3", ""}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithRounding(0, RoundHalfUp)}, tcase.opts...)
+
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,712 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+type column struct {
+	header string
+	order  int
+
+	// index is the position of the column when it was created, which is
+	// its order until the columns are reordered.
+	index int
+
+	// source is what set the last cell of the column, e.g. fieldSource.
+	source string
+
+	// data holds the values of the cells, which are only formatted when
+	// the rows are written. Cells without a value are nil.
+	data  []*structpb.Value
+	stats ColumnStats
+
+	// distinct holds the distinct values of the column until there are
+	// more than the cardinality limit.
+	distinct map[distinctValue]struct{}
+}
+
+// formatFunc appends the formatted scalar value for the column at the given
+// flattened path to the buffer.
+type formatFunc func(buf []byte, path string, value *structpb.Value) ([]byte, error)
+
+// columns is the columnar form of a list of records. Every record occupies a
+// block of rows: scalars and nested objects are written to the first row of
+// the block, and the objects in an array are written to successive rows, so
+// the block is as tall as the tallest array. Cells are addressed directly by
+// their flattened path and row, so the cost of adding a cell does not depend
+// on how deeply it is nested.
+type columns struct {
+	m             map[string]*column
+	buf           int
+	currentColNum int
+
+	// rows is the number of rows occupied by the records added so far.
+	rows    int
+	records int
+	format  formatFunc
+
+	// arena is the buffer that the cells of a row are formatted into, so
+	// that a row costs a single string allocation.
+	arena []byte
+
+	// recordID and arrayIndex are the headers of the generated key
+	// columns, if they are enabled, and firstRecord is the number of the
+	// records that were written before these.
+	recordID    string
+	arrayIndex  string
+	firstRecord int64
+
+	// explodeDepth is the number of levels of arrays of objects that are
+	// written to successive rows, or -1 for all of them, and depth is the
+	// level of the array being added.
+	explodeDepth int
+	depth        int
+
+	// sortedFields is set to add the fields of objects in order of their
+	// keys, rather than in map iteration order.
+	sortedFields bool
+
+	// arrayPolicy is how arrays are added.
+	arrayPolicy ArrayPolicy
+
+	// keys escapes the keys of objects in the paths of the columns.
+	keys *keyEscaper
+
+	// maxColumns is the number of columns after which adding another
+	// fails, or 0 for no limit.
+	maxColumns int
+
+	// cardinalityLimit is the number of distinct values of a column after
+	// which onCardinality is called, or 0 to not count them.
+	cardinalityLimit int
+	onCardinality    func(header string)
+
+	// spill is the store that the rows are formatted into and moved to
+	// once the cells held by the columns take more than its memory
+	// limit, if it is set. The rows before base have been moved, and
+	// cells is the number of cells held for the rows after it.
+	spill *rowStore
+	base  int
+	cells int64
+}
+
+// columnCellSize is the memory taken by a cell of a column, which points to
+// its value.
+const columnCellSize = 8
+
+type columnsOpt func(*columns)
+
+func newColumns(opts ...columnsOpt) *columns {
+	cols := &columns{
+		m:            make(map[string]*column),
+		explodeDepth: -1,
+		format: func(buf []byte, _ string, value *structpb.Value) ([]byte, error) {
+			return appendValue(buf, value), nil
+		},
+	}
+
+	for _, opt := range opts {
+		opt(cols)
+	}
+
+	return cols
+}
+
+// withBuf sets the number of rows to preallocate for each column.
+func withBuf(buf int) columnsOpt {
+	return func(cols *columns) {
+		cols.buf = buf
+	}
+}
+
+func withFormat(format formatFunc) columnsOpt {
+	return func(cols *columns) {
+		cols.format = format
+	}
+}
+
+// withKeys sets the headers of the generated key columns, which are disabled
+// if they are empty.
+func withKeys(recordID, arrayIndex string) columnsOpt {
+	return func(cols *columns) {
+		cols.recordID = recordID
+		cols.arrayIndex = arrayIndex
+	}
+}
+
+// withExplodeDepth sets the number of levels of arrays that are exploded into
+// rows, with -1 for all of them.
+func withExplodeDepth(depth int) columnsOpt {
+	return func(cols *columns) {
+		cols.explodeDepth = depth
+	}
+}
+
+// withSortedFields sets whether the fields of objects are added in order of
+// their keys, so that the order of the columns does not depend on map
+// iteration.
+func withSortedFields(sorted bool) columnsOpt {
+	return func(cols *columns) {
+		cols.sortedFields = sorted
+	}
+}
+
+// withKeyEscaper sets the escaper of the keys of objects, which may be nil.
+func withKeyEscaper(keys *keyEscaper) columnsOpt {
+	return func(cols *columns) {
+		cols.keys = keys
+	}
+}
+
+// withMaxColumns sets the number of columns after which adding another fails
+// with a *TooManyColumnsError, with 0 for no limit.
+func withMaxColumns(n int) columnsOpt {
+	return func(cols *columns) {
+		cols.maxColumns = n
+	}
+}
+
+// withSpill sets the store that the rows are moved to once the cells of the
+// columns take more than its memory limit, so that the columns of a large list
+// are not all held in memory. The rows are then not preallocated.
+func withSpill(store *rowStore) columnsOpt {
+	return func(cols *columns) {
+		cols.spill = store
+		cols.buf = 0
+	}
+}
+
+// withFirstRecord sets the number of the records written before the columns,
+// so that the generated record IDs continue from them.
+func withFirstRecord(n int64) columnsOpt {
+	return func(cols *columns) {
+		cols.firstRecord = n
+	}
+}
+
+// appendValue will append a scalar value to the buffer, formatted as a cell.
+// Numbers are formatted as with "%f".
+func appendValue(buf []byte, value *structpb.Value) []byte {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_NumberValue:
+		return strconv.AppendFloat(buf, valType.NumberValue, 'f', 6, 64) //nolint:gomnd
+	case *structpb.Value_StringValue:
+		return append(buf, valType.StringValue...)
+	case *structpb.Value_BoolValue:
+		return strconv.AppendBool(buf, valType.BoolValue)
+	default:
+		return buf
+	}
+}
+
+// formatValue will format a scalar value as a cell.
+func formatValue(value *structpb.Value) string {
+	return string(appendValue(nil, value))
+}
+
+// joinPath will return the flattened path of the key within the object at the
+// given path.
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+
+	return path + "." + key
+}
+
+// reorder will order the columns by their headers.
+func (cols *columns) reorder(less func(a, b string) bool) {
+	columns := make([]*column, len(cols.m))
+	for _, column := range cols.m {
+		columns[column.order] = column
+	}
+
+	sort.Slice(columns, func(i, j int) bool {
+		return less(columns[i].header, columns[j].header)
+	})
+
+	// update the order
+	for i, column := range columns {
+		column.order = i
+	}
+}
+
+// The sources of the cells of columns, which name them in the errors of
+// conflicting paths.
+const (
+	fieldSource      = "a field"
+	recordIDSource   = "the WithRecordID column"
+	arrayIndexSource = "the WithArrayIndex column"
+)
+
+// setData will set the cell of the column at the given path and row to the
+// value of a field, creating the column if it does not exist and the limit on
+// columns allows it.
+func (cols *columns) setData(path string, row int, value *structpb.Value) (*column, error) {
+	return cols.setCell(path, row, value, fieldSource)
+}
+
+// setCell will set the cell of the column at the given path and row to the
+// value from "source", as setData does.
+func (cols *columns) setCell(path string, row int, value *structpb.Value, source string) (*column, error) {
+	col, ok := cols.m[path]
+	if !ok {
+		if cols.maxColumns > 0 && len(cols.m) >= cols.maxColumns {
+			return nil, &TooManyColumnsError{Columns: len(cols.m) + 1, Limit: cols.maxColumns, Column: path}
+		}
+
+		col = &column{
+			header: path,
+			order:  cols.currentColNum,
+			index:  cols.currentColNum,
+			data:   make([]*structpb.Value, cols.buf),
+		}
+
+		cols.m[path] = col
+		cols.currentColNum++
+		cols.cells += int64(cols.buf)
+	}
+
+	// The rows before the base were moved to the spill store.
+	row -= cols.base
+
+	for len(col.data) <= row {
+		col.data = append(col.data, nil)
+		cols.cells++
+	}
+
+	// A cell is only set once, so a second value means that two sources
+	// have the same path, and one of the values would be lost. The fields
+	// of a record are added before its generated columns, so the cell
+	// was set by the last source of the column.
+	if col.data[row] != nil {
+		return nil, cols.conflict(path, col.source, source)
+	}
+
+	col.data[row] = value
+	col.source = source
+
+	return col, nil
+}
+
+// conflict will return the error for two sources of the cell at "path".
+func (cols *columns) conflict(path, first, second string) error {
+	if first != fieldSource || second != fieldSource {
+		return fmt.Errorf("%w: %q is the header of both %s and %s", ErrHeaderConflict, path, first, second)
+	}
+
+	// Without an escape, a key with a dot has the same path as the nested
+	// keys it names, e.g. {"a.b": 1, "a": {"b": 2}}.
+	if cols.keys == nil {
+		return fmt.Errorf("%w: %q is the path of two fields, use WithDotEscape to tell them apart",
+			ErrHeaderConflict, path)
+	}
+
+	return fmt.Errorf("%w: %q is the path of two fields", ErrHeaderConflict, path)
+}
+
+// addStruct will add the fields of the object at the given row, returning the
+// number of rows that the object occupies.
+func (cols *columns) addStruct(path string, obj *structpb.Struct, row int) (int, error) {
+	height := 1
+
+	if cols.sortedFields {
+		return cols.addSortedStruct(path, obj, row)
+	}
+
+	for fieldName, fieldValue := range obj.GetFields() {
+		n, err := cols.addField(joinPath(path, cols.keys.escapeKey(fieldName)), fieldValue, row)
+		if err != nil {
+			return 0, withPathSegment(err, pathSegment{key: fieldName})
+		}
+
+		if n > height {
+			height = n
+		}
+	}
+
+	return height, nil
+}
+
+// addSortedStruct will add the fields of the object in order of their keys.
+func (cols *columns) addSortedStruct(path string, obj *structpb.Struct, row int) (int, error) {
+	height := 1
+
+	for _, fieldName := range sortedKeys(obj) {
+		n, err := cols.addField(joinPath(path, cols.keys.escapeKey(fieldName)), obj.GetFields()[fieldName], row)
+		if err != nil {
+			return 0, withPathSegment(err, pathSegment{key: fieldName})
+		}
+
+		if n > height {
+			height = n
+		}
+	}
+
+	return height, nil
+}
+
+// sortedKeys will return the keys of the object's fields in order.
+func sortedKeys(obj *structpb.Struct) []string {
+	keys := make([]string, 0, len(obj.GetFields()))
+	for key := range obj.GetFields() {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// addList will add the list at the given row, returning the number of rows
+// that it occupies, as the array policy directs.
+func (cols *columns) addList(path string, list *structpb.ListValue, row int) (int, error) {
+	switch cols.arrayPolicy {
+	case ArrayPolicyInline:
+		return cols.addInline(path, list, row)
+	case ArrayPolicyIndex:
+		return cols.addIndexed(path, list, row)
+	case ArrayPolicyJSONString:
+		return cols.addJSON(path, list, row)
+	case ArrayPolicyAuto, ArrayPolicyExplode, ArrayPolicyChildTable:
+	}
+
+	if cols.explodeDepth >= 0 && cols.depth >= cols.explodeDepth {
+		return cols.addJSON(path, list, row)
+	}
+
+	if cols.arrayPolicy == ArrayPolicyExplode {
+		return cols.addExploded(path, list, row)
+	}
+
+	return cols.addAuto(path, list, row)
+}
+
+// addAuto will add the list at the given row, returning the number of rows
+// that it occupies. Objects in the list are written to successive rows, and
+// the other values are written to a single bracketed cell.
+func (cols *columns) addAuto(path string, list *structpb.ListValue, row int) (int, error) {
+	var buf strings.Builder
+
+	height := 0
+	scalars := 0
+
+	buf.WriteString("[")
+
+	for i, value := range list.GetValues() {
+		if obj, ok := value.Kind.(*structpb.Value_StructValue); ok {
+			cols.depth++
+			n, err := cols.addStruct(path, obj.StructValue, row+height)
+			cols.depth--
+
+			if err != nil {
+				return 0, withPathSegment(err, pathSegment{index: i, isIndex: true})
+			}
+
+			height += n
+
+			continue
+		}
+
+		if scalars > 0 {
+			buf.WriteString(",")
+		}
+
+		if err := writeInlineScalar(&buf, value); err != nil {
+			return 0, withPathSegment(err, pathSegment{index: i, isIndex: true})
+		}
+
+		scalars++
+	}
+
+	buf.WriteString("]")
+
+	// Only add the cell if the list has elements that are not objects,
+	// and they are not all empty.
+	if buf.Len() > len("[]") {
+		col, err := cols.setData(path, row, structpb.NewStringValue(buf.String()))
+		if err != nil {
+			return 0, err
+		}
+
+		col.stats.observe(structpb.NewListValue(list))
+	}
+
+	if height == 0 {
+		height = 1
+	}
+
+	return height, nil
+}
+
+// addJSON will add the list at the given row as a single cell of JSON.
+func (cols *columns) addJSON(path string, list *structpb.ListValue, row int) (int, error) {
+	// The list is marshaled through its plain Go form, since protojson
+	// does not produce stable output.
+	data, err := json.Marshal(list.AsSlice())
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal list as json: %w", err)
+	}
+
+	col, err := cols.setData(path, row, structpb.NewStringValue(string(data)))
+	if err != nil {
+		return 0, err
+	}
+
+	col.stats.observe(structpb.NewListValue(list))
+
+	return 1, nil
+}
+
+// addField will add the value at the given path and row, returning the number
+// of rows that it occupies.
+func (cols *columns) addField(path string, value *structpb.Value, row int) (int, error) {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_NullValue, *structpb.Value_NumberValue,
+		*structpb.Value_StringValue, *structpb.Value_BoolValue:
+		col, err := cols.setData(path, row, value)
+		if err != nil {
+			return 0, err
+		}
+
+		col.stats.observe(value)
+
+		if cols.cardinalityLimit > 0 {
+			cols.observeDistinct(col, value)
+		}
+
+		return 1, nil
+	case *structpb.Value_StructValue:
+		return cols.addStruct(path, valType.StructValue, row)
+	case *structpb.Value_ListValue:
+		return cols.addList(path, valType.ListValue, row)
+	default:
+		return 0, fmt.Errorf("%w: %T", ErrUnsupportedValueType, valType)
+	}
+}
+
+// addValue will add the value as a new record, below the rows occupied by the
+// records that have already been added.
+func (cols *columns) addValue(key string, value *structpb.Value) error {
+	height, err := cols.addField(key, value, cols.rows)
+	if err != nil {
+		return newValueError(cols.records, key, err)
+	}
+
+	if cols.recordID != "" || cols.arrayIndex != "" {
+		if err := cols.addKeys(height); err != nil {
+			return err
+		}
+	}
+
+	cols.rows += height
+	cols.records++
+
+	if cols.spill != nil && cols.cells*columnCellSize > cols.spill.memLimit {
+		return cols.moveRows()
+	}
+
+	return nil
+}
+
+// moveRows will format the rows held by the columns into the spill store and
+// release their cells. The cells of each row are in the order in which the
+// columns were created, and later columns are missing from the rows.
+func (cols *columns) moveRows() error {
+	// The columns are only reordered once every record is added, so they
+	// are still in the order in which they were created.
+	ordered := cols.ordered()
+
+	for row := cols.base; row < cols.rows; row++ {
+		cells, err := cols.formatRow(ordered, row)
+		if err != nil {
+			return fmt.Errorf("failed to format row %d: %w", row, err)
+		}
+
+		if err := cols.spill.add(cells); err != nil {
+			return err
+		}
+	}
+
+	for _, col := range cols.m {
+		col.data = nil
+	}
+
+	cols.base = cols.rows
+	cols.cells = 0
+	cols.buf = 0
+
+	return nil
+}
+
+// closeSpill will remove the files of the spill store, if it is set, returning
+// "err" or else the error from removing them.
+func (cols *columns) closeSpill(err error) error {
+	if cols.spill == nil {
+		return err
+	}
+
+	if closeErr := cols.spill.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
+
+// movedRows will return an iterator over the rows that were moved to the
+// spill store, with their cells in the order of "ordered".
+func (cols *columns) movedRows(ordered []*column) rowIter {
+	return func(yield func(row []string) error) error {
+		return cols.spill.iter()(func(moved []string) error {
+			row := make([]string, len(ordered))
+			for i, col := range ordered {
+				if col.index < len(moved) {
+					row[i] = moved[col.index]
+				}
+			}
+
+			return yield(row)
+		})
+	}
+}
+
+// addKeys will set the generated key columns of each of the rows occupied by
+// the record being added.
+func (cols *columns) addKeys(height int) error {
+	var recordID *structpb.Value
+	if cols.recordID != "" {
+		recordID = structpb.NewStringValue(strconv.FormatInt(cols.firstRecord+int64(cols.records)+1, 10))
+	}
+
+	for i := 0; i < height; i++ {
+		if recordID != nil {
+			if _, err := cols.setCell(cols.recordID, cols.rows+i, recordID, recordIDSource); err != nil {
+				return err
+			}
+		}
+
+		if cols.arrayIndex != "" {
+			index := structpb.NewStringValue(strconv.Itoa(i))
+			if _, err := cols.setCell(cols.arrayIndex, cols.rows+i, index, arrayIndexSource); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// ordered will return the columns in output order.
+func (cols *columns) ordered() []*column {
+	ordered := make([]*column, len(cols.m))
+	for _, col := range cols.m {
+		ordered[col.order] = col
+	}
+
+	return ordered
+}
+
+// formatCells will format the values, which belong to the columns at the
+// given paths, into the arena and slice the cells out of a single string.
+// Nil values are empty cells. The grown arena is returned for reuse.
+func formatCells(arena []byte, format formatFunc, paths []string,
+	values []*structpb.Value,
+) ([]string, []byte, error) {
+	ends := make([]int, len(values))
+	buf := arena[:0]
+
+	for i, value := range values {
+		if value != nil {
+			var err error
+			if buf, err = format(buf, paths[i], value); err != nil {
+				return nil, arena, err
+			}
+		}
+
+		ends[i] = len(buf)
+	}
+
+	str := string(buf)
+	cells := make([]string, len(values))
+
+	start := 0
+	for i, end := range ends {
+		cells[i] = str[start:end]
+		start = end
+	}
+
+	return cells, buf, nil
+}
+
+// formatRow will format the cells of the ordered columns at the given row,
+// which must not have been moved to the spill store.
+func (cols *columns) formatRow(ordered []*column, row int) ([]string, error) {
+	row -= cols.base
+
+	paths := make([]string, len(ordered))
+	values := make([]*structpb.Value, len(ordered))
+
+	for i, col := range ordered {
+		paths[i] = col.header
+
+		if row < len(col.data) {
+			values[i] = col.data[row]
+		}
+	}
+
+	cells, arena, err := formatCells(cols.arena, cols.format, paths, values)
+	cols.arena = arena
+
+	return cells, err
+}
+
+// rowBufferForStruct will return the number of rows that the object occupies,
+// which is the height of its tallest array of objects.
+func rowBufferForStruct(obj *structpb.Struct) int {
+	buf := 1
+
+	for _, value := range obj.GetFields() {
+		var height int
+
+		switch valType := value.Kind.(type) {
+		case *structpb.Value_StructValue:
+			height = rowBufferForStruct(valType.StructValue)
+		case *structpb.Value_ListValue:
+			height = rowBufferForList(valType.ListValue)
+		}
+
+		if height > buf {
+			buf = height
+		}
+	}
+
+	return buf
+}
+
+// rowBufferForList will return the number of rows that should be created for
+// the objects in the given structpb.ListValue.
+func rowBufferForList(list *structpb.ListValue) int {
+	var buf int
+
+	for _, value := range list.GetValues() {
+		if obj, ok := value.Kind.(*structpb.Value_StructValue); ok {
+			buf += rowBufferForStruct(obj.StructValue)
+		}
+	}
+
+	return buf
+}
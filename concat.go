@@ -0,0 +1,82 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// concatColumn is a column built from others by WithConcatColumns.
+type concatColumn struct {
+	column string
+	sep    string
+	cols   []string
+}
+
+// ConcatColumnsConfig is a WithConcatColumns in a Config.
+type ConcatColumnsConfig struct {
+	NewCol string   `json:"newCol" yaml:"newCol"`
+	Sep    string   `json:"sep" yaml:"sep"`
+	Cols   []string `json:"cols" yaml:"cols"`
+}
+
+// WithConcatColumns configures the ListWriter to add the "newCol" column to
+// each record, with the values of "cols" joined by "sep", e.g. a full name
+// from first and last names, or a composite key. The columns may be flattened
+// paths such as "user.id", and their values are joined by their plain form, as
+// with WithValueMap. A missing, null, or non-scalar value is an empty part, so
+// that each part keeps its position, and the new column is empty if every
+// value is. The joined columns are kept.
+//
+// Concatenations are applied after splits, in the order they are configured,
+// so a concatenation can use the columns of a split or of an earlier
+// concatenation, and before the field mask.
+func WithConcatColumns(newCol string, sep string, cols ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.concats = append(listWriter.concats, &concatColumn{
+			column: newCol,
+			sep:    sep,
+			cols:   cols,
+		})
+	}
+}
+
+// concat will add the new column to "fields".
+func (concat *concatColumn) concat(fields map[string]*structpb.Value) {
+	obj := &structpb.Struct{Fields: fields}
+	parts := make([]string, len(concat.cols))
+	found := false
+
+	for i, col := range concat.cols {
+		if value := fieldByPath(obj, col); value != nil {
+			parts[i], _ = plainKey(value)
+			found = found || parts[i] != ""
+		}
+	}
+
+	if !found {
+		fields[concat.column] = structpb.NewNullValue()
+
+		return
+	}
+
+	fields[concat.column] = structpb.NewStringValue(strings.Join(parts, concat.sep))
+}
+
+// applyConcats will return a list with the concatenated columns added to each
+// object.
+func (w *ListWriter) applyConcats(list *structpb.ListValue) *structpb.ListValue {
+	return rewriteRecords(list, func(_ *structpb.Struct, fields map[string]*structpb.Value) {
+		for _, concat := range w.concats {
+			concat.concat(fields)
+		}
+	})
+}
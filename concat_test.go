@@ -0,0 +1,77 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWithConcatColumns(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "full name",
+			data: `[{"first": "Ann", "last": "Lee"}, {"first": "Bob"}, {"age": 3}]`,
+			opts: []ListWriterOption{WithConcatColumns("name", " ", "first", "last")},
+			want: [][]string{
+				{"age", "first", "last", "name"},
+				{"", "Ann", "Lee", "Ann Lee"},
+				{"", "Bob", "", "Bob "},
+				{"3", "", "", ""},
+			},
+		},
+		{
+			name: "composite key",
+			data: `[{"user": {"id": 7}, "region": "eu", "active": true}]`,
+			opts: []ListWriterOption{WithConcatColumns("key", "|", "region", "user.id", "active")},
+			want: [][]string{{"active", "key", "region", "user.id"}, {"true", "eu|7|true", "eu", "7"}},
+		},
+		{
+			name: "after split",
+			data: `[{"region": "US-CA"}]`,
+			opts: []ListWriterOption{
+				WithSplitColumn("region", "-", []string{"country", "state"}),
+				WithConcatColumns("code", "/", "state", "country"),
+			},
+			want: [][]string{{"code", "country", "state"}, {"CA/US", "US", "CA"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders(), WithRounding(0, RoundHalfUp)},
+				tcase.opts...)
+
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,406 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"sort"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+// Config is a plain representation of the functional options, intended to be
+// loaded from a configuration file. The zero value of each field leaves the
+// corresponding behavior at its default.
+type Config struct {
+	// AlphabetizeHeaders mirrors WithAlphabetizeHeaders.
+	AlphabetizeHeaders bool `json:"alphabetizeHeaders,omitempty" yaml:"alphabetizeHeaders,omitempty"`
+
+	// ColumnGroups mirrors WithColumnGroups.
+	ColumnGroups [][]string `json:"columnGroups,omitempty" yaml:"columnGroups,omitempty"`
+
+	// ASCIIHeaders mirrors WithASCIIHeaders.
+	ASCIIHeaders bool `json:"asciiHeaders,omitempty" yaml:"asciiHeaders,omitempty"`
+
+	// DuplicateHeaderError mirrors WithDuplicateHeaderError.
+	DuplicateHeaderError bool `json:"duplicateHeaderError,omitempty" yaml:"duplicateHeaderError,omitempty"`
+
+	// MaxColumns mirrors WithMaxColumns.
+	MaxColumns int `json:"maxColumns,omitempty" yaml:"maxColumns,omitempty"`
+
+	// TotalsRow mirrors WithTotalsRow, listing the totaled columns.
+	TotalsRow []string `json:"totalsRow,omitempty" yaml:"totalsRow,omitempty"`
+
+	// CardinalityLimit mirrors WithCardinalityLimit.
+	CardinalityLimit int `json:"cardinalityLimit,omitempty" yaml:"cardinalityLimit,omitempty"`
+
+	// NullThresholds mirrors WithNullThreshold, mapping columns to their
+	// maximum null rates.
+	NullThresholds map[string]float64 `json:"nullThresholds,omitempty" yaml:"nullThresholds,omitempty"`
+
+	// RateLimit mirrors WithRateLimit, in rows per second.
+	RateLimit int `json:"rateLimit,omitempty" yaml:"rateLimit,omitempty"`
+
+	// LargestRecords mirrors WithLargestRecords.
+	LargestRecords int `json:"largestRecords,omitempty" yaml:"largestRecords,omitempty"`
+
+	// ScalarColumn mirrors WithScalarColumn.
+	ScalarColumn string `json:"scalarColumn,omitempty" yaml:"scalarColumn,omitempty"`
+
+	// Coercions mirrors WithCoercion, mapping columns to the name of the
+	// kind to coerce them to, e.g. "string".
+	Coercions map[string]Kind `json:"coercions,omitempty" yaml:"coercions,omitempty"`
+
+	// FieldMask mirrors WithFieldMask, listing the mask paths.
+	FieldMask []string `json:"fieldMask,omitempty" yaml:"fieldMask,omitempty"`
+
+	// SampleRate and SampleSeed mirror WithSample, which is used when
+	// SampleRate is set.
+	SampleRate float64 `json:"sampleRate,omitempty" yaml:"sampleRate,omitempty"`
+	SampleSeed int64   `json:"sampleSeed,omitempty" yaml:"sampleSeed,omitempty"`
+
+	// DropKinds mirrors WithDropKinds, listing the names of the kinds,
+	// e.g. "list".
+	DropKinds []Kind `json:"dropKinds,omitempty" yaml:"dropKinds,omitempty"`
+
+	// RepeatHeader mirrors WithRepeatHeader, with HeaderSeparator as its
+	// separator.
+	RepeatHeader    bool     `json:"repeatHeader,omitempty" yaml:"repeatHeader,omitempty"`
+	HeaderSeparator []string `json:"headerSeparator,omitempty" yaml:"headerSeparator,omitempty"`
+
+	// ValueInterning mirrors WithValueInterning.
+	ValueInterning bool `json:"valueInterning,omitempty" yaml:"valueInterning,omitempty"`
+
+	// InputSchema mirrors WithInputSchema. It is either the JSON Schema
+	// document itself, if it starts with "{" or is "true" or "false", or
+	// the path of a file holding it.
+	InputSchema string `json:"inputSchema,omitempty" yaml:"inputSchema,omitempty"`
+
+	// Filters mirrors WithFilter, with one CEL expression per filter.
+	Filters []string `json:"filters,omitempty" yaml:"filters,omitempty"`
+
+	// ComputedColumns mirrors WithComputedColumn, mapping column names to
+	// CEL expressions. The columns are computed in order of their names.
+	ComputedColumns map[string]string `json:"computedColumns,omitempty" yaml:"computedColumns,omitempty"`
+
+	// SortBy mirrors WithSortBy.
+	SortBy []string `json:"sortBy,omitempty" yaml:"sortBy,omitempty"`
+
+	// SpillDir and SpillMemLimit mirror WithSpill, which is used when the
+	// limit is set.
+	SpillDir      string `json:"spillDir,omitempty" yaml:"spillDir,omitempty"`
+	SpillMemLimit int64  `json:"spillMemLimit,omitempty" yaml:"spillMemLimit,omitempty"`
+
+	// BoolColumns mirrors WithBoolColumns.
+	BoolColumns []string `json:"boolColumns,omitempty" yaml:"boolColumns,omitempty"`
+
+	// BoolTrue and BoolFalse mirror WithBoolFormat, which is used when
+	// either is set. The other defaults to "true" or "false".
+	BoolTrue  string `json:"boolTrue,omitempty" yaml:"boolTrue,omitempty"`
+	BoolFalse string `json:"boolFalse,omitempty" yaml:"boolFalse,omitempty"`
+
+	// ValueMaps mirrors WithValueMap, mapping columns to their
+	// translations.
+	ValueMaps map[string]map[string]string `json:"valueMaps,omitempty" yaml:"valueMaps,omitempty"`
+
+	// Lookups mirrors WithLookup, in order.
+	Lookups []LookupConfig `json:"lookups,omitempty" yaml:"lookups,omitempty"`
+
+	// SplitColumns mirrors WithSplitColumn, in order.
+	SplitColumns []SplitColumnConfig `json:"splitColumns,omitempty" yaml:"splitColumns,omitempty"`
+
+	// ConcatColumns mirrors WithConcatColumns, in order.
+	ConcatColumns []ConcatColumnsConfig `json:"concatColumns,omitempty" yaml:"concatColumns,omitempty"`
+
+	// RecordID and ArrayIndex mirror WithRecordID and WithArrayIndex,
+	// giving the headers of the generated columns.
+	RecordID   string `json:"recordID,omitempty" yaml:"recordID,omitempty"`
+	ArrayIndex string `json:"arrayIndex,omitempty" yaml:"arrayIndex,omitempty"`
+
+	// ArrayPolicy mirrors WithArrayPolicy, given by name, e.g. "index".
+	// ArrayPolicyChildTable cannot be used, since it needs
+	// WithChildTables.
+	ArrayPolicy ArrayPolicy `json:"arrayPolicy,omitempty" yaml:"arrayPolicy,omitempty"`
+
+	// DotEscape mirrors WithDotEscape.
+	DotEscape string `json:"dotEscape,omitempty" yaml:"dotEscape,omitempty"`
+
+	// ExplodeDepth mirrors WithExplodeDepth. It is a pointer so that a
+	// depth of 0 can be told apart from the default.
+	ExplodeDepth *int `json:"explodeDepth,omitempty" yaml:"explodeDepth,omitempty"`
+
+	// Deterministic mirrors WithDeterministic.
+	Deterministic bool `json:"deterministic,omitempty" yaml:"deterministic,omitempty"`
+
+	// RoundDecimals and RoundMode mirror WithRounding, which is used when
+	// RoundDecimals is set. RoundMode is given by name, e.g. "halfEven".
+	RoundDecimals *int      `json:"roundDecimals,omitempty" yaml:"roundDecimals,omitempty"`
+	RoundMode     RoundMode `json:"roundMode,omitempty" yaml:"roundMode,omitempty"`
+
+	// PercentColumns and PercentDecimals mirror WithPercentColumns.
+	PercentColumns  []string `json:"percentColumns,omitempty" yaml:"percentColumns,omitempty"`
+	PercentDecimals int      `json:"percentDecimals,omitempty" yaml:"percentDecimals,omitempty"`
+
+	// EmptyInput and EmptyHeader mirror WithEmptyInput. EmptyInput is
+	// given by name, e.g. "header".
+	EmptyInput  EmptyInput `json:"emptyInput,omitempty" yaml:"emptyInput,omitempty"`
+	EmptyHeader []string   `json:"emptyHeader,omitempty" yaml:"emptyHeader,omitempty"`
+
+	// CurrencyColumns mirrors WithCurrencyColumns, mapping columns to
+	// their currency codes, which may be empty.
+	CurrencyColumns map[string]string `json:"currencyColumns,omitempty" yaml:"currencyColumns,omitempty"`
+
+	// Base64Output and Base64Columns mirror WithBase64Decode. Base64Output
+	// is given by name, e.g. "hex".
+	Base64Output  Base64Output `json:"base64Output,omitempty" yaml:"base64Output,omitempty"`
+	Base64Columns []string     `json:"base64Columns,omitempty" yaml:"base64Columns,omitempty"`
+
+	// CommentHeader mirrors WithCommentHeader.
+	CommentHeader []string `json:"commentHeader,omitempty" yaml:"commentHeader,omitempty"`
+
+	// TimeZone and TimeZoneColumns mirror WithTimeZone, which is used
+	// when TimeZone is set. TimeZone is given by name, e.g. "Europe/Berlin".
+	TimeZone        *TimeZone `json:"timeZone,omitempty" yaml:"timeZone,omitempty"`
+	TimeZoneColumns []string  `json:"timeZoneColumns,omitempty" yaml:"timeZoneColumns,omitempty"`
+
+	// ExcelProfile mirrors WithExcelProfile, with ExcelSepHint mirroring
+	// WithSepHint.
+	ExcelProfile bool `json:"excelProfile,omitempty" yaml:"excelProfile,omitempty"`
+	ExcelSepHint bool `json:"excelSepHint,omitempty" yaml:"excelSepHint,omitempty"`
+
+	// Zstd mirrors WithZstd.
+	Zstd bool `json:"zstd,omitempty" yaml:"zstd,omitempty"`
+
+	// StrictDecode mirrors WithStrictDecode.
+	StrictDecode bool `json:"strictDecode,omitempty" yaml:"strictDecode,omitempty"`
+
+	// MaxInputBytes mirrors WithMaxInputBytes.
+	MaxInputBytes int `json:"maxInputBytes,omitempty" yaml:"maxInputBytes,omitempty"`
+
+	// OneofPolicy mirrors WithOneofPolicy, by name.
+	OneofPolicy OneofPolicy `json:"oneofPolicy,omitempty" yaml:"oneofPolicy,omitempty"`
+}
+
+// OptionsFromConfig returns the ListWriter options described by the config.
+func OptionsFromConfig(cfg Config) []ListWriterOption {
+	var opts []ListWriterOption
+
+	if cfg.AlphabetizeHeaders {
+		opts = append(opts, WithAlphabetizeHeaders())
+	}
+
+	if len(cfg.ColumnGroups) > 0 {
+		opts = append(opts, WithColumnGroups(cfg.ColumnGroups...))
+	}
+
+	if cfg.ASCIIHeaders {
+		opts = append(opts, WithASCIIHeaders())
+	}
+
+	if cfg.DuplicateHeaderError {
+		opts = append(opts, WithDuplicateHeaderError())
+	}
+
+	if cfg.MaxColumns > 0 {
+		opts = append(opts, WithMaxColumns(cfg.MaxColumns))
+	}
+
+	if len(cfg.TotalsRow) > 0 {
+		opts = append(opts, WithTotalsRow(cfg.TotalsRow...))
+	}
+
+	if cfg.CardinalityLimit > 0 {
+		opts = append(opts, WithCardinalityLimit(cfg.CardinalityLimit))
+	}
+
+	for column, maxRate := range cfg.NullThresholds {
+		opts = append(opts, WithNullThreshold(column, maxRate))
+	}
+
+	if cfg.RateLimit > 0 {
+		opts = append(opts, WithRateLimit(cfg.RateLimit))
+	}
+
+	if cfg.LargestRecords > 0 {
+		opts = append(opts, WithLargestRecords(cfg.LargestRecords))
+	}
+
+	if cfg.ScalarColumn != "" {
+		opts = append(opts, WithScalarColumn(cfg.ScalarColumn))
+	}
+
+	for column, kind := range cfg.Coercions {
+		opts = append(opts, WithCoercion(column, kind))
+	}
+
+	if len(cfg.FieldMask) > 0 {
+		opts = append(opts, WithFieldMask(&fieldmaskpb.FieldMask{Paths: cfg.FieldMask}))
+	}
+
+	if cfg.SampleRate > 0 {
+		opts = append(opts, WithSample(cfg.SampleRate, cfg.SampleSeed))
+	}
+
+	if len(cfg.DropKinds) > 0 {
+		opts = append(opts, WithDropKinds(cfg.DropKinds...))
+	}
+
+	if cfg.ValueInterning {
+		opts = append(opts, WithValueInterning())
+	}
+
+	if cfg.InputSchema != "" {
+		opts = append(opts, inputSchemaFromConfig(cfg.InputSchema))
+	}
+
+	for _, filter := range cfg.Filters {
+		opts = append(opts, WithFilter(filter))
+	}
+
+	names := make([]string, 0, len(cfg.ComputedColumns))
+	for name := range cfg.ComputedColumns {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		opts = append(opts, WithComputedColumn(name, cfg.ComputedColumns[name]))
+	}
+
+	if len(cfg.SortBy) > 0 {
+		opts = append(opts, WithSortBy(cfg.SortBy...))
+	}
+
+	if cfg.SpillMemLimit > 0 {
+		opts = append(opts, WithSpill(cfg.SpillDir, cfg.SpillMemLimit))
+	}
+
+	if cfg.RepeatHeader {
+		opts = append(opts, WithRepeatHeader(cfg.HeaderSeparator))
+	}
+
+	if len(cfg.BoolColumns) > 0 {
+		opts = append(opts, WithBoolColumns(cfg.BoolColumns...))
+	}
+
+	if cfg.BoolTrue != "" || cfg.BoolFalse != "" {
+		trueCell, falseCell := cfg.BoolTrue, cfg.BoolFalse
+		if trueCell == "" {
+			trueCell = "true"
+		}
+
+		if falseCell == "" {
+			falseCell = "false"
+		}
+
+		opts = append(opts, WithBoolFormat(trueCell, falseCell))
+	}
+
+	for column, mapping := range cfg.ValueMaps {
+		opts = append(opts, WithValueMap(column, mapping))
+	}
+
+	for _, lookup := range cfg.Lookups {
+		opts = append(opts, WithLookup(lookup.Column, lookup.Table, lookup.NewCols))
+	}
+
+	for _, split := range cfg.SplitColumns {
+		opts = append(opts, WithSplitColumn(split.Column, split.Sep, split.NewCols))
+	}
+
+	for _, concat := range cfg.ConcatColumns {
+		opts = append(opts, WithConcatColumns(concat.NewCol, concat.Sep, concat.Cols...))
+	}
+
+	if cfg.RecordID != "" {
+		opts = append(opts, WithRecordID(cfg.RecordID))
+	}
+
+	if cfg.ArrayIndex != "" {
+		opts = append(opts, WithArrayIndex(cfg.ArrayIndex))
+	}
+
+	if cfg.ArrayPolicy != ArrayPolicyAuto {
+		opts = append(opts, WithArrayPolicy(cfg.ArrayPolicy))
+	}
+
+	if cfg.DotEscape != "" {
+		opts = append(opts, WithDotEscape(cfg.DotEscape))
+	}
+
+	if cfg.ExplodeDepth != nil {
+		opts = append(opts, WithExplodeDepth(*cfg.ExplodeDepth))
+	}
+
+	if cfg.Deterministic {
+		opts = append(opts, WithDeterministic())
+	}
+
+	if cfg.RoundDecimals != nil {
+		opts = append(opts, WithRounding(*cfg.RoundDecimals, cfg.RoundMode))
+	}
+
+	if len(cfg.PercentColumns) > 0 {
+		opts = append(opts, WithPercentColumns(cfg.PercentDecimals, cfg.PercentColumns...))
+	}
+
+	for column, code := range cfg.CurrencyColumns {
+		opts = append(opts, WithCurrencyColumns(code, column))
+	}
+
+	if len(cfg.Base64Columns) > 0 {
+		opts = append(opts, WithBase64Decode(cfg.Base64Output, cfg.Base64Columns...))
+	}
+
+	if cfg.EmptyInput != EmptyInputNothing {
+		opts = append(opts, WithEmptyInput(cfg.EmptyInput, cfg.EmptyHeader...))
+	}
+
+	if len(cfg.CommentHeader) > 0 {
+		opts = append(opts, WithCommentHeader(cfg.CommentHeader...))
+	}
+
+	if cfg.TimeZone != nil {
+		opts = append(opts, WithTimeZone(cfg.TimeZone.Location, cfg.TimeZoneColumns...))
+	}
+
+	if cfg.ExcelProfile {
+		var excelOpts []ExcelOption
+		if cfg.ExcelSepHint {
+			excelOpts = append(excelOpts, WithSepHint())
+		}
+
+		opts = append(opts, WithExcelProfile(excelOpts...))
+	}
+
+	if cfg.Zstd {
+		opts = append(opts, WithZstd())
+	}
+
+	return opts
+}
+
+// DecodeOptionsFromConfig returns the Decode options described by the config.
+func DecodeOptionsFromConfig(cfg Config) []DecodeOption {
+	var opts []DecodeOption
+
+	if cfg.StrictDecode {
+		opts = append(opts, WithStrictDecode())
+	}
+
+	if cfg.MaxInputBytes > 0 {
+		opts = append(opts, WithMaxInputBytes(cfg.MaxInputBytes))
+	}
+
+	if cfg.OneofPolicy != OneofPolicyVariants {
+		opts = append(opts, WithOneofPolicy(cfg.OneofPolicy))
+	}
+
+	return opts
+}
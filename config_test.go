@@ -0,0 +1,236 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestOptionsFromConfig(t *testing.T) {
+	t.Parallel()
+
+	var cfg Config
+	if err := json.Unmarshal([]byte(`{
+		"alphabetizeHeaders": true,
+		"columnGroups": [["id"], ["amount"]],
+		"asciiHeaders": true,
+		"duplicateHeaderError": true,
+		"maxColumns": 10,
+		"cardinalityLimit": 100,
+		"nullThresholds": {"email": 0.1},
+		"rateLimit": 50,
+		"largestRecords": 3,
+		"scalarColumn": "item",
+		"coercions": {"zip": "string"},
+		"fieldMask": ["user.id"],
+		"sampleRate": 0.5,
+		"sampleSeed": 7,
+		"dropKinds": ["list"],
+		"repeatHeader": true,
+		"headerSeparator": [],
+		"valueInterning": true,
+		"sortBy": ["id"],
+		"spillDir": "/tmp",
+		"spillMemLimit": 4096,
+		"boolColumns": ["active"],
+		"boolTrue": "Y",
+		"valueMaps": {"status": {"1": "active"}},
+		"recordID": "record_id",
+		"arrayIndex": "array_index",
+		"arrayPolicy": "index",
+		"dotEscape": "\\",
+		"explodeDepth": 0,
+		"deterministic": true,
+		"roundDecimals": 2,
+		"roundMode": "halfEven",
+		"percentColumns": ["ratio"],
+		"percentDecimals": 1,
+		"currencyColumns": {"price": "USD"},
+		"base64Output": "hex",
+		"base64Columns": ["payload"],
+		"emptyInput": "header",
+		"emptyHeader": ["id", "name"],
+		"commentHeader": ["generated"],
+		"timeZone": "UTC",
+		"timeZoneColumns": ["created"],
+		"excelProfile": true,
+		"excelSepHint": true,
+		"zstd": true,
+		"strictDecode": true,
+		"maxInputBytes": 1024,
+		"oneofPolicy": "case_value"
+	}`), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	got := NewListWriter(nil, OptionsFromConfig(cfg)...)
+	want := NewListWriter(nil, WithAlphabetizeHeaders(),
+		WithColumnGroups([]string{"id"}, []string{"amount"}), WithASCIIHeaders(),
+		WithDuplicateHeaderError(), WithMaxColumns(10), WithCardinalityLimit(100), WithNullThreshold("email", 0.1), WithRateLimit(50), WithLargestRecords(3),
+		WithScalarColumn("item"),
+		WithCoercion("zip", KindString),
+		WithFieldMask(&fieldmaskpb.FieldMask{Paths: []string{"user.id"}}), WithSample(0.5, 7), WithDropKinds(KindList),
+		WithRepeatHeader([]string{}), WithValueInterning(),
+		WithSortBy("id"), WithSpill("/tmp", 4096),
+		WithBoolColumns("active"), WithBoolFormat("Y", "false"),
+		WithValueMap("status", map[string]string{"1": "active"}),
+		WithRecordID("record_id"), WithArrayIndex("array_index"),
+		WithArrayPolicy(ArrayPolicyIndex), WithDotEscape(DefaultDotEscape), WithExplodeDepth(0), WithDeterministic(), WithRounding(2, RoundHalfEven),
+		WithPercentColumns(1, "ratio"), WithCurrencyColumns("USD", "price"), WithBase64Decode(Base64OutputHex, "payload"), WithEmptyInput(EmptyInputHeader, "id", "name"),
+		WithCommentHeader("generated"), WithTimeZone(time.UTC, "created"),
+		WithExcelProfile(WithSepHint()), WithZstd())
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	gotDec := &decoder{}
+	for _, opt := range DecodeOptionsFromConfig(cfg) {
+		opt(gotDec)
+	}
+
+	wantDec := &decoder{strict: true, maxInputBytes: 1024, oneofPolicy: OneofPolicyCaseValue}
+
+	if !reflect.DeepEqual(gotDec, wantDec) {
+		t.Fatalf("got %+v, want %+v", gotDec, wantDec)
+	}
+}
+
+// TestOptionsFromConfigWrite covers the options that cannot be compared by
+// value, such as those that set a function, by the output they write.
+func TestOptionsFromConfigWrite(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"name": "a-x", "amount": 1}, {"name": "b-y", "amount": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name   string
+		config string
+		want   [][]string
+	}{
+		{
+			name: "split columns",
+			config: `{"alphabetizeHeaders": true, "splitColumns": [
+				{"column": "name", "sep": "-", "newCols": ["first", "rest"]}
+			]}`,
+			want: [][]string{
+				{"amount", "first", "rest"},
+				{"1.000000", "a", "x"},
+				{"2.000000", "b", "y"},
+			},
+		},
+		{
+			name: "lookups",
+			config: `{"alphabetizeHeaders": true, "lookups": [
+				{"column": "name", "table": {"a-x": ["A"]}, "newCols": ["label"]}
+			]}`,
+			want: [][]string{
+				{"amount", "label", "name"},
+				{"1.000000", "A", "a-x"},
+				{"2.000000", "", "b-y"},
+			},
+		},
+		{
+			name: "concat columns",
+			config: `{"alphabetizeHeaders": true, "concatColumns": [
+				{"newCol": "key", "sep": "/", "cols": ["name", "amount"]}
+			]}`,
+			want: [][]string{
+				{"amount", "key", "name"},
+				{"1.000000", "a-x/1", "a-x"},
+				{"2.000000", "b-y/2", "b-y"},
+			},
+		},
+		{
+			name:   "totals row",
+			config: `{"alphabetizeHeaders": true, "totalsRow": ["amount"]}`,
+			want: [][]string{
+				{"amount", "name"},
+				{"1.000000", "a-x"},
+				{"2.000000", "b-y"},
+				{"3.000000", ""},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var cfg Config
+			if err := json.Unmarshal([]byte(tcase.config), &cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err := NewListWriter(&dst, OptionsFromConfig(cfg)...).Write(context.Background(), list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestOptionsFromConfigInputSchema(t *testing.T) {
+	t.Parallel()
+
+	const schema = `{"properties": {"amount": {"maximum": 1}}}`
+
+	path := filepath.Join(t.TempDir(), "schema.json")
+	if err := os.WriteFile(path, []byte(schema), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"amount": 1}, {"amount": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name    string
+		schema  string
+		wantErr error
+	}{
+		{name: "inline", schema: schema, wantErr: ErrSchemaViolation},
+		{name: "file", schema: path, wantErr: ErrSchemaViolation},
+		{name: "missing file", schema: path + ".missing", wantErr: ErrInvalidSchema},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			opts := OptionsFromConfig(Config{InputSchema: tcase.schema})
+
+			err := NewListWriter(&dst, opts...).Write(context.Background(), list)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+		})
+	}
+}
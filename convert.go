@@ -0,0 +1,443 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrDuplicateOutput is returned by ConvertFiles when two inputs would be
+// written to the same output file.
+var ErrDuplicateOutput = fmt.Errorf("duplicate output file")
+
+type converter struct {
+	concurrency int
+	decodeOpts  []DecodeOption
+	writerOpts  []ListWriterOption
+}
+
+// ConvertOption is used to configure ConvertFiles and Convert.
+type ConvertOption func(*converter)
+
+// WithConcurrency configures ConvertFiles to convert at most "n" files at a
+// time. The default is runtime.GOMAXPROCS(0).
+func WithConcurrency(n int) ConvertOption {
+	return func(conv *converter) {
+		conv.concurrency = n
+	}
+}
+
+// WithDecodeOptions configures the options used by ConvertFiles to decode each
+// input file.
+func WithDecodeOptions(opts ...DecodeOption) ConvertOption {
+	return func(conv *converter) {
+		conv.decodeOpts = append(conv.decodeOpts, opts...)
+	}
+}
+
+// WithListWriterOptions configures the options used by ConvertFiles to write
+// each output file.
+func WithListWriterOptions(opts ...ListWriterOption) ConvertOption {
+	return func(conv *converter) {
+		conv.writerOpts = append(conv.writerOpts, opts...)
+	}
+}
+
+// ConvertError is the error for a single input to ConvertFiles.
+type ConvertError struct {
+	Input string
+	Err   error
+}
+
+func (e *ConvertError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Input, e.Err)
+}
+
+func (e *ConvertError) Unwrap() error {
+	return e.Err
+}
+
+// ConvertErrors is returned by ConvertFiles when one or more inputs could not
+// be converted, in the order the inputs were given.
+type ConvertErrors []*ConvertError
+
+func (e ConvertErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+
+	return fmt.Sprintf("failed to convert %d files: %s", len(e), strings.Join(msgs, "; "))
+}
+
+// outputPath will return the path of the CSV file for the given input, which
+// has the same base name with a ".csv" extension.
+func outputPath(input, outDir string) string {
+	base := strings.TrimSuffix(filepath.Base(input), ".zst")
+
+	return filepath.Join(outDir, strings.TrimSuffix(base, filepath.Ext(base))+".csv")
+}
+
+// decode will decode the data read from "in".
+func (conv *converter) decode(dtype DecodeType, in io.Reader) (*structpb.ListValue, error) {
+	in, release, err := decompress(in)
+	if err != nil {
+		return nil, err
+	}
+
+	defer release()
+
+	dec := &decoder{}
+	for _, opt := range conv.decodeOpts {
+		opt(dec)
+	}
+
+	// Read one byte past the limit, so that Decode can tell that it was
+	// exceeded without the whole input being read.
+	if dec.maxInputBytes > 0 {
+		in = io.LimitReader(in, int64(dec.maxInputBytes)+1)
+	}
+
+	data, err := io.ReadAll(in)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	list, err := Decode(dtype, data, conv.decodeOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode input: %w", err)
+	}
+
+	return list, nil
+}
+
+// write will write the list as CSV to "out".
+func (conv *converter) write(ctx context.Context, list *structpb.ListValue, out io.Writer) error {
+	csvWriter := csv.NewWriter(out)
+
+	if err := NewListWriter(csvWriter, conv.writerOpts...).Write(ctx, list); err != nil {
+		return err
+	}
+
+	csvWriter.Flush()
+
+	if err := csvWriter.Error(); err != nil {
+		return fmt.Errorf("failed to flush output: %w", err)
+	}
+
+	return nil
+}
+
+// convertFile will decode the JSON file at "input" and write it as CSV to
+// "output".
+func (conv *converter) convertFile(ctx context.Context, input, output string) error {
+	in, err := os.Open(input)
+	if err != nil {
+		return fmt.Errorf("failed to read input: %w", err)
+	}
+
+	list, err := conv.decode(DecodeTypeJSON, in)
+	in.Close()
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create output: %w", err)
+	}
+
+	if err := conv.write(ctx, list, file); err != nil {
+		file.Close()
+
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close output: %w", err)
+	}
+
+	return nil
+}
+
+// convertBatch is the number of records that Convert encodes at a time when
+// it streams a JSON sequence.
+const convertBatch = 1000
+
+// limitedInput fails with ErrInputTooLarge once more than "limit" bytes are
+// read.
+type limitedInput struct {
+	r     io.Reader
+	limit int
+	read  int
+}
+
+func (in *limitedInput) Read(data []byte) (int, error) {
+	n, err := in.r.Read(data)
+	if in.read += n; in.read > in.limit {
+		return n, fmt.Errorf("%w: more than the limit of %d bytes", ErrInputTooLarge, in.limit)
+	}
+
+	return n, err //nolint:wrapcheck
+}
+
+// seqReader reads a JSON sequence with its record separators replaced by
+// spaces, so that json.Decoder reads its documents one after the other.
+type seqReader struct {
+	r io.Reader
+}
+
+func (in seqReader) Read(data []byte) (int, error) {
+	n, err := in.r.Read(data)
+	for i := range data[:n] {
+		if data[i] == recordSeparator {
+			data[i] = ' '
+		}
+	}
+
+	return n, err //nolint:wrapcheck
+}
+
+// streams will return true if Convert can stream the input of the decode type
+// through an Encoder, which writes the same table as the ListWriter unless an
+// option needs the whole table.
+func (conv *converter) streams(dtype DecodeType) bool {
+	listWriter := NewListWriter(nil, conv.writerOpts...)
+
+	return dtype == DecodeTypeJSONSeq && listWriter.streaming() &&
+		listWriter.arrayPolicy != ArrayPolicyChildTable
+}
+
+// stream will decode the documents of the JSON sequence read from "in" as they
+// are read, and write them as CSV to "out" through an Encoder, in batches of
+// convertBatch records.
+func (conv *converter) stream(ctx context.Context, in io.Reader, out io.Writer) error {
+	in, release, err := decompress(in)
+	if err != nil {
+		return err
+	}
+
+	defer release()
+
+	dec := &decoder{}
+	for _, opt := range conv.decodeOpts {
+		opt(dec)
+	}
+
+	if dec.maxInputBytes > 0 {
+		in = &limitedInput{r: io.LimitReader(in, int64(dec.maxInputBytes)+1), limit: dec.maxInputBytes}
+	}
+
+	buffered := bufio.NewReader(in)
+
+	// UTF-16 is transcoded as a whole, so the input is decoded at once.
+	head, _ := buffered.Peek(len(bomUTF8))
+	if order, _ := utf16Order(head); order != nil {
+		return conv.convert(ctx, DecodeTypeJSONSeq, buffered, out)
+	}
+
+	if bytes.HasPrefix(head, bomUTF8) {
+		_, _ = buffered.Discard(len(bomUTF8))
+	}
+
+	var (
+		enc     *Encoder
+		batch   = &structpb.ListValue{}
+		records int
+	)
+
+	encode := func() error {
+		if enc == nil {
+			enc = NewEncoder(out, conv.writerOpts...)
+		}
+
+		err := enc.Encode(ctx, batch)
+		batch = &structpb.ListValue{}
+
+		return err
+	}
+
+	docs := json.NewDecoder(seqReader{r: buffered})
+
+	for ; ; records++ {
+		var doc json.RawMessage
+		if err := docs.Decode(&doc); errors.Is(err, io.EOF) {
+			break
+		} else if errors.Is(err, ErrInputTooLarge) {
+			return fmt.Errorf("failed to decode input: %w", err)
+		} else if err != nil {
+			return fmt.Errorf("failed to decode input: %w", invalidJSON(
+				fmt.Errorf("failed to unmarshal json sequence: document %d: %w", records, err)))
+		}
+
+		if dec.strict {
+			if err := validateStrictJSON(doc); err != nil {
+				return fmt.Errorf("failed to decode input: document %d: %w", records, err)
+			}
+		}
+
+		value, err := newJSONParser(doc).parse()
+		if err != nil {
+			return fmt.Errorf("failed to decode input: %w", invalidJSON(
+				fmt.Errorf("failed to unmarshal json sequence: document %d: %w", records, err)))
+		}
+
+		batch.Values = append(batch.Values, value)
+
+		if len(batch.Values) == convertBatch {
+			if err := encode(); err != nil {
+				return err
+			}
+		}
+	}
+
+	// An empty input is written as the ListWriter writes an empty list.
+	if records == 0 {
+		return conv.write(ctx, batch, out)
+	}
+
+	if len(batch.Values) > 0 {
+		if err := encode(); err != nil {
+			return err
+		}
+	}
+
+	return enc.Close()
+}
+
+// convert will decode all of the data read from "in" and write it as CSV to
+// "out".
+func (conv *converter) convert(ctx context.Context, dtype DecodeType, in io.Reader, out io.Writer) error {
+	list, err := conv.decode(dtype, in)
+	if err != nil {
+		return err
+	}
+
+	return conv.write(ctx, list, out)
+}
+
+// Convert decodes the data read from "in" and writes it as CSV to "out", which
+// is flushed before Convert returns. The input is decoded with the options of
+// WithDecodeOptions and written with those of WithListWriterOptions, and
+// WithConcurrency is not used. Input that is compressed with zstd is
+// decompressed. If WithMaxInputBytes is used, no more than the limit is
+// decompressed from "in" before Convert fails with ErrInputTooLarge.
+//
+// A DecodeTypeJSONSeq input is streamed: its documents are decoded as they are
+// read and written through an Encoder in batches, so the input is not held in
+// memory. As with the Encoder, a document with columns that the header does not
+// have fails with ErrSchemaChange, unless WithRepeatHeader or
+// WithOnSchemaChange is used. The input is read at once if an option needs the
+// whole table, such as WithFooter, WithGroupBy, WithSortBy, or
+// WithChildTables, or if it is UTF-16. A JSON input is always read at once.
+func Convert(ctx context.Context, dtype DecodeType, in io.Reader, out io.Writer, opts ...ConvertOption) error {
+	conv := &converter{}
+	for _, opt := range opts {
+		opt(conv)
+	}
+
+	if conv.streams(dtype) {
+		return conv.stream(ctx, in, out)
+	}
+
+	return conv.convert(ctx, dtype, in, out)
+}
+
+// ConvertFiles converts each JSON file in "inputs" to a CSV file in "outDir"
+// with the same base name and a ".csv" extension. A file that is compressed
+// with zstd is decompressed, and a ".zst" suffix is dropped from its name, so
+// "a.json.zst" is written to "a.csv". Files are converted concurrently, and a
+// failure to convert one file does not stop the others. If any file fails, the
+// returned error is a ConvertErrors with one entry per failed input. Inputs
+// that have not started when the context is canceled fail with the context's
+// error.
+func ConvertFiles(ctx context.Context, inputs []string, outDir string, opts ...ConvertOption) error {
+	conv := &converter{concurrency: runtime.GOMAXPROCS(0)}
+	for _, opt := range opts {
+		opt(conv)
+	}
+
+	if conv.concurrency < 1 {
+		conv.concurrency = 1
+	}
+
+	errs := make([]error, len(inputs))
+	outputs := make([]string, len(inputs))
+	seen := make(map[string]string, len(inputs))
+
+	for i, input := range inputs {
+		outputs[i] = outputPath(input, outDir)
+
+		if other, ok := seen[outputs[i]]; ok {
+			errs[i] = fmt.Errorf("%w: %q is also written by %q", ErrDuplicateOutput, outputs[i], other)
+		}
+
+		seen[outputs[i]] = input
+	}
+
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+
+	for n := 0; n < conv.concurrency; n++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				if err := ctx.Err(); err != nil {
+					errs[i] = err
+
+					continue
+				}
+
+				errs[i] = conv.convertFile(ctx, inputs[i], outputs[i])
+			}
+		}()
+	}
+
+	for i := range inputs {
+		if errs[i] == nil {
+			jobs <- i
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	var convertErrs ConvertErrors
+
+	for i, err := range errs {
+		if err != nil {
+			convertErrs = append(convertErrs, &ConvertError{Input: inputs[i], Err: err})
+		}
+	}
+
+	if convertErrs != nil {
+		return convertErrs
+	}
+
+	return nil
+}
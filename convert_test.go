@@ -0,0 +1,254 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConvertFiles(t *testing.T) {
+	t.Parallel()
+
+	inDir := t.TempDir()
+	outDir := t.TempDir()
+
+	files := map[string]string{
+		"a.json":   `[{"id": 1, "name": "foo"}]`,
+		"b.json":   `{"id": 2}`,
+		"bad.json": `{"id":`,
+	}
+
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(inDir, name), []byte(data), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	inputs := []string{
+		filepath.Join(inDir, "a.json"),
+		filepath.Join(inDir, "bad.json"),
+		filepath.Join(inDir, "b.json"),
+		filepath.Join(inDir, "missing.json"),
+		filepath.Join(inDir, "a.json"),
+	}
+
+	err := ConvertFiles(context.Background(), inputs, outDir,
+		WithConcurrency(2), WithListWriterOptions(WithAlphabetizeHeaders()))
+
+	var convertErrs ConvertErrors
+	if !errors.As(err, &convertErrs) {
+		t.Fatalf("got error %v, want ConvertErrors", err)
+	}
+
+	var failed []string
+	for _, err := range convertErrs {
+		failed = append(failed, filepath.Base(err.Input))
+	}
+
+	if want := []string{"bad.json", "missing.json", "a.json"}; !reflect.DeepEqual(failed, want) {
+		t.Fatalf("got failed inputs %q, want %q", failed, want)
+	}
+
+	if !errors.Is(convertErrs[2], ErrDuplicateOutput) {
+		t.Fatalf("got error %v, want %v", convertErrs[2], ErrDuplicateOutput)
+	}
+
+	for name, want := range map[string]string{
+		"a.csv": "id,name\n1.000000,foo\n",
+		"b.csv": "id\n2.000000\n",
+	} {
+		got, err := os.ReadFile(filepath.Join(outDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if string(got) != want {
+			t.Fatalf("got %q for %s, want %q", got, name, want)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		in   string
+		opts []ConvertOption
+		want string
+		err  error
+	}{
+		{
+			name: "json",
+			in:   `[{"id": 1, "name": "foo"}, {"id": 2}]`,
+			opts: []ConvertOption{WithListWriterOptions(WithAlphabetizeHeaders())},
+			want: "id,name\n1.000000,foo\n2.000000,\n",
+		},
+		{
+			name: "invalid",
+			in:   `{"id":`,
+			err:  ErrInvalidJSON,
+		},
+		{
+			name: "too large",
+			in:   `[{"id": 1}, {"id": 2}]`,
+			opts: []ConvertOption{WithDecodeOptions(WithMaxInputBytes(4))},
+			err:  ErrInputTooLarge,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out strings.Builder
+
+			err := Convert(context.Background(), DecodeTypeJSON, strings.NewReader(tcase.in), &out, tcase.opts...)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if got := out.String(); got != tcase.want {
+				t.Fatalf("got %q, want %q", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestConvertJSONSeq(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		in   string
+		opts []ConvertOption
+		want string
+		err  error
+	}{
+		{
+			name: "ndjson",
+			in:   "{\"id\": 1, \"name\": \"foo\"}\n{\"id\": 2}\n",
+			opts: []ConvertOption{WithListWriterOptions(WithAlphabetizeHeaders())},
+			want: "id,name\n1.000000,foo\n2.000000,\n",
+		},
+		{
+			name: "record separators and bom",
+			in:   "\xef\xbb\xbf\x1e{\"id\": 1}\n\x1e{\"id\": 2}\n",
+			want: "id\n1.000000\n2.000000\n",
+		},
+		{
+			name: "empty",
+			in:   "\n",
+			opts: []ConvertOption{WithListWriterOptions(WithEmptyInput(EmptyInputHeader, "id"))},
+			want: "id\n",
+		},
+		{
+			name: "whole table",
+			in:   `{"n": 1} {"n": 2}`,
+			opts: []ConvertOption{WithListWriterOptions(WithTotalsRow("n"))},
+			want: "n\n1.000000\n2.000000\n3.000000\n",
+		},
+		{
+			name: "invalid",
+			in:   `{"id": 1} {"id":`,
+			err:  ErrInvalidJSON,
+		},
+		{
+			name: "duplicate key",
+			in:   `{"id": 1} {"id": 2, "id": 3}`,
+			opts: []ConvertOption{WithDecodeOptions(WithStrictDecode())},
+			err:  ErrDuplicateKey,
+		},
+		{
+			name: "too large",
+			in:   `{"id": 1} {"id": 2}`,
+			opts: []ConvertOption{WithDecodeOptions(WithMaxInputBytes(12))},
+			err:  ErrInputTooLarge,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var out strings.Builder
+
+			err := Convert(context.Background(), DecodeTypeJSONSeq, strings.NewReader(tcase.in), &out, tcase.opts...)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if got := out.String(); got != tcase.want {
+				t.Fatalf("got %q, want %q", got, tcase.want)
+			}
+		})
+	}
+}
+
+// notifyWriter closes "written" on its first write.
+type notifyWriter struct {
+	bytes.Buffer
+	written chan struct{}
+	once    sync.Once
+}
+
+func (w *notifyWriter) Write(data []byte) (int, error) {
+	w.once.Do(func() { close(w.written) })
+
+	return w.Buffer.Write(data)
+}
+
+func TestConvertJSONSeqStreams(t *testing.T) {
+	t.Parallel()
+
+	reader, writer := io.Pipe()
+	out := &notifyWriter{written: make(chan struct{})}
+	errs := make(chan error, 1)
+
+	go func() {
+		errs <- Convert(context.Background(), DecodeTypeJSONSeq, reader, out)
+	}()
+
+	for i := 0; i < convertBatch; i++ {
+		fmt.Fprintf(writer, "{\"id\": %d}\n", i)
+	}
+
+	// The first batch is written before the end of the input is read.
+	select {
+	case <-out.written:
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was written before the end of the input")
+	}
+
+	fmt.Fprintf(writer, "{\"id\": %d}\n", convertBatch)
+	writer.Close()
+
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if lines := strings.Count(out.String(), "\n"); lines != convertBatch+2 {
+		t.Fatalf("got %d lines, want %d", lines, convertBatch+2)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var (
+	// ErrHeaderConflict is returned when two headers cannot both be
+	// represented in the output, e.g. "foo" and "foo.bar" when converting
+	// CSV to JSON.
+	ErrHeaderConflict = fmt.Errorf("header conflict")
+
+	// ErrInvalidCSV is returned when the CSV to convert cannot be parsed.
+	// The parser's error is wrapped.
+	ErrInvalidCSV = fmt.Errorf("invalid csv")
+)
+
+// invalidCSV will categorize the error from the CSV parser as ErrInvalidCSV.
+func invalidCSV(err error) error {
+	return &categoryError{category: ErrInvalidCSV, err: err}
+}
+
+type csvToJSON struct {
+	ndjson bool
+	keys   *keyEscaper
+}
+
+// CSVToJSONOption is used to configure CSVToJSON.
+type CSVToJSONOption func(*csvToJSON)
+
+// WithNDJSON configures CSVToJSON to write newline-delimited JSON, one object
+// per line, rather than a single JSON array.
+func WithNDJSON() CSVToJSONOption {
+	return func(conv *csvToJSON) {
+		conv.ndjson = true
+	}
+}
+
+// setPath will set the value at the dotted path in the given object, creating
+// nested objects along the way.
+func setPath(obj map[string]any, path []string, value string) error {
+	key := path[0]
+
+	if len(path) == 1 {
+		if _, ok := obj[key]; ok {
+			return fmt.Errorf("%w: %q", ErrHeaderConflict, key)
+		}
+
+		obj[key] = value
+
+		return nil
+	}
+
+	child, ok := obj[key]
+	if !ok {
+		child = make(map[string]any)
+		obj[key] = child
+	}
+
+	childObj, ok := child.(map[string]any)
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrHeaderConflict, key)
+	}
+
+	return setPath(childObj, path[1:], value)
+}
+
+// CSVToJSON reads CSV data from "r", treating the first record as the header,
+// and writes the records to "w" as a JSON array of objects. Dotted headers
+// such as "foo.bar" are reconstructed into nested objects, which makes this the
+// inverse of the flattening done by the ListWriter. Cell values are written as
+// JSON strings. Headers that conflict fail with ErrHeaderConflict before
+// anything is written.
+func CSVToJSON(r io.Reader, w io.Writer, opts ...CSVToJSONOption) error {
+	conv := &csvToJSON{}
+	for _, opt := range opts {
+		opt(conv)
+	}
+
+	reader := csv.NewReader(r)
+
+	header, err := reader.Read()
+	if errors.Is(err, io.EOF) {
+		header = nil
+	} else if err != nil {
+		return invalidCSV(fmt.Errorf("failed to read csv header: %w", err))
+	}
+
+	paths := make([][]string, len(header))
+	for i, h := range header {
+		paths[i] = conv.keys.splitPath(h)
+	}
+
+	// The header is checked before anything is written, so that a conflict
+	// does not leave a partial document behind.
+	probe := make(map[string]any)
+	for _, path := range paths {
+		if err := setPath(probe, path, ""); err != nil {
+			return fmt.Errorf("invalid csv header: %w", err)
+		}
+	}
+
+	if !conv.ndjson {
+		if _, err := io.WriteString(w, "["); err != nil {
+			return writerFailed(fmt.Errorf("failed to write json: %w", err))
+		}
+	}
+
+	for count := 0; header != nil; count++ {
+		record, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return invalidCSV(fmt.Errorf("failed to read csv record: %w", err))
+		}
+
+		obj := make(map[string]any)
+
+		for i, cell := range record {
+			if err := setPath(obj, paths[i], cell); err != nil {
+				return fmt.Errorf("failed to build json object: %w", err)
+			}
+		}
+
+		data, err := json.Marshal(obj)
+		if err != nil {
+			return fmt.Errorf("failed to marshal json object: %w", err)
+		}
+
+		switch {
+		case conv.ndjson:
+			data = append(data, '\n')
+		case count > 0:
+			data = append([]byte{','}, data...)
+		}
+
+		if _, err := w.Write(data); err != nil {
+			return writerFailed(fmt.Errorf("failed to write json: %w", err))
+		}
+	}
+
+	if !conv.ndjson {
+		if _, err := io.WriteString(w, "]\n"); err != nil {
+			return writerFailed(fmt.Errorf("failed to write json: %w", err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCSVToJSON(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		opts    []CSVToJSONOption
+		want    string
+		wantErr error
+	}{
+		{
+			name: "empty",
+			data: "",
+			want: "[]\n",
+		},
+		{
+			name: "header only",
+			data: "id,name\n",
+			want: "[]\n",
+		},
+		{
+			name: "flat",
+			data: "id,name\n1,foo\n2,bar\n",
+			want: `[{"id":"1","name":"foo"},{"id":"2","name":"bar"}]` + "\n",
+		},
+		{
+			name: "nested",
+			data: "id,age.foo.bar,age.baz\n1,qux,quux\n",
+			want: `[{"age":{"baz":"quux","foo":{"bar":"qux"}},"id":"1"}]` + "\n",
+		},
+		{
+			name: "ndjson",
+			data: "id,name\n1,foo\n2,bar\n",
+			opts: []CSVToJSONOption{WithNDJSON()},
+			want: `{"id":"1","name":"foo"}` + "\n" + `{"id":"2","name":"bar"}` + "\n",
+		},
+		{
+			name: "escaped dots",
+			data: `a\.b,a.b,c\\d` + "\n1,2,3\n",
+			opts: []CSVToJSONOption{WithCSVDotEscape(DefaultDotEscape)},
+			want: `[{"a":{"b":"2"},"a.b":"1","c\\d":"3"}]` + "\n",
+		},
+		{
+			name:    "conflicting headers",
+			data:    "foo,foo.bar\n1,2\n",
+			wantErr: ErrHeaderConflict,
+		},
+		{
+			name:    "conflicting headers without records",
+			data:    "a,a.b\n",
+			wantErr: ErrHeaderConflict,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+
+			err := CSVToJSON(strings.NewReader(tcase.data), &buf, tcase.opts...)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+
+			if tcase.wantErr != nil {
+				if buf.Len() > 0 {
+					t.Fatalf("got output %q on error, want none", buf.String())
+				}
+
+				return
+			}
+
+			if got := buf.String(); got != tcase.want {
+				t.Fatalf("got %q, want %q", got, tcase.want)
+			}
+		})
+	}
+}
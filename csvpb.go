@@ -12,399 +12,956 @@ package csvpb
 import (
 	"context"
 	"fmt"
-	"math"
-	"sort"
 	"strings"
+	"time"
 
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-// ErrUnsupportedValueType is returned when a value type is not supported.
-var ErrUnsupportedValueType = fmt.Errorf("unsupported value type")
+var (
+	// ErrUnsupportedValueType is returned when a value type is not
+	// supported.
+	ErrUnsupportedValueType = fmt.Errorf("unsupported value type")
 
-type column struct {
-	parent *column
-	header string
-	order  int
-	data   []string
-	rowNum int
+	// ErrTooManyColumns is returned when the flattened data has more
+	// columns than the limit set by WithMaxColumns, or than a
+	// SQLiteWriter can insert.
+	ErrTooManyColumns = fmt.Errorf("too many columns")
+
+	// ErrWriterFailed is returned when the underlying Writer fails to
+	// write a record. The Writer's error is wrapped.
+	ErrWriterFailed = fmt.Errorf("writer failed")
+
+	// ErrRowTooWide is returned when a row has more cells than the
+	// header, e.g. a footer.
+	ErrRowTooWide = fmt.Errorf("row has more cells than the header")
+)
+
+// categoryError is an error that also matches the sentinel for its category
+// with errors.Is, without changing its message.
+type categoryError struct {
+	category error
+	err      error
 }
 
-// root is the root of the column tree, the oldest ancestor.
-func (col *column) root() *column {
-	if col.parent == nil {
-		return col
-	}
+func (e *categoryError) Error() string {
+	return e.err.Error()
+}
 
-	return col.parent.root()
+func (e *categoryError) Unwrap() error {
+	return e.err
 }
 
-func (col *column) currentRowNum() int {
-	return col.root().rowNum
+func (e *categoryError) Is(target error) bool {
+	return target == e.category
 }
 
-func (col *column) updateRowNum() {
-	col.root().rowNum++
+// writerFailed will categorize the error from a Writer as ErrWriterFailed.
+func writerFailed(err error) error {
+	return &categoryError{category: ErrWriterFailed, err: err}
 }
 
-type columns struct {
-	m             map[string]*column
-	buf           int
-	currentColNum int
+// TooManyColumnsError is returned when the flattened data has more columns
+// than the limit set by WithMaxColumns. It matches ErrTooManyColumns with
+// errors.Is. Flattening stops at the first column over the limit, so that a
+// pathological record is not flattened in full.
+type TooManyColumnsError struct {
+	// Columns is the number of columns found when flattening stopped.
+	Columns int
+
+	// Limit is the limit set by WithMaxColumns.
+	Limit int
+
+	// Column is the header of the first column over the limit.
+	Column string
 }
 
-type columnsOpt func(*columns)
+func (e *TooManyColumnsError) Error() string {
+	return fmt.Sprintf("%v: %d columns exceeds the limit of %d at column %q",
+		ErrTooManyColumns, e.Columns, e.Limit, e.Column)
+}
 
-func newColumns(opts ...columnsOpt) *columns {
-	cols := &columns{m: make(map[string]*column)}
+func (e *TooManyColumnsError) Is(target error) bool {
+	return target == ErrTooManyColumns
+}
 
-	for _, opt := range opts {
-		opt(cols)
+// DefaultScalarColumn is the header used for top-level values in a list that
+// are not objects, e.g. the elements of [1, 2, 3].
+const DefaultScalarColumn = "value"
+
+// Writer is a CSV writer.
+type Writer interface {
+	Write(record []string) error
+}
+
+// HeaderWriter is a Writer that is told which records are headers. The
+// ListWriter writes the header of every table with WriteHeader, rather than
+// Write, if the Writer implements it.
+type HeaderWriter interface {
+	Writer
+	WriteHeader(header []string) error
+}
+
+// writeHeaderRecord will write the header with WriteHeader if the writer is a
+// HeaderWriter, and as a record otherwise.
+func writeHeaderRecord(writer Writer, header []string) error {
+	if hw, ok := writer.(HeaderWriter); ok {
+		return hw.WriteHeader(header)
 	}
 
-	return cols
+	return writer.Write(header)
 }
 
-func withBuf(buf int) columnsOpt {
-	return func(cols *columns) {
-		cols.buf = buf
+// ListWriter is used to write a structpb.ListValue to CSV, using a CSV writer.
+type ListWriter struct {
+	alphabetizeHeaders bool
+	columnGroups       [][]string
+	asciiHeaders       bool
+	dupHeaderError     bool
+	maxColumns         int
+	footer             func(Table) []string
+	groupBy            *groupBy
+	scalarColumn       string
+	coercions          map[string]Kind
+	fieldMask          maskTree
+	warn               func(error)
+	onSchemaChange     func(added, removed []string) error
+	repeatHeader       bool
+	internValues       bool
+	spillDir           string
+	spillLimit         int64
+	sortBy             []string
+	checkpoint         CheckpointStore
+	progress           func(written, total int)
+	inputSchema        *jsonSchema
+	inputSchemaErr     error
+	filters            []*celExpr
+	computed           []*computedColumn
+	headerSeparator    []string
+	excel              *excelProfile
+	timeZone           *time.Location
+	timeZones          map[string]*time.Location
+	boolFormat         *boolFormat
+	valueMaps          map[string]map[string]string
+	lookups            []*lookup
+	splits             []*splitColumn
+	concats            []*concatColumn
+	openChild          func(table string) (Writer, error)
+	arrayPolicy        ArrayPolicy
+	keyEscaper         *keyEscaper
+	commentHeader      []string
+	beforeRow          func(index int, row []string) (bool, error)
+	rowIndex           int
+	columnTransforms   map[string][]func(string) string
+	zstd               bool
+	emptyInput         EmptyInput
+	emptyHeader        []string
+	sample             *sampler
+	cardinalityLimit   int
+	registry           SchemaRegistry
+	rejects            *rejectWriter
+	dedup              *dedupKey
+	dedupKeys          []string
+	nullThresholds     map[string]float64
+	rateLimit          *rateLimiter
+	recordSizes        *recordSizes
+	metrics            Metrics
+	counts             *writeCounts
+	formatters         []func(ValueFormatter) ValueFormatter
+	base64Columns      map[string]Base64Output
+	recordIDColumn     string
+	arrayIndexColumn   string
+	explodeDepth       int
+	sidecar            *sidecar
+	deterministic      bool
+	rounding           *rounding
+	percentColumns     map[string]int
+	currencyColumns    map[string]string
+	dropKinds          map[Kind]bool
+	writer             Writer
+}
+
+// ListWriterOption is used to configure the ListWriter.
+type ListWriterOption func(*ListWriter)
+
+// NewListWriter creates a new ListWriter for writing a structpb.ListValue to
+// CSV.
+func NewListWriter(writer Writer, opts ...ListWriterOption) *ListWriter {
+	listWriter := &ListWriter{
+		scalarColumn: DefaultScalarColumn,
+		explodeDepth: -1,
+		writer:       writer,
 	}
+
+	for _, opt := range opts {
+		opt(listWriter)
+	}
+
+	return listWriter
 }
 
-func (cols *columns) reorderAlphabetically() {
-	columns := make([]*column, len(cols.m))
-	for _, column := range cols.m {
-		columns[column.order] = column
+// Reset discards any state accumulated by previous writes and directs future
+// writes to "writer", so that a pooled ListWriter can be reused. The options
+// given to NewListWriter are retained, and the ListWriter then writes as if it
+// had just been created with them: e.g. WithSample selects the same records
+// again, the WithRateLimit bucket is full, and the header of WithRejectWriter
+// is written again. State kept outside of the ListWriter, such as the
+// KeyStore of WithDedupKey, is not reset.
+func (w *ListWriter) Reset(writer Writer) {
+	w.writer = writer
+	w.rowIndex = 0
+	w.dedupKeys = nil
+
+	if w.sample != nil {
+		w.sample.state = w.sample.seed
 	}
 
-	// sort the columns alphabetically
-	sort.Slice(columns, func(i, j int) bool {
-		return columns[i].header < columns[j].header
-	})
+	if w.rateLimit != nil {
+		w.rateLimit.tokens = w.rateLimit.rate
+		w.rateLimit.last = time.Time{}
+	}
 
-	// update the order
-	for i, column := range columns {
-		column.order = i
+	if w.recordSizes != nil {
+		w.recordSizes.top = nil
 	}
 
-	// update the map
-	cols.m = make(map[string]*column)
-	for _, column := range columns {
-		cols.m[column.header] = column
+	if w.counts != nil {
+		*w.counts = writeCounts{}
+	}
+
+	if w.sidecar != nil {
+		w.sidecar.start(nil)
+	}
+
+	if w.rejects != nil {
+		w.rejects.headerWritten = false
 	}
 }
 
-func (cols *columns) addChildColumn(parent *column, header string) {
-	if _, ok := cols.m[header]; ok {
-		return
+// WithRecordID configures the ListWriter to add a column with the given header
+// to every row, holding the number of the record the row came from, counted
+// from 1 in the order the records are written. Since the objects in an array
+// are written to successive rows, this lets consumers regroup the rows of a
+// source record. The Encoder continues the count across lists. A record with a
+// field at the path of the header fails with ErrHeaderConflict.
+func WithRecordID(header string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.recordIDColumn = header
 	}
+}
 
-	cols.m[header] = &column{
-		parent: parent,
-		header: header,
+// WithArrayIndex configures the ListWriter to add a column with the given
+// header to every row, holding the position of the row among the rows of its
+// record, counted from 0. For a record with a single array of objects, this is
+// the index of the object in the array. A record with a field at the path of
+// the header fails with ErrHeaderConflict.
+func WithArrayIndex(header string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.arrayIndexColumn = header
 	}
 }
 
-func (cols *columns) addColumn(header string) {
-	cols.addChildColumn(nil, header)
+// WithExplodeDepth configures the ListWriter to write the objects of arrays to
+// successive rows only for the first "n" levels of nested arrays. Arrays that
+// are nested more deeply are written to a single cell as JSON, which keeps
+// deeply nested payloads from multiplying into unusable numbers of rows. With
+// a depth of 0, no arrays are exploded. By default, all levels are exploded.
+func WithExplodeDepth(n int) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.explodeDepth = n
+	}
 }
 
-func (cols *columns) addChildData(parent *column, key string, data string) {
-	// If the column doesn't exist, then we need to create it.
-	if _, ok := cols.m[key]; !ok {
-		cols.addChildColumn(parent, key)
+// WithDeterministic configures the ListWriter to write byte-identical output
+// for the same input on every run, e.g. for golden files in tests. The fields
+// of each object are visited in order of their keys, so that the columns,
+// which are ordered by when they are first seen, do not depend on map
+// iteration. Cells are always formatted the same way, with numbers written
+// with six decimal places, so no other option is needed. The timestamp of
+// WithMetadataSidecar still varies.
+func WithDeterministic() ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.deterministic = true
 	}
+}
 
-	// If the data is empty update it to be the size of the buffer.
-	if len(cols.m[key].data) == 0 {
-		cols.m[key].data = make([]string, cols.buf)
-		cols.m[key].order = cols.currentColNum
-		cols.currentColNum++
+// WithAlphabetizeHeaders configures the ListWriter to alphabetize the headers
+// when writing the CSV.
+func WithAlphabetizeHeaders() ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.alphabetizeHeaders = true
 	}
+}
 
-	col := cols.m[key]
+// WithMaxColumns configures the ListWriter to return a *TooManyColumnsError,
+// without writing anything, when the flattened data has more than "n" columns.
+func WithMaxColumns(n int) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.maxColumns = n
+	}
+}
 
-	col.data[col.currentRowNum()] = data
+// WithFooter configures the ListWriter to write a final row after all of the
+// data rows, e.g. column totals. The footer function is given the flattened
+// table that was written.
+func WithFooter(footer func(Table) []string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.footer = footer
+	}
 }
 
-func (cols *columns) addData(key string, data string) {
-	cols.addChildData(nil, key, data)
+// WithTotalsRow configures the ListWriter to write a footer row with the sum
+// of the numeric values in each of the given columns. If the first column is
+// not totaled, its cell is labeled "TOTAL".
+func WithTotalsRow(columns ...string) ListWriterOption {
+	totaled := make(map[string]bool, len(columns))
+	for _, column := range columns {
+		totaled[column] = true
+	}
+
+	return WithFooter(func(table Table) []string {
+		row := make([]string, len(table.Header))
+
+		for i, header := range table.Header {
+			if totaled[header] {
+				row[i] = fmt.Sprintf("%f", table.Stats[header].Sum)
+			}
+		}
+
+		if len(row) > 0 && !totaled[table.Header[0]] {
+			row[0] = "TOTAL"
+		}
+
+		return row
+	})
 }
 
-// trimParents will trim the parent data from the columns.
-func (cols *columns) trimParents() {
-	for _, column := range cols.m {
-		if len(column.data) == 0 {
-			delete(cols.m, column.header)
+// WithGroupBy configures the ListWriter to write one row per distinct
+// combination of the "keys" columns, with each column in "aggs" reduced by its
+// AggFunc. The output columns are the keys followed by the aggregated columns
+// in alphabetical order. Column statistics given to a footer describe the data
+// before it was grouped.
+//
+// The numbers of the aggregated columns are given to their AggFunc as they
+// are, before formatting such as WithPercentColumns or WithCurrencyColumns, and
+// a numeric aggregate of such a column is then formatted as its cells are.
+func WithGroupBy(keys []string, aggs map[string]AggFunc) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.groupBy = &groupBy{keys: keys, aggs: aggs}
+	}
+}
+
+// WithWarningHandler configures the ListWriter to report recoverable problems,
+// such as cells that cannot be coerced, to "handler" instead of failing the
+// write.
+func WithWarningHandler(handler func(warning error)) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.warn = handler
+	}
+}
+
+// WithValueInterning configures the ListWriter to share the memory of equal
+// cells in a column when it buffers the whole table, e.g. for WithFooter or
+// WithGroupBy. This greatly reduces the memory held by columns with few
+// distinct values, such as enums or country codes, at the cost of a map lookup
+// per cell.
+func WithValueInterning() ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.internValues = true
+	}
+}
+
+// internCells will replace each cell of the row with the equal string from
+// its column's dictionary, adding the cells that are not yet in it. Cells are
+// copied into the dictionary so that they do not keep the row they were
+// sliced from alive.
+func internCells(dicts []map[string]string, row []string) {
+	for i, cell := range row {
+		if interned, ok := dicts[i][cell]; ok {
+			row[i] = interned
+
+			continue
 		}
+
+		cell = strings.Clone(cell)
+		dicts[i][cell] = cell
+		row[i] = cell
 	}
 }
 
-func (cols *columns) addStruct(key string, obj *structpb.Struct) error {
-	cols.addColumn(key)
+// appendValue will append a scalar value at the given flattened path to the
+// buffer, applying any coercion configured for the column.
+func (w *ListWriter) appendValue(buf []byte, path string, value *structpb.Value) ([]byte, error) {
+	start := len(buf)
 
-	// Add the parent column to the columns.
-	focus := cols
-	if key != "" {
-		// If the key is not empty, then that means that we are in a
-		// nested object. To deal with this case, we create a new object
-		// and add it to the columns.
-		focus = newColumns(withBuf(rowBufferForStruct(obj)))
+	if mapped, ok := w.mapValue(path, value); ok {
+		value = mapped
 	}
 
-	for fieldName, fieldValue := range obj.GetFields() {
-		err := focus.addChildValue(focus.m[key], fieldName, fieldValue)
-		if err != nil {
-			return fmt.Errorf("failed to add struct value: %w", err)
+	buf, err := w.appendCell(buf, path, value)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.timeZone != nil || w.timeZones != nil {
+		buf = w.convertTimeZone(buf, start, path, value)
+	}
+
+	if w.columnTransforms != nil {
+		buf = w.transformCell(buf, start, path)
+	}
+
+	if w.excel != nil {
+		buf = w.excel.escapeCell(buf, start, value)
+	}
+
+	return buf, nil
+}
+
+// appendCell will append the cell for a scalar value, coerced if the column
+// has a coercion.
+func (w *ListWriter) appendCell(buf []byte, path string, value *structpb.Value) ([]byte, error) {
+	if output, ok := w.base64Columns[path]; ok {
+		var err error
+		if value, err = w.decodeBase64Value(path, output, value); err != nil {
+			return nil, err
 		}
 	}
 
-	if focus != cols {
-		for _, subColumn := range focus.m {
-			// If the subColumn has no data, then do nothing.
-			if len(subColumn.data) == 0 {
-				continue
+	if code, ok := w.currencyColumns[path]; ok {
+		if buf, ok := w.appendCurrency(buf, value, code); ok {
+			return buf, nil
+		}
+	}
+
+	if decimals, ok := w.percentColumns[path]; ok {
+		if buf, ok := w.appendPercent(buf, value, decimals); ok {
+			return buf, nil
+		}
+	}
+
+	if kind, ok := w.coercions[path]; ok {
+		// Booleans and numbers are coerced here so that they are
+		// rendered in the configured format.
+		if kind == KindBool {
+			if b, ok := parseBool(value); ok {
+				return w.appendBool(buf, b), nil
 			}
+		}
 
-			newFieldName := fmt.Sprintf("%s.%s", key, subColumn.header)
+		if kind == KindNumber && w.rounding != nil {
+			if num, ok := parseNumber(value); ok {
+				return w.rounding.appendNumber(buf, num), nil
+			}
+		}
 
-			parent := cols.m[key]
-			cols.addChildData(parent, newFieldName, subColumn.data[0])
+		cell, err := coerce(value, kind)
+		if err == nil {
+			return append(buf, cell...), nil
 		}
+
+		err = fmt.Errorf("failed to coerce column %q: %w", path, err)
+		if w.warn == nil {
+			return nil, err
+		}
+
+		w.warn(err)
 	}
 
-	// If there is no column, there is nothing to update.
-	if cols.m[key] != nil {
-		cols.m[key].updateRowNum()
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_BoolValue:
+		return w.appendBool(buf, valType.BoolValue), nil
+	case *structpb.Value_NumberValue:
+		if w.rounding != nil {
+			return w.rounding.appendNumber(buf, valType.NumberValue), nil
+		}
 	}
 
-	return nil
+	return appendValue(buf, value), nil
 }
 
-//nolint:cyclop
-func (cols *columns) addList(key string, list *structpb.ListValue) error {
-	var buf strings.Builder
-
-	const minBufLen = 3
+// WithScalarColumn configures the header used for top-level values in a list
+// that are not objects. The default is DefaultScalarColumn.
+func WithScalarColumn(header string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.scalarColumn = header
+	}
+}
 
-	buf.WriteString("[")
+// wrapScalars will return a list where every top-level value that is not an
+// object is wrapped in an object with a single scalar column, so that it is
+// written as its own row.
+func (w *ListWriter) wrapScalars(list *structpb.ListValue) *structpb.ListValue {
+	var wrapped *structpb.ListValue
 
 	for i, value := range list.GetValues() {
-		// Stringify the value.
-		switch valType := value.Kind.(type) {
-		case *structpb.Value_StringValue:
-			buf.WriteString(valType.StringValue)
-		case *structpb.Value_NumberValue:
-			buf.WriteString(fmt.Sprintf("%f", valType.NumberValue))
-		case *structpb.Value_BoolValue:
-			buf.WriteString(fmt.Sprintf("%t", valType.BoolValue))
-		case *structpb.Value_NullValue:
-			buf.WriteString("")
-		case *structpb.Value_StructValue:
-			err := cols.addStruct(key, valType.StructValue)
-			if err != nil {
-				return fmt.Errorf("failed to add list value: %w", err)
+		if _, ok := value.Kind.(*structpb.Value_StructValue); ok {
+			continue
+		}
+
+		// Only copy the list if there is something to wrap.
+		if wrapped == nil {
+			wrapped = &structpb.ListValue{
+				Values: append([]*structpb.Value{}, list.GetValues()...),
 			}
+		}
 
-			// In the struct case, we need to exclude the key
-			// from being added to the list.
-			continue
-		default:
-			return fmt.Errorf("%w: %T", ErrUnsupportedValueType, valType)
+		wrapped.Values[i] = structpb.NewStructValue(&structpb.Struct{
+			Fields: map[string]*structpb.Value{w.scalarColumn: value},
+		})
+	}
+
+	if wrapped == nil {
+		return list
+	}
+
+	return wrapped
+}
+
+// Table is the flattened, tabular form of a structpb.ListValue, as it is
+// written to CSV.
+type Table struct {
+	// Header is the column headers, in output order.
+	Header []string
+
+	// Rows is the data, with one cell per header in each row.
+	Rows [][]string
+
+	// Stats are the statistics collected for each column, keyed by
+	// header.
+	Stats map[string]ColumnStats
+
+	// LargestRecords are the largest records, largest first, if
+	// WithLargestRecords is used.
+	LargestRecords []RecordSize
+}
+
+// prepare will sample, validate and filter the records of the list, add the
+// computed and lookup columns, split and concatenate columns, apply the field
+// mask, wrap its top-level scalars, so that every record is an object, and
+// skip the records whose dedup keys were seen.
+func (w *ListWriter) prepare(ctx context.Context, list *structpb.ListValue) (*structpb.ListValue, error) {
+	if w.arrayPolicy == ArrayPolicyChildTable && w.openChild == nil {
+		return nil, fmt.Errorf("%w: %s requires WithChildTables", ErrInvalidArrayPolicy, w.arrayPolicy)
+	}
+
+	if w.sample != nil {
+		list = w.sample.apply(list)
+	}
+
+	if w.inputSchema != nil || w.inputSchemaErr != nil {
+		var err error
+		if list, err = w.validateRecords(list); err != nil {
+			return nil, err
 		}
+	}
 
-		if i != len(list.GetValues())-1 {
-			buf.WriteString(",")
+	if len(w.filters) > 0 || len(w.computed) > 0 {
+		var err error
+		if list, err = w.applyCEL(list); err != nil {
+			return nil, err
 		}
 	}
 
-	buf.WriteString("]")
+	if len(w.lookups) > 0 {
+		list = w.applyLookups(list)
+	}
 
-	// If the buffer is greater than two (i.e. []), then we need to add
-	// the data to the column.
-	if buf.Len() >= minBufLen {
-		cols.addData(key, buf.String())
+	if len(w.splits) > 0 {
+		list = w.applySplits(list)
 	}
 
-	return nil
-}
+	if len(w.concats) > 0 {
+		list = w.applyConcats(list)
+	}
 
-func (cols *columns) addChildValue(parent *column, key string, value *structpb.Value) error {
-	switch valType := value.Kind.(type) {
-	case *structpb.Value_NullValue:
-		cols.addChildData(parent, key, "")
-	case *structpb.Value_NumberValue:
-		cols.addChildData(parent, key, fmt.Sprintf("%f", valType.NumberValue))
-	case *structpb.Value_StringValue:
-		cols.addChildData(parent, key, valType.StringValue)
-	case *structpb.Value_BoolValue:
-		cols.addChildData(parent, key, fmt.Sprintf("%t", valType.BoolValue))
-	case *structpb.Value_StructValue:
-		return cols.addStruct(key, valType.StructValue)
-	case *structpb.Value_ListValue:
-		return cols.addList(key, valType.ListValue)
-	default:
-		return fmt.Errorf("%w: %T", ErrUnsupportedValueType, valType)
+	if w.fieldMask != nil {
+		list = pruneValue(structpb.NewListValue(list), w.fieldMask).GetListValue()
 	}
 
-	return nil
+	if len(w.dropKinds) > 0 {
+		list = dropFields(structpb.NewListValue(list), w.dropKinds).GetListValue()
+	}
+
+	list = w.wrapScalars(list)
+
+	if w.rejects != nil && len(w.coercions) > 0 {
+		var err error
+		if list, err = w.rejectUncoercible(list); err != nil {
+			return nil, err
+		}
+	}
+
+	if w.dedup != nil {
+		var err error
+		if list, w.dedupKeys, err = w.dedup.skipSeen(ctx, list); err != nil {
+			return nil, err
+		}
+	}
+
+	return list, nil
 }
 
-func (cols *columns) addValue(key string, value *structpb.Value) error {
-	switch valType := value.Kind.(type) {
-	case *structpb.Value_NullValue:
-		cols.addData(key, "")
-	case *structpb.Value_NumberValue:
-		cols.addData(key, fmt.Sprintf("%f", valType.NumberValue))
-	case *structpb.Value_StringValue:
-		cols.addData(key, valType.StringValue)
-	case *structpb.Value_BoolValue:
-		cols.addData(key, fmt.Sprintf("%t", valType.BoolValue))
-	case *structpb.Value_StructValue:
-		return cols.addStruct(key, valType.StructValue)
-	case *structpb.Value_ListValue:
-		return cols.addList(key, valType.ListValue)
-	default:
-		return fmt.Errorf("%w: %T", ErrUnsupportedValueType, valType)
+// columnsOpts will return the options of the columns that the prepared list is
+// flattened into, followed by "opts".
+func (w *ListWriter) columnsOpts(list *structpb.ListValue, opts ...columnsOpt) []columnsOpt {
+	format := w.cellFormat()
+	if w.groupBy != nil {
+		format = w.aggFormat(format)
 	}
 
-	return nil
+	return append([]columnsOpt{
+		withBuf(rowBufferForList(list)),
+		withFormat(format),
+		withKeys(w.recordIDColumn, w.arrayIndexColumn),
+		withExplodeDepth(w.explodeDepth),
+		withSortedFields(w.deterministic),
+		withMaxColumns(w.maxColumns),
+		withArrayPolicy(w.arrayPolicy),
+		withKeyEscaper(w.keyEscaper),
+		withCardinalityLimit(w.cardinalityLimit, w.warnCardinality),
+	}, opts...)
 }
 
-// Writer is a CSV writer.
-type Writer interface {
-	Write(record []string) error
+// columns flattens the prepared list into columns.
+func (w *ListWriter) columns(list *structpb.ListValue, opts ...columnsOpt) (*columns, error) {
+	// columns is a map of column headers to the column data.
+	columns := newColumns(w.columnsOpts(list, opts...)...)
+
+	for _, value := range list.GetValues() {
+		err := columns.addValue("", value)
+		if err != nil {
+			return nil, columns.closeSpill(fmt.Errorf("failed to add value: %w", err))
+		}
+	}
+
+	// Reorder the columns by their groups, or in alphabetical order.
+	if less := w.headerLess(); less != nil {
+		columns.reorder(less)
+	}
+
+	if len(w.nullThresholds) > 0 {
+		if err := w.checkNullRates(columns); err != nil {
+			return nil, columns.closeSpill(err)
+		}
+	}
+
+	return columns, nil
 }
 
-// ListWriter is used to write a structpb.ListValue to CSV, using a CSV writer.
-type ListWriter struct {
-	alphabetizeHeaders bool
-	writer             Writer
+// spillOpts will return the options of the columns of a buffered table, which
+// move its rows to a spill store if WithSpill is used.
+func (w *ListWriter) spillOpts() []columnsOpt {
+	if w.spillLimit <= 0 {
+		return nil
+	}
+
+	return []columnsOpt{withSpill(&rowStore{dir: w.spillDir, memLimit: w.spillLimit})}
 }
 
-// ListWriterOption is used to configure the ListWriter.
-type ListWriterOption func(*ListWriter)
+// table formats all of the columns into a Table. The rows are buffered in the
+// returned store, which must be closed, and are only held in the Table if they
+// were not spilled.
+func (w *ListWriter) table(columns *columns) (*Table, *rowStore, error) {
+	ordered := columns.ordered()
 
-// NewListWriter creates a new ListWriter for writing a structpb.ListValue to
-// CSV.
-func NewListWriter(writer Writer, opts ...ListWriterOption) *ListWriter {
-	listWriter := &ListWriter{
-		writer: writer,
+	table := &Table{
+		Header:         make([]string, len(ordered)),
+		Stats:          make(map[string]ColumnStats, len(ordered)),
+		LargestRecords: w.recordSizes.largest(),
 	}
 
-	for _, opt := range opts {
-		opt(listWriter)
+	for i, column := range ordered {
+		table.Header[i] = column.header
+		table.Stats[column.header] = column.stats
 	}
 
-	return listWriter
+	var dicts []map[string]string
+	if w.internValues {
+		dicts = make([]map[string]string, len(ordered))
+		for i := range dicts {
+			dicts[i] = make(map[string]string)
+		}
+	}
+
+	store := &rowStore{dir: w.spillDir, memLimit: w.spillLimit}
+
+	// Grouped rows are sorted after they are grouped.
+	if len(w.sortBy) > 0 && w.groupBy == nil {
+		store.less = rowLess(table.Header, w.sortBy)
+	}
+
+	add := func(row []string) error {
+		if dicts != nil {
+			internCells(dicts, row)
+		}
+
+		return store.add(row)
+	}
+
+	if columns.spill != nil {
+		err := columns.movedRows(ordered)(add)
+		if err = columns.closeSpill(err); err != nil {
+			return nil, store, err
+		}
+	}
+
+	for i := columns.base; i < columns.rows; i++ {
+		row, err := columns.formatRow(ordered, i)
+		if err != nil {
+			return nil, store, fmt.Errorf("failed to format row %d: %w", i, err)
+		}
+
+		if err := add(row); err != nil {
+			return nil, store, err
+		}
+	}
+
+	store.finish()
+
+	if !store.spilled() {
+		table.Rows = store.rows
+	}
+
+	return table, store, nil
 }
 
-// WithAlphabetizeHeaders configures the ListWriter to alphabetize the headers
-// when writing the CSV.
-func WithAlphabetizeHeaders() ListWriterOption {
-	return func(listWriter *ListWriter) {
-		listWriter.alphabetizeHeaders = true
+// writeColumns writes the columns row by row, formatting each row as it is
+// written.
+func (w *ListWriter) writeColumns(ctx context.Context, columns *columns) error {
+	ordered := columns.ordered()
+
+	header := make([]string, len(ordered))
+	for i, column := range ordered {
+		header[i] = column.header
 	}
+
+	if err := w.writeHeader(w.writer, header); err != nil {
+		return err
+	}
+
+	for i := 0; i < columns.rows; i++ {
+		row, err := columns.formatRow(ordered, i)
+		if err != nil {
+			return fmt.Errorf("failed to format row %d: %w", i, err)
+		}
+
+		if err := w.writeRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
 }
 
-// rowBufferForStruct will recursively iterate over all fields and count the number
-// of columns in every nested struct.
-func rowBufferForStruct(obj *structpb.Struct) int {
-	var buf int
+// writeTable writes the buffered table, with its rows read from "rows".
+func (w *ListWriter) writeTable(ctx context.Context, table *Table, rows rowIter) error {
+	if w.groupBy != nil {
+		var err error
+		if table, err = w.groupBy.apply(table, rows, w.formatAgg); err != nil {
+			return err
+		}
 
-	for _, value := range obj.GetFields() {
-		valType := value.Kind
-		if _, ok := valType.(*structpb.Value_ListValue); !ok {
-			continue
+		if len(w.sortBy) > 0 {
+			sortRows(table.Rows, rowLess(table.Header, w.sortBy))
 		}
 
-		list, ok := valType.(*structpb.Value_ListValue)
-		if !ok {
-			continue
+		rows = sliceRows(table.Rows)
+	}
+
+	if w.registry != nil {
+		if err := w.registerSchema(ctx, table.Header, rows); err != nil {
+			return err
+		}
+	}
+
+	// Write the header data.
+	if err := w.writeHeader(w.writer, table.Header); err != nil {
+		return err
+	}
+
+	err := rows(func(row []string) error {
+		if err := w.writeRow(ctx, row); err != nil {
+			return err
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if w.footer != nil {
+		footer := w.footer(*table)
+		if len(footer) > len(table.Header) {
+			return fmt.Errorf("%w: footer has %d cells for %d columns",
+				ErrRowTooWide, len(footer), len(table.Header))
 		}
 
-		buf += rowBufferForList(list.ListValue)
+		if err := w.writer.Write(footer); err != nil {
+			return writerFailed(fmt.Errorf("failed to write csv footer: %w", err))
+		}
 	}
 
-	return int(math.Max(float64(buf), 1))
+	return nil
 }
 
-// rowBufferForList will return the number of rows that should be creatd for the given
-// structpb.Listvalue.
-func rowBufferForList(list *structpb.ListValue) int {
-	var buf int
+// writeRow writes a data row, unless the WithBeforeRow callback skips it.
+func (w *ListWriter) writeRow(ctx context.Context, row []string) error {
+	if w.beforeRow != nil {
+		index := w.rowIndex
+		w.rowIndex++
 
-	// Recursive call this function to get the number of unique columns
-	// across ALL objects in the list.
-	for _, value := range list.GetValues() {
-		valType := value.Kind
-		if _, ok := valType.(*structpb.Value_StructValue); !ok {
-			continue
+		skip, err := w.beforeRow(index, row)
+		if err != nil {
+			return fmt.Errorf("row %d: %w", index, err)
 		}
 
-		obj, ok := valType.(*structpb.Value_StructValue)
-		if !ok {
-			continue
+		if skip {
+			return nil
 		}
+	}
 
-		buf += rowBufferForStruct(obj.StructValue)
+	if w.rateLimit != nil {
+		if err := w.rateLimit.wait(ctx); err != nil {
+			return err
+		}
 	}
 
-	return buf
+	if w.sidecar != nil {
+		w.sidecar.observe(row)
+	}
+
+	if err := w.writer.Write(row); err != nil {
+		return writerFailed(fmt.Errorf("failed to write csv data: %w", err))
+	}
+
+	if w.counts != nil {
+		w.counts.rows++
+		w.counts.cells += len(row)
+	}
+
+	return nil
+}
+
+// WithBeforeRow configures the ListWriter and Encoder to call "fn" with each
+// data row before it is written, e.g. to sample, rate-limit, or veto rows. The
+// row is skipped if "fn" returns true, and the write fails if it returns an
+// error. The index counts the data rows offered to "fn", from 0 for each
+// Write of the ListWriter and for the lifetime of the Encoder. Rows are
+// offered after they are sorted and grouped, so the footer of WithFooter is
+// computed from every row, and "fn" must not retain or modify the row.
+func WithBeforeRow(fn func(index int, row []string) (skip bool, err error)) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.beforeRow = fn
+	}
 }
 
 // Write writes the ListValue to CSV.
 func (w *ListWriter) Write(ctx context.Context, list *structpb.ListValue) error {
-	rowCount := rowBufferForList(list)
+	return w.measure(func() error {
+		return w.writeTables(ctx, list)
+	})
+}
 
-	// columns is a map of column headers to the column data.
-	columns := newColumns(withBuf(rowCount))
+// writeTables writes the ListValue, and its child tables, followed by the
+// metadata sidecar.
+func (w *ListWriter) writeTables(ctx context.Context, list *structpb.ListValue) error {
+	w.rowIndex = 0
 
-	for _, value := range list.Values {
-		err := columns.addValue("", value)
-		if err != nil {
-			return fmt.Errorf("failed to add value: %w", err)
-		}
+	if len(list.GetValues()) == 0 {
+		return w.writeEmpty()
 	}
 
-	// Remove all nodes that do not contain data to write. These include
-	// parent rows for data organization.
-	columns.trimParents()
-
-	// Reorder the columns to be in alphabetical order.
-	if w.alphabetizeHeaders {
-		columns.reorderAlphabetically()
+	if w.sidecar == nil {
+		return w.write(ctx, list)
 	}
 
-	// Put the data in form of a slice of slices, where the first slice is
-	// the headers and the rest are the data.
-	data := make([][]string, len(list.Values)+1)
-	data[0] = make([]string, len(columns.m))
+	w.sidecar.start(nil)
 
-	for _, column := range columns.m {
-		data[0][column.order] = column.header
+	if err := w.write(ctx, list); err != nil {
+		return err
 	}
 
-	// Write the header data.
-	err := w.writer.Write(data[0])
+	return w.sidecar.emit(w.recordSizes.largest())
+}
+
+// write writes the ListValue, and its child tables.
+func (w *ListWriter) write(ctx context.Context, list *structpb.ListValue) error {
+	list, err := w.prepare(ctx, list)
 	if err != nil {
-		return fmt.Errorf("failed to write csv header: %w", err)
+		return err
 	}
 
-	for i := 0; i < rowCount; i++ {
-		row := make([]string, len(columns.m))
+	if w.recordSizes != nil {
+		w.recordSizes.observe(list)
+	}
 
-		for _, column := range columns.m {
-			column := column
+	if w.counts != nil {
+		w.counts.records += len(list.GetValues())
+	}
+
+	if w.arrayPolicy != ArrayPolicyChildTable {
+		err = w.writeList(ctx, list)
+	} else {
+		var children map[string]*structpb.ListValue
 
-			row[column.order] = column.data[i]
+		list, children = splitChildren(list, w.keyEscaper)
+		if err = w.writeList(ctx, list); err == nil {
+			err = w.writeChildren(ctx, children)
 		}
+	}
 
-		err := w.writer.Write(row)
+	if err != nil || w.dedup == nil {
+		return err
+	}
+
+	return w.addDedupKeys(ctx)
+}
+
+// streaming will return true if the rows can be written as they are
+// formatted, since no option needs the whole table.
+func (w *ListWriter) streaming() bool {
+	return w.footer == nil && w.groupBy == nil && len(w.sortBy) == 0 && w.registry == nil
+}
+
+// writeList writes the prepared list.
+func (w *ListWriter) writeList(ctx context.Context, list *structpb.ListValue) error {
+	streaming := w.streaming()
+
+	// Flat records do not need to be buffered into columns, unless the
+	// key columns are generated or the values are counted.
+	keyed := w.recordIDColumn != "" || w.arrayIndexColumn != ""
+	counted := w.cardinalityLimit > 0 || len(w.nullThresholds) > 0
+
+	if streaming && !keyed && !counted && isFlat(list) {
+		return w.writeFlat(ctx, list)
+	}
+
+	// Unless the whole table is needed, the rows are formatted as they
+	// are written.
+	if streaming {
+		columns, err := w.columns(list)
 		if err != nil {
-			return fmt.Errorf("failed to write csv data: %w", err)
+			return err
 		}
+
+		return w.writeColumns(ctx, columns)
 	}
 
-	return nil
+	columns, err := w.columns(list, w.spillOpts()...)
+	if err != nil {
+		return err
+	}
+
+	table, store, err := w.table(columns)
+	if err == nil {
+		err = w.writeTable(ctx, table, store.iter())
+	}
+
+	if closeErr := store.close(); err == nil {
+		err = closeErr
+	}
+
+	return err
 }
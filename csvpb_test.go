@@ -12,10 +12,24 @@ import (
 	"bytes"
 	"context"
 	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
 )
 
+// testColumn is a column with formatted data.
+type testColumn struct {
+	header string
+	order  int
+	data   []string
+}
+
 func TestColumns(t *testing.T) {
 	t.Parallel()
 
@@ -25,17 +39,17 @@ func TestColumns(t *testing.T) {
 		for _, tcase := range []struct {
 			name string
 			data []byte
-			want map[string]*column
+			want map[string]*testColumn
 		}{
 			{
 				name: "empty",
 				data: []byte(`{}`),
-				want: map[string]*column{},
+				want: map[string]*testColumn{},
 			},
 			{
 				name: "single",
 				data: []byte(`{"foo": "bar"}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo": {
 						header: "foo",
 						order:  0,
@@ -46,7 +60,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "multiple",
 				data: []byte(`{"foo": "bar", "baz": "qux"}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo": {
 						header: "foo",
 						order:  0,
@@ -62,7 +76,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "nested",
 				data: []byte(`{"foo": {"bar": "baz"}}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo.bar": {
 						header: "foo.bar",
 						order:  0,
@@ -73,7 +87,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "nested multiple",
 				data: []byte(`{"foo": {"bar": "baz", "qux": "quux"}}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo.bar": {
 						header: "foo.bar",
 						order:  0,
@@ -89,7 +103,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "many nested",
 				data: []byte(`{"foo": {"bar": "baz", "qux": "quux"}, "quux": {"quuz": "corge"}}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo.bar": {
 						header: "foo.bar",
 						order:  0,
@@ -110,7 +124,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "array of nested objects",
 				data: []byte(`[{"foo": {"bar": "baz", "qux": "quux"}}, {"foo": {"bar": "corge", "qux": "grault"}}]`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo.bar": {
 						header: "foo.bar",
 						order:  0,
@@ -126,7 +140,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "array of nested objects with different keys",
 				data: []byte(`[{"foo": {"bar": "baz", "qux": "quux"}}, {"foo": {"bar": "corge", "quuz": "grault"}}]`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo.bar": {
 						header: "foo.bar",
 						order:  0,
@@ -147,7 +161,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "object with array values of objects",
 				data: []byte(`{"foo": [{"bar": "baz"}, {"bar": "qux"}], "quux": "quuz", "corge": "grault"}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"foo.bar": {
 						header: "foo.bar",
 						order:  0,
@@ -168,7 +182,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "object with subobject",
 				data: []byte(`{"id": 1, "name": "test", "age": {"foo": "bar"}}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"id": {
 						header: "id",
 						order:  0,
@@ -189,7 +203,7 @@ func TestColumns(t *testing.T) {
 			{
 				name: "one json record with nested object",
 				data: []byte(`{"id": 1, "name": "test", "age": {"foo": {"bar": "baz"}}}`),
-				want: map[string]*column{
+				want: map[string]*testColumn{
 					"id": {
 						header: "id",
 						order:  0,
@@ -229,9 +243,13 @@ func TestColumns(t *testing.T) {
 					}
 				}
 
-				cols.trimParents()
+				for _, col := range cols.m {
+					got := &testColumn{header: col.header, order: col.order}
+					for i := range col.data {
+						cell, _ := cols.formatRow([]*column{col}, i)
+						got.data = append(got.data, cell[0])
+					}
 
-				for _, got := range cols.m {
 					want, ok := tcase.want[got.header]
 					if !ok {
 						t.Logf("got: %+v for header %q with len=%d", got, got.header, len(got.data))
@@ -306,6 +324,77 @@ func TestWrite(t *testing.T) {
 				{"1.000000", "test", "baz"},
 			},
 		},
+		{
+			name:       "nested object with the same key as its parent",
+			decodeType: DecodeTypeJSON,
+			data:       []byte(`{"a": {"a": {"b": 1}, "c": 2}}`),
+			want: [][]string{
+				{"a.a.b", "a.c"},
+				{"1.000000", "2.000000"},
+			},
+		},
+		{
+			name:       "nested object only in a later record",
+			decodeType: DecodeTypeJSON,
+			data:       []byte(`[{"id": 1}, {"id": 2, "foo": {"bar": "baz"}}]`),
+			want: [][]string{
+				{"id", "foo.bar"},
+				{"1.000000", ""},
+				{"2.000000", "baz"},
+			},
+		},
+		{
+			name:       "array of objects in a nested object",
+			decodeType: DecodeTypeJSON,
+			data:       []byte(`{"id": 1, "foo": {"items": [{"x": 1}, {"x": 2}]}}`),
+			want: [][]string{
+				{"id", "foo.items.x"},
+				{"1.000000", "1.000000"},
+				{"", "2.000000"},
+			},
+		},
+		{
+			name:       "arrays of objects in many records",
+			decodeType: DecodeTypeJSON,
+			data:       []byte(`[{"id": 1, "items": [{"x": 1}, {"x": 2}]}, {"id": 2, "items": [{"x": 3}]}]`),
+			want: [][]string{
+				{"id", "items.x"},
+				{"1.000000", "1.000000"},
+				{"", "2.000000"},
+				{"2.000000", "3.000000"},
+			},
+		},
+		{
+			name:       "scalar",
+			decodeType: DecodeTypeJSON,
+			data:       []byte(`42`),
+			want: [][]string{
+				{"value"},
+				{"42.000000"},
+			},
+		},
+		{
+			name:       "array of numbers",
+			decodeType: DecodeTypeJSON,
+			data:       []byte(`[1, 2, 3]`),
+			want: [][]string{
+				{"value"},
+				{"1.000000"},
+				{"2.000000"},
+				{"3.000000"},
+			},
+		},
+		{
+			name:       "array of mixed values",
+			decodeType: DecodeTypeJSON,
+			data:       []byte(`["a", {"id": 1}, [true, false]]`),
+			want: [][]string{
+				{"value", "id"},
+				{"a", ""},
+				{"", "1.000000"},
+				{"[true,false]", ""},
+			},
+		},
 		{
 			name:       "array of objects",
 			decodeType: DecodeTypeJSON,
@@ -385,6 +474,410 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+func TestWriteMaxColumns(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`{"id": 1, "name": "test", "age": {"foo": "bar"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	csvWriter := csv.NewWriter(&buf)
+
+	if err := NewListWriter(csvWriter, WithMaxColumns(3)).Write(context.Background(), list); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	csvWriter.Flush()
+	buf.Reset()
+
+	err = NewListWriter(csvWriter, WithMaxColumns(2)).Write(context.Background(), list)
+	if !errors.Is(err, ErrTooManyColumns) {
+		t.Fatalf("got error %v, want %v", err, ErrTooManyColumns)
+	}
+
+	var tooMany *TooManyColumnsError
+	if !errors.As(err, &tooMany) || tooMany.Columns != 3 || tooMany.Limit != 2 {
+		t.Fatalf("got error %#v, want 3 columns over the limit of 2", tooMany)
+	}
+
+	csvWriter.Flush()
+
+	if buf.Len() != 0 {
+		t.Fatalf("unexpected output: %q", buf.String())
+	}
+}
+
+func TestWriteMaxColumnsEarlyAbort(t *testing.T) {
+	t.Parallel()
+
+	// The first record alone exceeds the limit, so the rest are never
+	// flattened, which the unsupported value in the last would fail.
+	list := &structpb.ListValue{}
+
+	for _, flat := range []bool{true, false} {
+		fields := map[string]*structpb.Value{}
+		for i := 0; i < 100; i++ {
+			fields[fmt.Sprintf("col%03d", i)] = structpb.NewNumberValue(float64(i))
+		}
+
+		if !flat {
+			fields["nested"] = structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{
+				"a": structpb.NewNullValue(),
+			}})
+		}
+
+		list.Values = []*structpb.Value{
+			structpb.NewStructValue(&structpb.Struct{Fields: fields}),
+			structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{"bad": {}}}),
+		}
+
+		err := NewListWriter(&recordWriter{}, WithMaxColumns(10), WithDeterministic()).
+			Write(context.Background(), list)
+
+		var tooMany *TooManyColumnsError
+		if !errors.As(err, &tooMany) {
+			t.Fatalf("flat %v: got error %v, want a TooManyColumnsError", flat, err)
+		}
+
+		if tooMany.Columns != 11 || tooMany.Column != "col010" {
+			t.Fatalf("flat %v: got %+v, want column col010 over the limit", flat, tooMany)
+		}
+
+		var valueErr *ValueError
+		if !errors.As(err, &valueErr) || valueErr.Record != 0 {
+			t.Fatalf("flat %v: got error %v, want it in record 0", flat, err)
+		}
+	}
+}
+
+func TestWriteBeforeRow(t *testing.T) {
+	t.Parallel()
+
+	errVeto := errors.New("veto")
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		fn      func(index int, row []string) (bool, error)
+		want    [][]string
+		wantErr error
+	}{
+		{
+			name: "sample",
+			data: `[{"a": 1}, {"a": 2}, {"a": 3}, {"a": 4}]`,
+			fn: func(index int, _ []string) (bool, error) {
+				return index%2 == 1, nil
+			},
+			want: [][]string{{"a"}, {"1.000000"}, {"3.000000"}},
+		},
+		{
+			name: "exploded",
+			data: `[{"a": [{"b": 1}, {"b": 2}]}, {"a": [{"b": 3}]}]`,
+			fn: func(_ int, row []string) (bool, error) {
+				return row[0] == "2.000000", nil
+			},
+			want: [][]string{{"a.b"}, {"1.000000"}, {"3.000000"}},
+		},
+		{
+			name: "veto",
+			data: `[{"a": 1}, {"a": 2}]`,
+			fn: func(index int, _ []string) (bool, error) {
+				if index == 1 {
+					return false, errVeto
+				}
+
+				return false, nil
+			},
+			want:    [][]string{{"a"}, {"1.000000"}},
+			wantErr: errVeto,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err = NewListWriter(&dst, WithBeforeRow(tcase.fn)).Write(context.Background(), list)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+
+			if errors.Is(err, ErrWriterFailed) {
+				t.Fatalf("got error %v, which is not from the writer", err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestWriteFlat(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "name": "foo", "ok": true},
+		{"id": 2, "score": 1.5, "note": null},
+		3
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listWriter := NewListWriter(nil, WithAlphabetizeHeaders())
+	prepared, err := listWriter.prepare(context.Background(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !isFlat(prepared) {
+		t.Fatal("expected the list to be flat")
+	}
+
+	var want, got [][]string
+
+	// The buffered path is the reference for the fast path.
+	listWriter.Reset(WriterFunc(func(record []string) error {
+		want = append(want, record)
+
+		return nil
+	}))
+
+	columns, err := listWriter.columns(prepared)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := listWriter.writeColumns(context.Background(), columns); err != nil {
+		t.Fatal(err)
+	}
+
+	listWriter.Reset(WriterFunc(func(record []string) error {
+		got = append(got, record)
+
+		return nil
+	}))
+
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestErrorCategories(t *testing.T) {
+	t.Parallel()
+
+	errWriter := errors.New("disk full")
+
+	list, err := Decode(DecodeTypeJSON, []byte(`{"id": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	failing := WriterFunc(func([]string) error { return errWriter })
+
+	err = NewListWriter(failing).Write(context.Background(), list)
+	if !errors.Is(err, ErrWriterFailed) || !errors.Is(err, errWriter) {
+		t.Fatalf("got error %v, want %v wrapping %v", err, ErrWriterFailed, errWriter)
+	}
+
+	footer := WithFooter(func(Table) []string { return []string{"a", "b"} })
+
+	err = NewListWriter(&recordWriter{}, footer).Write(context.Background(), list)
+	if !errors.Is(err, ErrRowTooWide) {
+		t.Fatalf("got error %v, want %v", err, ErrRowTooWide)
+	}
+
+	_, err = Decode(DecodeTypeJSON, []byte(`{"id":`))
+	if !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidJSON)
+	}
+
+	err = CSVToJSON(strings.NewReader("a,b\n1\n"), io.Discard)
+	if !errors.Is(err, ErrInvalidCSV) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidCSV)
+	}
+}
+
+func TestListWriterReset(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`{"id": 1}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var first, second bytes.Buffer
+
+	firstWriter := csv.NewWriter(&first)
+	secondWriter := csv.NewWriter(&second)
+
+	listWriter := NewListWriter(firstWriter)
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	listWriter.Reset(secondWriter)
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	firstWriter.Flush()
+	secondWriter.Flush()
+
+	if first.String() != second.String() {
+		t.Fatalf("got %q, want %q", second.String(), first.String())
+	}
+}
+
+func TestListWriterResetState(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"n": 1}, {"n": 2}, {"n": 3}, {"n": 4},
+		{"n": 5}, {"n": 6}, {"n": 7}, {"n": 8}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var first, second recordWriter
+
+	listWriter := NewListWriter(&first, WithSample(0.5, 42), WithRateLimit(len(list.GetValues())))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	// The bucket of the rate limit is empty after the first write, so the
+	// second write only fits in the deadline if Reset refills it.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	listWriter.Reset(&second)
+
+	if err := listWriter.Write(ctx, list); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(first.records, second.records) {
+		t.Fatalf("got %q after Reset, want %q", second.records, first.records)
+	}
+}
+
+func TestWriteFooter(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1}, {"id": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	footer := func(table Table) []string {
+		return []string{fmt.Sprintf("TOTAL %d", len(table.Rows))}
+	}
+
+	if err := NewListWriter(&dst, WithFooter(footer)).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"id"}, {"1.000000"}, {"2.000000"}, {"TOTAL 2"}}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
+
+func TestWriteValueInterning(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"country": "CA", "id": 1},
+		{"country": "US", "id": 2},
+		{"country": "CA", "id": 3}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst, WithAlphabetizeHeaders(), WithValueInterning(), WithTotalsRow("id"))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"country", "id"},
+		{"CA", "1.000000"},
+		{"US", "2.000000"},
+		{"CA", "3.000000"},
+		{"TOTAL", "6.000000"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
+
+func TestWriteTotalsRow(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"name": "a", "amount": 1.5, "fee": {"value": 1}},
+		{"name": "b", "amount": 2, "fee": {"value": null}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst, WithAlphabetizeHeaders(), WithTotalsRow("amount", "fee.value"))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"3.500000", "1.000000", ""}
+	if got := dst.records[len(dst.records)-1]; !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
+
+func TestWriteScalarColumn(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`["a", "b"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	if err := NewListWriter(&dst, WithScalarColumn("letter")).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"letter"}, {"a"}, {"b"}}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
+
 func TestRowBufferForList(t *testing.T) {
 	t.Parallel()
 
@@ -484,3 +977,219 @@ func BenchmarkListWriter(b *testing.B) {
 		}
 	}
 }
+
+// nestedObject will return a JSON object with "width" fields at every level,
+// nested "depth" levels deep.
+func nestedObject(width, depth int) string {
+	fields := make([]string, 0, width+1)
+	for i := 0; i < width; i++ {
+		fields = append(fields, fmt.Sprintf(`"f%d": %d`, i, i))
+	}
+
+	if depth > 0 {
+		fields = append(fields, fmt.Sprintf(`"child%d": %s`, depth, nestedObject(width, depth-1)))
+	}
+
+	return "{" + strings.Join(fields, ",") + "}"
+}
+
+func BenchmarkListWriterWideDeep(b *testing.B) {
+	for _, size := range []struct{ width, depth int }{
+		{width: 10, depth: 0},
+		{width: 10, depth: 2},
+		{width: 10, depth: 8},
+		{width: 50, depth: 8},
+	} {
+		size := size
+
+		b.Run(fmt.Sprintf("width=%d depth=%d", size.width, size.depth), func(b *testing.B) {
+			records := make([]string, 100)
+			for i := range records {
+				records[i] = nestedObject(size.width, size.depth)
+			}
+
+			list, err := Decode(DecodeTypeJSON, []byte("["+strings.Join(records, ",")+"]"))
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			listWriter := NewListWriter(WriterFunc(func([]string) error { return nil }))
+
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if err := listWriter.Write(context.Background(), list); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteKeyColumns(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"id": "a", "items": [{"sku": "x"}, {"sku": "y"}]},
+		{"id": "b"},
+		{"id": "c", "items": [{"sku": "z"}]}
+	]`)
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "record id",
+			opts: []ListWriterOption{WithRecordID("record_id")},
+			want: [][]string{
+				{"id", "items.sku", "record_id"},
+				{"a", "x", "1"},
+				{"", "y", "1"},
+				{"b", "", "2"},
+				{"c", "z", "3"},
+			},
+		},
+		{
+			name: "record id and array index",
+			opts: []ListWriterOption{WithRecordID("record_id"), WithArrayIndex("array_index")},
+			want: [][]string{
+				{"array_index", "id", "items.sku", "record_id"},
+				{"0", "a", "x", "1"},
+				{"1", "", "y", "1"},
+				{"0", "b", "", "2"},
+				{"0", "c", "z", "3"},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestWriteExplodeDepth(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"id": "a", "items": [
+			{"sku": "x", "parts": [{"n": 1}, {"n": 2}], "tags": ["t"]},
+			{"sku": "y"}
+		]}
+	]`)
+
+	for _, tcase := range []struct {
+		name  string
+		depth int
+		want  [][]string
+	}{
+		{
+			name:  "unlimited",
+			depth: -1,
+			want: [][]string{
+				{"id", "items.parts.n", "items.sku", "items.tags"},
+				{"a", "1.000000", "x", "[t]"},
+				{"", "2.000000", "", ""},
+				{"", "", "y", ""},
+			},
+		},
+		{
+			name:  "first level",
+			depth: 1,
+			want: [][]string{
+				{"id", "items.parts", "items.sku", "items.tags"},
+				{"a", `[{"n":1},{"n":2}]`, "x", `["t"]`},
+				{"", "", "y", ""},
+			},
+		},
+		{
+			name:  "none",
+			depth: 0,
+			want: [][]string{
+				{"id", "items"},
+				{"a", `[{"parts":[{"n":1},{"n":2}],"sku":"x","tags":["t"]},{"sku":"y"}]`},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			listWriter := NewListWriter(&dst, WithAlphabetizeHeaders(), WithExplodeDepth(tcase.depth))
+			if err := listWriter.Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestWriteDeterministic(t *testing.T) {
+	t.Parallel()
+
+	for _, data := range []string{
+		`[{"c": 1, "a": 2, "b": 3}, {"e": 4, "d": 5}]`,
+		`[{"c": 1, "a": {"z": 1, "y": 2}, "b": [{"q": 1, "p": 2}]}, {"e": 4, "d": 5}]`,
+	} {
+		list, err := Decode(DecodeTypeJSON, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var want string
+
+		// Map iteration order is random, so a run that depends on it is
+		// very unlikely to produce the same output many times.
+		for i := 0; i < 20; i++ {
+			var buf bytes.Buffer
+
+			csvWriter := csv.NewWriter(&buf)
+			if err := NewListWriter(csvWriter, WithDeterministic()).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			csvWriter.Flush()
+
+			if i == 0 {
+				want = buf.String()
+			} else if got := buf.String(); got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		}
+
+		if header := strings.SplitN(want, "\n", 2)[0]; !strings.HasPrefix(header, "a") {
+			t.Fatalf("got header %q, want the keys of the first record in order", header)
+		}
+	}
+}
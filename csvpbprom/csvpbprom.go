@@ -0,0 +1,102 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Package csvpbprom reports the metrics of csvpb writes to Prometheus. It is a
+// separate module, so that csvpb does not depend on the Prometheus client.
+package csvpbprom
+
+import (
+	"github.com/alpstable/csvpb"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace is the namespace of the metrics that are registered.
+const Namespace = "csvpb"
+
+// Metrics is a csvpb.Metrics that updates Prometheus collectors.
+type Metrics struct {
+	records  prometheus.Counter
+	rows     prometheus.Counter
+	cells    prometheus.Counter
+	duration prometheus.Histogram
+	errors   *prometheus.CounterVec
+}
+
+// New will return Metrics with its collectors registered with "reg":
+//
+//   - csvpb_records_written_total, the records that were written.
+//   - csvpb_rows_written_total, the data rows that were written, including
+//     those of child tables.
+//   - csvpb_cells_written_total, the cells of those rows.
+//   - csvpb_write_duration_seconds, a histogram of how long each write took.
+//   - csvpb_write_errors_total, the writes that failed, by the "category" of
+//     csvpb.ErrorCategory.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	metrics := &Metrics{
+		records: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "records_written_total",
+			Help:      "The number of records that were written.",
+		}),
+		rows: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "rows_written_total",
+			Help:      "The number of data rows that were written, including those of child tables.",
+		}),
+		cells: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "cells_written_total",
+			Help:      "The number of cells that were written.",
+		}),
+		duration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: Namespace,
+			Name:      "write_duration_seconds",
+			Help:      "How long each write took.",
+			Buckets:   prometheus.DefBuckets,
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: Namespace,
+			Name:      "write_errors_total",
+			Help:      "The number of writes that failed, by category.",
+		}, []string{"category"}),
+	}
+
+	for _, collector := range []prometheus.Collector{
+		metrics.records, metrics.rows, metrics.cells, metrics.duration, metrics.errors,
+	} {
+		if err := reg.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+
+	return metrics, nil
+}
+
+// WithMetrics will return an option that configures the ListWriter and the
+// Encoder to report their writes to the collectors of New, registered with
+// "reg".
+func WithMetrics(reg prometheus.Registerer) (csvpb.ListWriterOption, error) {
+	metrics, err := New(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	return csvpb.WithMetrics(metrics), nil
+}
+
+// ObserveWrite will update the collectors with the metrics of a write.
+func (m *Metrics) ObserveWrite(metrics csvpb.WriteMetrics) {
+	m.records.Add(float64(metrics.Records))
+	m.rows.Add(float64(metrics.Rows))
+	m.cells.Add(float64(metrics.Cells))
+	m.duration.Observe(metrics.Duration.Seconds())
+
+	if metrics.Err != nil {
+		m.errors.WithLabelValues(csvpb.ErrorCategory(metrics.Err)).Inc()
+	}
+}
@@ -0,0 +1,74 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpbprom
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/alpstable/csvpb"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// failingWriter is a csvpb.Writer that always fails.
+type failingWriter struct{}
+
+func (failingWriter) Write([]string) error {
+	return errors.New("disk full")
+}
+
+func TestWithMetrics(t *testing.T) {
+	t.Parallel()
+
+	list, err := csvpb.Decode(csvpb.DecodeTypeJSON, []byte(`[{"id": 1, "name": "a"}, {"id": 2, "name": "b"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reg := prometheus.NewRegistry()
+
+	metrics, err := New(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+
+	if err := csvpb.NewListWriter(csv.NewWriter(io.Discard), csvpb.WithMetrics(metrics)).Write(ctx, list); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := testutil.ToFloat64(metrics.records); got != 2 {
+		t.Errorf("got %v records, want 2", got)
+	}
+
+	if got := testutil.ToFloat64(metrics.cells); got != 4 {
+		t.Errorf("got %v cells, want 4", got)
+	}
+
+	if got := testutil.CollectAndCount(metrics.duration); got != 1 {
+		t.Errorf("got %d histograms, want 1", got)
+	}
+
+	if err := csvpb.NewListWriter(failingWriter{}, csvpb.WithMetrics(metrics)).Write(ctx, list); err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if got := testutil.ToFloat64(metrics.errors.WithLabelValues("writer")); got != 1 {
+		t.Errorf("got %v writer errors, want 1", got)
+	}
+
+	if _, err := New(reg); err == nil {
+		t.Fatal("expected an error registering the collectors twice")
+	}
+}
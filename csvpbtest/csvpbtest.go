@@ -0,0 +1,229 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+// Package csvpbtest provides helpers for testing code that writes CSV, such as
+// with csvpb, against golden files.
+package csvpbtest
+
+import (
+	"encoding/csv"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type comparer struct {
+	ignoreRowOrder bool
+	tolerance      float64
+}
+
+// Option is used to configure the comparison of AssertCSV and AssertTable.
+type Option func(*comparer)
+
+// IgnoreRowOrder configures the comparison to ignore the order of the rows.
+func IgnoreRowOrder() Option {
+	return func(cmp *comparer) {
+		cmp.ignoreRowOrder = true
+	}
+}
+
+// WithTolerance configures the comparison to treat numbers as equal if they
+// differ by at most "tolerance".
+func WithTolerance(tolerance float64) Option {
+	return func(cmp *comparer) {
+		cmp.tolerance = tolerance
+	}
+}
+
+// AssertCSV reports an error to "t" if the CSV tables "got" and "want" differ,
+// and returns whether they are equal. The first record of each is the header.
+// See AssertTable for how the tables are compared.
+func AssertCSV(t testing.TB, got, want string, opts ...Option) bool {
+	t.Helper()
+
+	gotTable, err := csv.NewReader(strings.NewReader(got)).ReadAll()
+	if err != nil {
+		t.Errorf("failed to read got CSV: %v", err)
+
+		return false
+	}
+
+	wantTable, err := csv.NewReader(strings.NewReader(want)).ReadAll()
+	if err != nil {
+		t.Errorf("failed to read want CSV: %v", err)
+
+		return false
+	}
+
+	return AssertTable(t, gotTable, wantTable, opts...)
+}
+
+// AssertTable reports an error to "t" if the tables "got" and "want" differ,
+// and returns whether they are equal. The first row of each is the header.
+//
+// The order of the columns is ignored, as is the formatting noise between
+// writers: cells are compared without surrounding whitespace, and cells that
+// are both numbers are compared by value, so "1" equals "1.000000".
+func AssertTable(t testing.TB, got, want [][]string, opts ...Option) bool {
+	t.Helper()
+
+	cmp := &comparer{}
+	for _, opt := range opts {
+		opt(cmp)
+	}
+
+	if err := cmp.compare(got, want); err != nil {
+		t.Errorf("tables differ: %v\ngot:  %q\nwant: %q", err, got, want)
+
+		return false
+	}
+
+	return true
+}
+
+// header will return the header of the table, which is empty if the table is.
+func header(table [][]string) []string {
+	if len(table) == 0 {
+		return nil
+	}
+
+	return table[0]
+}
+
+// rows will return the rows of the table after the header.
+func rows(table [][]string) [][]string {
+	if len(table) == 0 {
+		return nil
+	}
+
+	return table[1:]
+}
+
+// compare will return an error describing the first difference between the
+// tables.
+func (cmp *comparer) compare(got, want [][]string) error {
+	gotIndex := make(map[string]int, len(header(got)))
+	for i, h := range header(got) {
+		gotIndex[h] = i
+	}
+
+	// The columns of "got" in the order of "want".
+	order := make([]int, len(header(want)))
+
+	for i, h := range header(want) {
+		j, ok := gotIndex[h]
+		if !ok {
+			return fmt.Errorf("missing column %q", h)
+		}
+
+		order[i] = j
+
+		delete(gotIndex, h)
+	}
+
+	for h := range gotIndex {
+		return fmt.Errorf("unexpected column %q", h)
+	}
+
+	if len(got) != len(want) {
+		return fmt.Errorf("got %d rows, want %d", len(got)-1, len(want)-1)
+	}
+
+	gotRows := make([][]string, 0, len(got))
+
+	for _, row := range rows(got) {
+		reordered := make([]string, len(order))
+		for i, j := range order {
+			if j < len(row) {
+				reordered[i] = row[j]
+			}
+		}
+
+		gotRows = append(gotRows, reordered)
+	}
+
+	wantRows := rows(want)
+
+	if cmp.ignoreRowOrder {
+		gotRows = cmp.sorted(gotRows)
+		wantRows = cmp.sorted(wantRows)
+	}
+
+	for r := range wantRows {
+		for c, h := range header(want) {
+			var wantCell string
+			if c < len(wantRows[r]) {
+				wantCell = wantRows[r][c]
+			}
+
+			if !cmp.cellsEqual(gotRows[r][c], wantCell) {
+				return fmt.Errorf("row %d, column %q: got %q, want %q", r+1, h, gotRows[r][c], wantCell)
+			}
+		}
+	}
+
+	return nil
+}
+
+// cellsEqual will return true if the cells are equal, ignoring surrounding
+// whitespace and the formatting of numbers.
+func (cmp *comparer) cellsEqual(got, want string) bool {
+	got, want = strings.TrimSpace(got), strings.TrimSpace(want)
+	if got == want {
+		return true
+	}
+
+	gotNum, gotErr := strconv.ParseFloat(got, 64)
+	wantNum, wantErr := strconv.ParseFloat(want, 64)
+
+	return gotErr == nil && wantErr == nil && math.Abs(gotNum-wantNum) <= cmp.tolerance
+}
+
+// sorted will return a sorted copy of the rows, with the cells normalized so
+// that rows that compare equal sort together.
+func (cmp *comparer) sorted(rows [][]string) [][]string {
+	keys := make([]string, len(rows))
+	sortedRows := make([][]string, len(rows))
+
+	for i, row := range rows {
+		cells := make([]string, len(row))
+
+		for j, cell := range row {
+			cell = strings.TrimSpace(cell)
+			if num, err := strconv.ParseFloat(cell, 64); err == nil {
+				cell = strconv.FormatFloat(num, 'g', -1, 64)
+			}
+
+			cells[j] = cell
+		}
+
+		keys[i] = strings.Join(cells, "\x00")
+		sortedRows[i] = row
+	}
+
+	sort.Sort(byKey{keys: keys, rows: sortedRows})
+
+	return sortedRows
+}
+
+// byKey sorts rows by their normalized keys.
+type byKey struct {
+	keys []string
+	rows [][]string
+}
+
+func (b byKey) Len() int           { return len(b.keys) }
+func (b byKey) Less(i, j int) bool { return b.keys[i] < b.keys[j] }
+
+func (b byKey) Swap(i, j int) {
+	b.keys[i], b.keys[j] = b.keys[j], b.keys[i]
+	b.rows[i], b.rows[j] = b.rows[j], b.rows[i]
+}
@@ -0,0 +1,123 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpbtest
+
+import (
+	"fmt"
+	"testing"
+)
+
+// recordingTB records the errors reported to it.
+type recordingTB struct {
+	testing.TB
+	errors []string
+}
+
+func (tb *recordingTB) Helper() {}
+
+func (tb *recordingTB) Errorf(format string, args ...any) {
+	tb.errors = append(tb.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertCSV(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		got  string
+		want string
+		opts []Option
+		ok   bool
+	}{
+		{
+			name: "equal",
+			got:  "a,b\n1,2\n",
+			want: "a,b\n1,2\n",
+			ok:   true,
+		},
+		{
+			name: "column order",
+			got:  "b,a\n2,1\n",
+			want: "a,b\n1,2\n",
+			ok:   true,
+		},
+		{
+			name: "number formatting",
+			got:  "a,b\n1.000000,x\n",
+			want: "a,b\n1, x \n",
+			ok:   true,
+		},
+		{
+			name: "line endings",
+			got:  "a,b\r\n1,2\r\n",
+			want: "a,b\n1,2\n",
+			ok:   true,
+		},
+		{
+			name: "different cell",
+			got:  "a,b\n1,2\n",
+			want: "a,b\n1,3\n",
+		},
+		{
+			name: "missing column",
+			got:  "a\n1\n",
+			want: "a,b\n1,2\n",
+		},
+		{
+			name: "unexpected column",
+			got:  "a,b,c\n1,2,3\n",
+			want: "a,b\n1,2\n",
+		},
+		{
+			name: "different row count",
+			got:  "a\n1\n2\n",
+			want: "a\n1\n",
+		},
+		{
+			name: "row order",
+			got:  "a,b\n2,y\n1,x\n",
+			want: "a,b\n1,x\n2,y\n",
+		},
+		{
+			name: "ignore row order",
+			got:  "a,b\n2,y\n1.0,x\n",
+			want: "a,b\n1,x\n2,y\n",
+			opts: []Option{IgnoreRowOrder()},
+			ok:   true,
+		},
+		{
+			name: "tolerance",
+			got:  "a\n0.30000000000000004\n",
+			want: "a\n0.3\n",
+			opts: []Option{WithTolerance(1e-9)},
+			ok:   true,
+		},
+		{
+			name: "invalid csv",
+			got:  "a\n\"1\n",
+			want: "a\n1\n",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			tb := &recordingTB{}
+
+			if ok := AssertCSV(tb, tcase.got, tcase.want, tcase.opts...); ok != tcase.ok {
+				t.Fatalf("got %v, want %v: %v", ok, tcase.ok, tb.errors)
+			}
+
+			if tcase.ok != (len(tb.errors) == 0) {
+				t.Fatalf("unexpected errors: %v", tb.errors)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "google.golang.org/protobuf/types/known/structpb"
+
+// currencyDecimals is the number of digits after the decimal point of an
+// amount of money.
+const currencyDecimals = 2
+
+// WithCurrencyColumns configures the ListWriter to write the cells of the
+// columns, which hold amounts of money, with exactly two digits after the
+// decimal point, followed by a space and "code" unless it is empty, e.g. 12.5
+// as "12.50 EUR". The amounts are rounded from their shortest decimal form, so
+// 0.1 + 0.2 is written as "0.30" rather than drifting as "%f" would. Numbers and
+// strings that are numbers are converted, and other cells are written
+// unchanged. The amounts are rounded half up, unless WithRounding gives another
+// mode.
+func WithCurrencyColumns(code string, columns ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if listWriter.currencyColumns == nil {
+			listWriter.currencyColumns = make(map[string]string)
+		}
+
+		for _, column := range columns {
+			listWriter.currencyColumns[column] = code
+		}
+	}
+}
+
+// appendCurrency will append the value as an amount of money with the given
+// code, if it is a number.
+func (w *ListWriter) appendCurrency(buf []byte, value *structpb.Value, code string) ([]byte, bool) {
+	if _, ok := value.Kind.(*structpb.Value_BoolValue); ok {
+		return buf, false
+	}
+
+	num, ok := parseNumber(value)
+	if !ok {
+		return buf, false
+	}
+
+	r := &rounding{decimals: currencyDecimals}
+	if w.rounding != nil {
+		r.mode = w.rounding.mode
+	}
+
+	buf = r.appendNumber(buf, num)
+	if code != "" {
+		buf = append(append(buf, ' '), code...)
+	}
+
+	return buf, true
+}
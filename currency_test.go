@@ -0,0 +1,77 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWriteCurrencyColumns(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"price": 12.5, "total": 0.30000000000000004},
+		{"price": "1.005", "total": 1e21},
+		{"price": "n/a", "total": -0.001},
+		{"price": null, "total": true}
+	]`)
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "half up",
+			opts: []ListWriterOption{WithCurrencyColumns("EUR", "price"), WithCurrencyColumns("", "total")},
+			want: [][]string{
+				{"price", "total"},
+				{"12.50 EUR", "0.30"},
+				{"1.01 EUR", "1000000000000000000000.00"},
+				{"n/a", "0.00"},
+				{"", "true"},
+			},
+		},
+		{
+			name: "rounding mode",
+			opts: []ListWriterOption{WithCurrencyColumns("USD", "price"), WithRounding(0, RoundHalfEven)},
+			want: [][]string{
+				{"price", "total"},
+				{"12.50 USD", "0"},
+				{"1.00 USD", "1000000000000000000000"},
+				{"n/a", "0"},
+				{"", "true"},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
@@ -9,46 +9,221 @@
 package csvpb
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 
+	"google.golang.org/protobuf/reflect/protoregistry"
 	"google.golang.org/protobuf/types/known/structpb"
 )
 
-// ErrUnkownDecodeType is returned when an unknown decode type is provided.
-var ErrUnkownDecodeType = fmt.Errorf("unknown decode type")
+var (
+	// ErrUnkownDecodeType is returned when an unknown decode type is
+	// provided.
+	ErrUnkownDecodeType = fmt.Errorf("unknown decode type")
+
+	// ErrTrailingData is returned in strict mode when there is data after
+	// the top-level JSON value.
+	ErrTrailingData = fmt.Errorf("trailing data after top-level value")
+
+	// ErrDuplicateKey is returned in strict mode when a JSON object
+	// contains the same key more than once.
+	ErrDuplicateKey = fmt.Errorf("duplicate object key")
+
+	// ErrScalarValue is returned in strict mode when the top-level JSON
+	// value is neither an object nor an array.
+	ErrScalarValue = fmt.Errorf("top-level value is not an object or array")
+
+	// ErrInputTooLarge is returned when the data to decode exceeds the
+	// limit set by WithMaxInputBytes.
+	ErrInputTooLarge = fmt.Errorf("input too large")
+
+	// ErrInvalidJSON is returned when the data to decode is not valid
+	// JSON. The parser's error is wrapped.
+	ErrInvalidJSON = fmt.Errorf("invalid json")
+)
+
+// invalidJSON will categorize the error from the JSON parser as
+// ErrInvalidJSON.
+func invalidJSON(err error) error {
+	return &categoryError{category: ErrInvalidJSON, err: err}
+}
+
+type decoder struct {
+	strict        bool
+	maxInputBytes int
+	oneofPolicy   OneofPolicy
+	types         protoregistry.MessageTypeResolver
+}
+
+// DecodeOption is used to configure Decode.
+type DecodeOption func(*decoder)
+
+// WithStrictDecode configures Decode to reject JSON with trailing data after
+// the top-level value, duplicate object keys, and top-level scalars. The
+// returned errors include the byte offset at which the problem was found.
+func WithStrictDecode() DecodeOption {
+	return func(dec *decoder) {
+		dec.strict = true
+	}
+}
+
+// WithMaxInputBytes configures Decode to return ErrInputTooLarge, without
+// parsing, when the data is larger than "n" bytes.
+func WithMaxInputBytes(n int) DecodeOption {
+	return func(dec *decoder) {
+		dec.maxInputBytes = n
+	}
+}
+
+// validateStrictValue will consume the JSON value starting with "tok",
+// checking every nested object for duplicate keys.
+func validateStrictValue(dec *json.Decoder, tok json.Token) error {
+	delim, ok := tok.(json.Delim)
+	if !ok {
+		return nil
+	}
+
+	seen := make(map[string]struct{})
+
+	for dec.More() {
+		if delim == '{' {
+			keyTok, err := dec.Token()
+			if err != nil {
+				return invalidJSON(fmt.Errorf("failed to read json key: %w", err))
+			}
+
+			key, _ := keyTok.(string)
+			if _, ok := seen[key]; ok {
+				return fmt.Errorf("%w: %q at offset %d", ErrDuplicateKey, key, dec.InputOffset())
+			}
+
+			seen[key] = struct{}{}
+		}
+
+		valTok, err := dec.Token()
+		if err != nil {
+			return invalidJSON(fmt.Errorf("failed to read json value: %w", err))
+		}
+
+		if err := validateStrictValue(dec, valTok); err != nil {
+			return err
+		}
+	}
+
+	// Consume the closing delimiter.
+	if _, err := dec.Token(); err != nil {
+		return invalidJSON(fmt.Errorf("failed to read json delimiter: %w", err))
+	}
+
+	return nil
+}
+
+// validateStrictJSON will check that the data is a single JSON object or array
+// without duplicate keys.
+func validateStrictJSON(data []byte) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	tok, err := dec.Token()
+	if errors.Is(err, io.EOF) {
+		return nil
+	}
+
+	if err != nil {
+		return invalidJSON(fmt.Errorf("failed to read json: %w", err))
+	}
+
+	if _, ok := tok.(json.Delim); !ok {
+		return fmt.Errorf("%w: %v", ErrScalarValue, tok)
+	}
+
+	if err := validateStrictValue(dec, tok); err != nil {
+		return err
+	}
+
+	offset := dec.InputOffset()
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: at offset %d", ErrTrailingData, offset)
+	}
+
+	return nil
+}
+
+// validateStrictSeq will check that every document of the sequence is an
+// object or array without duplicate keys.
+func validateStrictSeq(data []byte) error {
+	// The record separators are replaced by spaces, which keeps the
+	// offsets in the errors.
+	if bytes.IndexByte(data, recordSeparator) >= 0 {
+		data = bytes.ReplaceAll(data, []byte{recordSeparator}, []byte{' '})
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	for {
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return invalidJSON(fmt.Errorf("failed to read json: %w", err))
+		}
+
+		if _, ok := tok.(json.Delim); !ok {
+			return fmt.Errorf("%w: %v", ErrScalarValue, tok)
+		}
+
+		if err := validateStrictValue(dec, tok); err != nil {
+			return err
+		}
+	}
+}
+
+// decodeJSONSeq will decode each document of the sequence as one record.
+func decodeJSONSeq(data []byte) (*structpb.ListValue, error) {
+	values, err := newJSONParser(data).parseSeq()
+	if err != nil {
+		return nil, invalidJSON(fmt.Errorf("failed to unmarshal json sequence: %w", err))
+	}
+
+	return &structpb.ListValue{Values: values}, nil
+}
 
 func decodeJSON(data []byte) (*structpb.ListValue, error) {
 	// If there is no data, return an empty list.
+	data = bytes.TrimSpace(data)
 	if len(data) == 0 {
 		return &structpb.ListValue{}, nil
 	}
 
+	value, err := newJSONParser(data).parse()
+
 	// Check if the first byte of the json is a '{' or '['
-	if data[0] == '{' {
-		// Unmarshal the json into a structpb.Struct
-		record := &structpb.Struct{}
-		if err := json.Unmarshal(data, record); err != nil {
-			return nil, fmt.Errorf("failed to unmarshal json object: %w", err)
+	switch data[0] {
+	case '{':
+		if err != nil {
+			return nil, invalidJSON(fmt.Errorf("failed to unmarshal json object: %w", err))
 		}
 
-		return &structpb.ListValue{
-			Values: []*structpb.Value{
-				{
-					Kind: &structpb.Value_StructValue{
-						StructValue: record,
-					},
-				},
-			},
-		}, nil
-	}
+		return &structpb.ListValue{Values: []*structpb.Value{value}}, nil
+	case '[':
+		if err != nil {
+			return nil, invalidJSON(fmt.Errorf("failed to unmarshal json array: %w", err))
+		}
 
-	records := &structpb.ListValue{}
-	if err := json.Unmarshal(data, records); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal json array: %w", err)
-	}
+		return value.GetListValue(), nil
+	default:
+		// A top-level scalar is treated as a list of one value, which
+		// is written as a one-cell table.
+		if err != nil {
+			return nil, invalidJSON(fmt.Errorf("failed to unmarshal json scalar: %w", err))
+		}
 
-	return records, nil
+		return &structpb.ListValue{Values: []*structpb.Value{value}}, nil
+	}
 }
 
 // DecodeType is an enum that represents the type of data that is being decoded.
@@ -60,14 +235,66 @@ const (
 
 	// DecodeTypeJSON is used to decode JSON data.
 	DecodeTypeJSON
+
+	// DecodeTypeJSONSeq is used to decode a sequence of JSON documents
+	// that follow each other, optionally separated by white space, e.g.
+	// {"id": 1}{"id": 2}, as written by some log shippers. RFC 7464 JSON
+	// text sequences (application/json-seq), in which each document is
+	// preceded by an ASCII record separator, as written by "jq --seq",
+	// are decoded too. Each document is decoded as one record, even if it
+	// is an array.
+	DecodeTypeJSONSeq
 )
 
 // Decode will a UpsertRequest into a structpb.ListValue for ease-of-use. This
 // method will return an error if the provided "decodeType" is not supported.
-func Decode(dtype DecodeType, data []byte) (*structpb.ListValue, error) {
+//
+// A top-level JSON object is decoded as a list of one object, and a top-level
+// scalar such as 42 is decoded as a list of one scalar, which the ListWriter
+// writes as a one-cell table under its scalar column. Use WithStrictDecode to
+// reject top-level scalars with ErrScalarValue instead.
+//
+// A UTF-8 byte order mark is stripped, and UTF-16 data, with or without a byte
+// order mark, is transcoded to UTF-8. WithMaxInputBytes limits the size of the
+// data before it is transcoded.
+func Decode(dtype DecodeType, data []byte, opts ...DecodeOption) (*structpb.ListValue, error) {
+	dec := &decoder{}
+	for _, opt := range opts {
+		opt(dec)
+	}
+
+	if dec.maxInputBytes > 0 && len(data) > dec.maxInputBytes {
+		return nil, fmt.Errorf("%w: %d bytes exceeds the limit of %d",
+			ErrInputTooLarge, len(data), dec.maxInputBytes)
+	}
+
 	switch dtype {
 	case DecodeTypeJSON:
+		var err error
+		if data, err = toUTF8(data); err != nil {
+			return nil, err
+		}
+
+		if dec.strict {
+			if err := validateStrictJSON(data); err != nil {
+				return nil, err
+			}
+		}
+
 		return decodeJSON(data)
+	case DecodeTypeJSONSeq:
+		var err error
+		if data, err = toUTF8(data); err != nil {
+			return nil, err
+		}
+
+		if dec.strict {
+			if err := validateStrictSeq(data); err != nil {
+				return nil, err
+			}
+		}
+
+		return decodeJSONSeq(data)
 	case DecodeTypeUnknown:
 		fallthrough
 	default:
@@ -0,0 +1,305 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf16"
+)
+
+func TestDecodeStrict(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    []byte
+		wantLen int
+		wantErr error
+	}{
+		{
+			name:    "empty",
+			data:    []byte(``),
+			wantLen: 0,
+		},
+		{
+			name:    "object",
+			data:    []byte(`{"foo": "bar"}`),
+			wantLen: 1,
+		},
+		{
+			name:    "array",
+			data:    []byte(`[{"foo": "bar"}, {"foo": {"foo": "baz"}}]`),
+			wantLen: 2,
+		},
+		{
+			name:    "trailing object",
+			data:    []byte(`{"foo": "bar"}{"foo": "baz"}`),
+			wantErr: ErrTrailingData,
+		},
+		{
+			name:    "trailing garbage",
+			data:    []byte(`[{"foo": "bar"}] xyz`),
+			wantErr: ErrTrailingData,
+		},
+		{
+			name:    "duplicate key",
+			data:    []byte(`{"foo": "bar", "foo": "baz"}`),
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			name:    "nested duplicate key",
+			data:    []byte(`[{"foo": {"bar": 1, "bar": 2}}]`),
+			wantErr: ErrDuplicateKey,
+		},
+		{
+			name:    "scalar",
+			data:    []byte(`42`),
+			wantErr: ErrScalarValue,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, tcase.data, WithStrictDecode())
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+
+			if tcase.wantErr != nil {
+				return
+			}
+
+			if got := len(list.GetValues()); got != tcase.wantLen {
+				t.Fatalf("got %d values, want %d", got, tcase.wantLen)
+			}
+		})
+	}
+}
+
+func TestDecodeScalar(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    []byte
+		want    interface{}
+		wantErr bool
+	}{
+		{name: "number", data: []byte(`42`), want: float64(42)},
+		{name: "string", data: []byte(` "foo" `), want: "foo"},
+		{name: "bool", data: []byte(`true`), want: true},
+		{name: "null", data: []byte(`null`), want: nil},
+		{name: "invalid", data: []byte(`foo`), wantErr: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, tcase.data)
+			if tcase.wantErr {
+				if err == nil {
+					t.Fatal("expected error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			got := list.AsSlice()
+			if len(got) != 1 || got[0] != tcase.want {
+				t.Fatalf("got %v, want [%v]", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestDecodeMaxInputBytes(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`{"foo": "bar"}`)
+
+	if _, err := Decode(DecodeTypeJSON, data, WithMaxInputBytes(len(data))); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	_, err := Decode(DecodeTypeJSON, data, WithMaxInputBytes(len(data)-1))
+	if !errors.Is(err, ErrInputTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrInputTooLarge)
+	}
+}
+
+func TestDecodeJSONSeq(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name   string
+		data   string
+		strict bool
+		want   []interface{}
+		err    error
+	}{
+		{
+			name: "concatenated",
+			data: `{"id": 1}{"id": 2}` + "\n" + ` {"id": 3}`,
+			want: []interface{}{
+				map[string]interface{}{"id": 1.0},
+				map[string]interface{}{"id": 2.0},
+				map[string]interface{}{"id": 3.0},
+			},
+		},
+		{
+			name: "array document",
+			data: `[1, 2]{"id": 1}`,
+			want: []interface{}{
+				[]interface{}{1.0, 2.0},
+				map[string]interface{}{"id": 1.0},
+			},
+		},
+		{
+			name: "rfc 7464",
+			data: "\x1e{\"id\": 1}\n\x1e{\"id\": 2}\n",
+			want: []interface{}{
+				map[string]interface{}{"id": 1.0},
+				map[string]interface{}{"id": 2.0},
+			},
+		},
+		{
+			name:   "strict rfc 7464",
+			data:   "\x1e{\"id\": 1}\n\x1e[1]\n",
+			strict: true,
+			want: []interface{}{
+				map[string]interface{}{"id": 1.0},
+				[]interface{}{1.0},
+			},
+		},
+		{name: "empty", data: " \n ", want: []interface{}{}},
+		{name: "invalid", data: `{"id": 1}{"id":`, err: ErrInvalidJSON},
+		{name: "strict duplicate key", data: `{"id": 1}{"id": 2, "id": 3}`, strict: true, err: ErrDuplicateKey},
+		{name: "strict scalar", data: `{"id": 1} 2`, strict: true, err: ErrScalarValue},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var opts []DecodeOption
+			if tcase.strict {
+				opts = append(opts, WithStrictDecode())
+			}
+
+			list, err := Decode(DecodeTypeJSONSeq, []byte(tcase.data), opts...)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, tcase.want) {
+				t.Fatalf("got %v, want %v", got, tcase.want)
+			}
+		})
+	}
+}
+
+// encodeUTF16 will encode the string as UTF-16 in the byte order, preceded by
+// "bom".
+func encodeUTF16(order binary.ByteOrder, bom []byte, str string) []byte {
+	data := append([]byte{}, bom...)
+	for _, unit := range utf16.Encode([]rune(str)) {
+		data = append(data, 0, 0)
+		order.PutUint16(data[len(data)-2:], unit)
+	}
+
+	return data
+}
+
+func TestDecodeBOM(t *testing.T) {
+	t.Parallel()
+
+	const doc = `[{"name": "Zoë 🙂"}]`
+
+	for _, tcase := range []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{name: "utf-8", data: []byte(doc)},
+		{name: "utf-8 bom", data: append([]byte{0xef, 0xbb, 0xbf}, doc...)},
+		{name: "utf-16be bom", data: encodeUTF16(binary.BigEndian, []byte{0xfe, 0xff}, doc)},
+		{name: "utf-16le bom", data: encodeUTF16(binary.LittleEndian, []byte{0xff, 0xfe}, doc)},
+		{name: "utf-16be", data: encodeUTF16(binary.BigEndian, nil, doc)},
+		{name: "utf-16le", data: encodeUTF16(binary.LittleEndian, nil, doc)},
+		{
+			name: "odd utf-16",
+			data: encodeUTF16(binary.LittleEndian, []byte{0xff, 0xfe}, doc)[:9],
+			err:  ErrInvalidJSON,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, tcase.data, WithStrictDecode())
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			got := list.GetValues()[0].GetStructValue().GetFields()["name"].GetStringValue()
+			if want := "Zoë 🙂"; got != want {
+				t.Fatalf("got %q, want %q", got, want)
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeJSON(b *testing.B) {
+	for _, size := range []struct{ records, width, depth int }{
+		{records: 1000, width: 10, depth: 0},
+		{records: 1000, width: 10, depth: 2},
+	} {
+		size := size
+
+		b.Run(fmt.Sprintf("records=%d width=%d depth=%d", size.records, size.width, size.depth), func(b *testing.B) {
+			records := make([]string, size.records)
+			for i := range records {
+				records[i] = nestedObject(size.width, size.depth)
+			}
+
+			data := []byte("[" + strings.Join(records, ",") + "]")
+
+			b.SetBytes(int64(len(data)))
+			b.ResetTimer()
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				if _, err := Decode(DecodeTypeJSON, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
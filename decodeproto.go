@@ -0,0 +1,305 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrUnknownOneofPolicy is returned when a oneof policy name cannot be
+// parsed.
+var ErrUnknownOneofPolicy = fmt.Errorf("unknown oneof policy")
+
+// OneofPolicy is how DecodeProto flattens the oneof fields of a message, set
+// by WithOneofPolicy.
+type OneofPolicy int32
+
+const (
+	// OneofPolicyVariants writes one column per variant of the oneof, which
+	// is empty unless that variant is set. It is the default.
+	OneofPolicyVariants OneofPolicy = iota
+
+	// OneofPolicyCaseValue writes the oneof as a pair of columns,
+	// "<oneof>_case" with the JSON name of the variant that is set and
+	// "<oneof>_value" with its value. Both are empty if no variant is set.
+	OneofPolicyCaseValue
+)
+
+var oneofPolicyNames = map[OneofPolicy]string{
+	OneofPolicyVariants:  "variants",
+	OneofPolicyCaseValue: "case_value",
+}
+
+// String returns the name of the oneof policy.
+func (p OneofPolicy) String() string {
+	if name, ok := oneofPolicyNames[p]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("OneofPolicy(%d)", p)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (p OneofPolicy) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that oneof policies
+// can be given by name in a Config.
+func (p *OneofPolicy) UnmarshalText(text []byte) error {
+	for policy, name := range oneofPolicyNames {
+		if name == string(text) {
+			*p = policy
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownOneofPolicy, text)
+}
+
+// WithOneofPolicy configures how DecodeProto flattens the oneof fields of the
+// messages. Decode ignores this option.
+func WithOneofPolicy(policy OneofPolicy) DecodeOption {
+	return func(dec *decoder) {
+		dec.oneofPolicy = policy
+	}
+}
+
+// isWellKnownType will return true if the message is one of the well-known
+// types, which protojson writes in their own JSON form.
+func isWellKnownType(desc protoreflect.MessageDescriptor) bool {
+	return desc.FullName().Parent() == "google.protobuf"
+}
+
+// messageValue will return the protojson value of the message value of the
+// field, with its Any fields unpacked and its oneofs flattened.
+func (dec *decoder) messageValue(fd protoreflect.FieldDescriptor, value protoreflect.Value,
+	jsonValue *structpb.Value,
+) (*structpb.Value, error) {
+	switch {
+	case isAny(fd.Message()):
+		return dec.anyValue(value.Message())
+	case isWellKnownType(fd.Message()):
+		return jsonValue, nil
+	default:
+		return jsonValue, dec.flattenMessage(value.Message(), jsonValue.GetStructValue())
+	}
+}
+
+// flattenMessage will rewrite the protojson object of the message, and those
+// of its nested messages, with the Any fields unpacked and the oneofs
+// flattened.
+//
+//nolint:cyclop
+func (dec *decoder) flattenMessage(msg protoreflect.Message, obj *structpb.Struct) error {
+	if obj == nil {
+		return nil
+	}
+
+	if obj.Fields == nil {
+		obj.Fields = make(map[string]*structpb.Value)
+	}
+
+	fields := msg.Descriptor().Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if fd.Message() == nil || !msg.Has(fd) {
+			continue
+		}
+
+		name := fd.JSONName()
+
+		switch {
+		case fd.IsMap():
+			if fd.MapValue().Message() == nil {
+				continue
+			}
+
+			entries := obj.Fields[name].GetStructValue()
+			if entries == nil {
+				entries = &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+			}
+
+			var err error
+
+			msg.Get(fd).Map().Range(func(key protoreflect.MapKey, elem protoreflect.Value) bool {
+				var value *structpb.Value
+
+				value, err = dec.messageValue(fd.MapValue(), elem, entries.Fields[key.String()])
+				entries.Fields[key.String()] = value
+
+				return err == nil
+			})
+
+			if err != nil {
+				return fmt.Errorf("field %s: %w", fd.Name(), err)
+			}
+
+			obj.Fields[name] = structpb.NewStructValue(entries)
+		case fd.IsList():
+			list := msg.Get(fd).List()
+			jsonValues := obj.Fields[name].GetListValue().GetValues()
+			values := make([]*structpb.Value, list.Len())
+
+			for j := range values {
+				var jsonValue *structpb.Value
+				if j < len(jsonValues) {
+					jsonValue = jsonValues[j]
+				}
+
+				var err error
+				if values[j], err = dec.messageValue(fd, list.Get(j), jsonValue); err != nil {
+					return fmt.Errorf("field %s: element %d: %w", fd.Name(), j, err)
+				}
+			}
+
+			obj.Fields[name] = structpb.NewListValue(&structpb.ListValue{Values: values})
+		default:
+			value, err := dec.messageValue(fd, msg.Get(fd), obj.Fields[name])
+			if err != nil {
+				return fmt.Errorf("field %s: %w", fd.Name(), err)
+			}
+
+			obj.Fields[name] = value
+		}
+	}
+
+	oneofs := msg.Descriptor().Oneofs()
+	for i := 0; i < oneofs.Len(); i++ {
+		if od := oneofs.Get(i); !od.IsSynthetic() {
+			dec.flattenOneof(od, obj)
+		}
+	}
+
+	return nil
+}
+
+// flattenOneof will rewrite the variants of the oneof in the object as set by
+// the oneof policy.
+func (dec *decoder) flattenOneof(od protoreflect.OneofDescriptor, obj *structpb.Struct) {
+	if obj == nil {
+		return
+	}
+
+	variants := od.Fields()
+
+	if dec.oneofPolicy != OneofPolicyCaseValue {
+		for i := 0; i < variants.Len(); i++ {
+			fd := variants.Get(i)
+			if _, ok := obj.Fields[fd.JSONName()]; ok {
+				continue
+			}
+
+			// An unset message is empty rather than null, so that it
+			// does not add a column beside those of its fields.
+			obj.Fields[fd.JSONName()] = structpb.NewNullValue()
+			if fd.Message() != nil && !isWellKnownType(fd.Message()) {
+				obj.Fields[fd.JSONName()] = structpb.NewStructValue(&structpb.Struct{})
+			}
+		}
+
+		return
+	}
+
+	oneofCase, oneofValue := structpb.NewNullValue(), structpb.NewNullValue()
+
+	for i := 0; i < variants.Len(); i++ {
+		name := variants.Get(i).JSONName()
+		if value, ok := obj.Fields[name]; ok {
+			oneofCase, oneofValue = structpb.NewStringValue(name), value
+
+			delete(obj.Fields, name)
+		}
+	}
+
+	obj.Fields[string(od.Name())+"_case"] = oneofCase
+	obj.Fields[string(od.Name())+"_value"] = oneofValue
+}
+
+// protoValue will marshal the message to its protojson value, with the Any
+// fields unpacked and the oneofs flattened.
+func (dec *decoder) protoValue(msg protoreflect.Message) (*structpb.Value, error) {
+	if isAny(msg.Descriptor()) {
+		return dec.anyValue(msg)
+	}
+
+	wellKnown := isWellKnownType(msg.Descriptor())
+
+	// The Any fields are unpacked from the message itself, so that those
+	// of unknown types do not fail protojson.
+	clone := proto.Clone(msg.Interface()).ProtoReflect()
+	if !wellKnown {
+		clearAnys(clone)
+	}
+
+	data, err := protojson.Marshal(clone.Interface())
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s: %w", msg.Descriptor().FullName(), err)
+	}
+
+	value := &structpb.Value{}
+	if err := protojson.Unmarshal(data, value); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s: %w", msg.Descriptor().FullName(), err)
+	}
+
+	if obj := value.GetStructValue(); obj != nil && !wellKnown {
+		if err := dec.flattenMessage(msg, obj); err != nil {
+			return nil, err
+		}
+	}
+
+	return value, nil
+}
+
+// decodeProto will decode the message into its protojson object.
+func (dec *decoder) decodeProto(msg protoreflect.Message) (*structpb.Struct, error) {
+	value, err := dec.protoValue(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	obj := value.GetStructValue()
+	if obj == nil {
+		return nil, fmt.Errorf("%w: %s is not an object", ErrUnsupportedValueType, msg.Descriptor().FullName())
+	}
+
+	return obj, nil
+}
+
+// DecodeProto decodes the messages into a list of their protojson objects, so
+// that the ListWriter writes proto messages like any other records. It is the
+// counterpart of EncodeProto. Nested messages are written as dotted columns,
+// oneof fields as set by WithOneofPolicy, and google.protobuf.Any fields as
+// set by WithTypeResolver. Messages of the well-known types whose JSON form is
+// not an object, e.g. google.protobuf.Timestamp, cannot be decoded as records.
+func DecodeProto[T proto.Message](msgs []T, opts ...DecodeOption) (*structpb.ListValue, error) {
+	dec := &decoder{}
+	for _, opt := range opts {
+		opt(dec)
+	}
+
+	list := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(msgs))}
+
+	for i, msg := range msgs {
+		obj, err := dec.decodeProto(msg.ProtoReflect())
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode message %d: %w", i, err)
+		}
+
+		list.Values = append(list.Values, structpb.NewStructValue(obj))
+	}
+
+	return list, nil
+}
@@ -0,0 +1,190 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// paymentDescriptor will build the descriptor of a message with a oneof:
+//
+//	message Payment {
+//	  string id = 1;
+//	  oneof method {
+//	    string card = 2;
+//	    Bank bank_transfer = 3;
+//	  }
+//	  google.protobuf.Any details = 4;
+//	}
+//
+//	message Bank { string iban = 1; }
+func paymentDescriptor(t *testing.T) protoreflect.MessageDescriptor {
+	t.Helper()
+
+	field := func(name string, number int32, typ descriptorpb.FieldDescriptorProto_Type,
+		typeName string, oneof *int32,
+	) *descriptorpb.FieldDescriptorProto {
+		fdp := &descriptorpb.FieldDescriptorProto{
+			Name:       proto.String(name),
+			Number:     proto.Int32(number),
+			Label:      descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:       typ.Enum(),
+			OneofIndex: oneof,
+		}
+
+		if typeName != "" {
+			fdp.TypeName = proto.String(typeName)
+		}
+
+		return fdp
+	}
+
+	file, err := protodesc.NewFile(&descriptorpb.FileDescriptorProto{
+		Name:       proto.String("payment.proto"),
+		Package:    proto.String("test"),
+		Syntax:     proto.String("proto3"),
+		Dependency: []string{"google/protobuf/any.proto"},
+		MessageType: []*descriptorpb.DescriptorProto{
+			{
+				Name: proto.String("Payment"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("id", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", nil),
+					field("card", 2, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", proto.Int32(0)),
+					field("bank_transfer", 3, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+						".test.Bank", proto.Int32(0)),
+					field("details", 4, descriptorpb.FieldDescriptorProto_TYPE_MESSAGE,
+						".google.protobuf.Any", nil),
+				},
+				OneofDecl: []*descriptorpb.OneofDescriptorProto{{Name: proto.String("method")}},
+			},
+			{
+				Name: proto.String("Bank"),
+				Field: []*descriptorpb.FieldDescriptorProto{
+					field("iban", 1, descriptorpb.FieldDescriptorProto_TYPE_STRING, "", nil),
+				},
+			},
+		},
+	}, protoregistry.GlobalFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return file.Messages().ByName("Payment")
+}
+
+func TestDecodeProto(t *testing.T) {
+	t.Parallel()
+
+	desc := paymentDescriptor(t)
+
+	payment := func(id string, set func(msg *dynamicpb.Message)) *dynamicpb.Message {
+		msg := dynamicpb.NewMessage(desc)
+		msg.Set(desc.Fields().ByName("id"), protoreflect.ValueOfString(id))
+
+		if set != nil {
+			set(msg)
+		}
+
+		return msg
+	}
+
+	msgs := []*dynamicpb.Message{
+		payment("1", func(msg *dynamicpb.Message) {
+			msg.Set(desc.Fields().ByName("card"), protoreflect.ValueOfString("4242"))
+		}),
+		payment("2", func(msg *dynamicpb.Message) {
+			bankField := desc.Fields().ByName("bank_transfer")
+			bank := dynamicpb.NewMessage(bankField.Message())
+			bank.Set(bankField.Message().Fields().ByName("iban"), protoreflect.ValueOfString("DE89"))
+			msg.Set(bankField, protoreflect.ValueOfMessage(bank))
+		}),
+		payment("3", nil),
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []DecodeOption
+		want [][]string
+	}{
+		{
+			name: "variants",
+			want: [][]string{
+				{"bankTransfer.iban", "card", "id"},
+				{"", "4242", "1"},
+				{"DE89", "", "2"},
+				{"", "", "3"},
+			},
+		},
+		{
+			name: "case and value",
+			opts: []DecodeOption{WithOneofPolicy(OneofPolicyCaseValue)},
+			want: [][]string{
+				{"id", "method_case", "method_value", "method_value.iban"},
+				{"1", "card", "4242", ""},
+				{"2", "bankTransfer", "", "DE89"},
+				{"3", "", "", ""},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := DecodeProto(msgs, tcase.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err = NewListWriter(&dst, WithAlphabetizeHeaders()).Write(context.Background(), list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestDecodeProtoNotObject(t *testing.T) {
+	t.Parallel()
+
+	_, err := DecodeProto([]*timestamppb.Timestamp{timestamppb.Now()})
+	if !errors.Is(err, ErrUnsupportedValueType) {
+		t.Fatalf("got error %v, want %v", err, ErrUnsupportedValueType)
+	}
+}
+
+func TestOneofPolicyUnmarshalText(t *testing.T) {
+	t.Parallel()
+
+	var policy OneofPolicy
+	if err := policy.UnmarshalText([]byte("case_value")); err != nil || policy != OneofPolicyCaseValue {
+		t.Fatalf("got %v, %v", policy, err)
+	}
+
+	if err := policy.UnmarshalText([]byte("pairs")); !errors.Is(err, ErrUnknownOneofPolicy) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownOneofPolicy)
+	}
+}
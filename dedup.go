@@ -0,0 +1,269 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// KeyStore persists the keys of the records written with WithDedupKey.
+type KeyStore interface {
+	// Contains reports, for each of the keys, whether it was added before.
+	Contains(ctx context.Context, keys []string) ([]bool, error)
+
+	// Add records the keys of records that have been written.
+	Add(ctx context.Context, keys []string) error
+}
+
+// dedupKey is the key of the records deduplicated by WithDedupKey.
+type dedupKey struct {
+	columns []string
+	store   KeyStore
+}
+
+// WithDedupKey configures the ListWriter to skip the records whose values in
+// the "columns" were seen before, so that the output of repeated extractions
+// can be appended to a growing CSV file with each record written once. The
+// columns are flattened paths, such as "user.id", and are read from each
+// record as it would be written, after any field mask. The keys of the
+// records are added to "seen" once they have been written, and records with
+// the same key in one list are written once. A record that has no scalar value
+// in one of the columns is always written.
+//
+// If the write fails after some rows were written, their keys are not added,
+// so the records are written again by the next run.
+func WithDedupKey(columns []string, seen KeyStore) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.dedup = &dedupKey{columns: columns, store: seen}
+	}
+}
+
+// key will return the key of the record, which is the JSON array of the plain
+// forms of its values in the key columns, or false if it has none.
+func (dedup *dedupKey) key(record *structpb.Value) (string, bool) {
+	obj := record.GetStructValue()
+	values := make([]string, len(dedup.columns))
+
+	for i, column := range dedup.columns {
+		value := fieldByPath(obj, column)
+		if value == nil {
+			return "", false
+		}
+
+		var ok bool
+		if values[i], ok = plainKey(value); !ok {
+			return "", false
+		}
+	}
+
+	// Marshaling a slice of strings cannot fail.
+	data, _ := json.Marshal(values)
+
+	return string(data), true
+}
+
+// skipSeen will return the records of the prepared list whose keys have not
+// been seen, and the keys of those records.
+func (dedup *dedupKey) skipSeen(ctx context.Context, list *structpb.ListValue) (*structpb.ListValue, []string, error) {
+	keys := make([]string, len(list.GetValues()))
+	hasKey := make([]bool, len(keys))
+
+	var lookup []string
+
+	for i, record := range list.GetValues() {
+		if keys[i], hasKey[i] = dedup.key(record); hasKey[i] {
+			lookup = append(lookup, keys[i])
+		}
+	}
+
+	if len(lookup) == 0 {
+		return list, nil, nil
+	}
+
+	contains, err := dedup.store.Contains(ctx, lookup)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up dedup keys: %w", err)
+	}
+
+	seen := make(map[string]bool, len(lookup))
+
+	for i, key := range lookup {
+		if i < len(contains) && contains[i] {
+			seen[key] = true
+		}
+	}
+
+	out := &structpb.ListValue{Values: make([]*structpb.Value, 0, len(keys))}
+	added := make([]string, 0, len(lookup))
+
+	for i, record := range list.GetValues() {
+		if hasKey[i] {
+			if seen[keys[i]] {
+				continue
+			}
+
+			seen[keys[i]] = true
+			added = append(added, keys[i])
+		}
+
+		out.Values = append(out.Values, record)
+	}
+
+	return out, added, nil
+}
+
+// addDedupKeys will add the keys of the records that have been written to the
+// store.
+func (w *ListWriter) addDedupKeys(ctx context.Context) error {
+	keys := w.dedupKeys
+	w.dedupKeys = nil
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	if err := w.dedup.store.Add(ctx, keys); err != nil {
+		return fmt.Errorf("failed to add dedup keys: %w", err)
+	}
+
+	return nil
+}
+
+// MemoryKeyStore is a KeyStore that keeps the keys in memory. It is safe for
+// concurrent use.
+type MemoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]bool
+}
+
+// NewMemoryKeyStore creates an empty MemoryKeyStore.
+func NewMemoryKeyStore() *MemoryKeyStore {
+	return &MemoryKeyStore{keys: make(map[string]bool)}
+}
+
+// Contains reports whether each of the keys is in the store.
+func (store *MemoryKeyStore) Contains(_ context.Context, keys []string) ([]bool, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	contains := make([]bool, len(keys))
+	for i, key := range keys {
+		contains[i] = store.keys[key]
+	}
+
+	return contains, nil
+}
+
+// Add adds the keys to the store.
+func (store *MemoryKeyStore) Add(_ context.Context, keys []string) error {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	for _, key := range keys {
+		store.keys[key] = true
+	}
+
+	return nil
+}
+
+// FileKeyStore is a KeyStore that keeps the keys in a file, one per line. The
+// file is read when the store is first used, and keys are appended to it.
+type FileKeyStore struct {
+	path   string
+	memory *MemoryKeyStore
+}
+
+// NewFileKeyStore creates a FileKeyStore that keeps the keys in the file at
+// "path", which is created when the first keys are added.
+func NewFileKeyStore(path string) *FileKeyStore {
+	return &FileKeyStore{path: path}
+}
+
+// load will read the keys in the file, if they have not been read.
+func (store *FileKeyStore) load() error {
+	if store.memory != nil {
+		return nil
+	}
+
+	memory := NewMemoryKeyStore()
+
+	file, err := os.Open(store.path)
+	if errors.Is(err, os.ErrNotExist) {
+		store.memory = memory
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to open keys: %w", err)
+	}
+
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, bufio.MaxScanTokenSize<<4)
+
+	for scanner.Scan() {
+		memory.keys[scanner.Text()] = true
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read keys: %w", err)
+	}
+
+	store.memory = memory
+
+	return nil
+}
+
+// Contains reports whether each of the keys is in the file.
+func (store *FileKeyStore) Contains(ctx context.Context, keys []string) ([]bool, error) {
+	if err := store.load(); err != nil {
+		return nil, err
+	}
+
+	return store.memory.Contains(ctx, keys)
+}
+
+// Add appends the keys to the file.
+func (store *FileKeyStore) Add(ctx context.Context, keys []string) error {
+	if err := store.load(); err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(store.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open keys: %w", err)
+	}
+
+	buf := bufio.NewWriter(file)
+	for _, key := range keys {
+		buf.WriteString(key + "\n")
+	}
+
+	if err := buf.Flush(); err != nil {
+		file.Close()
+
+		return fmt.Errorf("failed to write keys: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close keys: %w", err)
+	}
+
+	return store.memory.Add(ctx, keys)
+}
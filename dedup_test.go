@@ -0,0 +1,110 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestWriteDedupKey(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name  string
+		store func(t *testing.T) func() KeyStore
+	}{
+		{
+			name: "memory",
+			store: func(t *testing.T) func() KeyStore {
+				t.Helper()
+
+				store := NewMemoryKeyStore()
+
+				return func() KeyStore { return store }
+			},
+		},
+		{
+			name: "file",
+			store: func(t *testing.T) func() KeyStore {
+				t.Helper()
+
+				path := filepath.Join(t.TempDir(), "keys")
+
+				// Each run opens the store anew.
+				return func() KeyStore { return NewFileKeyStore(path) }
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			store := tcase.store(t)
+
+			for _, run := range []struct {
+				data string
+				want [][]string
+			}{
+				{
+					data: `[{"id": 1, "src": "a", "n": 1}, {"id": 1, "src": "b", "n": 2}, {"id": 1, "src": "a", "n": 3}]`,
+					want: [][]string{{"id", "n", "src"}, {"1", "1", "a"}, {"1", "2", "b"}},
+				},
+				{
+					data: `[{"id": 1, "src": "a", "n": 4}, {"id": 2, "src": "a", "n": 5}, {"n": 6}]`,
+					want: [][]string{{"id", "n", "src"}, {"2", "5", "a"}, {"", "6", ""}},
+				},
+			} {
+				list, err := Decode(DecodeTypeJSON, []byte(run.data))
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				var dst recordWriter
+
+				listWriter := NewListWriter(&dst, WithAlphabetizeHeaders(), WithRounding(0, RoundHalfUp),
+					WithDedupKey([]string{"id", "src"}, store()))
+				if err := listWriter.Write(context.Background(), list); err != nil {
+					t.Fatal(err)
+				}
+
+				if !reflect.DeepEqual(dst.records, run.want) {
+					t.Fatalf("got %v, want %v", dst.records, run.want)
+				}
+			}
+		})
+	}
+}
+
+func TestEncodeDedupKey(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, WithRounding(0, RoundHalfUp), WithDedupKey([]string{"id"}, NewMemoryKeyStore()))
+
+	for _, batch := range []string{`[{"id": 1}, {"id": 2}]`, `[{"id": 2}, {"id": 3}]`} {
+		list, err := Decode(DecodeTypeJSON, []byte(batch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := buf.String(), "id\n1\n2\n3\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
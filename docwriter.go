@@ -0,0 +1,52 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+)
+
+// DocumentWriter is an io.Writer that decodes the bytes of each call to Write
+// as one JSON document, and encodes its records with an Encoder, so that the
+// documents are appended to one CSV table. This lets csvpb be the sink of e.g.
+// a log.Logger or a slog.JSONHandler, which write one JSON object per call, or
+// of an HTTP response body that is copied with a single Write.
+//
+// A document must not be split across calls to Write, so a DocumentWriter
+// cannot be the destination of io.Copy for a stream of documents. Since the
+// Encoder flushes after each document, wrap its output in a BufferedWriter
+// for high rates of small documents. The documents are encoded with a
+// background context, and a DocumentWriter is not safe for concurrent use.
+type DocumentWriter struct {
+	encoder    *Encoder
+	decodeOpts []DecodeOption
+}
+
+// NewDocumentWriter creates a DocumentWriter that encodes with the Encoder,
+// decoding each document with the options.
+func NewDocumentWriter(encoder *Encoder, opts ...DecodeOption) *DocumentWriter {
+	return &DocumentWriter{encoder: encoder, decodeOpts: opts}
+}
+
+// Write decodes "p" as one JSON document and encodes it. If the document
+// cannot be decoded or encoded, nothing is written and 0 is returned with the
+// error.
+func (dw *DocumentWriter) Write(p []byte) (int, error) {
+	list, err := Decode(DecodeTypeJSON, p, dw.decodeOpts...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode document: %w", err)
+	}
+
+	if err := dw.encoder.Encode(context.Background(), list); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"errors"
+	"log"
+	"testing"
+)
+
+func TestDocumentWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	docWriter := NewDocumentWriter(NewEncoder(&buf, WithAlphabetizeHeaders()))
+
+	logger := log.New(docWriter, "", 0)
+	logger.Printf(`{"level": "info", "msg": %q}`, "started")
+	logger.Printf(`{"level": "warn", "msg": %q}`, "slow")
+	logger.Print(`[{"level": "info", "msg": "a"}, {"level": "info", "msg": "b"}]`)
+
+	want := "level,msg\ninfo,started\nwarn,slow\ninfo,a\ninfo,b\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	n, err := docWriter.Write([]byte(`{"level": `))
+	if !errors.Is(err, ErrInvalidJSON) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidJSON)
+	}
+
+	if n != 0 {
+		t.Fatalf("got %d bytes written, want 0", n)
+	}
+
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q after the invalid document, want %q", got, want)
+	}
+}
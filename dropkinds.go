@@ -0,0 +1,59 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "google.golang.org/protobuf/types/known/structpb"
+
+// WithDropKinds configures the ListWriter to leave out the fields of records,
+// at any depth, whose values are of the given kinds. For example, KindList
+// drops the columns of arrays, which are otherwise written as bracketed or JSON
+// cells, or exploded into rows, and KindStruct drops nested objects, so that
+// only the scalar fields at the top level of the records are written. The
+// elements of arrays that are kept are not dropped, but the fields of the
+// objects in them are.
+func WithDropKinds(kinds ...Kind) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if listWriter.dropKinds == nil {
+			listWriter.dropKinds = make(map[Kind]bool, len(kinds))
+		}
+
+		for _, kind := range kinds {
+			listWriter.dropKinds[kind] = true
+		}
+	}
+}
+
+// dropFields will return a copy of the value without the fields of the
+// dropped kinds.
+func dropFields(value *structpb.Value, drop map[Kind]bool) *structpb.Value {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_StructValue:
+		fields := valType.StructValue.GetFields()
+		kept := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(fields))}
+
+		for key, field := range fields {
+			if !drop[kindOf(field)] {
+				kept.Fields[key] = dropFields(field, drop)
+			}
+		}
+
+		return structpb.NewStructValue(kept)
+	case *structpb.Value_ListValue:
+		elems := valType.ListValue.GetValues()
+		kept := &structpb.ListValue{Values: make([]*structpb.Value, len(elems))}
+
+		for i, elem := range elems {
+			kept.Values[i] = dropFields(elem, drop)
+		}
+
+		return structpb.NewListValue(kept)
+	default:
+		return value
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWriteDropKinds(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"id": 1, "tags": ["a", "b"], "user": {"name": "x", "roles": [1]}, "note": null},
+		{"id": 2, "items": [{"sku": "s", "parts": [1, 2]}]}
+	]`)
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "lists",
+			opts: []ListWriterOption{WithDropKinds(KindList)},
+			want: [][]string{
+				{"id", "note", "user.name"},
+				{"1.000000", "", "x"},
+				{"2.000000", "", ""},
+			},
+		},
+		{
+			name: "structs and lists",
+			opts: []ListWriterOption{WithDropKinds(KindStruct, KindList)},
+			want: [][]string{
+				{"id", "note"},
+				{"1.000000", ""},
+				{"2.000000", ""},
+			},
+		},
+		{
+			name: "nested objects in kept lists",
+			opts: []ListWriterOption{WithDropKinds(KindNull, KindNumber)},
+			want: [][]string{
+				{"items.parts", "items.sku", "tags", "user.name", "user.roles"},
+				{"", "", "[a,b]", "x", "[1.000000]"},
+				{"[1.000000,2.000000]", "s", "", "", ""},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
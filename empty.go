@@ -0,0 +1,107 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "fmt"
+
+var (
+	// ErrEmptyInput is returned by ListWriter.Write for a list without
+	// records when EmptyInputError is used.
+	ErrEmptyInput = fmt.Errorf("empty input")
+
+	// ErrUnknownEmptyInput is returned when an empty input policy name
+	// cannot be parsed.
+	ErrUnknownEmptyInput = fmt.Errorf("unknown empty input policy")
+)
+
+// EmptyInput is what ListWriter.Write does with a list that has no records,
+// set by WithEmptyInput. A list whose records are all left out, e.g. by
+// WithFilter, is not empty.
+type EmptyInput int32
+
+const (
+	// EmptyInputNothing writes nothing. It is the default.
+	EmptyInputNothing EmptyInput = iota
+
+	// EmptyInputHeader writes the header given to WithEmptyInput, so that
+	// consumers see the columns of an empty table.
+	EmptyInputHeader
+
+	// EmptyInputError writes nothing and returns ErrEmptyInput, so that
+	// "no data" can be told apart from a table that was written.
+	EmptyInputError
+)
+
+var emptyInputNames = map[EmptyInput]string{
+	EmptyInputNothing: "nothing",
+	EmptyInputHeader:  "header",
+	EmptyInputError:   "error",
+}
+
+// String returns the name of the empty input policy.
+func (e EmptyInput) String() string {
+	if name, ok := emptyInputNames[e]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("EmptyInput(%d)", e)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (e EmptyInput) MarshalText() ([]byte, error) {
+	return []byte(e.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that empty input
+// policies can be given by name in a Config.
+func (e *EmptyInput) UnmarshalText(text []byte) error {
+	for policy, name := range emptyInputNames {
+		if name == string(text) {
+			*e = policy
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownEmptyInput, text)
+}
+
+// WithEmptyInput configures what the ListWriter does with a list that has no
+// records. With EmptyInputHeader, "header" is written as the header of the
+// empty table, e.g. the names of the columns of a fixed Schema. The Encoder
+// ignores this option, since an empty list does not end its table.
+func WithEmptyInput(policy EmptyInput, header ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.emptyInput = policy
+		listWriter.emptyHeader = header
+	}
+}
+
+// writeEmpty will write a list without records, as set by WithEmptyInput.
+func (w *ListWriter) writeEmpty() error {
+	if w.emptyInput == EmptyInputError {
+		return ErrEmptyInput
+	}
+
+	if w.sidecar != nil {
+		w.sidecar.start(nil)
+	}
+
+	if w.emptyInput == EmptyInputHeader {
+		if err := w.writeHeader(w.writer, w.emptyHeader); err != nil {
+			return err
+		}
+	}
+
+	if w.sidecar != nil {
+		return w.sidecar.emit(nil)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteEmptyInput(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		opts []ListWriterOption
+		want [][]string
+		err  error
+	}{
+		{
+			name: "nothing",
+			data: `[]`,
+		},
+		{
+			name: "header",
+			data: `[]`,
+			opts: []ListWriterOption{WithEmptyInput(EmptyInputHeader, "id", "name")},
+			want: [][]string{{"id", "name"}},
+		},
+		{
+			name: "error",
+			data: `[]`,
+			opts: []ListWriterOption{WithEmptyInput(EmptyInputError)},
+			err:  ErrEmptyInput,
+		},
+		{
+			name: "filtered is not empty",
+			data: `[{"id": 1}]`,
+			opts: []ListWriterOption{WithEmptyInput(EmptyInputError), WithFilter("item.id > 1.0")},
+			want: [][]string{nil},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err = NewListWriter(&dst, tcase.opts...).Write(context.Background(), list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestEmptyInputText(t *testing.T) {
+	t.Parallel()
+
+	for policy := range emptyInputNames {
+		text, err := policy.MarshalText()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got EmptyInput
+		if err := got.UnmarshalText(text); err != nil {
+			t.Fatal(err)
+		}
+
+		if got != policy {
+			t.Fatalf("got %v, want %v", got, policy)
+		}
+	}
+
+	var policy EmptyInput
+	if err := policy.UnmarshalText([]byte("skip")); !errors.Is(err, ErrUnknownEmptyInput) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownEmptyInput)
+	}
+}
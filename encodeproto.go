@@ -0,0 +1,331 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/base64"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	// ErrUnknownField is returned when a column does not map onto a field
+	// of the proto message.
+	ErrUnknownField = fmt.Errorf("unknown field")
+
+	// ErrTypeMismatch is returned when a value does not match the type
+	// that was declared for it.
+	ErrTypeMismatch = fmt.Errorf("type mismatch")
+)
+
+// flattenStruct will flatten the object into a map of dotted paths to the
+// non-object values, following the same rules as the ListWriter.
+func flattenStruct(prefix string, obj *structpb.Struct, flat map[string]*structpb.Value) {
+	for key, value := range obj.GetFields() {
+		if child, ok := value.Kind.(*structpb.Value_StructValue); ok {
+			flattenStruct(prefix+key+".", child.StructValue, flat)
+
+			continue
+		}
+
+		flat[prefix+key] = value
+	}
+}
+
+// findProtoField will find the field by its proto or JSON name.
+func findProtoField(desc protoreflect.MessageDescriptor, name string) protoreflect.FieldDescriptor {
+	if fd := desc.Fields().ByName(protoreflect.Name(name)); fd != nil {
+		return fd
+	}
+
+	return desc.Fields().ByJSONName(name)
+}
+
+// protoNumber will return the value as a float, parsing strings.
+func protoNumber(value *structpb.Value) (float64, error) {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_NumberValue:
+		return valType.NumberValue, nil
+	case *structpb.Value_StringValue:
+		num, err := strconv.ParseFloat(valType.StringValue, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %q is not a number", ErrTypeMismatch, valType.StringValue)
+		}
+
+		return num, nil
+	default:
+		return 0, fmt.Errorf("%w: %s is not a number", ErrTypeMismatch, kindOf(value))
+	}
+}
+
+// maxSafeInteger is the largest integer below which every integer is held
+// exactly by a float64.
+const maxSafeInteger = 1<<53 - 1
+
+// protoSafeInteger will return the value as an integer that is held exactly
+// by a float64. Larger integers must be given as strings, since JSON numbers
+// are decoded as float64s and may already have been rounded.
+func protoSafeInteger(value *structpb.Value) (float64, error) {
+	num, err := protoNumber(value)
+	if err != nil {
+		return 0, err
+	}
+
+	if num != math.Trunc(num) {
+		return 0, fmt.Errorf("%w: %v is not a valid integer", ErrTypeMismatch, num)
+	}
+
+	if math.Abs(num) > maxSafeInteger {
+		return 0, fmt.Errorf("%w: %v is not exact, give it as a string", ErrTypeMismatch, num)
+	}
+
+	return num, nil
+}
+
+// protoInt will return the value as an integer within the given bounds.
+// Strings are parsed as integers, so that 64-bit values keep their precision.
+func protoInt(value *structpb.Value, min, max int64) (int64, error) {
+	num, err := strconv.ParseInt(value.GetStringValue(), 10, 64)
+	if err != nil {
+		var safe float64
+		if safe, err = protoSafeInteger(value); err != nil {
+			return 0, err
+		}
+
+		num = int64(safe)
+	}
+
+	if num < min || num > max {
+		return 0, fmt.Errorf("%w: %d is out of range", ErrTypeMismatch, num)
+	}
+
+	return num, nil
+}
+
+// protoUint will return the value as an unsigned integer no greater than
+// "max". Strings are parsed as integers, so that 64-bit values keep their
+// precision.
+func protoUint(value *structpb.Value, max uint64) (uint64, error) {
+	num, err := strconv.ParseUint(value.GetStringValue(), 10, 64)
+	if err != nil {
+		safe, err := protoSafeInteger(value)
+		if err != nil {
+			return 0, err
+		}
+
+		if safe < 0 {
+			return 0, fmt.Errorf("%w: %v is out of range", ErrTypeMismatch, safe)
+		}
+
+		num = uint64(safe)
+	}
+
+	if num > max {
+		return 0, fmt.Errorf("%w: %d is out of range", ErrTypeMismatch, num)
+	}
+
+	return num, nil
+}
+
+// protoScalar will convert the value to the scalar type of the field.
+//
+//nolint:cyclop,funlen
+func protoScalar(fd protoreflect.FieldDescriptor, value *structpb.Value) (protoreflect.Value, error) {
+	switch fd.Kind() {
+	case protoreflect.BoolKind:
+		switch valType := value.Kind.(type) {
+		case *structpb.Value_BoolValue:
+			return protoreflect.ValueOfBool(valType.BoolValue), nil
+		case *structpb.Value_StringValue:
+			b, err := strconv.ParseBool(valType.StringValue)
+			if err == nil {
+				return protoreflect.ValueOfBool(b), nil
+			}
+		}
+
+		return protoreflect.Value{}, fmt.Errorf("%w: %v is not a bool", ErrTypeMismatch, value.AsInterface())
+	case protoreflect.StringKind:
+		if num, ok := value.Kind.(*structpb.Value_NumberValue); ok {
+			return protoreflect.ValueOfString(strconv.FormatFloat(num.NumberValue, 'f', -1, 64)), nil
+		}
+
+		return protoreflect.ValueOfString(formatValue(value)), nil
+	case protoreflect.BytesKind:
+		data, err := base64.StdEncoding.DecodeString(value.GetStringValue())
+		if err != nil {
+			return protoreflect.Value{}, fmt.Errorf("%w: invalid base64: %v", ErrTypeMismatch, err)
+		}
+
+		return protoreflect.ValueOfBytes(data), nil
+	case protoreflect.EnumKind:
+		if name, ok := value.Kind.(*structpb.Value_StringValue); ok {
+			ev := fd.Enum().Values().ByName(protoreflect.Name(name.StringValue))
+			if ev == nil {
+				return protoreflect.Value{}, fmt.Errorf("%w: unknown enum value %q", ErrTypeMismatch, name.StringValue)
+			}
+
+			return protoreflect.ValueOfEnum(ev.Number()), nil
+		}
+
+		num, err := protoInt(value, math.MinInt32, math.MaxInt32)
+
+		return protoreflect.ValueOfEnum(protoreflect.EnumNumber(num)), err
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		num, err := protoInt(value, math.MinInt32, math.MaxInt32)
+
+		return protoreflect.ValueOfInt32(int32(num)), err
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		num, err := protoInt(value, math.MinInt64, math.MaxInt64)
+
+		return protoreflect.ValueOfInt64(num), err
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		num, err := protoUint(value, math.MaxUint32)
+
+		return protoreflect.ValueOfUint32(uint32(num)), err
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		num, err := protoUint(value, math.MaxUint64)
+
+		return protoreflect.ValueOfUint64(num), err
+	case protoreflect.FloatKind:
+		num, err := protoNumber(value)
+
+		return protoreflect.ValueOfFloat32(float32(num)), err
+	case protoreflect.DoubleKind:
+		num, err := protoNumber(value)
+
+		return protoreflect.ValueOfFloat64(num), err
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		fallthrough
+	default:
+		return protoreflect.Value{}, fmt.Errorf("%w: %s field", ErrUnsupportedValueType, fd.Kind())
+	}
+}
+
+// setProtoList will append the values to the repeated field.
+func setProtoList(msg protoreflect.Message, fd protoreflect.FieldDescriptor, value *structpb.Value) error {
+	values := []*structpb.Value{value}
+	if list, ok := value.Kind.(*structpb.Value_ListValue); ok {
+		values = list.ListValue.GetValues()
+	}
+
+	list := msg.Mutable(fd).List()
+
+	for i, elem := range values {
+		if fd.Message() == nil {
+			val, err := protoScalar(fd, elem)
+			if err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+
+			list.Append(val)
+
+			continue
+		}
+
+		obj := elem.GetStructValue()
+		if obj == nil {
+			return fmt.Errorf("%w: element %d is not an object", ErrTypeMismatch, i)
+		}
+
+		child := list.NewElement()
+		if err := setProtoStruct(child.Message(), obj); err != nil {
+			return fmt.Errorf("element %d: %w", i, err)
+		}
+
+		list.Append(child)
+	}
+
+	return nil
+}
+
+// setProtoPath will set the value at the dotted path of the message.
+func setProtoPath(msg protoreflect.Message, path []string, value *structpb.Value) error {
+	fd := findProtoField(msg.Descriptor(), path[0])
+	if fd == nil {
+		return fmt.Errorf("%w: %q in %s", ErrUnknownField, path[0], msg.Descriptor().FullName())
+	}
+
+	switch {
+	case fd.IsMap():
+		return fmt.Errorf("%w: map field %q", ErrUnsupportedValueType, fd.Name())
+	case len(path) > 1:
+		if fd.Message() == nil || fd.IsList() {
+			return fmt.Errorf("%w: %q is not a message", ErrUnknownField, fd.Name())
+		}
+
+		return setProtoPath(msg.Mutable(fd).Message(), path[1:], value)
+	case kindOf(value) == KindNull:
+		return nil
+	case fd.IsList():
+		return setProtoList(msg, fd, value)
+	}
+
+	val, err := protoScalar(fd, value)
+	if err != nil {
+		return err
+	}
+
+	msg.Set(fd, val)
+
+	return nil
+}
+
+// setProtoStruct will set the flattened fields of the object on the message.
+func setProtoStruct(msg protoreflect.Message, obj *structpb.Struct) error {
+	flat := make(map[string]*structpb.Value)
+	flattenStruct("", obj, flat)
+
+	for path, value := range flat {
+		if err := setProtoPath(msg, strings.Split(path, "."), value); err != nil {
+			return fmt.Errorf("failed to set field %q: %w", path, err)
+		}
+	}
+
+	return nil
+}
+
+// EncodeProto re-encodes every object in the list as a proto message of type
+// T. The objects are flattened into dotted columns, as they would be written
+// to CSV, and each column is mapped onto the field with the same proto or JSON
+// name, descending into nested messages at each dot. Arrays map onto repeated
+// fields, and null values leave fields unset. Integers beyond 2^53 - 1 must be
+// given as strings, as protojson writes 64-bit integers, since JSON numbers
+// cannot hold them exactly.
+func EncodeProto[T proto.Message](list *structpb.ListValue) ([]T, error) {
+	var zero T
+
+	msgs := make([]T, 0, len(list.GetValues()))
+
+	for i, value := range list.GetValues() {
+		obj := value.GetStructValue()
+		if obj == nil {
+			return nil, fmt.Errorf("%w: record %d is not an object", ErrTypeMismatch, i)
+		}
+
+		msg := zero.ProtoReflect().New()
+		if err := setProtoStruct(msg, obj); err != nil {
+			return nil, fmt.Errorf("failed to encode record %d: %w", i, err)
+		}
+
+		typed, ok := msg.Interface().(T)
+		if !ok {
+			return nil, fmt.Errorf("%w: %T", ErrUnsupportedValueType, msg.Interface())
+		}
+
+		msgs = append(msgs, typed)
+	}
+
+	return msgs, nil
+}
@@ -0,0 +1,214 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/sourcecontextpb"
+	"google.golang.org/protobuf/types/known/structpb"
+	"google.golang.org/protobuf/types/known/typepb"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func TestEncodeProto(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{
+			"name": "Foo",
+			"sourceContext": {"file_name": "foo.proto"},
+			"oneofs": ["a", "b"],
+			"syntax": "SYNTAX_PROTO3",
+			"fields": [{"name": "id", "number": 1, "kind": "TYPE_INT64"}]
+		},
+		{"name": "Bar", "source_context.file_name": "bar.proto", "syntax": null}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := EncodeProto[*typepb.Type](list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []*typepb.Type{
+		{
+			Name:          "Foo",
+			SourceContext: &sourcecontextpb.SourceContext{FileName: "foo.proto"},
+			Oneofs:        []string{"a", "b"},
+			Syntax:        typepb.Syntax_SYNTAX_PROTO3,
+			Fields:        []*typepb.Field{{Name: "id", Number: 1, Kind: typepb.Field_TYPE_INT64}},
+		},
+		{
+			Name:          "Bar",
+			SourceContext: &sourcecontextpb.SourceContext{FileName: "bar.proto"},
+		},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("got %d messages, want %d", len(got), len(want))
+	}
+
+	for i := range want {
+		if !proto.Equal(got[i], want[i]) {
+			t.Fatalf("got %v, want %v", got[i], want[i])
+		}
+	}
+}
+
+func TestEncodeProtoErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    []byte
+		wantErr error
+	}{
+		{"unknown field", []byte(`{"foo": 1}`), ErrUnknownField},
+		{"type mismatch", []byte(`{"fields": [{"number": 1.5}]}`), ErrTypeMismatch},
+		{"unknown enum", []byte(`{"syntax": "SYNTAX_FOO"}`), ErrTypeMismatch},
+		{"scalar record", []byte(`[1]`), ErrTypeMismatch},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, tcase.data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := EncodeProto[*typepb.Type](list); !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+		})
+	}
+}
+
+func TestEncodeProtoIntegers(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		encode  func(list *structpb.ListValue) (proto.Message, error)
+		want    proto.Message
+		wantErr error
+	}{
+		{
+			name:   "max int64 string",
+			data:   `{"seconds": "9223372036854775807"}`,
+			encode: encodeFirst[*durationpb.Duration],
+			want:   &durationpb.Duration{Seconds: math.MaxInt64},
+		},
+		{
+			name:   "min int64 string",
+			data:   `{"seconds": "-9223372036854775808"}`,
+			encode: encodeFirst[*durationpb.Duration],
+			want:   &durationpb.Duration{Seconds: math.MinInt64},
+		},
+		{
+			name:   "int64 string beyond 2^53",
+			data:   `{"seconds": "9007199254740993"}`,
+			encode: encodeFirst[*durationpb.Duration],
+			want:   &durationpb.Duration{Seconds: 9007199254740993},
+		},
+		{
+			name:    "int64 string overflow",
+			data:    `{"seconds": "9223372036854775808"}`,
+			encode:  encodeFirst[*durationpb.Duration],
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:   "max safe number",
+			data:   `{"seconds": 9007199254740991}`,
+			encode: encodeFirst[*durationpb.Duration],
+			want:   &durationpb.Duration{Seconds: 9007199254740991},
+		},
+		{
+			name:    "number beyond 2^53",
+			data:    `{"seconds": 9007199254740992}`,
+			encode:  encodeFirst[*durationpb.Duration],
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:   "int32 bounds",
+			data:   `{"nanos": -2147483648}`,
+			encode: encodeFirst[*durationpb.Duration],
+			want:   &durationpb.Duration{Nanos: math.MinInt32},
+		},
+		{
+			name:    "int32 overflow",
+			data:    `{"nanos": "2147483648"}`,
+			encode:  encodeFirst[*durationpb.Duration],
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:   "max uint64 string",
+			data:   `{"value": "18446744073709551615"}`,
+			encode: encodeFirst[*wrapperspb.UInt64Value],
+			want:   wrapperspb.UInt64(math.MaxUint64),
+		},
+		{
+			name:    "uint64 string overflow",
+			data:    `{"value": "18446744073709551616"}`,
+			encode:  encodeFirst[*wrapperspb.UInt64Value],
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "negative uint64",
+			data:    `{"value": -1}`,
+			encode:  encodeFirst[*wrapperspb.UInt64Value],
+			wantErr: ErrTypeMismatch,
+		},
+		{
+			name:    "uint32 overflow",
+			data:    `{"value": 4294967296}`,
+			encode:  encodeFirst[*wrapperspb.UInt32Value],
+			wantErr: ErrTypeMismatch,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := tcase.encode(list)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+
+			if tcase.wantErr == nil && !proto.Equal(got, tcase.want) {
+				t.Fatalf("got %v, want %v", got, tcase.want)
+			}
+		})
+	}
+}
+
+// encodeFirst will encode the list and return its first message.
+func encodeFirst[T proto.Message](list *structpb.ListValue) (proto.Message, error) {
+	msgs, err := EncodeProto[T](list)
+	if err != nil {
+		return nil, err
+	}
+
+	return msgs[0], nil
+}
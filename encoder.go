@@ -0,0 +1,467 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrSchemaChange is returned by the Encoder when a list has columns that are
+// not in the header that has already been written.
+var ErrSchemaChange = fmt.Errorf("schema change")
+
+// Encoder writes a stream of lists to CSV as a single table. The header is
+// written with the first list, and the rows of every later list are written
+// under it, with empty cells for the columns that a list does not have.
+//
+// The Encoder is configured with the same options as the ListWriter. WithFooter,
+// WithGroupBy, and WithSortBy need the whole table and are not used by the
+// Encoder, and since it writes a single table, Encode returns
+// ErrInvalidArrayPolicy with WithChildTables.
+type Encoder struct {
+	listWriter *ListWriter
+	csvWriter  *csv.Writer
+	out        io.Writer
+	output     *offsetWriter
+	header     []string
+
+	// order is the header restored by Restore, which new tables start
+	// with.
+	order []string
+
+	// zstd compresses the output if WithZstd is used, and err is the
+	// error from ending the stream of a previous io.Writer on Reset.
+	zstd *zstd.Encoder
+	err  error
+
+	// records is the number of input records that have been written, and
+	// skip is the number already written before a checkpoint was resumed.
+	records int64
+	skip    int64
+	resumed bool
+
+	// written is the number of records that have been flattened, which
+	// numbers the records for WithRecordID.
+	written int64
+}
+
+// NewEncoder creates a new Encoder that writes CSV to "w".
+func NewEncoder(w io.Writer, opts ...ListWriterOption) *Encoder {
+	enc := &Encoder{listWriter: NewListWriter(nil, opts...)}
+	enc.setOutput(w)
+
+	return enc
+}
+
+// offsetWriter counts the bytes written to the output of an Encoder, which
+// is the Offset of its checkpoints.
+type offsetWriter struct {
+	writer io.Writer
+	offset int64
+}
+
+// Write writes the data to the output and counts the bytes written.
+func (w *offsetWriter) Write(data []byte) (int, error) {
+	n, err := w.writer.Write(data)
+	w.offset += int64(n)
+
+	return n, err //nolint:wrapcheck
+}
+
+// setOutput will direct the CSV writer to "w", through the zstd encoder if
+// WithZstd is used.
+func (enc *Encoder) setOutput(w io.Writer) {
+	enc.output = &offsetWriter{writer: w}
+	w = enc.output
+	enc.out = w
+
+	if enc.listWriter.zstd {
+		if enc.zstd == nil {
+			// Without options, the encoder cannot fail to be
+			// created.
+			enc.zstd, _ = zstd.NewWriter(w)
+		} else {
+			enc.zstd.Reset(w)
+		}
+
+		enc.out = enc.zstd
+	}
+
+	enc.csvWriter = csv.NewWriter(enc.out)
+
+	// The state of the ListWriter, such as the sample, continues across
+	// the outputs of the Encoder.
+	enc.listWriter.writer = enc.csvWriter
+}
+
+// Reset directs future writes to "w" as a new table, so the header is written
+// again with the next list. It may be called from the WithOnSchemaChange
+// callback to rotate to a new file. With WithZstd, the compressed stream of
+// the previous io.Writer is ended first, and if that fails, the error is
+// returned by the next call to Encode.
+func (enc *Encoder) Reset(w io.Writer) {
+	if enc.zstd != nil {
+		if err := enc.Close(); err != nil && enc.err == nil {
+			enc.err = err
+		}
+	}
+
+	enc.setOutput(w)
+	enc.header = nil
+}
+
+// Close flushes the CSV writer and, with WithZstd, ends the compressed stream.
+// It does not close the underlying io.Writer.
+func (enc *Encoder) Close() error {
+	enc.csvWriter.Flush()
+
+	if err := enc.csvWriter.Error(); err != nil {
+		return writerFailed(fmt.Errorf("failed to flush csv: %w", err))
+	}
+
+	if enc.zstd == nil {
+		return nil
+	}
+
+	if err := enc.zstd.Close(); err != nil {
+		return writerFailed(fmt.Errorf("failed to close zstd stream: %w", err))
+	}
+
+	return nil
+}
+
+// WithOnSchemaChange configures the Encoder to call "onChange" when a list
+// does not have the same columns as the header that has already been written.
+// The "added" columns are those that are new in the list, and the "removed"
+// columns are those in the header that the list does not have. If "onChange"
+// returns an error, the list is not written and the error is returned.
+// Otherwise, the added columns are appended to the header, unless the Encoder
+// was reset by "onChange", in which case a new header is written.
+//
+// Without this option, the Encoder returns ErrSchemaChange when a list adds
+// columns, unless WithRepeatHeader is used.
+func WithOnSchemaChange(onChange func(added, removed []string) error) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.onSchemaChange = onChange
+	}
+}
+
+// WithRepeatHeader configures the Encoder to write the header again, with the
+// added columns appended, when a list adds columns, rather than returning
+// ErrSchemaChange. This suits log-style targets that are only ever appended
+// to. If "separator" is not nil, it is written as a record before the repeated
+// header: an empty record writes a blank line, and a record such as
+// []string{"# schema changed"} writes a marker.
+func WithRepeatHeader(separator []string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.repeatHeader = true
+		listWriter.headerSeparator = separator
+	}
+}
+
+// WithCommentHeader configures the Encoder to write the lines as comments,
+// prefixed with "# ", before the header of each table, e.g. the generation
+// time, the source, and the schema version. A line that contains newlines is
+// written as several comments. The ListWriter ignores this option.
+//
+// The comments are read back by a csv.Reader as records unless its Comment
+// field is set to '#', in which case they are skipped. Note that the reader
+// then also skips any data row whose first cell starts with '#'. Spreadsheet
+// applications show the comments as rows, so they are best not combined with
+// WithExcelProfile.
+func WithCommentHeader(lines ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.commentHeader = append(listWriter.commentHeader, lines...)
+	}
+}
+
+// writeRepeatedHeader will write the header again, after a schema change with
+// WithRepeatHeader.
+func (enc *Encoder) writeRepeatedHeader() error {
+	header, err := enc.listWriter.outputHeader(enc.header)
+	if err != nil {
+		return err
+	}
+
+	if err := enc.csvWriter.Write(header); err != nil {
+		return writerFailed(fmt.Errorf("failed to write csv header: %w", err))
+	}
+
+	return nil
+}
+
+// writeComments will write the comment header directly to the output, since
+// the CSV writer would quote the lines that contain delimiters.
+func (enc *Encoder) writeComments() error {
+	var buf strings.Builder
+
+	for _, line := range enc.listWriter.commentHeader {
+		for _, comment := range strings.Split(line, "\n") {
+			comment = strings.TrimSuffix(comment, "\r")
+			if comment == "" {
+				buf.WriteString("#\n")
+			} else {
+				buf.WriteString("# " + comment + "\n")
+			}
+		}
+	}
+
+	// Anything written to the table so far must precede the comments.
+	enc.csvWriter.Flush()
+
+	if err := enc.csvWriter.Error(); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(enc.out, buf.String())
+
+	return err
+}
+
+// schemaChange will return the columns that are new in "ordered" and the
+// columns of the header that are not in "ordered".
+func (enc *Encoder) schemaChange(ordered []*column) ([]string, []string) {
+	var added, removed []string
+
+	inHeader := make(map[string]bool, len(enc.header))
+	for _, header := range enc.header {
+		inHeader[header] = true
+	}
+
+	inList := make(map[string]bool, len(ordered))
+
+	for _, col := range ordered {
+		inList[col.header] = true
+
+		if !inHeader[col.header] {
+			added = append(added, col.header)
+		}
+	}
+
+	for _, header := range enc.header {
+		if !inList[header] {
+			removed = append(removed, header)
+		}
+	}
+
+	return added, removed
+}
+
+// headerWrite is how the header is written before the rows of a list.
+type headerWrite int
+
+const (
+	// headerUnchanged means the header has already been written.
+	headerUnchanged headerWrite = iota
+
+	// headerNew means the list starts a new table.
+	headerNew
+
+	// headerRepeated means the header changed within the table and is
+	// written again.
+	headerRepeated
+)
+
+// updateHeader will reconcile the header with the columns of the next list,
+// returning how the header needs to be written.
+func (enc *Encoder) updateHeader(ordered []*column) (headerWrite, error) {
+	if enc.header == nil {
+		if enc.order != nil {
+			enc.header = enc.orderHeader(ordered)
+
+			return headerNew, nil
+		}
+
+		enc.header = make([]string, len(ordered))
+		for i, col := range ordered {
+			enc.header[i] = col.header
+		}
+
+		return headerNew, nil
+	}
+
+	added, removed := enc.schemaChange(ordered)
+	if len(added) == 0 && len(removed) == 0 {
+		return headerUnchanged, nil
+	}
+
+	listWriter := enc.listWriter
+
+	if listWriter.onSchemaChange != nil {
+		if err := listWriter.onSchemaChange(added, removed); err != nil {
+			return headerUnchanged, err
+		}
+
+		// The callback reset the encoder, so the list starts a new
+		// table.
+		if enc.header == nil {
+			return enc.updateHeader(ordered)
+		}
+	} else if len(added) > 0 && !listWriter.repeatHeader {
+		return headerUnchanged, fmt.Errorf("%w: new columns %q", ErrSchemaChange, added)
+	}
+
+	if len(added) == 0 {
+		return headerUnchanged, nil
+	}
+
+	maxColumns := listWriter.maxColumns
+	if maxColumns > 0 && len(enc.header)+len(added) > maxColumns {
+		// The first added column over the limit, given that a resumed
+		// header may already be over it.
+		over := maxColumns - len(enc.header)
+		if over < 0 {
+			over = 0
+		}
+
+		return headerUnchanged, &TooManyColumnsError{
+			Columns: len(enc.header) + len(added),
+			Limit:   maxColumns,
+			Column:  added[over],
+		}
+	}
+
+	enc.header = append(enc.header, added...)
+
+	if listWriter.repeatHeader {
+		return headerRepeated, nil
+	}
+
+	return headerUnchanged, nil
+}
+
+// Encode writes the rows of the list, and the header if it has not yet been
+// written. An empty list writes nothing. The CSV writer is flushed after each
+// list, and then the checkpoint is saved if WithCheckpoint is used.
+func (enc *Encoder) Encode(ctx context.Context, list *structpb.ListValue) error {
+	return enc.listWriter.measure(func() error {
+		return enc.encode(ctx, list)
+	})
+}
+
+// encode writes the rows of the list.
+func (enc *Encoder) encode(ctx context.Context, list *structpb.ListValue) error {
+	if err := enc.err; err != nil {
+		enc.err = nil
+
+		return err
+	}
+
+	listWriter := enc.listWriter
+
+	if listWriter.arrayPolicy == ArrayPolicyChildTable {
+		return fmt.Errorf("%w: the Encoder writes a single table, not %s",
+			ErrInvalidArrayPolicy, listWriter.arrayPolicy)
+	}
+
+	if listWriter.checkpoint != nil {
+		var err error
+		if list, err = enc.resume(ctx, list); err != nil {
+			return err
+		}
+	}
+
+	// Records are counted before any are left out by validation.
+	records := int64(len(list.GetValues()))
+
+	list, err := listWriter.prepare(ctx, list)
+	if err != nil {
+		return err
+	}
+
+	columns, err := listWriter.columns(list, withFirstRecord(enc.written))
+	if err != nil {
+		return err
+	}
+
+	enc.written += int64(columns.records)
+
+	if listWriter.counts != nil {
+		listWriter.counts.records += columns.records
+	}
+
+	if columns.rows == 0 {
+		return enc.saveCheckpoint(ctx, records)
+	}
+
+	writeHeader, err := enc.updateHeader(columns.ordered())
+	if err != nil {
+		return err
+	}
+
+	if writeHeader == headerRepeated && listWriter.headerSeparator != nil {
+		if err := enc.csvWriter.Write(listWriter.headerSeparator); err != nil {
+			return writerFailed(fmt.Errorf("failed to write csv header separator: %w", err))
+		}
+	}
+
+	if writeHeader == headerNew && len(listWriter.commentHeader) > 0 {
+		if err := enc.writeComments(); err != nil {
+			return writerFailed(fmt.Errorf("failed to write comment header: %w", err))
+		}
+	}
+
+	switch writeHeader {
+	case headerNew:
+		err = listWriter.writeHeader(enc.csvWriter, enc.header)
+	case headerRepeated:
+		err = enc.writeRepeatedHeader()
+	case headerUnchanged:
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Align the columns of the list with the header.
+	aligned := make([]*column, len(enc.header))
+	for i, header := range enc.header {
+		if aligned[i] = columns.m[header]; aligned[i] == nil {
+			aligned[i] = &column{header: header}
+		}
+	}
+
+	for i := 0; i < columns.rows; i++ {
+		row, err := columns.formatRow(aligned, i)
+		if err != nil {
+			return fmt.Errorf("failed to format row %d: %w", i, err)
+		}
+
+		if err := listWriter.writeRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	enc.csvWriter.Flush()
+
+	if err := enc.csvWriter.Error(); err != nil {
+		return writerFailed(fmt.Errorf("failed to flush csv: %w", err))
+	}
+
+	if enc.zstd != nil {
+		if err := enc.zstd.Flush(); err != nil {
+			return writerFailed(fmt.Errorf("failed to flush zstd stream: %w", err))
+		}
+	}
+
+	if listWriter.dedup != nil {
+		if err := listWriter.addDedupKeys(ctx); err != nil {
+			return err
+		}
+	}
+
+	return enc.saveCheckpoint(ctx, records)
+}
@@ -0,0 +1,248 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestEncoder(t *testing.T) {
+	t.Parallel()
+
+	errAbort := errors.New("abort")
+
+	type change struct{ added, removed []string }
+
+	for _, tcase := range []struct {
+		name        string
+		batches     []string
+		opts        []ListWriterOption
+		onChange    func(added, removed []string) error
+		want        string
+		wantChanges []change
+		wantErr     error
+	}{
+		{
+			name:    "same columns",
+			batches: []string{`{"a": "1", "b": "2"}`, `[{"a": "3", "b": "4"}]`},
+			want:    "a,b\n1,2\n3,4\n",
+		},
+		{
+			name:    "empty batch",
+			batches: []string{`[]`, `{"a": "1"}`, `[]`},
+			want:    "a\n1\n",
+		},
+		{
+			name:    "removed columns",
+			batches: []string{`{"a": "1", "b": "2"}`, `{"a": "3"}`},
+			want:    "a,b\n1,2\n3,\n",
+		},
+		{
+			name:    "added columns",
+			batches: []string{`{"a": "1"}`, `{"a": "2", "b": "3"}`},
+			want:    "a\n1\n",
+			wantErr: ErrSchemaChange,
+		},
+		{
+			name:     "accept added columns",
+			batches:  []string{`{"a": "1", "b": "2"}`, `{"a": "3", "c": "4"}`},
+			onChange: func(added, removed []string) error { return nil },
+			want:     "a,b\n1,2\n3,,4\n",
+			wantChanges: []change{
+				{added: []string{"c"}, removed: []string{"b"}},
+			},
+		},
+		{
+			name:    "repeat header",
+			batches: []string{`{"a": "1"}`, `{"a": "2"}`, `{"b": "3"}`, `{"a": "4"}`},
+			opts:    []ListWriterOption{WithRepeatHeader(nil)},
+			want:    "a\n1\n2\na,b\n,3\n4,\n",
+		},
+		{
+			name:    "repeat header with blank line",
+			batches: []string{`{"a": "1"}`, `{"b": "2"}`},
+			opts:    []ListWriterOption{WithRepeatHeader([]string{})},
+			want:    "a\n1\n\na,b\n,2\n",
+		},
+		{
+			name:    "repeat header with marker",
+			batches: []string{`{"a": "1"}`, `{"b": "2"}`},
+			opts:    []ListWriterOption{WithRepeatHeader([]string{"# schema changed"})},
+			want:    "a\n1\n# schema changed\na,b\n,2\n",
+		},
+		{
+			name:     "abort",
+			batches:  []string{`{"a": "1"}`, `{"b": "2"}`},
+			onChange: func(added, removed []string) error { return errAbort },
+			want:     "a\n1\n",
+			wantErr:  errAbort,
+			wantChanges: []change{
+				{added: []string{"b"}, removed: []string{"a"}},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var (
+				buf     bytes.Buffer
+				changes []change
+				err     error
+			)
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			if tcase.onChange != nil {
+				opts = append(opts, WithOnSchemaChange(func(added, removed []string) error {
+					changes = append(changes, change{added: added, removed: removed})
+
+					return tcase.onChange(added, removed)
+				}))
+			}
+
+			enc := NewEncoder(&buf, opts...)
+
+			for _, batch := range tcase.batches {
+				list, decodeErr := Decode(DecodeTypeJSON, []byte(batch))
+				if decodeErr != nil {
+					t.Fatal(decodeErr)
+				}
+
+				if err = enc.Encode(context.Background(), list); err != nil {
+					break
+				}
+			}
+
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+
+			if got := buf.String(); got != tcase.want {
+				t.Fatalf("got %q, want %q", got, tcase.want)
+			}
+
+			if !reflect.DeepEqual(changes, tcase.wantChanges) {
+				t.Fatalf("got changes %v, want %v", changes, tcase.wantChanges)
+			}
+		})
+	}
+}
+
+func TestEncoderRotate(t *testing.T) {
+	t.Parallel()
+
+	var first, second bytes.Buffer
+
+	var enc *Encoder
+
+	enc = NewEncoder(&first, WithOnSchemaChange(func(added, removed []string) error {
+		enc.Reset(&second)
+
+		return nil
+	}))
+
+	for _, batch := range []string{`{"a": "1"}`, `{"b": "2"}`} {
+		list, err := Decode(DecodeTypeJSON, []byte(batch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := first.String(), "a\n1\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got, want := second.String(), "b\n2\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncoderRecordID(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, WithRecordID("record_id"), WithAlphabetizeHeaders())
+
+	for _, data := range []string{`[{"a": 1}, {"a": 2}]`, `[{"a": 3}]`} {
+		list, err := Decode(DecodeTypeJSON, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+	}
+
+	want := "a,record_id\n1.000000,1\n2.000000,2\n3.000000,3\n"
+	if got := buf.String(); got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncoderCommentHeader(t *testing.T) {
+	t.Parallel()
+
+	var first, second bytes.Buffer
+
+	var enc *Encoder
+
+	enc = NewEncoder(&first, WithCommentHeader("generated by csvpb, v1", "", "source: a\nb"),
+		WithOnSchemaChange(func(added, removed []string) error {
+			enc.Reset(&second)
+
+			return nil
+		}))
+
+	for _, batch := range []string{`{"a": "1"}`, `{"a": "2"}`, `{"b": "#3"}`} {
+		list, err := Decode(DecodeTypeJSON, []byte(batch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	const comments = "# generated by csvpb, v1\n#\n# source: a\n# b\n"
+
+	if got, want := first.String(), comments+"a\n1\n2\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got, want := second.String(), comments+"b\n#3\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	// A reader that skips comments also skips the data row starting with
+	// '#'.
+	reader := csv.NewReader(&second)
+	reader.Comment = '#'
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][]string{{"b"}}; !reflect.DeepEqual(records, want) {
+		t.Fatalf("got %v, want %v", records, want)
+	}
+}
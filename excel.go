@@ -0,0 +1,181 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// utf8BOM is the byte order mark that Excel needs to read a CSV file as UTF-8.
+const utf8BOM = "\ufeff"
+
+// Layouts of the timestamps that Excel recognizes as dates.
+const (
+	excelDateTime       = "2006-01-02 15:04:05"
+	excelDateTimeMillis = "2006-01-02 15:04:05.000"
+)
+
+type excelProfile struct {
+	sepHint bool
+}
+
+// ExcelOption is used to configure WithExcelProfile.
+type ExcelOption func(*excelProfile)
+
+// WithSepHint configures the Excel profile to write a "sep=" line before the
+// header, which tells Excel the delimiter regardless of the system's list
+// separator. The line is written as the cells "sep=" and "", so that it names
+// whatever delimiter the CSV writer uses. Some versions of Excel ignore the byte
+// order mark when the line is present, so it is not written by default.
+func WithSepHint() ExcelOption {
+	return func(profile *excelProfile) {
+		profile.sepHint = true
+	}
+}
+
+// WithExcelProfile configures the ListWriter and Encoder to write CSV that
+// opens correctly in Excel:
+//
+//   - the output starts with a UTF-8 byte order mark, so that non-ASCII text
+//     is not garbled;
+//   - string cells that are RFC 3339 timestamps are written as
+//     "2006-01-02 15:04:05", which Excel parses as a date, in the timestamp's
+//     own offset;
+//   - string cells that Excel would evaluate as a formula, i.e. that start with
+//     "=", "+", "-", "@", a tab, or a carriage return and are not numbers, are
+//     prefixed with a single quote.
+func WithExcelProfile(opts ...ExcelOption) ListWriterOption {
+	profile := &excelProfile{}
+	for _, opt := range opts {
+		opt(profile)
+	}
+
+	return func(listWriter *ListWriter) {
+		listWriter.excel = profile
+	}
+}
+
+// parseTimestamp will parse the cell if it is an RFC 3339 timestamp.
+func parseTimestamp(cell []byte) (time.Time, bool) {
+	// Check the shape before parsing, since most cells are not timestamps.
+	if len(cell) < len("2006-01-02T15:04:05Z") || cell[4] != '-' || cell[10] != 'T' && cell[10] != 't' {
+		return time.Time{}, false
+	}
+
+	ts, err := time.Parse(time.RFC3339Nano, string(cell))
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return ts, true
+}
+
+// appendExcelTime will append the timestamp in a layout that Excel parses,
+// which has no time zone and at most millisecond precision.
+func appendExcelTime(buf []byte, ts time.Time) []byte {
+	if ts.Nanosecond() >= int(time.Millisecond) {
+		return ts.AppendFormat(buf, excelDateTimeMillis)
+	}
+
+	return ts.AppendFormat(buf, excelDateTime)
+}
+
+// isFormula will return true if Excel would evaluate the cell as a formula.
+func isFormula(cell []byte) bool {
+	if len(cell) == 0 {
+		return false
+	}
+
+	switch cell[0] {
+	case '=', '@', '\t', '\r':
+		return true
+	case '+', '-':
+		// Signed numbers are not formulas.
+		_, err := strconv.ParseFloat(string(cell), 64)
+
+		return err != nil
+	default:
+		return false
+	}
+}
+
+// escapeCell will rewrite the string cell that starts at "start" in the buffer
+// so that Excel reads it as it is meant.
+func (profile *excelProfile) escapeCell(buf []byte, start int, value *structpb.Value) []byte {
+	if _, ok := value.GetKind().(*structpb.Value_StringValue); !ok {
+		return buf
+	}
+
+	cell := buf[start:]
+
+	if ts, ok := parseTimestamp(cell); ok {
+		return appendExcelTime(buf[:start], ts)
+	}
+
+	if isFormula(cell) {
+		buf = append(buf, 0)
+		copy(buf[start+1:], buf[start:])
+		buf[start] = '\''
+	}
+
+	return buf
+}
+
+// preamble will return the records written before the header, and the header
+// with the byte order mark, if the Excel profile is used.
+func (profile *excelProfile) preamble(header []string) ([][]string, []string) {
+	if profile == nil {
+		return nil, header
+	}
+
+	if profile.sepHint {
+		return [][]string{{utf8BOM + "sep=", ""}}, header
+	}
+
+	if len(header) == 0 {
+		return nil, header
+	}
+
+	marked := make([]string, len(header))
+	copy(marked, header)
+	marked[0] = utf8BOM + marked[0]
+
+	return nil, marked
+}
+
+// writeHeader writes the output header to "writer", preceded by the preamble
+// of the Excel profile.
+func (w *ListWriter) writeHeader(writer Writer, header []string) error {
+	header, err := w.outputHeader(header)
+	if err != nil {
+		return err
+	}
+
+	if w.sidecar != nil {
+		w.sidecar.start(header)
+	}
+
+	records, header := w.excel.preamble(header)
+
+	for _, record := range records {
+		if err := writer.Write(record); err != nil {
+			return writerFailed(fmt.Errorf("failed to write csv header: %w", err))
+		}
+	}
+
+	if err := writeHeaderRecord(writer, header); err != nil {
+		return writerFailed(fmt.Errorf("failed to write csv header: %w", err))
+	}
+
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestWithExcelProfile(t *testing.T) {
+	t.Parallel()
+
+	records := []any{
+		map[string]any{"a": "=SUM(A1)", "b": 1},
+		map[string]any{"a": "-5", "b": "+1+2"},
+		map[string]any{"a": "2023-01-02T15:04:05Z", "b": "2023-01-02T15:04:05.25+02:00"},
+		map[string]any{"a": "@cmd", "b": "héllo"},
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want string
+	}{
+		{
+			name: "profile",
+			opts: []ListWriterOption{WithExcelProfile()},
+			want: "\ufeffa,b\n" +
+				"'=SUM(A1),1.000000\n" +
+				"-5,'+1+2\n" +
+				"2023-01-02 15:04:05,2023-01-02 15:04:05.250\n" +
+				"'@cmd,héllo\n",
+		},
+		{
+			name: "sep hint",
+			opts: []ListWriterOption{WithExcelProfile(WithSepHint())},
+			want: "\ufeffsep=,\na,b\n" +
+				"'=SUM(A1),1.000000\n" +
+				"-5,'+1+2\n" +
+				"2023-01-02 15:04:05,2023-01-02 15:04:05.250\n" +
+				"'@cmd,héllo\n",
+		},
+		{
+			name: "sorted",
+			opts: []ListWriterOption{WithExcelProfile(), WithSortBy("b")},
+			want: "\ufeffa,b\n" +
+				"-5,'+1+2\n" +
+				"'=SUM(A1),1.000000\n" +
+				"2023-01-02 15:04:05,2023-01-02 15:04:05.250\n" +
+				"'@cmd,héllo\n",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := structpb.NewList(records)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var buf bytes.Buffer
+
+			csvWriter := csv.NewWriter(&buf)
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			if err := NewListWriter(csvWriter, opts...).Write(context.Background(), list); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+
+			csvWriter.Flush()
+
+			if got := buf.String(); got != tcase.want {
+				t.Fatalf("got:\n%q\nwant:\n%q", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestEncoderExcelProfile(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, WithExcelProfile())
+
+	for _, record := range []any{map[string]any{"a": "x"}, map[string]any{"a": "=y"}} {
+		list, err := structpb.NewList([]any{record})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatalf("failed to encode: %v", err)
+		}
+	}
+
+	// The byte order mark is only written once, at the start.
+	if want := "\ufeffa\nx\n'=y\n"; buf.String() != want {
+		t.Fatalf("got %q, want %q", buf.String(), want)
+	}
+}
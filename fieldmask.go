@@ -0,0 +1,122 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// maskTree is a FieldMask as a tree of path segments. A node without children
+// selects the entire subtree. The node at the end of a path is nil, so that a
+// longer path does not narrow it, since the paths of a mask are a union.
+type maskTree map[string]maskTree
+
+// lowerCamel will convert the snake_case proto name to its lowerCamelCase JSON
+// name.
+func lowerCamel(name string) string {
+	parts := strings.Split(name, "_")
+	for i := 1; i < len(parts); i++ {
+		if parts[i] != "" {
+			parts[i] = strings.ToUpper(parts[i][:1]) + parts[i][1:]
+		}
+	}
+
+	return strings.Join(parts, "")
+}
+
+// newMaskTree will build a tree from the mask paths. Every segment is added
+// under both its proto name and its JSON name, so that the mask selects data
+// encoded either way.
+func newMaskTree(mask *fieldmaskpb.FieldMask) maskTree {
+	tree := make(maskTree)
+
+	for _, path := range mask.GetPaths() {
+		nodes := []maskTree{tree}
+		segs := strings.Split(path, ".")
+
+		for i, seg := range segs {
+			var next []maskTree
+
+			names := []string{seg}
+			if camel := lowerCamel(seg); camel != seg {
+				names = append(names, camel)
+			}
+
+			for _, node := range nodes {
+				for _, name := range names {
+					child, ok := node[name]
+
+					switch {
+					case ok && child == nil:
+						// A shorter path selects the subtree.
+						continue
+					case i == len(segs)-1:
+						node[name] = nil
+
+						continue
+					case !ok:
+						child = make(maskTree)
+						node[name] = child
+					}
+
+					next = append(next, child)
+				}
+			}
+
+			nodes = next
+		}
+	}
+
+	return tree
+}
+
+// pruneValue will return the value with only the fields selected by the tree.
+// Lists apply the tree to each of their elements.
+func pruneValue(value *structpb.Value, tree maskTree) *structpb.Value {
+	if len(tree) == 0 {
+		return value
+	}
+
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_StructValue:
+		pruned := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+
+		for key, field := range valType.StructValue.GetFields() {
+			if subtree, ok := tree[key]; ok {
+				pruned.Fields[key] = pruneValue(field, subtree)
+			}
+		}
+
+		return structpb.NewStructValue(pruned)
+	case *structpb.Value_ListValue:
+		pruned := &structpb.ListValue{Values: make([]*structpb.Value, len(valType.ListValue.GetValues()))}
+
+		for i, elem := range valType.ListValue.GetValues() {
+			pruned.Values[i] = pruneValue(elem, tree)
+		}
+
+		return structpb.NewListValue(pruned)
+	default:
+		return value
+	}
+}
+
+// WithFieldMask configures the ListWriter to only write the fields selected by
+// the mask, so that the partial-response mask of an API can be reused for
+// exports. Paths may use the proto field names or their JSON names, and
+// select the entire subtree of a field. Top-level scalar values are not
+// masked.
+func WithFieldMask(mask *fieldmaskpb.FieldMask) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.fieldMask = newMaskTree(mask)
+	}
+}
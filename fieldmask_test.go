@@ -0,0 +1,85 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/fieldmaskpb"
+)
+
+func TestWriteFieldMask(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "displayName": "a", "secret": "x", "sourceContext": {"fileName": "a.proto", "line": 1}},
+		{"id": 2, "displayName": "b", "secret": "y", "sourceContext": {"fileName": "b.proto", "line": 2}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mask := &fieldmaskpb.FieldMask{Paths: []string{"id", "display_name", "source_context.file_name"}}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst, WithAlphabetizeHeaders(), WithFieldMask(mask))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"displayName", "id", "sourceContext.fileName"},
+		{"a", "1.000000", "a.proto"},
+		{"b", "2.000000", "b.proto"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
+
+func TestWriteFieldMaskPrefix(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1, "user": {"name": "a", "email": "a@x"}}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{{"user.email", "user.name"}, {"a@x", "a"}}
+
+	for _, tcase := range []struct {
+		name  string
+		paths []string
+	}{
+		{name: "prefix first", paths: []string{"user", "user.name"}},
+		{name: "prefix last", paths: []string{"user.name", "user"}},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			mask := &fieldmaskpb.FieldMask{Paths: tcase.paths}
+			if err := NewListWriter(&dst, WithAlphabetizeHeaders(), WithFieldMask(mask)).Write(
+				context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, want) {
+				t.Fatalf("got %v, want %v", dst.records, want)
+			}
+		})
+	}
+}
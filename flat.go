@@ -0,0 +1,150 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// isFlat will return true if every record in the prepared list is an object
+// of scalars, in which case each record is exactly one row. Values of any other
+// kind, including unsupported ones, are left to the columnar path.
+func isFlat(list *structpb.ListValue) bool {
+	for _, value := range list.GetValues() {
+		for _, field := range value.GetStructValue().GetFields() {
+			switch field.Kind.(type) {
+			case *structpb.Value_NullValue, *structpb.Value_NumberValue,
+				*structpb.Value_StringValue, *structpb.Value_BoolValue:
+			default:
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// flatHeader gathers the header of flat records in the order the keys are
+// first seen.
+type flatHeader struct {
+	w      *ListWriter
+	header []string
+	index  map[string]int
+}
+
+func newFlatHeader(w *ListWriter) *flatHeader {
+	return &flatHeader{w: w, index: make(map[string]int)}
+}
+
+// add will add the key to the header if it has not been seen.
+func (h *flatHeader) add(key string) error {
+	key = h.w.keyEscaper.escapeKey(key)
+	if _, ok := h.index[key]; ok {
+		return nil
+	}
+
+	if maxColumns := h.w.maxColumns; maxColumns > 0 && len(h.header) >= maxColumns {
+		return &TooManyColumnsError{Columns: len(h.header) + 1, Limit: maxColumns, Column: key}
+	}
+
+	h.index[key] = len(h.header)
+	h.header = append(h.header, key)
+
+	return nil
+}
+
+// sort will order the header if WithAlphabetizeHeaders or WithColumnGroups is
+// used.
+func (h *flatHeader) sort() {
+	less := h.w.headerLess()
+	if less == nil {
+		return
+	}
+
+	sort.Slice(h.header, func(i, j int) bool {
+		return less(h.header[i], h.header[j])
+	})
+
+	for i, key := range h.header {
+		h.index[key] = i
+	}
+}
+
+// column will return the index of the column for the key.
+func (h *flatHeader) column(key string) int {
+	return h.index[h.w.keyEscaper.escapeKey(key)]
+}
+
+// writeFlat writes a list of flat records row by row, without buffering the
+// cells into columns. Only the header is gathered before writing, in the
+// order the keys are first seen.
+func (w *ListWriter) writeFlat(ctx context.Context, list *structpb.ListValue) error {
+	header := newFlatHeader(w)
+
+	for i, value := range list.GetValues() {
+		obj := value.GetStructValue()
+
+		if w.deterministic {
+			for _, key := range sortedKeys(obj) {
+				if err := header.add(key); err != nil {
+					return newValueError(i, key, err)
+				}
+			}
+
+			continue
+		}
+
+		for key := range obj.GetFields() {
+			if err := header.add(key); err != nil {
+				return newValueError(i, key, err)
+			}
+		}
+	}
+
+	header.sort()
+
+	if err := w.writeHeader(w.writer, header.header); err != nil {
+		return err
+	}
+
+	var arena []byte
+
+	format := w.cellFormat()
+
+	values := make([]*structpb.Value, len(header.header))
+
+	for i, value := range list.GetValues() {
+		for j := range values {
+			values[j] = nil
+		}
+
+		for key, field := range value.GetStructValue().GetFields() {
+			values[header.column(key)] = field
+		}
+
+		var (
+			row []string
+			err error
+		)
+
+		if row, arena, err = formatCells(arena, format, header.header, values); err != nil {
+			return fmt.Errorf("failed to format row %d: %w", i, err)
+		}
+
+		if err := w.writeRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
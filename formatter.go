@@ -0,0 +1,79 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ValueFormatter formats the scalar value at a flattened path, such as
+// "user.id", as a cell.
+type ValueFormatter interface {
+	Format(path string, value *structpb.Value) (string, error)
+}
+
+// ValueFormatterFunc is a function that is a ValueFormatter.
+type ValueFormatterFunc func(path string, value *structpb.Value) (string, error)
+
+// Format calls the function.
+func (fn ValueFormatterFunc) Format(path string, value *structpb.Value) (string, error) {
+	return fn(path, value)
+}
+
+// WithValueFormatter configures the ListWriter to format the cells with the
+// ValueFormatter returned by "decorate", which is given the formatter that
+// would otherwise be used. The default formatter applies the formatting
+// options, such as WithCoercion, WithRounding, WithBoolFormat, and
+// WithTimeZone, so "decorate" may handle some values itself and defer the
+// rest to it, or adjust its cells. When the option is used several times, the
+// decorators are applied in order, so the last one is given the first value.
+//
+// Cells that are missing from a row are empty and are not formatted.
+func WithValueFormatter(decorate func(next ValueFormatter) ValueFormatter) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.formatters = append(listWriter.formatters, decorate)
+	}
+}
+
+// defaultFormatter is the ValueFormatter of the formatting options.
+type defaultFormatter struct {
+	w *ListWriter
+}
+
+func (f defaultFormatter) Format(path string, value *structpb.Value) (string, error) {
+	buf, err := f.w.appendValue(nil, path, value)
+	if err != nil {
+		return "", err
+	}
+
+	return string(buf), nil
+}
+
+// cellFormat will return the function that formats the cells, which appends
+// the cells of the default formatter directly to the buffer unless
+// WithValueFormatter is used.
+func (w *ListWriter) cellFormat() formatFunc {
+	if len(w.formatters) == 0 {
+		return w.appendValue
+	}
+
+	var formatter ValueFormatter = defaultFormatter{w: w}
+	for _, decorate := range w.formatters {
+		formatter = decorate(formatter)
+	}
+
+	return func(buf []byte, path string, value *structpb.Value) ([]byte, error) {
+		cell, err := formatter.Format(path, value)
+		if err != nil {
+			return nil, err
+		}
+
+		return append(buf, cell...), nil
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var errRedacted = fmt.Errorf("redacted")
+
+func TestWithValueFormatter(t *testing.T) {
+	t.Parallel()
+
+	// redact handles the secret column itself.
+	redact := func(next ValueFormatter) ValueFormatter {
+		return ValueFormatterFunc(func(path string, value *structpb.Value) (string, error) {
+			if path == "secret" {
+				return "***", nil
+			}
+
+			return next.Format(path, value)
+		})
+	}
+
+	// upper adjusts the cells of the formatters before it.
+	upper := func(next ValueFormatter) ValueFormatter {
+		return ValueFormatterFunc(func(path string, value *structpb.Value) (string, error) {
+			cell, err := next.Format(path, value)
+
+			return strings.ToUpper(cell), err
+		})
+	}
+
+	failing := func(next ValueFormatter) ValueFormatter {
+		return ValueFormatterFunc(func(path string, value *structpb.Value) (string, error) {
+			return "", errRedacted
+		})
+	}
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		opts []ListWriterOption
+		want [][]string
+		err  error
+	}{
+		{
+			name: "flat",
+			data: `[{"name": "a", "secret": "s", "ok": true, "n": 1.5}]`,
+			opts: []ListWriterOption{
+				WithBoolFormat("yes", "no"), WithRounding(0, RoundHalfUp),
+				WithValueFormatter(redact), WithValueFormatter(upper),
+			},
+			want: [][]string{{"n", "name", "ok", "secret"}, {"2", "A", "YES", "***"}},
+		},
+		{
+			name: "nested",
+			data: `[{"user": {"name": "a"}, "secret": 1}, {"user": {}}]`,
+			opts: []ListWriterOption{WithValueFormatter(upper), WithValueFormatter(redact)},
+			want: [][]string{{"secret", "user.name"}, {"***", "A"}, {"", ""}},
+		},
+		{
+			name: "error",
+			data: `[{"name": "a"}]`,
+			opts: []ListWriterOption{WithValueFormatter(failing)},
+			err:  errRedacted,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+
+			err = NewListWriter(&dst, opts...).Write(context.Background(), list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
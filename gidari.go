@@ -0,0 +1,40 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"sync"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// GidariWriter adapts an Encoder to gidari's ListWriter interface, which has
+// the method Write(context.Context, *structpb.ListValue) error, so that the
+// lists extracted from a web API by gidari are written to a single CSV table.
+// Gidari may write lists concurrently, so the GidariWriter serializes calls to
+// the Encoder. The order of the rows follows the order in which the lists are
+// written.
+type GidariWriter struct {
+	mu      sync.Mutex
+	encoder *Encoder
+}
+
+// NewGidariWriter creates a GidariWriter that writes with the Encoder.
+func NewGidariWriter(encoder *Encoder) *GidariWriter {
+	return &GidariWriter{encoder: encoder}
+}
+
+// Write encodes the list, implementing gidari's ListWriter interface.
+func (w *GidariWriter) Write(ctx context.Context, list *structpb.ListValue) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.encoder.Encode(ctx, list)
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestGidariWriter(t *testing.T) {
+	t.Parallel()
+
+	const lists = 20
+
+	var buf bytes.Buffer
+
+	// gidari.ListWriter is not imported to avoid the dependency, so the
+	// interface is restated here to check that it is satisfied.
+	var writer interface {
+		Write(context.Context, *structpb.ListValue) error
+	} = NewGidariWriter(NewEncoder(&buf))
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < lists; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			defer wg.Done()
+
+			list, err := structpb.NewList([]any{map[string]any{"n": i}})
+			if err != nil {
+				t.Error(err)
+
+				return
+			}
+
+			if err := writer.Write(context.Background(), list); err != nil {
+				t.Errorf("failed to write list: %v", err)
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != lists+1 {
+		t.Fatalf("got %d lines, want %d", len(lines), lists+1)
+	}
+
+	if lines[0] != "n" {
+		t.Fatalf("got header %q, want %q", lines[0], "n")
+	}
+}
@@ -2,4 +2,15 @@ module github.com/alpstable/csvpb
 
 go 1.19
 
-require google.golang.org/protobuf v1.28.1
+require (
+	github.com/google/cel-go v0.13.0
+	github.com/klauspost/compress v1.15.12
+	golang.org/x/text v0.3.8
+	google.golang.org/protobuf v1.28.1
+)
+
+require (
+	github.com/antlr/antlr4/runtime/Go/antlr v1.4.10 // indirect
+	github.com/stoewer/go-strcase v1.2.0 // indirect
+	google.golang.org/genproto v0.0.0-20221027153422-115e99e71e1c // indirect
+)
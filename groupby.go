@@ -0,0 +1,242 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// AggFunc aggregates the cells of a column within a group into a single cell.
+type AggFunc func(cells []string) (string, error)
+
+// parseNumbers will parse the non-empty cells as floats.
+func parseNumbers(cells []string) ([]float64, error) {
+	nums := make([]float64, 0, len(cells))
+
+	for _, cell := range cells {
+		if cell == "" {
+			continue
+		}
+
+		num, err := strconv.ParseFloat(cell, 64)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse number: %w", err)
+		}
+
+		nums = append(nums, num)
+	}
+
+	return nums, nil
+}
+
+// AggSum is an AggFunc that sums the numeric cells, ignoring empty cells.
+func AggSum(cells []string) (string, error) {
+	nums, err := parseNumbers(cells)
+	if err != nil {
+		return "", err
+	}
+
+	var sum float64
+	for _, num := range nums {
+		sum += num
+	}
+
+	return fmt.Sprintf("%f", sum), nil
+}
+
+// AggCount is an AggFunc that counts the non-empty cells.
+func AggCount(cells []string) (string, error) {
+	var count int
+
+	for _, cell := range cells {
+		if cell != "" {
+			count++
+		}
+	}
+
+	return strconv.Itoa(count), nil
+}
+
+// aggExtreme will return the numeric cell for which "less" holds against all
+// of the others, or an empty string if there are no numeric cells.
+func aggExtreme(cells []string, less func(a, b float64) bool) (string, error) {
+	nums, err := parseNumbers(cells)
+	if err != nil || len(nums) == 0 {
+		return "", err
+	}
+
+	extreme := nums[0]
+	for _, num := range nums[1:] {
+		if less(num, extreme) {
+			extreme = num
+		}
+	}
+
+	return fmt.Sprintf("%f", extreme), nil
+}
+
+// AggMin is an AggFunc that returns the smallest numeric cell, ignoring empty
+// cells.
+func AggMin(cells []string) (string, error) {
+	return aggExtreme(cells, func(a, b float64) bool { return a < b })
+}
+
+// AggMax is an AggFunc that returns the largest numeric cell, ignoring empty
+// cells.
+func AggMax(cells []string) (string, error) {
+	return aggExtreme(cells, func(a, b float64) bool { return a > b })
+}
+
+type groupBy struct {
+	keys []string
+	aggs map[string]AggFunc
+}
+
+// aggFormat will return the format of the cells of a grouped table, which
+// leaves the numbers of the aggregated columns unformatted, so that they are
+// aggregated by their values rather than by their cells, e.g. "0.125" rather
+// than "12.5%".
+func (w *ListWriter) aggFormat(format formatFunc) formatFunc {
+	return func(buf []byte, path string, value *structpb.Value) ([]byte, error) {
+		if _, ok := w.groupBy.aggs[path]; !ok {
+			return format(buf, path, value)
+		}
+
+		if _, ok := w.mapValue(path, value); ok {
+			return format(buf, path, value)
+		}
+
+		switch valType := value.Kind.(type) {
+		case *structpb.Value_NumberValue:
+			return strconv.AppendFloat(buf, valType.NumberValue, 'f', -1, 64), nil
+		case *structpb.Value_StringValue:
+			if _, err := strconv.ParseFloat(valType.StringValue, 64); err == nil {
+				return append(buf, valType.StringValue...), nil
+			}
+		}
+
+		return format(buf, path, value)
+	}
+}
+
+// formatAgg will format the numeric aggregate of the column as its cells are
+// formatted by WithCurrencyColumns or WithPercentColumns. Other aggregates are
+// returned as they are.
+func (w *ListWriter) formatAgg(header, agg string) string {
+	num, err := strconv.ParseFloat(agg, 64)
+	if err != nil {
+		return agg
+	}
+
+	value := structpb.NewNumberValue(num)
+
+	if code, ok := w.currencyColumns[header]; ok {
+		if buf, ok := w.appendCurrency(nil, value, code); ok {
+			return string(buf)
+		}
+	}
+
+	if decimals, ok := w.percentColumns[header]; ok {
+		if buf, ok := w.appendPercent(nil, value, decimals); ok {
+			return string(buf)
+		}
+	}
+
+	return agg
+}
+
+// apply will group the rows of the table by the key columns, producing a table
+// with the key columns followed by the aggregated columns in alphabetical
+// order. Groups are written in the order they are first seen. The rows are read
+// from "rows", since they may not be held in the table. Each aggregate is
+// formatted by "format".
+func (gb *groupBy) apply(table *Table, rows rowIter, format func(header, agg string) string) (*Table, error) {
+	index := make(map[string]int, len(table.Header))
+	for i, header := range table.Header {
+		index[header] = i
+	}
+
+	cell := func(row []string, header string) string {
+		if i, ok := index[header]; ok {
+			return row[i]
+		}
+
+		return ""
+	}
+
+	aggHeaders := make([]string, 0, len(gb.aggs))
+	for header := range gb.aggs {
+		aggHeaders = append(aggHeaders, header)
+	}
+
+	sort.Strings(aggHeaders)
+
+	var groupKeys []string
+
+	groups := make(map[string][][]string)
+
+	err := rows(func(row []string) error {
+		keyCells := make([]string, len(gb.keys))
+		for i, key := range gb.keys {
+			keyCells[i] = cell(row, key)
+		}
+
+		// Use the unit separator to avoid collisions between the key
+		// cells.
+		groupKey := strings.Join(keyCells, "\x1f")
+		if _, ok := groups[groupKey]; !ok {
+			groupKeys = append(groupKeys, groupKey)
+		}
+
+		groups[groupKey] = append(groups[groupKey], row)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	grouped := &Table{
+		Header: append(append([]string{}, gb.keys...), aggHeaders...),
+		Rows:   make([][]string, 0, len(groupKeys)),
+		Stats:  table.Stats,
+	}
+
+	for _, groupKey := range groupKeys {
+		rows := groups[groupKey]
+		out := make([]string, 0, len(grouped.Header))
+
+		for _, key := range gb.keys {
+			out = append(out, cell(rows[0], key))
+		}
+
+		for _, header := range aggHeaders {
+			cells := make([]string, len(rows))
+			for i, row := range rows {
+				cells[i] = cell(row, header)
+			}
+
+			agg, err := gb.aggs[header](cells)
+			if err != nil {
+				return nil, fmt.Errorf("failed to aggregate column %q: %w", header, err)
+			}
+
+			out = append(out, format(header, agg))
+		}
+
+		grouped.Rows = append(grouped.Rows, out)
+	}
+
+	return grouped, nil
+}
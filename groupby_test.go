@@ -0,0 +1,120 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWriteGroupBy(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"region": "us", "amount": 1},
+		{"region": "eu", "amount": 5},
+		{"region": "us", "amount": 3},
+		{"region": "us", "amount": null}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst, WithGroupBy([]string{"region"}, map[string]AggFunc{
+		"amount": AggSum,
+		"count":  AggCount,
+		"min":    AggMin,
+	}))
+
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	// Columns that do not exist aggregate over empty cells.
+	want := [][]string{
+		{"region", "amount", "count", "min"},
+		{"us", "4.000000", "0", ""},
+		{"eu", "5.000000", "0", ""},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
+
+func TestWriteGroupByFormatted(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"region": "us", "price": 1.25, "ratio": 0.125},
+		{"region": "eu", "price": 5, "ratio": 0.5},
+		{"region": "us", "price": 3, "ratio": 0.25}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst,
+		WithCurrencyColumns("USD", "price"),
+		WithPercentColumns(1, "ratio"),
+		WithGroupBy([]string{"region"}, map[string]AggFunc{
+			"price": AggSum,
+			"ratio": AggMax,
+		}))
+
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	// The numbers are aggregated before they are formatted.
+	want := [][]string{
+		{"region", "price", "ratio"},
+		{"us", "4.25 USD", "25.0%"},
+		{"eu", "5.00 USD", "50.0%"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
+
+func TestAggFuncs(t *testing.T) {
+	t.Parallel()
+
+	cells := []string{"2", "", "1.5", "3"}
+
+	for _, tcase := range []struct {
+		name string
+		agg  AggFunc
+		want string
+	}{
+		{"sum", AggSum, "6.500000"},
+		{"count", AggCount, "3"},
+		{"min", AggMin, "1.500000"},
+		{"max", AggMax, "3.000000"},
+	} {
+		got, err := tcase.agg(cells)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tcase.name, err)
+		}
+
+		if got != tcase.want {
+			t.Fatalf("%s: got %q, want %q", tcase.name, got, tcase.want)
+		}
+	}
+
+	if _, err := AggSum([]string{"foo"}); err == nil {
+		t.Fatal("expected error for non-numeric cell")
+	}
+}
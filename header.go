@@ -0,0 +1,102 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// ErrDuplicateHeader is returned when WithDuplicateHeaderError is used and
+// two columns are written with the same header.
+var ErrDuplicateHeader = fmt.Errorf("duplicate header")
+
+// WithDuplicateHeaderError configures the ListWriter to return
+// ErrDuplicateHeader, without writing the header, when two columns would be
+// written with the same header, e.g. "café" and "cafe" with WithASCIIHeaders.
+// By default, such headers are disambiguated: the first column keeps the
+// header, and each later one gets the first of the suffixes "_2", "_3", and so
+// on that is not the header of another column.
+func WithDuplicateHeaderError() ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.dupHeaderError = true
+	}
+}
+
+// outputHeader will return the header as it is written, after the header
+// transforms, with any duplicates disambiguated.
+func (w *ListWriter) outputHeader(header []string) ([]string, error) {
+	out := header
+	if w.asciiHeaders {
+		out = make([]string, len(header))
+		for i, name := range header {
+			out[i] = asciiHeader(name)
+		}
+	}
+
+	return w.uniqueHeader(header, out)
+}
+
+// uniqueNames will disambiguate the duplicate names: the first keeps the name,
+// and each later one gets the first of the suffixes "_2", "_3", and so on that
+// is not another name. The index of the first duplicate is returned, or -1 if
+// there are none.
+func uniqueNames(names []string) ([]string, int) {
+	first := make(map[string]bool, len(names))
+
+	var duplicates []int
+
+	for i, name := range names {
+		if first[name] {
+			duplicates = append(duplicates, i)
+
+			continue
+		}
+
+		first[name] = true
+	}
+
+	if len(duplicates) == 0 {
+		return names, -1
+	}
+
+	unique := append([]string{}, names...)
+
+	for _, i := range duplicates {
+		for n := 2; ; n++ {
+			name := names[i] + "_" + strconv.Itoa(n)
+			if !first[name] {
+				unique[i] = name
+				first[name] = true
+
+				break
+			}
+		}
+	}
+
+	return unique, duplicates[0]
+}
+
+// uniqueHeader will disambiguate the duplicates of the output header, or
+// return ErrDuplicateHeader, reporting the columns by their original header.
+func (w *ListWriter) uniqueHeader(header, out []string) ([]string, error) {
+	unique, dup := uniqueNames(out)
+	if dup < 0 || !w.dupHeaderError {
+		return unique, nil
+	}
+
+	for i, name := range out[:dup] {
+		if name == out[dup] {
+			return nil, fmt.Errorf("%w: %q and %q are both written as %q",
+				ErrDuplicateHeader, header[i], header[dup], out[dup])
+		}
+	}
+
+	return nil, fmt.Errorf("%w: %q", ErrDuplicateHeader, out[dup])
+}
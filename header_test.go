@@ -0,0 +1,126 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestDuplicateHeaders(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		opts []ListWriterOption
+		want [][]string
+		err  error
+	}{
+		{
+			name: "unique",
+			data: `[{"café": 1, "tea": 2}]`,
+			opts: []ListWriterOption{WithASCIIHeaders()},
+			want: [][]string{{"cafe", "tea"}, {"1", "2"}},
+		},
+		{
+			name: "disambiguated",
+			data: `[{"cafe": 1, "cafè": 2, "café": 3}]`,
+			opts: []ListWriterOption{WithASCIIHeaders()},
+			want: [][]string{{"cafe", "cafe_2", "cafe_3"}, {"1", "2", "3"}},
+		},
+		{
+			name: "suffix taken",
+			data: `[{"cafe": 1, "cafe_2": 2, "café": 3}]`,
+			opts: []ListWriterOption{WithASCIIHeaders()},
+			want: [][]string{{"cafe", "cafe_2", "cafe_3"}, {"1", "2", "3"}},
+		},
+		{
+			name: "nested",
+			data: `[{"prix": {"é": 1, "e": 2}}]`,
+			opts: []ListWriterOption{WithASCIIHeaders()},
+			want: [][]string{{"prix.e", "prix.e_2"}, {"2", "1"}},
+		},
+		{
+			name: "error",
+			data: `[{"cafe": 1, "café": 2}]`,
+			opts: []ListWriterOption{WithASCIIHeaders(), WithDuplicateHeaderError()},
+			err:  ErrDuplicateHeader,
+		},
+		{
+			name: "empty input header",
+			data: `[]`,
+			opts: []ListWriterOption{WithEmptyInput(EmptyInputHeader, "id", "id")},
+			want: [][]string{{"id", "id_2"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders(), WithRounding(0, RoundHalfUp)},
+				tcase.opts...)
+
+			err = NewListWriter(&dst, opts...).Write(context.Background(), list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				if len(dst.records) != 0 {
+					t.Fatalf("got records %q", dst.records)
+				}
+
+				if ErrorCategory(err) == "writer" {
+					t.Fatalf("got category %q", ErrorCategory(err))
+				}
+
+				return
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestEncoderDuplicateHeaders(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+
+	enc := NewEncoder(&buf, WithASCIIHeaders(), WithRepeatHeader(nil), WithRounding(0, RoundHalfUp))
+
+	for _, data := range []string{`[{"é": 1}]`, `[{"é": 2, "e": 3}]`} {
+		list, err := Decode(DecodeTypeJSON, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if got, want := buf.String(), "e\n1\ne,e_2\n2,3\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,218 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrUnknownColumnType is returned when a column type name cannot be parsed.
+var ErrUnknownColumnType = fmt.Errorf("unknown column type")
+
+// ColumnType is the type of a column inferred from its cells, e.g. for writer
+// backends that require a typed schema.
+type ColumnType int32
+
+const (
+	// ColumnTypeString is a column of text, or of mixed types.
+	ColumnTypeString ColumnType = iota
+
+	// ColumnTypeInt is a column of integers.
+	ColumnTypeInt
+
+	// ColumnTypeFloat is a column of numbers, some of which are not
+	// integers.
+	ColumnTypeFloat
+
+	// ColumnTypeBool is a column of booleans.
+	ColumnTypeBool
+)
+
+var columnTypeNames = map[ColumnType]string{
+	ColumnTypeString: "string",
+	ColumnTypeInt:    "int",
+	ColumnTypeFloat:  "float",
+	ColumnTypeBool:   "bool",
+}
+
+// String returns the name of the column type.
+func (t ColumnType) String() string {
+	if name, ok := columnTypeNames[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("ColumnType(%d)", t)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (t ColumnType) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that a Schema can be
+// read back from JSON.
+func (t *ColumnType) UnmarshalText(text []byte) error {
+	for typ, name := range columnTypeNames {
+		if name == string(text) {
+			*t = typ
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownColumnType, text)
+}
+
+// SchemaColumn is a column of a Schema.
+type SchemaColumn struct {
+	Name string     `json:"name"`
+	Type ColumnType `json:"type"`
+}
+
+// Schema is the columns of a table, in order, with the type inferred for each
+// from its cells.
+type Schema struct {
+	Columns []SchemaColumn `json:"columns"`
+}
+
+// Fingerprint returns a stable hash of the columns of the schema, as the hex
+// SHA-256 of their names and types in order of name, so that a change to the
+// schema between runs can be detected by comparing fingerprints. The order of
+// the columns does not change the fingerprint.
+func (schema *Schema) Fingerprint() string {
+	columns := make([]SchemaColumn, len(schema.Columns))
+	copy(columns, schema.Columns)
+
+	sort.Slice(columns, func(i, j int) bool {
+		if columns[i].Name != columns[j].Name {
+			return columns[i].Name < columns[j].Name
+		}
+
+		return columns[i].Type < columns[j].Type
+	})
+
+	hash := sha256.New()
+
+	// The names are quoted, so that no name can be mistaken for another
+	// name and type.
+	for _, col := range columns {
+		fmt.Fprintf(hash, "%q:%s\n", col.Name, col.Type)
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// InferSchema returns the schema of the table. Empty cells are ignored,
+// integers are widened to floats when a column has both, and any other mix of
+// types is a string. Cells with leading zeros, such as zip codes, are strings.
+func InferSchema(table Table) *Schema {
+	schema := &Schema{Columns: make([]SchemaColumn, len(table.Header))}
+
+	for i, header := range table.Header {
+		schema.Columns[i] = SchemaColumn{Name: header, Type: inferCellType(table.Rows, i)}
+	}
+
+	return schema
+}
+
+// parseCellType will return the narrowest type that the non-empty cell can be
+// parsed as.
+func parseCellType(cell string) ColumnType {
+	// Leading zeros are significant, e.g. zip codes.
+	if len(cell) > 1 && cell[0] == '0' && cell[1] != '.' {
+		return ColumnTypeString
+	}
+
+	if _, err := strconv.ParseInt(cell, 10, 64); err == nil {
+		return ColumnTypeInt
+	}
+
+	// ParseFloat also accepts "NaN", "Inf", and hexadecimal floats, which
+	// are not numbers in CSV.
+	if strings.Trim(cell, "0123456789+-.eE") == "" {
+		if _, err := strconv.ParseFloat(cell, 64); err == nil {
+			return ColumnTypeFloat
+		}
+	}
+
+	if cell == "true" || cell == "false" {
+		return ColumnTypeBool
+	}
+
+	return ColumnTypeString
+}
+
+// typeInference infers the type of a column from its cells, one at a time.
+// Empty cells are ignored, integers are widened to floats, and any other mix
+// of types is a string.
+type typeInference struct {
+	typ   ColumnType
+	seen  bool
+	mixed bool
+}
+
+// observe will update the inferred type with the cell.
+func (inf *typeInference) observe(cell string) {
+	if cell == "" || inf.mixed {
+		return
+	}
+
+	cur := parseCellType(cell)
+
+	switch {
+	case !inf.seen, cur == inf.typ:
+		inf.typ = cur
+	case cur == ColumnTypeFloat && inf.typ == ColumnTypeInt,
+		cur == ColumnTypeInt && inf.typ == ColumnTypeFloat:
+		inf.typ = ColumnTypeFloat
+	default:
+		inf.typ = ColumnTypeString
+		inf.mixed = true
+	}
+
+	inf.seen = true
+}
+
+// inferCellType will return the type of the column at index "col", given the
+// rows.
+func inferCellType(rows [][]string, col int) ColumnType {
+	var inf typeInference
+
+	for _, row := range rows {
+		if col < len(row) {
+			inf.observe(row[col])
+		}
+
+		if inf.mixed {
+			break
+		}
+	}
+
+	return inf.typ
+}
+
+// cellConforms will return true if the non-empty cell can be written as the
+// given type.
+func cellConforms(cell string, typ ColumnType) bool {
+	switch cur := parseCellType(cell); typ {
+	case ColumnTypeString:
+		return true
+	case ColumnTypeFloat:
+		return cur == ColumnTypeFloat || cur == ColumnTypeInt
+	case ColumnTypeInt, ColumnTypeBool:
+		return cur == typ
+	default:
+		return false
+	}
+}
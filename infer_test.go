@@ -0,0 +1,94 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "testing"
+
+func TestSchemaFingerprint(t *testing.T) {
+	t.Parallel()
+
+	schema := &Schema{Columns: []SchemaColumn{
+		{Name: "id", Type: ColumnTypeInt},
+		{Name: "name", Type: ColumnTypeString},
+	}}
+
+	got := schema.Fingerprint()
+	if len(got) != 64 {
+		t.Fatalf("got fingerprint %q, want 64 hex digits", got)
+	}
+
+	for _, tcase := range []struct {
+		name    string
+		columns []SchemaColumn
+		same    bool
+	}{
+		{
+			name: "reordered",
+			columns: []SchemaColumn{
+				{Name: "name", Type: ColumnTypeString},
+				{Name: "id", Type: ColumnTypeInt},
+			},
+			same: true,
+		},
+		{
+			name: "type changed",
+			columns: []SchemaColumn{
+				{Name: "id", Type: ColumnTypeFloat},
+				{Name: "name", Type: ColumnTypeString},
+			},
+		},
+		{
+			name: "column added",
+			columns: []SchemaColumn{
+				{Name: "id", Type: ColumnTypeInt},
+				{Name: "name", Type: ColumnTypeString},
+				{Name: "ok", Type: ColumnTypeBool},
+			},
+		},
+		{
+			name: "name with separators",
+			columns: []SchemaColumn{
+				{Name: "id\":int\n\"name", Type: ColumnTypeString},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			other := (&Schema{Columns: tcase.columns}).Fingerprint()
+			if same := other == got; same != tcase.same {
+				t.Fatalf("got same fingerprint %t, want %t", same, tcase.same)
+			}
+		})
+	}
+}
+
+func TestParseCellType(t *testing.T) {
+	t.Parallel()
+
+	for cell, want := range map[string]ColumnType{
+		"42":       ColumnTypeInt,
+		"-1.5e3":   ColumnTypeFloat,
+		"0.5":      ColumnTypeFloat,
+		"02134":    ColumnTypeString,
+		"true":     ColumnTypeBool,
+		"NaN":      ColumnTypeString,
+		"Inf":      ColumnTypeString,
+		"-Inf":     ColumnTypeString,
+		"infinity": ColumnTypeString,
+		"0x1p-2":   ColumnTypeString,
+		"e":        ColumnTypeString,
+	} {
+		if got := parseCellType(cell); got != want {
+			t.Errorf("got %v for %q, want %v", got, cell, want)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+var (
+	// ErrJoinColumn is returned by JoinTables when there are no join
+	// columns, or a join column is not in both tables.
+	ErrJoinColumn = fmt.Errorf("invalid join column")
+
+	// ErrUnknownJoinKind is returned when a join kind cannot be parsed, or
+	// JoinTables is given an unknown join kind.
+	ErrUnknownJoinKind = fmt.Errorf("unknown join kind")
+)
+
+// JoinKind is the kind of join done by JoinTables.
+type JoinKind int32
+
+const (
+	// JoinInner keeps the rows of the left table that match a row of the
+	// right table.
+	JoinInner JoinKind = iota
+
+	// JoinLeft keeps every row of the left table, with empty cells for the
+	// columns of the right table if no row matches.
+	JoinLeft
+)
+
+var joinKindNames = map[JoinKind]string{
+	JoinInner: "inner",
+	JoinLeft:  "left",
+}
+
+// String returns the name of the join kind.
+func (k JoinKind) String() string {
+	if name, ok := joinKindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("JoinKind(%d)", k)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k JoinKind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler.
+func (k *JoinKind) UnmarshalText(text []byte) error {
+	for kind, name := range joinKindNames {
+		if name == string(text) {
+			*k = kind
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownJoinKind, text)
+}
+
+// joinColumns will return the indexes of the join columns in the header.
+func joinColumns(header, on []string) ([]int, error) {
+	index := make(map[string]int, len(header))
+	for i, name := range header {
+		index[name] = i
+	}
+
+	cols := make([]int, len(on))
+
+	for i, name := range on {
+		col, ok := index[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not in the table", ErrJoinColumn, name)
+		}
+
+		cols[i] = col
+	}
+
+	return cols, nil
+}
+
+// joinKey will return the key of the row in the join columns, and false if a
+// join cell is empty.
+func joinKey(row []string, cols []int) (string, bool) {
+	cells := make([]string, len(cols))
+
+	for i, col := range cols {
+		if col >= len(row) || row[col] == "" {
+			return "", false
+		}
+
+		cells[i] = row[col]
+	}
+
+	// Marshaling strings cannot fail.
+	key, _ := json.Marshal(cells)
+
+	return string(key), true
+}
+
+// cellStats will count the statistics of the column at "col" from its cells,
+// with empty cells as nulls.
+func cellStats(rows [][]string, col int) ColumnStats {
+	var stats ColumnStats
+
+	for _, row := range rows {
+		stats.Values++
+
+		if row[col] == "" {
+			stats.Nulls++
+
+			continue
+		}
+
+		if num, err := strconv.ParseFloat(row[col], 64); err == nil {
+			stats.Numbers++
+			stats.Sum += num
+		}
+	}
+
+	return stats
+}
+
+// JoinTables joins the rows of the tables whose cells are equal in the "on"
+// columns, e.g. to write users and their orders, flattened by the ListWriter
+// from two payloads, as one CSV. The joined table has the columns of the left
+// table, followed by those of the right table other than the join columns. A
+// right column with the same header as a left column is disambiguated with a
+// suffix, as duplicate headers are written. The rows are in the order of the
+// left table, and a left row that matches several right rows is repeated for
+// each of them, in their order. As in SQL, a row with an empty join cell
+// matches no row. The statistics of the joined table are counted from its
+// cells, with empty cells as nulls.
+func JoinTables(left, right *Table, on []string, kind JoinKind) (*Table, error) {
+	if _, ok := joinKindNames[kind]; !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownJoinKind, kind)
+	}
+
+	if len(on) == 0 {
+		return nil, fmt.Errorf("%w: no join columns", ErrJoinColumn)
+	}
+
+	leftCols, err := joinColumns(left.Header, on)
+	if err != nil {
+		return nil, fmt.Errorf("left: %w", err)
+	}
+
+	rightCols, err := joinColumns(right.Header, on)
+	if err != nil {
+		return nil, fmt.Errorf("right: %w", err)
+	}
+
+	isKey := make(map[int]bool, len(rightCols))
+	for _, col := range rightCols {
+		isKey[col] = true
+	}
+
+	header := append([]string{}, left.Header...)
+
+	var rest []int
+
+	for i, name := range right.Header {
+		if !isKey[i] {
+			header = append(header, name)
+			rest = append(rest, i)
+		}
+	}
+
+	header, _ = uniqueNames(header)
+
+	matches := make(map[string][]int, len(right.Rows))
+
+	for i, row := range right.Rows {
+		if key, ok := joinKey(row, rightCols); ok {
+			matches[key] = append(matches[key], i)
+		}
+	}
+
+	joined := &Table{Header: header, Stats: make(map[string]ColumnStats, len(header))}
+
+	appendRow := func(leftRow, rightRow []string) {
+		row := make([]string, len(header))
+		copy(row, leftRow)
+
+		for i, col := range rest {
+			if col < len(rightRow) {
+				row[len(left.Header)+i] = rightRow[col]
+			}
+		}
+
+		joined.Rows = append(joined.Rows, row)
+	}
+
+	for _, row := range left.Rows {
+		key, ok := joinKey(row, leftCols)
+
+		if ok && len(matches[key]) > 0 {
+			for _, i := range matches[key] {
+				appendRow(row, right.Rows[i])
+			}
+
+			continue
+		}
+
+		if kind == JoinLeft {
+			appendRow(row, nil)
+		}
+	}
+
+	for i, name := range header {
+		joined.Stats[name] = cellStats(joined.Rows, i)
+	}
+
+	return joined, nil
+}
@@ -0,0 +1,156 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestJoinTables(t *testing.T) {
+	t.Parallel()
+
+	users := &Table{
+		Header: []string{"id", "name"},
+		Rows:   [][]string{{"1", "ann"}, {"2", "bob"}, {"", "nobody"}, {"3", "cy"}},
+	}
+
+	orders := &Table{
+		Header: []string{"order", "id", "name"},
+		Rows:   [][]string{{"a", "1", "pen"}, {"b", "3", "ink"}, {"c", "1", "pad"}, {"d", "", "cup"}},
+	}
+
+	for _, tcase := range []struct {
+		name string
+		on   []string
+		kind JoinKind
+		want *Table
+		err  error
+	}{
+		{
+			name: "inner",
+			on:   []string{"id"},
+			kind: JoinInner,
+			want: &Table{
+				Header: []string{"id", "name", "order", "name_2"},
+				Rows:   [][]string{{"1", "ann", "a", "pen"}, {"1", "ann", "c", "pad"}, {"3", "cy", "b", "ink"}},
+			},
+		},
+		{
+			name: "left",
+			on:   []string{"id"},
+			kind: JoinLeft,
+			want: &Table{
+				Header: []string{"id", "name", "order", "name_2"},
+				Rows: [][]string{
+					{"1", "ann", "a", "pen"},
+					{"1", "ann", "c", "pad"},
+					{"2", "bob", "", ""},
+					{"", "nobody", "", ""},
+					{"3", "cy", "b", "ink"},
+				},
+			},
+		},
+		{
+			name: "several columns",
+			on:   []string{"id", "name"},
+			kind: JoinInner,
+			want: &Table{Header: []string{"id", "name", "order"}},
+		},
+		{
+			name: "missing column",
+			on:   []string{"user"},
+			err:  ErrJoinColumn,
+		},
+		{
+			name: "no columns",
+			err:  ErrJoinColumn,
+		},
+		{
+			name: "unknown kind",
+			on:   []string{"id"},
+			kind: JoinKind(7),
+			err:  ErrUnknownJoinKind,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := JoinTables(users, orders, tcase.on, tcase.kind)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if !reflect.DeepEqual(got.Header, tcase.want.Header) || !reflect.DeepEqual(got.Rows, tcase.want.Rows) {
+				t.Fatalf("got %q %q, want %q %q", got.Header, got.Rows, tcase.want.Header, tcase.want.Rows)
+			}
+		})
+	}
+}
+
+func TestWriteJoinedTable(t *testing.T) {
+	t.Parallel()
+
+	decode := func(data string) *Table {
+		t.Helper()
+
+		list, err := Decode(DecodeTypeJSON, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		table, err := NewListWriter(nil, WithAlphabetizeHeaders(), WithRounding(0, RoundHalfUp)).
+			Table(context.Background(), list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return table
+	}
+
+	users := decode(`[{"user": {"id": 1}, "name": "ann"}, {"user": {"id": 2}, "name": "bob"}]`)
+	orders := decode(`[{"user": {"id": 2}, "total": 5}, {"user": {"id": 1}, "total": 3},
+		{"user": {"id": 2}, "total": 4}]`)
+
+	joined, err := JoinTables(users, orders, []string{"user.id"}, JoinLeft)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := joined.Stats["total"]; got.Values != 3 || got.Numbers != 3 || got.Sum != 12 {
+		t.Fatalf("got stats %+v", got)
+	}
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithSortBy("total"), WithTotalsRow("total")).WriteTable(context.Background(), joined)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"name", "user.id", "total"},
+		{"ann", "1", "3"},
+		{"bob", "2", "4"},
+		{"bob", "2", "5"},
+		{"TOTAL", "", "12.000000"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %q, want %q", dst.records, want)
+	}
+}
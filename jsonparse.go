@@ -0,0 +1,560 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"strconv"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// maxJSONDepth is the deepest nesting of objects and arrays that is parsed,
+// which keeps malicious input from exhausting the stack.
+const maxJSONDepth = 10000
+
+// maxSlabSize is the largest number of values allocated at once by a slab.
+const maxSlabSize = 1024
+
+// slab allocates values in batches, so that decoding a large array does not
+// allocate every value separately. Batches start small and double, so small
+// inputs do not pay for a large batch.
+type slab[T any] struct {
+	buf  []T
+	size int
+}
+
+func (s *slab[T]) alloc() *T {
+	if len(s.buf) == 0 {
+		if s.size < maxSlabSize {
+			s.size = 2*s.size + 8
+		}
+
+		s.buf = make([]T, s.size)
+	}
+
+	value := &s.buf[0]
+	s.buf = s.buf[1:]
+
+	return value
+}
+
+// allocSlice will return a slice of length "n" that cannot be appended to
+// without copying, so the slices handed out do not overlap.
+func (s *slab[T]) allocSlice(n int) []T {
+	if n > len(s.buf) {
+		if n > maxSlabSize {
+			return make([]T, n)
+		}
+
+		if s.size < maxSlabSize {
+			s.size = 2*s.size + 8
+		}
+
+		if s.size < n {
+			s.size = n
+		}
+
+		s.buf = make([]T, s.size)
+	}
+
+	values := s.buf[:n:n]
+	s.buf = s.buf[n:]
+
+	return values
+}
+
+// jsonField is an object member that has been parsed but not yet added to
+// its object.
+type jsonField struct {
+	key   string
+	value *structpb.Value
+}
+
+// jsonParser decodes JSON directly into structpb values. Decoding through
+// protojson allocates every value, kind, and string separately; the parser
+// instead allocates them from slabs, and strings without escapes share the
+// memory of a single copy of the input.
+type jsonParser struct {
+	data []byte
+	text string
+	pos  int
+
+	// values and fields are stacks of the members of the arrays and
+	// objects being parsed.
+	values []*structpb.Value
+	fields []jsonField
+
+	valueSlab  slab[structpb.Value]
+	ptrSlab    slab[*structpb.Value]
+	numberSlab slab[structpb.Value_NumberValue]
+	stringSlab slab[structpb.Value_StringValue]
+	boolSlab   slab[structpb.Value_BoolValue]
+	nullSlab   slab[structpb.Value_NullValue]
+	structSlab slab[structpb.Struct]
+	objectSlab slab[structpb.Value_StructValue]
+	listSlab   slab[structpb.ListValue]
+	arraySlab  slab[structpb.Value_ListValue]
+}
+
+func newJSONParser(data []byte) *jsonParser {
+	return &jsonParser{data: data, text: string(data)}
+}
+
+// parse will parse the data as a single JSON value.
+func (p *jsonParser) parse() (*structpb.Value, error) {
+	value, err := p.parseValue(0)
+	if err != nil {
+		return nil, err
+	}
+
+	p.skipSpace()
+
+	if p.pos < len(p.data) {
+		return nil, p.syntaxError("after top-level value")
+	}
+
+	return value, nil
+}
+
+// recordSeparator precedes each JSON text of an RFC 7464 sequence.
+const recordSeparator = 0x1e
+
+// skipSeparators will advance past the white space and record separators
+// between the values of a sequence.
+func (p *jsonParser) skipSeparators() {
+	for p.skipSpace(); p.pos < len(p.data) && p.data[p.pos] == recordSeparator; p.skipSpace() {
+		p.pos++
+	}
+}
+
+// parseSeq will parse the data as a sequence of JSON values, which may be
+// separated by white space and record separators.
+func (p *jsonParser) parseSeq() ([]*structpb.Value, error) {
+	var values []*structpb.Value
+
+	for p.skipSeparators(); p.pos < len(p.data); p.skipSeparators() {
+		value, err := p.parseValue(0)
+		if err != nil {
+			return nil, fmt.Errorf("document %d: %w", len(values), err)
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+// syntaxError will return an error for the character at the current position.
+func (p *jsonParser) syntaxError(context string) error {
+	if p.pos >= len(p.data) {
+		return fmt.Errorf("unexpected end of input")
+	}
+
+	return fmt.Errorf("invalid character %q %s at offset %d", p.data[p.pos], context, p.pos)
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.data) {
+		switch p.data[p.pos] {
+		case ' ', '\t', '\n', '\r':
+			p.pos++
+		default:
+			return
+		}
+	}
+}
+
+// consume will advance past "literal" if the data continues with it.
+func (p *jsonParser) consume(literal string) bool {
+	if len(p.data)-p.pos < len(literal) || p.text[p.pos:p.pos+len(literal)] != literal {
+		return false
+	}
+
+	p.pos += len(literal)
+
+	return true
+}
+
+func (p *jsonParser) parseValue(depth int) (*structpb.Value, error) {
+	p.skipSpace()
+
+	if p.pos >= len(p.data) {
+		return nil, p.syntaxError("")
+	}
+
+	switch c := p.data[p.pos]; {
+	case c == '{':
+		return p.parseObject(depth + 1)
+	case c == '[':
+		return p.parseArray(depth + 1)
+	case c == '"':
+		str, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+
+		kind := p.stringSlab.alloc()
+		kind.StringValue = str
+
+		value := p.valueSlab.alloc()
+		value.Kind = kind
+
+		return value, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		num, err := p.parseNumber()
+		if err != nil {
+			return nil, err
+		}
+
+		kind := p.numberSlab.alloc()
+		kind.NumberValue = num
+
+		value := p.valueSlab.alloc()
+		value.Kind = kind
+
+		return value, nil
+	case p.consume("true"):
+		kind := p.boolSlab.alloc()
+		kind.BoolValue = true
+
+		value := p.valueSlab.alloc()
+		value.Kind = kind
+
+		return value, nil
+	case p.consume("false"):
+		value := p.valueSlab.alloc()
+		value.Kind = p.boolSlab.alloc()
+
+		return value, nil
+	case p.consume("null"):
+		value := p.valueSlab.alloc()
+		value.Kind = p.nullSlab.alloc()
+
+		return value, nil
+	default:
+		return nil, p.syntaxError("looking for beginning of value")
+	}
+}
+
+func (p *jsonParser) parseObject(depth int) (*structpb.Value, error) {
+	if depth > maxJSONDepth {
+		return nil, fmt.Errorf("exceeded max depth at offset %d", p.pos)
+	}
+
+	p.pos++ // '{'
+
+	base := len(p.fields)
+	defer func() { p.fields = p.fields[:base] }()
+
+	p.skipSpace()
+
+	if !p.consume("}") {
+		for {
+			p.skipSpace()
+
+			if p.pos >= len(p.data) || p.data[p.pos] != '"' {
+				return nil, p.syntaxError("looking for beginning of object key string")
+			}
+
+			key, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+
+			p.skipSpace()
+
+			if !p.consume(":") {
+				return nil, p.syntaxError("after object key")
+			}
+
+			value, err := p.parseValue(depth)
+			if err != nil {
+				return nil, err
+			}
+
+			p.fields = append(p.fields, jsonField{key: key, value: value})
+
+			p.skipSpace()
+
+			if p.consume("}") {
+				break
+			}
+
+			if !p.consume(",") {
+				return nil, p.syntaxError("after object key:value pair")
+			}
+		}
+	}
+
+	members := p.fields[base:]
+	fields := make(map[string]*structpb.Value, len(members))
+
+	for _, member := range members {
+		if _, ok := fields[member.key]; ok {
+			return nil, fmt.Errorf("duplicate key %q in object ending at offset %d", member.key, p.pos)
+		}
+
+		fields[member.key] = member.value
+	}
+
+	record := p.structSlab.alloc()
+	record.Fields = fields
+
+	kind := p.objectSlab.alloc()
+	kind.StructValue = record
+
+	value := p.valueSlab.alloc()
+	value.Kind = kind
+
+	return value, nil
+}
+
+func (p *jsonParser) parseArray(depth int) (*structpb.Value, error) {
+	if depth > maxJSONDepth {
+		return nil, fmt.Errorf("exceeded max depth at offset %d", p.pos)
+	}
+
+	p.pos++ // '['
+
+	base := len(p.values)
+	defer func() { p.values = p.values[:base] }()
+
+	p.skipSpace()
+
+	if !p.consume("]") {
+		for {
+			value, err := p.parseValue(depth)
+			if err != nil {
+				return nil, err
+			}
+
+			p.values = append(p.values, value)
+
+			p.skipSpace()
+
+			if p.consume("]") {
+				break
+			}
+
+			if !p.consume(",") {
+				return nil, p.syntaxError("after array element")
+			}
+		}
+	}
+
+	list := p.listSlab.alloc()
+
+	if n := len(p.values) - base; n > 0 {
+		list.Values = p.ptrSlab.allocSlice(n)
+		copy(list.Values, p.values[base:])
+	}
+
+	kind := p.arraySlab.alloc()
+	kind.ListValue = list
+
+	value := p.valueSlab.alloc()
+	value.Kind = kind
+
+	return value, nil
+}
+
+// parseNumber will parse the number at the current position, which must be
+// valid JSON and finite as a float64.
+func (p *jsonParser) parseNumber() (float64, error) {
+	start := p.pos
+
+	digits := func() int {
+		n := 0
+		for p.pos < len(p.data) && p.data[p.pos] >= '0' && p.data[p.pos] <= '9' {
+			p.pos++
+			n++
+		}
+
+		return n
+	}
+
+	p.consume("-")
+
+	switch {
+	case p.consume("0"):
+	case digits() == 0:
+		return 0, p.syntaxError("in numeric literal")
+	}
+
+	if p.consume(".") && digits() == 0 {
+		return 0, p.syntaxError("after decimal point in numeric literal")
+	}
+
+	if p.consume("e") || p.consume("E") {
+		if !p.consume("+") {
+			p.consume("-")
+		}
+
+		if digits() == 0 {
+			return 0, p.syntaxError("in exponent of numeric literal")
+		}
+	}
+
+	num, err := strconv.ParseFloat(p.text[start:p.pos], 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %s at offset %d", p.text[start:p.pos], start)
+	}
+
+	return num, nil
+}
+
+// parseString will parse the string at the current position. Strings without
+// escapes are returned as substrings of the input.
+func (p *jsonParser) parseString() (string, error) {
+	p.pos++ // '"'
+	start := p.pos
+	ascii := true
+
+	for p.pos < len(p.data) {
+		switch c := p.data[p.pos]; {
+		case c == '"':
+			str := p.text[start:p.pos]
+			if !ascii && !utf8.ValidString(str) {
+				return "", fmt.Errorf("invalid UTF-8 in string at offset %d", start)
+			}
+
+			p.pos++
+
+			return str, nil
+		case c == '\\':
+			return p.parseEscapedString(start)
+		case c < 0x20:
+			return "", p.syntaxError("in string literal")
+		case c >= utf8.RuneSelf:
+			ascii = false
+		}
+
+		p.pos++
+	}
+
+	return "", p.syntaxError("")
+}
+
+// parseEscapedString will parse the rest of a string that starts at "start"
+// and has an escape at the current position.
+func (p *jsonParser) parseEscapedString(start int) (string, error) {
+	buf := make([]byte, 0, p.pos-start+16)
+	buf = append(buf, p.data[start:p.pos]...)
+
+	for p.pos < len(p.data) {
+		c := p.data[p.pos]
+
+		switch {
+		case c == '"':
+			if !utf8.Valid(buf) {
+				return "", fmt.Errorf("invalid UTF-8 in string at offset %d", start)
+			}
+
+			p.pos++
+
+			return string(buf), nil
+		case c < 0x20:
+			return "", p.syntaxError("in string literal")
+		case c != '\\':
+			buf = append(buf, c)
+			p.pos++
+
+			continue
+		}
+
+		p.pos++
+
+		if p.pos >= len(p.data) {
+			break
+		}
+
+		escape := p.data[p.pos]
+		p.pos++
+
+		switch escape {
+		case '"', '\\', '/':
+			buf = append(buf, escape)
+		case 'b':
+			buf = append(buf, '\b')
+		case 'f':
+			buf = append(buf, '\f')
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'u':
+			r, err := p.parseRune()
+			if err != nil {
+				return "", err
+			}
+
+			buf = utf8.AppendRune(buf, r)
+		default:
+			p.pos--
+
+			return "", p.syntaxError("in string escape code")
+		}
+	}
+
+	return "", p.syntaxError("")
+}
+
+// parseHex4 will parse the four hex digits of a \u escape.
+func (p *jsonParser) parseHex4() (rune, error) {
+	if len(p.data)-p.pos < 4 {
+		p.pos = len(p.data)
+
+		return 0, p.syntaxError("")
+	}
+
+	r, err := strconv.ParseUint(p.text[p.pos:p.pos+4], 16, 16)
+	if err != nil {
+		return 0, p.syntaxError("in \\u hexadecimal character escape")
+	}
+
+	p.pos += 4
+
+	return rune(r), nil
+}
+
+// parseRune will parse the rune of a \u escape, which is a surrogate pair if
+// it is outside of the basic multilingual plane.
+func (p *jsonParser) parseRune() (rune, error) {
+	offset := p.pos - 2
+
+	r, err := p.parseHex4()
+	if err != nil {
+		return 0, err
+	}
+
+	if !utf16.IsSurrogate(r) {
+		return r, nil
+	}
+
+	if !p.consume(`\u`) {
+		return 0, fmt.Errorf("invalid surrogate escape at offset %d", offset)
+	}
+
+	low, err := p.parseHex4()
+	if err != nil {
+		return 0, err
+	}
+
+	r = utf16.DecodeRune(r, low)
+	if r == utf8.RuneError {
+		return 0, fmt.Errorf("invalid surrogate escape at offset %d", offset)
+	}
+
+	return r, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestJSONParser(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		wantErr bool
+	}{
+		{name: "empty object", data: `{}`},
+		{name: "empty array", data: `[ ]`},
+		{name: "scalars", data: `[null, true, false, 0, -0, 1.5e3, -2E-2, "a"]`},
+		{name: "nested", data: `{"a": [{"b": {"c": [1, [2, []]]}}], "d": {}}`},
+		{name: "escapes", data: `["\"\\\/\b\f\n\r\t", "é中", "😀", "x\u0000y"]`},
+		{name: "unicode", data: `["héllo", "中文", "😀"]`},
+		{name: "whitespace", data: " \t\n\r[ 1 ,\n2 ]\r\n "},
+		{name: "large array", data: "[" + strings.Repeat(`{"a":1,"b":"x"},`, 3000) + "null]"},
+		{name: "trailing comma", data: `[1,]`, wantErr: true},
+		{name: "leading zero", data: `[01]`, wantErr: true},
+		{name: "bare decimal", data: `[1.]`, wantErr: true},
+		{name: "bare exponent", data: `[1e]`, wantErr: true},
+		{name: "out of range", data: `[1e400]`, wantErr: true},
+		{name: "duplicate key", data: `{"a": 1, "a": 2}`, wantErr: true},
+		{name: "unquoted key", data: `{a: 1}`, wantErr: true},
+		{name: "missing colon", data: `{"a" 1}`, wantErr: true},
+		{name: "unterminated string", data: `["abc`, wantErr: true},
+		{name: "control character", data: "[\"a\tb\"]", wantErr: true},
+		{name: "invalid escape", data: `["\x"]`, wantErr: true},
+		{name: "invalid utf8", data: "[\"\xff\"]", wantErr: true},
+		{name: "lone surrogate", data: `["\ud800"]`, wantErr: true},
+		{name: "trailing data", data: `[1] 2`, wantErr: true},
+		{name: "truncated literal", data: `[tru]`, wantErr: true},
+		{name: "unterminated array", data: `[1, 2`, wantErr: true},
+		{name: "too deep", data: strings.Repeat("[", maxJSONDepth+1), wantErr: true},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := newJSONParser([]byte(tcase.data)).parse()
+			if tcase.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %v", got)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to parse: %v", err)
+			}
+
+			// The parser must agree with protojson.
+			want := &structpb.Value{}
+			if err := protojson.Unmarshal([]byte(tcase.data), want); err != nil {
+				t.Fatalf("protojson failed: %v", err)
+			}
+
+			if !proto.Equal(got, want) {
+				t.Fatalf("got %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "strings"
+
+// DefaultDotEscape is the conventional escape for WithDotEscape and
+// WithCSVDotEscape, which writes the key "a.b" as `a\.b`.
+const DefaultDotEscape = `\`
+
+// keyEscaper escapes the dots in keys, so that they can be told apart from the
+// dots that join the keys of nested objects. A nil keyEscaper leaves keys
+// unchanged.
+type keyEscaper struct {
+	escape   string
+	replacer *strings.Replacer
+}
+
+// newKeyEscaper will return an escaper that prefixes dots with "escape", or nil
+// if it is empty.
+func newKeyEscaper(escape string) *keyEscaper {
+	if escape == "" {
+		return nil
+	}
+
+	return &keyEscaper{
+		escape:   escape,
+		replacer: strings.NewReplacer(escape, escape+escape, ".", escape+"."),
+	}
+}
+
+// escapeKey will return the key with its dots and escapes escaped.
+func (e *keyEscaper) escapeKey(key string) string {
+	if e == nil || !strings.Contains(key, ".") && !strings.Contains(key, e.escape) {
+		return key
+	}
+
+	return e.replacer.Replace(key)
+}
+
+// splitPath will split the flattened path into its keys, at the dots that are
+// not escaped, and unescape them. An escape that is not followed by a dot or
+// another escape is kept as it is.
+func (e *keyEscaper) splitPath(path string) []string {
+	if e == nil {
+		return strings.Split(path, ".")
+	}
+
+	var (
+		keys []string
+		key  strings.Builder
+	)
+
+	for len(path) > 0 {
+		switch {
+		case strings.HasPrefix(path, e.escape+e.escape):
+			key.WriteString(e.escape)
+			path = path[2*len(e.escape):]
+		case strings.HasPrefix(path, e.escape+"."):
+			key.WriteByte('.')
+			path = path[len(e.escape)+1:]
+		case path[0] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+
+			path = path[1:]
+		default:
+			key.WriteByte(path[0])
+			path = path[1:]
+		}
+	}
+
+	return append(keys, key.String())
+}
+
+// WithDotEscape configures the ListWriter to escape the dots in the keys of
+// records, which would otherwise be indistinguishable from the dots that join
+// the keys of nested objects. Each dot in a key is prefixed with "escape", and
+// each occurrence of "escape" is doubled, so that e.g. with DefaultDotEscape
+// the record {"a.b": 1, "a": {"b": 2}} is written with the headers `a\.b` and
+// "a.b". The headers can be read back with CSVToJSON and WithCSVDotEscape.
+//
+// Without this option, keys are written as they are, and a record in which two
+// fields have the same path, such as the one above, fails with
+// ErrHeaderConflict rather than losing one of the values.
+//
+// Options that name columns, such as WithCoercion, must use the escaped
+// headers.
+func WithDotEscape(escape string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.keyEscaper = newKeyEscaper(escape)
+	}
+}
+
+// WithCSVDotEscape configures CSVToJSON to split headers only at the dots that
+// are not escaped with "escape", as they are written with WithDotEscape, and to
+// unescape the keys.
+func WithCSVDotEscape(escape string) CSVToJSONOption {
+	return func(conv *csvToJSON) {
+		conv.keys = newKeyEscaper(escape)
+	}
+}
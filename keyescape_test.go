@@ -0,0 +1,209 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestKeyEscaper(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		escape string
+		keys   []string
+		path   string
+	}{
+		{escape: `\`, keys: []string{"a.b", "c"}, path: `a\.b.c`},
+		{escape: `\`, keys: []string{`a\`, "b"}, path: `a\\.b`},
+		{escape: `\`, keys: []string{`a\.b`}, path: `a\\\.b`},
+		{escape: `~`, keys: []string{"a.b", "c~d"}, path: `a~.b.c~~d`},
+		{escape: `%%`, keys: []string{"a.b"}, path: `a%%.b`},
+	} {
+		keys := newKeyEscaper(tcase.escape)
+
+		var path string
+		for i, key := range tcase.keys {
+			if i > 0 {
+				path += "."
+			}
+
+			path += keys.escapeKey(key)
+		}
+
+		if path != tcase.path {
+			t.Errorf("escaped %q with %q: got %q, want %q", tcase.keys, tcase.escape, path, tcase.path)
+		}
+
+		if got := keys.splitPath(path); !reflect.DeepEqual(got, tcase.keys) {
+			t.Errorf("split %q with %q: got %q, want %q", path, tcase.escape, got, tcase.keys)
+		}
+	}
+}
+
+func TestWriteDotEscape(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "flat",
+			data: `[{"a.b": 1, "c": 2}]`,
+			want: [][]string{{`a\.b`, "c"}, {"1.000000", "2.000000"}},
+		},
+		{
+			name: "nested",
+			data: `[{"a.b": 1, "a": {"b": 2, "c.d": 3}}]`,
+			want: [][]string{{`a.b`, `a.c\.d`, `a\.b`}, {"2.000000", "3.000000", "1.000000"}},
+		},
+		{
+			name: "coercion by escaped header",
+			data: `[{"a.b": 1, "a": {"b": 2}}]`,
+			opts: []ListWriterOption{WithCoercion(`a\.b`, KindString)},
+			want: [][]string{{`a.b`, `a\.b`}, {"2.000000", "1"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders(), WithDotEscape(DefaultDotEscape)},
+				tcase.opts...)
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestWritePathConflict(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		opts    []ListWriterOption
+		want    [][]string
+		wantErr error
+		wantMsg string
+	}{
+		{
+			name:    "same record",
+			data:    `[{"a.b": 1, "a": {"b": 2}}]`,
+			wantErr: ErrHeaderConflict,
+			wantMsg: "use WithDotEscape",
+		},
+		{
+			name: "different records",
+			data: `[{"a.b": 1}, {"a": {"b": 2}}]`,
+			want: [][]string{{"a.b"}, {"1.000000"}, {"2.000000"}},
+		},
+		{
+			name:    "record ID",
+			data:    `[{"n": 1}, {"n": 2, "record_id": "x"}]`,
+			opts:    []ListWriterOption{WithRecordID("record_id")},
+			wantErr: ErrHeaderConflict,
+			wantMsg: "a field and the WithRecordID column",
+		},
+		{
+			name:    "record ID and array index",
+			data:    `[{"n": 1}]`,
+			opts:    []ListWriterOption{WithRecordID("key"), WithArrayIndex("key"), WithDotEscape(DefaultDotEscape)},
+			wantErr: ErrHeaderConflict,
+			wantMsg: "the WithRecordID column and the WithArrayIndex column",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err = NewListWriter(&dst, tcase.opts...).Write(context.Background(), list)
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+
+			if err != nil && !strings.Contains(err.Error(), tcase.wantMsg) {
+				t.Fatalf("got error %q, want it to contain %q", err, tcase.wantMsg)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func TestDotEscapeRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	const data = `[{"a":{"b":"1"},"a.b":"2","c\\d":"3"}]`
+
+	list, err := Decode(DecodeTypeJSON, []byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var csvBuf bytes.Buffer
+
+	csvWriter := csv.NewWriter(&csvBuf)
+	if err := NewListWriter(csvWriter, WithDotEscape(DefaultDotEscape)).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	csvWriter.Flush()
+
+	var jsonBuf bytes.Buffer
+	if err := CSVToJSON(&csvBuf, &jsonBuf, WithCSVDotEscape(DefaultDotEscape)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got, want any
+	if err := json.Unmarshal(jsonBuf.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := json.Unmarshal([]byte(data), &want); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrUnknownKind is returned when a kind name cannot be parsed.
+var ErrUnknownKind = fmt.Errorf("unknown kind")
+
+// Kind is an enum that represents the kind of a structpb.Value.
+type Kind int32
+
+const (
+	// KindUnknown is the default value for the Kind enum.
+	KindUnknown Kind = iota
+
+	// KindNull is a null value.
+	KindNull
+
+	// KindNumber is a number value.
+	KindNumber
+
+	// KindString is a string value.
+	KindString
+
+	// KindBool is a boolean value.
+	KindBool
+
+	// KindStruct is an object value.
+	KindStruct
+
+	// KindList is an array value.
+	KindList
+)
+
+var kindNames = map[Kind]string{
+	KindUnknown: "unknown",
+	KindNull:    "null",
+	KindNumber:  "number",
+	KindString:  "string",
+	KindBool:    "bool",
+	KindStruct:  "struct",
+	KindList:    "list",
+}
+
+// String returns the name of the kind.
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("Kind(%d)", k)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (k Kind) MarshalText() ([]byte, error) {
+	return []byte(k.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that kinds can be
+// given by name in a Config.
+func (k *Kind) UnmarshalText(text []byte) error {
+	for kind, name := range kindNames {
+		if name == string(text) {
+			*k = kind
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownKind, text)
+}
+
+// kindOf will return the kind of the value.
+func kindOf(value *structpb.Value) Kind {
+	switch value.GetKind().(type) {
+	case *structpb.Value_NullValue:
+		return KindNull
+	case *structpb.Value_NumberValue:
+		return KindNumber
+	case *structpb.Value_StringValue:
+		return KindString
+	case *structpb.Value_BoolValue:
+		return KindBool
+	case *structpb.Value_StructValue:
+		return KindStruct
+	case *structpb.Value_ListValue:
+		return KindList
+	default:
+		return KindUnknown
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// lookup is a reference table joined to the records by WithLookup.
+type lookup struct {
+	column  string
+	table   map[string][]string
+	newCols []string
+}
+
+// LookupConfig is a WithLookup in a Config.
+type LookupConfig struct {
+	Column  string              `json:"column" yaml:"column"`
+	Table   map[string][]string `json:"table" yaml:"table"`
+	NewCols []string            `json:"newCols" yaml:"newCols"`
+}
+
+// WithLookup configures the ListWriter to enrich each record with values
+// joined from an in-memory reference table. The record's value in "column",
+// which may be a flattened path such as "user.country", is looked up in
+// "table" by its plain form, as with WithValueMap, and the cells of the row
+// found are added to the record as the "newCols" columns, in order. Records
+// whose key is missing or not in the table have empty cells in the new
+// columns, as do rows that are shorter than "newCols".
+//
+// Lookups are applied after filters and computed columns, so computed columns
+// can be used as keys, and before the field mask.
+func WithLookup(column string, table map[string][]string, newCols []string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.lookups = append(listWriter.lookups, &lookup{
+			column:  column,
+			table:   table,
+			newCols: newCols,
+		})
+	}
+}
+
+// fieldByPath will return the value at the flattened path within the object,
+// or nil if there is none.
+func fieldByPath(obj *structpb.Struct, path string) *structpb.Value {
+	for {
+		key, rest, nested := strings.Cut(path, ".")
+
+		value, ok := obj.GetFields()[key]
+		if !ok || !nested {
+			return value
+		}
+
+		if obj = value.GetStructValue(); obj == nil {
+			return nil
+		}
+
+		path = rest
+	}
+}
+
+// join will add the new columns for the record's row of the table to "fields".
+func (lookup *lookup) join(obj *structpb.Struct, fields map[string]*structpb.Value) {
+	var row []string
+
+	if key := fieldByPath(obj, lookup.column); key != nil {
+		if plain, ok := plainKey(key); ok {
+			row = lookup.table[plain]
+		}
+	}
+
+	for i, col := range lookup.newCols {
+		if i < len(row) {
+			fields[col] = structpb.NewStringValue(row[i])
+		} else {
+			fields[col] = structpb.NewNullValue()
+		}
+	}
+}
+
+// rewriteRecords will return a list with the fields of each object rewritten
+// by "rewrite", which is given the object and a copy of its fields. The
+// records of the original list are not modified.
+func rewriteRecords(list *structpb.ListValue,
+	rewrite func(obj *structpb.Struct, fields map[string]*structpb.Value),
+) *structpb.ListValue {
+	out := &structpb.ListValue{Values: make([]*structpb.Value, len(list.GetValues()))}
+
+	for i, record := range list.GetValues() {
+		obj := record.GetStructValue()
+		if obj == nil {
+			out.Values[i] = record
+
+			continue
+		}
+
+		fields := make(map[string]*structpb.Value, len(obj.GetFields()))
+		for key, value := range obj.GetFields() {
+			fields[key] = value
+		}
+
+		rewrite(obj, fields)
+
+		out.Values[i] = structpb.NewStructValue(&structpb.Struct{Fields: fields})
+	}
+
+	return out
+}
+
+// applyLookups will return a list with the lookup columns added to each
+// object.
+func (w *ListWriter) applyLookups(list *structpb.ListValue) *structpb.ListValue {
+	return rewriteRecords(list, func(obj *structpb.Struct, fields map[string]*structpb.Value) {
+		for _, lookup := range w.lookups {
+			lookup.join(obj, fields)
+		}
+	})
+}
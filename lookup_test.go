@@ -0,0 +1,62 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWithLookup(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"id": 1, "user": {"country": "FR"}},
+		{"id": 2, "user": {"country": "JP"}},
+		{"id": 3, "user": {"country": "XX"}},
+		{"id": 4}
+	]`)
+
+	list, err := Decode(DecodeTypeJSON, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	countries := map[string][]string{
+		"FR": {"France", "EUR"},
+		"JP": {"Japan"},
+	}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst, WithAlphabetizeHeaders(),
+		WithLookup("user.country", countries, []string{"country_name", "currency"}))
+
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"country_name", "currency", "id", "user.country"},
+		{"France", "EUR", "1.000000", "FR"},
+		{"Japan", "", "2.000000", "JP"},
+		{"", "", "3.000000", "XX"},
+		{"", "", "4.000000", ""},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+
+	// The input is not modified.
+	if fields := list.GetValues()[0].GetStructValue().GetFields(); len(fields) != 2 {
+		t.Fatalf("input record has %d fields, want 2", len(fields))
+	}
+}
@@ -0,0 +1,413 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// mapCell is a reusable value for the cells of one column of flat maps, so
+// that the maps are formatted without being converted to structpb.
+type mapCell struct {
+	value  structpb.Value
+	null   structpb.Value_NullValue
+	number structpb.Value_NumberValue
+	str    structpb.Value_StringValue
+	bool   structpb.Value_BoolValue
+}
+
+// set will point the cell at "v", returning false if "v" is not a scalar that
+// newMapValue would convert.
+func (cell *mapCell) set(v interface{}) bool {
+	if str, ok := mapString(v); ok {
+		cell.str.StringValue = str
+		cell.value.Kind = &cell.str
+
+		return true
+	}
+
+	switch v := indirectMapValue(v).(type) {
+	case nil:
+		cell.value.Kind = &cell.null
+	case bool:
+		cell.bool.BoolValue = v
+		cell.value.Kind = &cell.bool
+	case string:
+		cell.str.StringValue = v
+		cell.value.Kind = &cell.str
+	case int:
+		cell.setNumber(float64(v))
+	case int32:
+		cell.setNumber(float64(v))
+	case int64:
+		cell.setNumber(float64(v))
+	case uint:
+		cell.setNumber(float64(v))
+	case uint32:
+		cell.setNumber(float64(v))
+	case uint64:
+		cell.setNumber(float64(v))
+	case float32:
+		cell.setNumber(float64(v))
+	case float64:
+		cell.setNumber(v)
+	default:
+		scalar, ok := reflectScalar(reflect.ValueOf(v))
+		if !ok {
+			return false
+		}
+
+		return cell.set(scalar)
+	}
+
+	return true
+}
+
+func (cell *mapCell) setNumber(num float64) {
+	cell.number.NumberValue = num
+	cell.value.Kind = &cell.number
+}
+
+// indirectMapValue will return the value that "v" points to, through any
+// number of pointers, or nil if one of them is nil.
+func indirectMapValue(v interface{}) interface{} {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer {
+		return v
+	}
+
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+
+		rv = rv.Elem()
+	}
+
+	return rv.Interface()
+}
+
+// reflectScalar will return the bool, float64, or string of a value of a
+// boolean, numeric, or string kind that has no case of its own, such as an
+// int16 or a named string type.
+func reflectScalar(rv reflect.Value) (interface{}, bool) {
+	switch rv.Kind() {
+	case reflect.Bool:
+		return rv.Bool(), true
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		return rv.String(), true
+	default:
+		return nil, false
+	}
+}
+
+// mapString will return the string that the Go value is written as, if it is
+// a time, a duration, bytes, or a fmt.Stringer that structpb.NewValue would
+// not convert, or a pointer to one. Times are written in RFC 3339 with their
+// time zone, durations as e.g. "1m30s", and bytes in base64, as by
+// structpb.NewValue.
+func mapString(v interface{}) (string, bool) {
+	switch v := indirectMapValue(v).(type) {
+	case time.Time:
+		return v.Format(time.RFC3339Nano), true
+	case time.Duration:
+		return v.String(), true
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), true
+	case nil, bool, string, int, int32, int64, uint, uint32, uint64, float32, float64,
+		map[string]interface{}, []interface{}:
+		return "", false
+	case fmt.Stringer:
+		return v.String(), true
+	}
+
+	// A Stringer with a pointer receiver is only one through the pointer,
+	// which is not nil, or it would have been the nil case.
+	if stringer, ok := v.(fmt.Stringer); ok {
+		return stringer.String(), true
+	}
+
+	return "", false
+}
+
+// newMapValue will convert the Go value to a structpb.Value, as
+// structpb.NewValue does, also converting the values that mapString does and,
+// by reflection, pointers, slices, arrays, maps with string keys, and values
+// of other boolean, numeric, and string types, including those in nested maps
+// and slices.
+func newMapValue(v interface{}) (*structpb.Value, error) {
+	if str, ok := mapString(v); ok {
+		return structpb.NewStringValue(str), nil
+	}
+
+	switch v := indirectMapValue(v).(type) {
+	case map[string]interface{}:
+		obj, err := newMapStruct(v)
+		if err != nil {
+			return nil, err
+		}
+
+		return structpb.NewStructValue(obj), nil
+	case []interface{}:
+		list := &structpb.ListValue{Values: make([]*structpb.Value, len(v))}
+
+		for i, elem := range v {
+			var err error
+			if list.Values[i], err = newMapValue(elem); err != nil {
+				return nil, err
+			}
+		}
+
+		return structpb.NewListValue(list), nil
+	case nil, bool, string, int, int32, int64, uint, uint32, uint64, float32, float64:
+		return structpb.NewValue(v)
+	default:
+		return reflectMapValue(reflect.ValueOf(v))
+	}
+}
+
+// reflectMapValue will convert a Go value that newMapValue has no case for to
+// a structpb.Value by reflection, returning the error of structpb.NewValue for
+// a value of a kind it cannot convert, such as a channel.
+func reflectMapValue(rv reflect.Value) (*structpb.Value, error) {
+	if scalar, ok := reflectScalar(rv); ok {
+		return structpb.NewValue(scalar)
+	}
+
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		if rv.Kind() == reflect.Slice && rv.Type().Elem().Kind() == reflect.Uint8 {
+			return structpb.NewStringValue(base64.StdEncoding.EncodeToString(rv.Bytes())), nil
+		}
+
+		list := &structpb.ListValue{Values: make([]*structpb.Value, rv.Len())}
+
+		for i := range list.Values {
+			var err error
+			if list.Values[i], err = newMapValue(rv.Index(i).Interface()); err != nil {
+				return nil, err
+			}
+		}
+
+		return structpb.NewListValue(list), nil
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			break
+		}
+
+		obj := &structpb.Struct{Fields: make(map[string]*structpb.Value, rv.Len())}
+
+		for iter := rv.MapRange(); iter.Next(); {
+			value, err := newMapValue(iter.Value().Interface())
+			if err != nil {
+				return nil, fmt.Errorf("field %q: %w", iter.Key().String(), err)
+			}
+
+			obj.Fields[iter.Key().String()] = value
+		}
+
+		return structpb.NewStructValue(obj), nil
+	}
+
+	return structpb.NewValue(rv.Interface())
+}
+
+// newMapStruct will convert the map to a structpb.Struct with newMapValue.
+func newMapStruct(record map[string]interface{}) (*structpb.Struct, error) {
+	obj := &structpb.Struct{Fields: make(map[string]*structpb.Value, len(record))}
+
+	for key, v := range record {
+		value, err := newMapValue(v)
+		if err != nil {
+			return nil, fmt.Errorf("field %q: %w", key, err)
+		}
+
+		obj.Fields[key] = value
+	}
+
+	return obj, nil
+}
+
+// isFlatMap will return true if every value of the record is a scalar.
+func isFlatMap(record map[string]interface{}) bool {
+	var cell mapCell
+
+	for _, v := range record {
+		if !cell.set(v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// writesMapsDirectly will return true if the records can be written without
+// being converted to structpb, which is when they are flat and the ListWriter
+// neither prepares nor buffers the list.
+func (w *ListWriter) writesMapsDirectly(records []map[string]interface{}) bool {
+	prepares := w.arrayPolicy == ArrayPolicyChildTable || w.sample != nil ||
+		w.inputSchema != nil || w.inputSchemaErr != nil ||
+		len(w.filters) > 0 || len(w.computed) > 0 || len(w.lookups) > 0 ||
+		w.fieldMask != nil || len(w.dropKinds) > 0 ||
+		(w.rejects != nil && len(w.coercions) > 0) || w.dedup != nil
+
+	keyed := w.recordIDColumn != "" || w.arrayIndexColumn != ""
+
+	if prepares || !w.streaming() || keyed || w.cardinalityLimit > 0 || len(w.nullThresholds) > 0 ||
+		w.recordSizes != nil {
+		return false
+	}
+
+	for _, record := range records {
+		if !isFlatMap(record) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// WriteMaps writes each map as a record, e.g. rows that were already decoded
+// into Go maps. The values may be of any type that structpb.NewValue accepts,
+// or a time.Time, a time.Duration, or a fmt.Stringer, which are written as
+// strings: times in RFC 3339 with their time zone, durations as e.g. "1m30s",
+// and Stringers as their String. Bytes are written in base64. Other Go types
+// are converted by reflection: pointers as the value they point to, or null,
+// slices and arrays as lists, maps with string keys as objects, and sized or
+// named integers, floats, bools, and strings as their value.
+//
+// Flat maps, whose values are all scalars, are formatted directly when the
+// ListWriter would stream them, saving the allocation of a structpb copy of
+// every record. Otherwise, e.g. for nested maps or with WithFilter, the maps are
+// converted to structpb and written by Write.
+func (w *ListWriter) WriteMaps(ctx context.Context, records []map[string]interface{}) error {
+	if !w.writesMapsDirectly(records) {
+		list := &structpb.ListValue{Values: make([]*structpb.Value, len(records))}
+
+		for i, record := range records {
+			obj, err := newMapStruct(record)
+			if err != nil {
+				return fmt.Errorf("failed to convert record %d: %w", i, err)
+			}
+
+			list.Values[i] = structpb.NewStructValue(obj)
+		}
+
+		return w.Write(ctx, list)
+	}
+
+	return w.measure(func() error {
+		w.rowIndex = 0
+
+		if w.counts != nil {
+			w.counts.records += len(records)
+		}
+
+		if w.sidecar == nil {
+			return w.writeMaps(ctx, records)
+		}
+
+		w.sidecar.start(nil)
+
+		if err := w.writeMaps(ctx, records); err != nil {
+			return err
+		}
+
+		return w.sidecar.emit(nil)
+	})
+}
+
+// sortedMapKeys will return the keys of the record in sorted order.
+func sortedMapKeys(record map[string]interface{}) []string {
+	keys := make([]string, 0, len(record))
+	for key := range record {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// writeMaps writes flat maps row by row, as writeFlat does for flat records.
+func (w *ListWriter) writeMaps(ctx context.Context, records []map[string]interface{}) error {
+	header := newFlatHeader(w)
+
+	for i, record := range records {
+		if w.deterministic {
+			for _, key := range sortedMapKeys(record) {
+				if err := header.add(key); err != nil {
+					return newValueError(i, key, err)
+				}
+			}
+
+			continue
+		}
+
+		for key := range record {
+			if err := header.add(key); err != nil {
+				return newValueError(i, key, err)
+			}
+		}
+	}
+
+	header.sort()
+
+	if err := w.writeHeader(w.writer, header.header); err != nil {
+		return err
+	}
+
+	var arena []byte
+
+	format := w.cellFormat()
+
+	cells := make([]mapCell, len(header.header))
+	values := make([]*structpb.Value, len(header.header))
+
+	for i, record := range records {
+		for j := range values {
+			values[j] = nil
+		}
+
+		for key, v := range record {
+			j := header.column(key)
+
+			cells[j].set(v)
+			values[j] = &cells[j].value
+		}
+
+		var (
+			row []string
+			err error
+		)
+
+		if row, arena, err = formatCells(arena, format, header.header, values); err != nil {
+			return fmt.Errorf("failed to format row %d: %w", i, err)
+		}
+
+		if err := w.writeRow(ctx, row); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,206 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestWriteMaps(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name    string
+		records []map[string]interface{}
+		opts    []ListWriterOption
+		direct  bool
+	}{
+		{
+			name: "flat",
+			records: []map[string]interface{}{
+				{"id": 1, "name": "a", "score": 1.5, "ok": true},
+				{"id": int64(2), "name": nil, "count": uint32(7)},
+			},
+			opts:   []ListWriterOption{WithRounding(1, RoundHalfUp), WithColumnTransform("name", TransformUpper)},
+			direct: true,
+		},
+		{
+			name: "nested",
+			records: []map[string]interface{}{
+				{"id": 1, "user": map[string]interface{}{"name": "a"}},
+				{"id": 2, "tags": []interface{}{"x", "y"}},
+			},
+		},
+		{
+			name: "filtered",
+			records: []map[string]interface{}{
+				{"id": 1},
+				{"id": 2},
+			},
+			opts: []ListWriterOption{WithFilter("item.id > 1.0")},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+
+			var got recordWriter
+
+			listWriter := NewListWriter(&got, opts...)
+			if direct := listWriter.writesMapsDirectly(tcase.records); direct != tcase.direct {
+				t.Fatalf("got direct %t, want %t", direct, tcase.direct)
+			}
+
+			if err := listWriter.WriteMaps(context.Background(), tcase.records); err != nil {
+				t.Fatal(err)
+			}
+
+			// The records are written as they would be by Write.
+			list := &structpb.ListValue{}
+
+			for _, record := range tcase.records {
+				obj, err := structpb.NewStruct(record)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				list.Values = append(list.Values, structpb.NewStructValue(obj))
+			}
+
+			var want recordWriter
+			if err := NewListWriter(&want, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got.records, want.records) {
+				t.Fatalf("got %q, want %q", got.records, want.records)
+			}
+		})
+	}
+}
+
+func TestWriteMapsInvalidValue(t *testing.T) {
+	t.Parallel()
+
+	var dst recordWriter
+
+	err := NewListWriter(&dst).WriteMaps(context.Background(), []map[string]interface{}{
+		{"ch": make(chan int)},
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+
+	if len(dst.records) != 0 {
+		t.Fatalf("got %q, want nothing written", dst.records)
+	}
+}
+
+// level is a fmt.Stringer that structpb.NewValue does not accept.
+type level int
+
+func (l level) String() string {
+	return [...]string{"low", "high"}[l]
+}
+
+// status is a named string type.
+type status string
+
+func TestWriteMapsGoTypes(t *testing.T) {
+	t.Parallel()
+
+	at := time.Date(2023, 1, 2, 3, 4, 5, 0, time.FixedZone("CET", 3600))
+	took := 90 * time.Second
+	count := int16(3)
+
+	for _, tcase := range []struct {
+		name    string
+		records []map[string]interface{}
+		want    [][]string
+	}{
+		{
+			name: "flat",
+			records: []map[string]interface{}{
+				{"at": at, "took": 90 * time.Second, "raw": []byte("hi"), "level": level(1)},
+			},
+			want: [][]string{{"at", "level", "raw", "took"}, {"2023-01-02T03:04:05+01:00", "high", "aGk=", "1m30s"}},
+		},
+		{
+			name: "nested",
+			records: []map[string]interface{}{
+				{"event": map[string]interface{}{"at": at}, "levels": []interface{}{level(0), level(1)}},
+			},
+			want: [][]string{{"event.at", "levels"}, {"2023-01-02T03:04:05+01:00", "[low,high]"}},
+		},
+		{
+			name: "pointers",
+			records: []map[string]interface{}{
+				{"at": &at, "took": &took, "count": &count, "missing": (*int)(nil)},
+			},
+			want: [][]string{{"at", "count", "missing", "took"}, {"2023-01-02T03:04:05+01:00", "3.000000", "", "1m30s"}},
+		},
+		{
+			name: "sized and named",
+			records: []map[string]interface{}{
+				{"small": int8(-1), "port": uint16(80), "ratio": float32(0.5), "status": status("ok")},
+			},
+			want: [][]string{{"port", "ratio", "small", "status"}, {"80.000000", "0.500000", "-1.000000", "ok"}},
+		},
+		{
+			name: "slices and maps",
+			records: []map[string]interface{}{
+				{"tags": []string{"a", "b"}, "labels": map[string]string{"env": "prod"}, "ids": [2]int16{1, 2}},
+			},
+			want: [][]string{{"ids", "labels.env", "tags"}, {"[1.000000,2.000000]", "prod", "[a,b]"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			err := NewListWriter(&dst, WithAlphabetizeHeaders()).WriteMaps(context.Background(), tcase.records)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
+
+func BenchmarkWriteMaps(b *testing.B) {
+	records := make([]map[string]interface{}, 1000)
+	for i := range records {
+		records[i] = map[string]interface{}{"id": i, "name": "name", "score": 1.5, "ok": true}
+	}
+
+	listWriter := NewListWriter(WriterFunc(func([]string) error { return nil }))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		if err := listWriter.WriteMaps(context.Background(), records); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
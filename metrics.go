@@ -0,0 +1,113 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// WriteMetrics are the measurements of a call to ListWriter.Write,
+// ListWriter.WriteMaps, or Encoder.Encode.
+type WriteMetrics struct {
+	// Records is the number of records that were written, after any were
+	// left out, e.g. by WithFilter.
+	Records int
+
+	// Rows and Cells are the number of data rows, and of the cells in
+	// them, that were written, including those of child tables.
+	Rows  int
+	Cells int
+
+	// Duration is how long the call took.
+	Duration time.Duration
+
+	// Err is the error that the call returned, or nil.
+	Err error
+}
+
+// Metrics receives the WriteMetrics of each write, e.g. to update the counters
+// and histograms of a Prometheus registry. The package does not depend on a
+// metrics library: the csvpbprom module registers Prometheus collectors, and
+// other callers adapt their own, labeling errors with ErrorCategory.
+type Metrics interface {
+	ObserveWrite(metrics WriteMetrics)
+}
+
+// writeCounts are the counts of a write that is being measured.
+type writeCounts struct {
+	records int
+	rows    int
+	cells   int
+}
+
+// WithMetrics configures the ListWriter and the Encoder to report the
+// WriteMetrics of each write to "metrics", once the write has returned.
+func WithMetrics(metrics Metrics) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.metrics = metrics
+		listWriter.counts = &writeCounts{}
+	}
+}
+
+// ErrorCategory returns a short label for the category of an error returned
+// by a write, for use as a metrics label: "writer", "schema", "header",
+// "too_many_columns", "uncoercible", "expression", "input", "canceled", or
+// "other". It returns "" for a nil error.
+func ErrorCategory(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrWriterFailed), errors.Is(err, ErrRetriesExhausted):
+		return "writer"
+	case errors.Is(err, ErrSchemaViolation), errors.Is(err, ErrSchemaChange),
+		errors.Is(err, ErrIncompatibleSchema), errors.Is(err, ErrNullThreshold),
+		errors.Is(err, ErrTypeMismatch), errors.Is(err, ErrRowTooWide):
+		return "schema"
+	case errors.Is(err, ErrDuplicateHeader), errors.Is(err, ErrHeaderConflict):
+		return "header"
+	case errors.Is(err, ErrTooManyColumns):
+		return "too_many_columns"
+	case errors.Is(err, ErrUncoercible):
+		return "uncoercible"
+	case errors.Is(err, ErrInvalidExpression):
+		return "expression"
+	case errors.Is(err, ErrInvalidJSON), errors.Is(err, ErrInputTooLarge),
+		errors.Is(err, ErrEmptyInput), errors.Is(err, ErrUnsupportedValueType),
+		errors.Is(err, ErrInvalidBase64):
+		return "input"
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	default:
+		return "other"
+	}
+}
+
+// measure will call "write" and report its metrics, if WithMetrics is used.
+func (w *ListWriter) measure(write func() error) error {
+	if w.metrics == nil {
+		return write()
+	}
+
+	*w.counts = writeCounts{}
+	start := time.Now()
+
+	err := write()
+
+	w.metrics.ObserveWrite(WriteMetrics{
+		Records:  w.counts.records,
+		Rows:     w.counts.rows,
+		Cells:    w.counts.cells,
+		Duration: time.Since(start),
+		Err:      err,
+	})
+
+	return err
+}
@@ -0,0 +1,122 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"testing"
+)
+
+// recordMetrics is a Metrics that keeps the metrics it observes.
+type recordMetrics struct {
+	observed []WriteMetrics
+}
+
+func (m *recordMetrics) ObserveWrite(metrics WriteMetrics) {
+	m.observed = append(m.observed, metrics)
+}
+
+// rejectingWriter is a Writer that always fails.
+type rejectingWriter struct{}
+
+func (rejectingWriter) Write([]string) error {
+	return errFailingWriter
+}
+
+func TestWriteMetrics(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "tags": [{"t": "a"}, {"t": "b"}]},
+		{"id": 2, "tags": []},
+		{"id": 3}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var metrics recordMetrics
+
+	listWriter := NewListWriter(&recordWriter{}, WithMetrics(&metrics), WithFilter("item.id < 3.0"))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := NewListWriter(rejectingWriter{}, WithMetrics(&metrics)).Write(context.Background(), list); err == nil {
+		t.Fatal("got no error, want one")
+	}
+
+	if len(metrics.observed) != 2 {
+		t.Fatalf("got %d observations, want 2", len(metrics.observed))
+	}
+
+	got := metrics.observed[0]
+	if got.Records != 2 || got.Rows != 3 || got.Cells != 6 || got.Err != nil {
+		t.Fatalf("got %+v, want 2 records, 3 rows, and 6 cells", got)
+	}
+
+	if category := ErrorCategory(metrics.observed[1].Err); category != "writer" {
+		t.Fatalf("got category %q, want %q", category, "writer")
+	}
+}
+
+func TestEncodeMetrics(t *testing.T) {
+	t.Parallel()
+
+	var (
+		buf     bytes.Buffer
+		metrics recordMetrics
+	)
+
+	enc := NewEncoder(&buf, WithMetrics(&metrics))
+
+	for _, batch := range []string{`[{"a": 1}, {"a": 2}]`, `[{"a": 3}]`} {
+		list, err := Decode(DecodeTypeJSON, []byte(batch))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(metrics.observed) != 2 || metrics.observed[0].Records != 2 || metrics.observed[1].Rows != 1 {
+		t.Fatalf("got %+v", metrics.observed)
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		err  error
+		want string
+	}{
+		{err: nil, want: ""},
+		{err: writerFailed(fmt.Errorf("disk full")), want: "writer"},
+		{err: fmt.Errorf("%w after 3 attempts", ErrRetriesExhausted), want: "writer"},
+		{err: fmt.Errorf("record 1: %w", ErrSchemaViolation), want: "schema"},
+		{err: fmt.Errorf("%w: 1.5 is not a valid integer", ErrTypeMismatch), want: "schema"},
+		{err: fmt.Errorf("footer: %w", ErrRowTooWide), want: "schema"},
+		{err: fmt.Errorf("%w: %q", ErrDuplicateHeader, "id"), want: "header"},
+		{err: fmt.Errorf("%w: %q", ErrHeaderConflict, "a.b"), want: "header"},
+		{err: &TooManyColumnsError{Columns: 3, Limit: 2}, want: "too_many_columns"},
+		{err: fmt.Errorf("column %q: %w", "n", ErrUncoercible), want: "uncoercible"},
+		{err: fmt.Errorf("%w: column %q", ErrInvalidBase64, "payload"), want: "input"},
+		{err: context.Canceled, want: "canceled"},
+		{err: fmt.Errorf("unknown"), want: "other"},
+	} {
+		if got := ErrorCategory(tcase.err); got != tcase.want {
+			t.Errorf("got %q for %v, want %q", got, tcase.err, tcase.want)
+		}
+	}
+}
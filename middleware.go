@@ -0,0 +1,172 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WriterFunc is an adapter to allow the use of ordinary functions as Writers.
+type WriterFunc func(record []string) error
+
+// Write calls fn(record).
+func (fn WriterFunc) Write(record []string) error {
+	return fn(record)
+}
+
+// WrapWriter wraps "writer" with the given middlewares. The first middleware
+// is the outermost, so records pass through the middlewares in the order they
+// are given before reaching "writer".
+func WrapWriter(writer Writer, mw ...func(Writer) Writer) Writer {
+	for i := len(mw) - 1; i >= 0; i-- {
+		writer = mw[i](writer)
+	}
+
+	return writer
+}
+
+// middlewareWriter is the Writer of a middleware, which passes both records
+// and headers through "fn" on their way to "next".
+type middlewareWriter struct {
+	next Writer
+	fn   func(record []string, write func([]string) error) error
+}
+
+// middleware will return a Writer that calls "fn" with every record and
+// header, and with the function that writes it to "next", so that headers
+// still reach a HeaderWriter that is wrapped.
+func middleware(next Writer, fn func(record []string, write func([]string) error) error) Writer {
+	return &middlewareWriter{next: next, fn: fn}
+}
+
+// Write passes the record through the middleware.
+func (mw *middlewareWriter) Write(record []string) error {
+	return mw.fn(record, mw.next.Write)
+}
+
+// WriteHeader passes the header through the middleware.
+func (mw *middlewareWriter) WriteHeader(header []string) error {
+	return mw.fn(header, func(header []string) error {
+		return writeHeaderRecord(mw.next, header)
+	})
+}
+
+// CountRecords is a middleware that atomically increments "counter" for every
+// record that is successfully written, including the header.
+func CountRecords(counter *int64) func(Writer) Writer {
+	return func(next Writer) Writer {
+		return middleware(next, func(record []string, write func([]string) error) error {
+			if err := write(record); err != nil {
+				return err
+			}
+
+			atomic.AddInt64(counter, 1)
+
+			return nil
+		})
+	}
+}
+
+// redactWriter is the Writer of the Redact middleware.
+type redactWriter struct {
+	next        Writer
+	replacement string
+	redacted    map[string]bool
+	indices     []int
+}
+
+// WriteHeader finds the redacted columns of the table from its header.
+func (rw *redactWriter) WriteHeader(header []string) error {
+	rw.indices = rw.indices[:0]
+
+	for i, name := range header {
+		if rw.redacted[name] {
+			rw.indices = append(rw.indices, i)
+		}
+	}
+
+	return writeHeaderRecord(rw.next, header)
+}
+
+// Write redacts the cells of the record under the redacted headers.
+func (rw *redactWriter) Write(record []string) error {
+	if len(rw.indices) == 0 {
+		return rw.next.Write(record)
+	}
+
+	// Copy the record so that the caller's data is not modified.
+	out := make([]string, len(record))
+	copy(out, record)
+
+	for _, i := range rw.indices {
+		if i < len(out) {
+			out[i] = rw.replacement
+		}
+	}
+
+	return rw.next.Write(out)
+}
+
+// Redact is a middleware that replaces every cell under the given headers with
+// "replacement". The columns are found from the header of each table, which
+// the ListWriter marks by calling WriteHeader, so the writer may be shared by
+// several tables with different headers. Records written before any header are
+// not redacted.
+func Redact(replacement string, headers ...string) func(Writer) Writer {
+	redacted := make(map[string]bool, len(headers))
+	for _, header := range headers {
+		redacted[header] = true
+	}
+
+	return func(next Writer) Writer {
+		return &redactWriter{next: next, replacement: replacement, redacted: redacted}
+	}
+}
+
+// Throttle is a middleware that limits writes to at most "perSecond" records
+// per second by sleeping between writes. A non-positive rate disables the
+// throttle.
+func Throttle(perSecond int) func(Writer) Writer {
+	return func(next Writer) Writer {
+		if perSecond <= 0 {
+			return next
+		}
+
+		interval := time.Second / time.Duration(perSecond)
+
+		var (
+			mu   sync.Mutex
+			last time.Time
+		)
+
+		return middleware(next, func(record []string, write func([]string) error) error {
+			mu.Lock()
+
+			if wait := time.Until(last.Add(interval)); wait > 0 {
+				time.Sleep(wait)
+			}
+
+			last = time.Now()
+
+			mu.Unlock()
+
+			return write(record)
+		})
+	}
+}
+
+// Tee is a middleware that also writes every record to "other", after it has
+// been written to the wrapped writer.
+func Tee(other Writer) func(Writer) Writer {
+	return func(next Writer) Writer {
+		return MultiWriter(next, other)
+	}
+}
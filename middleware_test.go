@@ -0,0 +1,107 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+// recordWriter is a Writer that keeps every record in memory.
+type recordWriter struct {
+	records [][]string
+}
+
+func (w *recordWriter) Write(record []string) error {
+	w.records = append(w.records, record)
+
+	return nil
+}
+
+func TestWrapWriter(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1, "secret": "a"}, {"id": 2, "secret": "b"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		count int64
+		dst   recordWriter
+		tee   recordWriter
+	)
+
+	writer := WrapWriter(&dst, CountRecords(&count), Redact("***", "secret"), Throttle(1000), Tee(&tee))
+
+	listWriter := NewListWriter(writer, WithAlphabetizeHeaders())
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"id", "secret"},
+		{"1.000000", "***"},
+		{"2.000000", "***"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+
+	if !reflect.DeepEqual(tee.records, want) {
+		t.Fatalf("got tee %v, want %v", tee.records, want)
+	}
+
+	if count != 3 {
+		t.Fatalf("got count %d, want 3", count)
+	}
+}
+
+func TestRedactPerTable(t *testing.T) {
+	t.Parallel()
+
+	var (
+		count int64
+		dst   recordWriter
+	)
+
+	writer := WrapWriter(&dst, CountRecords(&count), Redact("***", "secret"))
+
+	for _, data := range []string{
+		`[{"id": 1, "secret": "a"}]`,
+		`[{"secret": "b", "user": "c"}]`,
+	} {
+		list, err := Decode(DecodeTypeJSON, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		listWriter := NewListWriter(writer, WithAlphabetizeHeaders())
+		if err := listWriter.Write(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	want := [][]string{
+		{"id", "secret"},
+		{"1.000000", "***"},
+		{"secret", "user"},
+		{"***", "c"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+
+	if count != 4 {
+		t.Fatalf("got count %d, want 4", count)
+	}
+}
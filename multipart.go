@@ -0,0 +1,165 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrMissingFormField is returned by DecodeMultipart when the request does not
+// have the form field.
+var ErrMissingFormField = fmt.Errorf("missing form field")
+
+// jsonSeqMediaType is the content type of an uploaded RFC 7464 JSON text
+// sequence.
+const jsonSeqMediaType = "application/json-seq"
+
+// ndjsonMediaTypes are the content types of uploaded newline-delimited JSON.
+var ndjsonMediaTypes = map[string]bool{
+	"application/x-ndjson":    true,
+	"application/ndjson":      true,
+	"application/jsonl":       true,
+	"application/x-jsonlines": true,
+}
+
+// isJSONSeq will return true if the part is a JSON text sequence, judged by its
+// content type.
+func isJSONSeq(part *multipart.Part) bool {
+	mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type"))
+
+	return err == nil && mediaType == jsonSeqMediaType
+}
+
+// isNDJSON will return true if the part is newline-delimited JSON, judged by
+// its content type and then by the extension of its file name.
+func isNDJSON(part *multipart.Part) bool {
+	if mediaType, _, err := mime.ParseMediaType(part.Header.Get("Content-Type")); err == nil {
+		if ndjsonMediaTypes[mediaType] {
+			return true
+		}
+	}
+
+	name := strings.TrimSuffix(part.FileName(), ".zst")
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".ndjson", ".jsonl":
+		return true
+	}
+
+	return false
+}
+
+// decodeNDJSON will decode each non-empty line of the data as JSON, appending
+// the records of every line to one list.
+func decodeNDJSON(data []byte, opts ...DecodeOption) (*structpb.ListValue, error) {
+	list := &structpb.ListValue{}
+
+	for i, line := range bytes.Split(data, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+
+		lineList, err := Decode(DecodeTypeJSON, line, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+
+		list.Values = append(list.Values, lineList.GetValues()...)
+	}
+
+	return list, nil
+}
+
+// DecodeMultipart decodes the file uploaded in the "field" of a
+// multipart/form-data request. The file is JSON, or newline-delimited JSON
+// when its content type is e.g. "application/x-ndjson" or its name ends in
+// ".ndjson" or ".jsonl", in which case the records of every line are decoded
+// into one list. A file whose content type is "application/json-seq" is
+// decoded as DecodeTypeJSONSeq. A zstd-compressed file is decompressed, and
+// may have a ".zst" suffix after its extension.
+//
+// The form is read as a stream, so the other parts are skipped without being
+// buffered, and no temporary files are created as they are by
+// http.Request.ParseMultipartForm. The file itself is read into memory, and
+// WithMaxInputBytes, which limits the decompressed size, stops reading as soon
+// as the limit is exceeded.
+func DecodeMultipart(r *http.Request, field string, opts ...DecodeOption) (*structpb.ListValue, error) {
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read multipart form: %w", err)
+	}
+
+	dec := &decoder{}
+	for _, opt := range opts {
+		opt(dec)
+	}
+
+	for {
+		part, err := reader.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("%w: %q", ErrMissingFormField, field)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read multipart form: %w", err)
+		}
+
+		if part.FormName() != field {
+			continue
+		}
+
+		src, release, err := decompress(part)
+		if err != nil {
+			return nil, err
+		}
+
+		defer release()
+
+		if dec.maxInputBytes > 0 {
+			// Read one byte past the limit to tell that it was
+			// exceeded.
+			src = io.LimitReader(src, int64(dec.maxInputBytes)+1)
+		}
+
+		data, err := io.ReadAll(src)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read form field %q: %w", field, err)
+		}
+
+		if dec.maxInputBytes > 0 && len(data) > dec.maxInputBytes {
+			return nil, fmt.Errorf("%w: form field %q exceeds the limit of %d bytes",
+				ErrInputTooLarge, field, dec.maxInputBytes)
+		}
+
+		if isJSONSeq(part) {
+			return Decode(DecodeTypeJSONSeq, data, opts...)
+		}
+
+		if isNDJSON(part) {
+			// The lines are split after the data is transcoded.
+			if data, err = toUTF8(data); err != nil {
+				return nil, err
+			}
+
+			return decodeNDJSON(data, opts...)
+		}
+
+		return Decode(DecodeTypeJSON, data, opts...)
+	}
+}
@@ -0,0 +1,141 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"errors"
+	"mime/multipart"
+	"net/http/httptest"
+	"net/textproto"
+	"reflect"
+	"testing"
+)
+
+func TestDecodeMultipart(t *testing.T) {
+	t.Parallel()
+
+	records := []interface{}{
+		map[string]interface{}{"id": 1.0},
+		map[string]interface{}{"id": 2.0},
+	}
+
+	for _, tcase := range []struct {
+		name        string
+		field       string
+		filename    string
+		contentType string
+		data        string
+		opts        []DecodeOption
+		want        []interface{}
+		err         error
+	}{
+		{
+			name:     "json",
+			field:    "file",
+			filename: "rows.json",
+			data:     `[{"id": 1}, {"id": 2}]`,
+			want:     records,
+		},
+		{
+			name:     "ndjson by name",
+			field:    "file",
+			filename: "rows.jsonl",
+			data:     "{\"id\": 1}\n\n{\"id\": 2}\n",
+			want:     records,
+		},
+		{
+			name:        "ndjson by content type",
+			field:       "file",
+			filename:    "upload",
+			contentType: "application/x-ndjson",
+			data:        "{\"id\": 1}\n{\"id\": 2}",
+			want:        records,
+		},
+		{
+			name:        "json text sequence",
+			field:       "file",
+			filename:    "rows.json",
+			contentType: "application/json-seq",
+			data:        "\x1e{\"id\": 1}\n\x1e{\"id\": 2}\n",
+			want:        records,
+		},
+		{
+			name:     "invalid ndjson line",
+			field:    "file",
+			filename: "rows.ndjson",
+			data:     "{\"id\": 1}\n{\"id\": }",
+			err:      ErrInvalidJSON,
+		},
+		{
+			name:     "missing field",
+			field:    "other",
+			filename: "rows.json",
+			data:     `[]`,
+			err:      ErrMissingFormField,
+		},
+		{
+			name:     "too large",
+			field:    "file",
+			filename: "rows.json",
+			data:     `[{"id": 1}, {"id": 2}]`,
+			opts:     []DecodeOption{WithMaxInputBytes(8)},
+			err:      ErrInputTooLarge,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var body bytes.Buffer
+
+			form := multipart.NewWriter(&body)
+			if err := form.WriteField("note", "ignored"); err != nil {
+				t.Fatal(err)
+			}
+
+			header := make(textproto.MIMEHeader)
+			header.Set("Content-Disposition", `form-data; name="file"; filename="`+tcase.filename+`"`)
+
+			if tcase.contentType != "" {
+				header.Set("Content-Type", tcase.contentType)
+			}
+
+			part, err := form.CreatePart(header)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := part.Write([]byte(tcase.data)); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := form.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			req := httptest.NewRequest("POST", "/upload", &body)
+			req.Header.Set("Content-Type", form.FormDataContentType())
+
+			list, err := DecodeMultipart(req, tcase.field, tcase.opts...)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil {
+				return
+			}
+
+			if got := list.AsSlice(); !reflect.DeepEqual(got, tcase.want) {
+				t.Fatalf("got %v, want %v", got, tcase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "fmt"
+
+type multiWriter struct {
+	writers    []Writer
+	bestEffort bool
+}
+
+// MultiWriterOption is used to configure a writer created by NewMultiWriter.
+type MultiWriterOption func(*multiWriter)
+
+// WithBestEffort configures the multi-writer to write every record to all of
+// its writers, even if some of them fail. The first error is returned along
+// with the number of failed writers.
+func WithBestEffort() MultiWriterOption {
+	return func(mw *multiWriter) {
+		mw.bestEffort = true
+	}
+}
+
+// NewMultiWriter creates a Writer that duplicates every record to all of the
+// given writers, in order. By default the write stops at, and returns, the
+// first error.
+func NewMultiWriter(writers []Writer, opts ...MultiWriterOption) Writer {
+	mw := &multiWriter{writers: writers}
+
+	for _, opt := range opts {
+		opt(mw)
+	}
+
+	return mw
+}
+
+// MultiWriter creates a Writer that duplicates every record to all of the
+// given writers, stopping at the first error.
+func MultiWriter(writers ...Writer) Writer {
+	return NewMultiWriter(writers)
+}
+
+// Write writes the record to every writer.
+func (mw *multiWriter) Write(record []string) error {
+	return mw.write(record, Writer.Write)
+}
+
+// WriteHeader writes the header to every writer.
+func (mw *multiWriter) WriteHeader(header []string) error {
+	return mw.write(header, writeHeaderRecord)
+}
+
+// write will write the record to every writer with "write".
+func (mw *multiWriter) write(record []string, write func(Writer, []string) error) error {
+	var (
+		firstErr error
+		failed   int
+	)
+
+	for i, writer := range mw.writers {
+		err := write(writer, record)
+		if err == nil {
+			continue
+		}
+
+		if !mw.bestEffort {
+			return fmt.Errorf("failed to write to writer %d: %w", i, err)
+		}
+
+		if firstErr == nil {
+			firstErr = err
+		}
+
+		failed++
+	}
+
+	if firstErr != nil {
+		return fmt.Errorf("failed to write to %d of %d writers: %w",
+			failed, len(mw.writers), firstErr)
+	}
+
+	return nil
+}
@@ -0,0 +1,56 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMultiWriter(t *testing.T) {
+	t.Parallel()
+
+	errWrite := errors.New("write failed")
+	failing := WriterFunc(func([]string) error { return errWrite })
+
+	for _, tcase := range []struct {
+		name      string
+		opts      []MultiWriterOption
+		wantCount int
+	}{
+		{
+			name:      "first error",
+			wantCount: 0,
+		},
+		{
+			name:      "best effort",
+			opts:      []MultiWriterOption{WithBestEffort()},
+			wantCount: 1,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			writer := NewMultiWriter([]Writer{failing, &dst}, tcase.opts...)
+
+			err := writer.Write([]string{"foo"})
+			if !errors.Is(err, errWrite) {
+				t.Fatalf("got error %v, want %v", err, errWrite)
+			}
+
+			if got := len(dst.records); got != tcase.wantCount {
+				t.Fatalf("got %d records, want %d", got, tcase.wantCount)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+)
+
+// ErrNullThreshold is returned when the ratio of empty cells in a column
+// exceeds the limit set by WithNullThreshold.
+var ErrNullThreshold = fmt.Errorf("null threshold exceeded")
+
+// WithNullThreshold configures the ListWriter to fail the write with an error
+// that wraps ErrNullThreshold, before anything is written, if more than
+// "maxRate" of the rows have a null or missing value in the column, e.g. 0.05
+// for 5%. A column that is not in the table at all is entirely null. If a
+// warning handler is configured, the error is reported to it and the table is
+// written. The child tables of WithChildTables are not checked, and the
+// Encoder checks each list separately.
+func WithNullThreshold(column string, maxRate float64) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if listWriter.nullThresholds == nil {
+			listWriter.nullThresholds = make(map[string]float64)
+		}
+
+		listWriter.nullThresholds[column] = maxRate
+	}
+}
+
+// checkNullRates will check the null rate of each column with a threshold.
+func (w *ListWriter) checkNullRates(cols *columns) error {
+	errs := w.nullRateErrors(cols)
+	if len(errs) > 0 && w.warn == nil {
+		return errs[0]
+	}
+
+	for _, err := range errs {
+		w.warn(err)
+	}
+
+	return nil
+}
+
+// nullRateErrors will return an error for each column whose null rate exceeds
+// its threshold.
+func (w *ListWriter) nullRateErrors(cols *columns) []error {
+	if cols.rows == 0 {
+		return nil
+	}
+
+	var errs []error
+
+	for _, header := range sortedColumns(w.nullThresholds) {
+		maxRate := w.nullThresholds[header]
+
+		nulls := cols.rows
+		if col, ok := cols.m[header]; ok {
+			nulls -= col.stats.Values - col.stats.Nulls
+		}
+
+		rate := float64(nulls) / float64(cols.rows)
+		if rate <= maxRate {
+			continue
+		}
+
+		errs = append(errs, fmt.Errorf("%w: column %q is %g null, over %g",
+			ErrNullThreshold, header, rate, maxRate))
+	}
+
+	return errs
+}
@@ -0,0 +1,103 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestWriteNullThreshold(t *testing.T) {
+	t.Parallel()
+
+	const data = `[{"id": 1, "email": "a@b.c"}, {"id": 2, "email": null}, {"id": 3}, {"id": 4, "email": "d@e.f"}]`
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		err  error
+	}{
+		{
+			name: "under the threshold",
+			opts: []ListWriterOption{WithNullThreshold("email", 0.5)},
+		},
+		{
+			name: "over the threshold",
+			opts: []ListWriterOption{WithNullThreshold("email", 0.25)},
+			err:  ErrNullThreshold,
+		},
+		{
+			name: "missing column",
+			opts: []ListWriterOption{WithNullThreshold("phone", 0.99)},
+			err:  ErrNullThreshold,
+		},
+		{
+			name: "buffered table",
+			opts: []ListWriterOption{WithNullThreshold("email", 0.25), WithSortBy("id")},
+			err:  ErrNullThreshold,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			err = NewListWriter(&dst, tcase.opts...).Write(context.Background(), list)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if tcase.err != nil && len(dst.records) != 0 {
+				t.Fatalf("got %v, want nothing written", dst.records)
+			}
+		})
+	}
+}
+
+func TestWriteNullThresholdWarning(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1}, {"id": 2, "email": "a@b.c"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		dst      recordWriter
+		warnings []error
+	)
+
+	listWriter := NewListWriter(&dst, WithNullThreshold("email", 0.1), WithNullThreshold("id", 0),
+		WithWarningHandler(func(err error) {
+			warnings = append(warnings, err)
+		}))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrNullThreshold) {
+		t.Fatalf("got warnings %v, want one %v", warnings, ErrNullThreshold)
+	}
+
+	if len(dst.records) != 3 {
+		t.Fatalf("got %d records, want 3", len(dst.records))
+	}
+
+	if problems := listWriter.Validate(list); len(problems) != 1 {
+		t.Fatalf("got problems %v, want 1", problems)
+	}
+}
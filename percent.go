@@ -0,0 +1,55 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "google.golang.org/protobuf/types/known/structpb"
+
+// percentScale is the power of ten that converts a ratio to a percentage.
+const percentScale = 2
+
+// WithPercentColumns configures the ListWriter to write the cells of the
+// columns, which hold ratios, as percentages with "decimals" digits after the
+// decimal point, e.g. 0.125 as "12.5%" with 1 decimal. Numbers and strings that
+// are numbers are converted, and other cells are written unchanged. The
+// percentages are rounded half up, unless WithRounding gives another mode.
+func WithPercentColumns(decimals int, columns ...string) ListWriterOption {
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	return func(listWriter *ListWriter) {
+		if listWriter.percentColumns == nil {
+			listWriter.percentColumns = make(map[string]int)
+		}
+
+		for _, column := range columns {
+			listWriter.percentColumns[column] = decimals
+		}
+	}
+}
+
+// appendPercent will append the value as a percentage with the given number of
+// decimals, if it is a number.
+func (w *ListWriter) appendPercent(buf []byte, value *structpb.Value, decimals int) ([]byte, bool) {
+	if _, ok := value.Kind.(*structpb.Value_BoolValue); ok {
+		return buf, false
+	}
+
+	num, ok := parseNumber(value)
+	if !ok {
+		return buf, false
+	}
+
+	r := &rounding{decimals: decimals}
+	if w.rounding != nil {
+		r.mode = w.rounding.mode
+	}
+
+	return append(r.appendScaled(buf, num, percentScale), '%'), true
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWritePercentColumns(t *testing.T) {
+	t.Parallel()
+
+	data := []byte(`[
+		{"ratio": 0.125, "share": 0.285},
+		{"ratio": "0.5", "share": 1},
+		{"ratio": "n/a", "share": -0.0001},
+		{"ratio": null, "share": true}
+	]`)
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "half up",
+			opts: []ListWriterOption{WithPercentColumns(1, "ratio"), WithPercentColumns(0, "share")},
+			want: [][]string{
+				{"ratio", "share"},
+				{"12.5%", "29%"},
+				{"50.0%", "100%"},
+				{"n/a", "0%"},
+				{"", "true"},
+			},
+		},
+		{
+			name: "rounding mode",
+			opts: []ListWriterOption{
+				WithPercentColumns(0, "ratio", "share"),
+				WithRounding(2, RoundHalfEven),
+			},
+			want: [][]string{
+				{"ratio", "share"},
+				{"12%", "28%"},
+				{"50%", "100%"},
+				{"n/a", "0%"},
+				{"", "true"},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,295 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WritePlan describes what a Write of a list would produce, without writing
+// it.
+type WritePlan struct {
+	// Header is the header that would be written.
+	Header []string
+
+	// Rows is the number of data rows that would be written, not counting
+	// the header or the footer.
+	Rows int
+
+	// Records is the number of records that would be written, after any
+	// were left out, e.g. by WithFilter.
+	Records int
+
+	// RowRecords maps each data row to the index of the record that it
+	// comes from, among the records that would be written. A record whose
+	// arrays of objects are exploded spans several rows. It is nil if the
+	// rows are grouped by WithGroupBy.
+	RowRecords []int
+
+	// Transforms describes the options that change the data, in the order
+	// in which they are applied, e.g. `filter "item.age > 18"`.
+	Transforms []string
+
+	// ChildTables are the plans of the child tables of WithChildTables,
+	// keyed by name.
+	ChildTables map[string]*WritePlan
+}
+
+// Plan returns what a Write of the list would produce, without writing
+// anything. It fails where the Write would, except for the failures of the
+// Writer and the footer.
+func (w *ListWriter) Plan(list *structpb.ListValue) (*WritePlan, error) {
+	// The list is sampled as the next Write would sample it.
+	planner := *w
+	planner.sample = w.sample.clone()
+
+	// The rejected records are left out, but not written.
+	if w.rejects != nil {
+		planner.rejects = &rejectWriter{}
+	}
+
+	list, err := planner.prepare(context.Background(), list)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.arrayPolicy != ArrayPolicyChildTable {
+		return w.planList(list)
+	}
+
+	list, children := splitChildren(list, w.keyEscaper)
+
+	plan, err := w.planList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.ChildTables = make(map[string]*WritePlan, len(children))
+
+	// The child tables are planned as they are written.
+	child := *w
+	child.footer = nil
+	child.groupBy = nil
+	child.sortBy = nil
+
+	for name, table := range children {
+		if plan.ChildTables[name], err = child.planList(table); err != nil {
+			return nil, fmt.Errorf("failed to plan child table %q: %w", name, err)
+		}
+	}
+
+	return plan, nil
+}
+
+// planList will return the plan of the prepared list.
+func (w *ListWriter) planList(list *structpb.ListValue) (*WritePlan, error) {
+	cols := newColumns(w.columnsOpts(list)...)
+	plan := &WritePlan{Transforms: w.transforms()}
+
+	for i, value := range list.GetValues() {
+		first := cols.rows
+
+		if err := cols.addValue("", value); err != nil {
+			return nil, fmt.Errorf("failed to add value: %w", err)
+		}
+
+		for row := first; row < cols.rows; row++ {
+			plan.RowRecords = append(plan.RowRecords, i)
+		}
+	}
+
+	if less := w.headerLess(); less != nil {
+		cols.reorder(less)
+	}
+
+	plan.Records = cols.records
+	plan.Rows = cols.rows
+
+	if w.groupBy == nil {
+		for _, col := range cols.ordered() {
+			plan.Header = append(plan.Header, col.header)
+		}
+
+		return plan, nil
+	}
+
+	// The grouped header and rows depend on the cells, so the table is
+	// built and grouped.
+	table, store, err := w.table(cols)
+	if err == nil {
+		table, err = w.groupBy.apply(table, store.iter(), w.formatAgg)
+	}
+
+	if closeErr := store.close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Header = table.Header
+	plan.Rows = len(table.Rows)
+	plan.RowRecords = nil
+
+	return plan, nil
+}
+
+// sortedColumns will return the keys of the map in order.
+func sortedColumns[T any](m map[string]T) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// transforms will describe the options that change the data, in the order in
+// which they are applied.
+//
+//nolint:cyclop
+func (w *ListWriter) transforms() []string {
+	var transforms []string
+
+	add := func(format string, args ...any) {
+		transforms = append(transforms, fmt.Sprintf(format, args...))
+	}
+
+	if w.sample != nil {
+		add("sample %g", w.sample.rate)
+	}
+
+	if w.inputSchema != nil {
+		add("input schema")
+	}
+
+	for _, filter := range w.filters {
+		add("filter %q", filter.expr)
+	}
+
+	for _, column := range w.computed {
+		add("computed column %q = %q", column.name, column.expr.expr)
+	}
+
+	for _, lookup := range w.lookups {
+		add("lookup %q adding %s", lookup.column, strings.Join(lookup.newCols, ", "))
+	}
+
+	for _, split := range w.splits {
+		add("split %q by %q into %s", split.column, split.sep, strings.Join(split.newCols, ", "))
+	}
+
+	for _, concat := range w.concats {
+		add("concatenate %s by %q into %q", strings.Join(concat.cols, ", "), concat.sep, concat.column)
+	}
+
+	if w.fieldMask != nil {
+		add("field mask")
+	}
+
+	if len(w.dropKinds) > 0 {
+		kinds := make([]string, 0, len(w.dropKinds))
+		for kind := range w.dropKinds {
+			kinds = append(kinds, kind.String())
+		}
+
+		sort.Strings(kinds)
+		add("drop kinds %s", strings.Join(kinds, ", "))
+	}
+
+	if w.dedup != nil {
+		add("dedup key %s", strings.Join(w.dedup.columns, ", "))
+	}
+
+	if w.arrayPolicy != ArrayPolicyAuto {
+		add("array policy %s", w.arrayPolicy)
+	}
+
+	if w.explodeDepth >= 0 {
+		add("explode depth %d", w.explodeDepth)
+	}
+
+	if w.recordIDColumn != "" {
+		add("record ID column %q", w.recordIDColumn)
+	}
+
+	if w.arrayIndexColumn != "" {
+		add("array index column %q", w.arrayIndexColumn)
+	}
+
+	for _, column := range sortedColumns(w.valueMaps) {
+		add("value map %q", column)
+	}
+
+	for _, column := range sortedColumns(w.base64Columns) {
+		add("base64 decode %q as %s", column, w.base64Columns[column])
+	}
+
+	for _, column := range sortedColumns(w.percentColumns) {
+		add("percent %q with %d decimals", column, w.percentColumns[column])
+	}
+
+	for _, column := range sortedColumns(w.currencyColumns) {
+		add("currency %q in %q", column, w.currencyColumns[column])
+	}
+
+	for _, column := range sortedColumns(w.coercions) {
+		add("coerce %q to %s", column, w.coercions[column])
+	}
+
+	if w.rounding != nil {
+		add("round to %d decimals %s", w.rounding.decimals, w.rounding.mode)
+	}
+
+	if w.boolFormat != nil {
+		add("bool format %q/%q", w.boolFormat.trueCell, w.boolFormat.falseCell)
+	}
+
+	if w.timeZone != nil {
+		add("time zone %s", w.timeZone)
+	}
+
+	for _, column := range sortedColumns(w.timeZones) {
+		add("time zone %s for %q", w.timeZones[column], column)
+	}
+
+	for _, column := range sortedColumns(w.columnTransforms) {
+		add("transform %q", column)
+	}
+
+	if w.excel != nil {
+		add("excel profile")
+	}
+
+	for range w.formatters {
+		add("value formatter")
+	}
+
+	if w.groupBy != nil {
+		add("group by %s", strings.Join(w.groupBy.keys, ", "))
+	}
+
+	if len(w.sortBy) > 0 {
+		add("sort by %s", strings.Join(w.sortBy, ", "))
+	}
+
+	if w.footer != nil {
+		add("footer")
+	}
+
+	return transforms
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "items": [{"sku": "a"}, {"sku": "b"}]},
+		{"id": 2, "items": []},
+		{"id": 3, "items": [{"sku": "c"}]}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want *WritePlan
+	}{
+		{
+			name: "exploded",
+			opts: []ListWriterOption{WithAlphabetizeHeaders()},
+			want: &WritePlan{
+				Header:     []string{"id", "items.sku"},
+				Rows:       4,
+				Records:    3,
+				RowRecords: []int{0, 0, 1, 2},
+			},
+		},
+		{
+			name: "transforms",
+			opts: []ListWriterOption{
+				WithAlphabetizeHeaders(),
+				WithFilter("item.id > 1"),
+				WithCoercion("id", KindString),
+				WithRecordID("record"),
+			},
+			want: &WritePlan{
+				Header:     []string{"id", "items.sku", "record"},
+				Rows:       2,
+				Records:    2,
+				RowRecords: []int{0, 1},
+				Transforms: []string{
+					`filter "item.id > 1"`,
+					`record ID column "record"`,
+					`coerce "id" to string`,
+				},
+			},
+		},
+		{
+			name: "child tables",
+			opts: []ListWriterOption{
+				WithAlphabetizeHeaders(),
+				WithChildTables(func(string) (Writer, error) { return &recordWriter{}, nil }),
+			},
+			want: &WritePlan{
+				Header:     []string{"_id", "id"},
+				Rows:       3,
+				Records:    3,
+				RowRecords: []int{0, 1, 2},
+				Transforms: []string{"array policy childTable"},
+				ChildTables: map[string]*WritePlan{
+					"items": {
+						Header:     []string{"_id", "_parent_id", "sku"},
+						Rows:       3,
+						Records:    3,
+						RowRecords: []int{0, 1, 2},
+						Transforms: []string{"array policy childTable"},
+					},
+				},
+			},
+		},
+		{
+			name: "grouped",
+			opts: []ListWriterOption{WithGroupBy([]string{"id"}, map[string]AggFunc{"items.sku": AggCount})},
+			want: &WritePlan{
+				// The second row of the first record has no id.
+				Header:     []string{"id", "items.sku"},
+				Rows:       4,
+				Records:    3,
+				Transforms: []string{"group by id"},
+			},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			got, err := NewListWriter(&dst, tcase.opts...).Plan(list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tcase.want) {
+				t.Fatalf("got %+v, want %+v", got, tcase.want)
+			}
+
+			if len(dst.records) != 0 {
+				t.Fatalf("unexpected records: %v", dst.records)
+			}
+		})
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"unicode/utf8"
+)
+
+// prettyPadding is the number of spaces between columns.
+const prettyPadding = 2
+
+// prettyEllipsis marks a cell that was truncated to the maximum width.
+const prettyEllipsis = "…"
+
+// ColorMode is whether the PrettyWriter colors its output.
+type ColorMode int
+
+const (
+	// ColorNever writes plain text. This is the default.
+	ColorNever ColorMode = iota
+
+	// ColorAuto colors the output if it is written to a terminal and the
+	// NO_COLOR environment variable is not set.
+	ColorAuto
+
+	// ColorAlways colors the output.
+	ColorAlways
+)
+
+// ANSI escape codes for the PrettyWriter. Every code that starts a cell has the
+// same length, so that the columns, which the tabwriter aligns by length, still
+// line up on screen.
+const (
+	ansiBold    = "\x1b[01m"
+	ansiDim     = "\x1b[02m"
+	ansiNumber  = "\x1b[36m"
+	ansiBool    = "\x1b[33m"
+	ansiDefault = "\x1b[39m"
+	ansiReset   = "\x1b[0m"
+)
+
+// prettyNull is shown, dimmed, for empty cells when the output is colored,
+// since nulls are written as empty cells.
+const prettyNull = "∅"
+
+// PrettyWriter is a Writer that renders records as aligned, padded columns for
+// reading in a terminal. Columns can only be aligned once all of the rows are
+// known, so nothing is written until Flush is called.
+type PrettyWriter struct {
+	tabWriter *tabwriter.Writer
+	maxWidth  int
+	color     ColorMode
+	header    bool
+}
+
+// PrettyWriterOption is used to configure the PrettyWriter.
+type PrettyWriterOption func(*PrettyWriter)
+
+// WithMaxCellWidth configures the PrettyWriter to truncate cells that are wider
+// than "n" characters, marking them with an ellipsis.
+func WithMaxCellWidth(n int) PrettyWriterOption {
+	return func(w *PrettyWriter) {
+		w.maxWidth = n
+	}
+}
+
+// WithColor configures whether the PrettyWriter colors its output. Numbers and
+// booleans are highlighted, empty cells are shown as a dimmed "∅", and the
+// header is bold.
+func WithColor(mode ColorMode) PrettyWriterOption {
+	return func(w *PrettyWriter) {
+		w.color = mode
+	}
+}
+
+// isTerminal will return true if the writer is a character device, such as a
+// terminal.
+func isTerminal(writer io.Writer) bool {
+	file, ok := writer.(*os.File)
+	if !ok {
+		return false
+	}
+
+	info, err := file.Stat()
+
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// NewPrettyWriter creates a PrettyWriter that writes to "writer". The first
+// record written is treated as the header.
+func NewPrettyWriter(writer io.Writer, opts ...PrettyWriterOption) *PrettyWriter {
+	prettyWriter := &PrettyWriter{
+		tabWriter: tabwriter.NewWriter(writer, 0, 0, prettyPadding, ' ', 0),
+		header:    true,
+	}
+
+	for _, opt := range opts {
+		opt(prettyWriter)
+	}
+
+	if prettyWriter.color == ColorAuto {
+		_, noColor := os.LookupEnv("NO_COLOR")
+		if noColor || !isTerminal(writer) {
+			prettyWriter.color = ColorNever
+		}
+	}
+
+	return prettyWriter
+}
+
+// colorCell will wrap the cell in the escape codes for its type.
+func colorCell(cell string, header bool) string {
+	code := ansiDefault
+
+	switch {
+	case header:
+		code = ansiBold
+	case cell == "":
+		code, cell = ansiDim, prettyNull
+	default:
+		switch parseCellType(cell) {
+		case ColumnTypeInt, ColumnTypeFloat:
+			code = ansiNumber
+		case ColumnTypeBool:
+			code = ansiBool
+		case ColumnTypeString:
+		}
+	}
+
+	return code + cell + ansiReset
+}
+
+// prettyCell will escape the characters in the cell that would break the
+// layout, and truncate it to the maximum width.
+func (w *PrettyWriter) prettyCell(cell string) string {
+	cell = strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(cell)
+
+	if w.maxWidth > 0 && utf8.RuneCountInString(cell) > w.maxWidth {
+		runes := []rune(cell)
+
+		// Keep room for the ellipsis, unless there is none.
+		keep := w.maxWidth - 1
+		if keep < 0 {
+			keep = 0
+		}
+
+		cell = string(runes[:keep]) + prettyEllipsis
+	}
+
+	return cell
+}
+
+// Write buffers the record as a row.
+func (w *PrettyWriter) Write(record []string) error {
+	var buf strings.Builder
+
+	for i, cell := range record {
+		if i > 0 {
+			buf.WriteByte('\t')
+		}
+
+		cell = w.prettyCell(cell)
+		if w.color != ColorNever {
+			cell = colorCell(cell, w.header)
+		}
+
+		buf.WriteString(cell)
+	}
+
+	w.header = false
+
+	buf.WriteByte('\n')
+
+	if _, err := io.WriteString(w.tabWriter, buf.String()); err != nil {
+		return fmt.Errorf("failed to write pretty row: %w", err)
+	}
+
+	return nil
+}
+
+// Flush writes the buffered rows, aligned by column.
+func (w *PrettyWriter) Flush() error {
+	if err := w.tabWriter.Flush(); err != nil {
+		return fmt.Errorf("failed to flush pretty rows: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPrettyWriter(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "name": "a\tb", "note": "short"},
+		{"id": 22, "name": "ünïcode", "note": "a very long note"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []PrettyWriterOption
+		want string
+	}{
+		{
+			name: "aligned",
+			want: "" +
+				"id         name     note\n" +
+				"1.000000   a\\tb     short\n" +
+				"22.000000  ünïcode  a very long note\n",
+		},
+		{
+			name: "max width",
+			opts: []PrettyWriterOption{WithMaxCellWidth(6)},
+			want: "" +
+				"id      name    note\n" +
+				"1.000…  a\\tb    short\n" +
+				"22.00…  ünïco…  a ver…\n",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf bytes.Buffer
+
+			prettyWriter := NewPrettyWriter(&buf, tcase.opts...)
+
+			err := NewListWriter(prettyWriter, WithAlphabetizeHeaders()).Write(context.Background(), list)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := prettyWriter.Flush(); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := buf.String(); got != tcase.want {
+				t.Fatalf("got\n%s\nwant\n%s", got, tcase.want)
+			}
+		})
+	}
+}
+
+func TestPrettyWriterColor(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "name": "alpha", "ok": true},
+		{"id": 22, "name": null, "ok": false}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write := func(mode ColorMode) string {
+		var buf bytes.Buffer
+
+		prettyWriter := NewPrettyWriter(&buf, WithColor(mode))
+
+		err := NewListWriter(prettyWriter, WithAlphabetizeHeaders()).Write(context.Background(), list)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := prettyWriter.Flush(); err != nil {
+			t.Fatal(err)
+		}
+
+		return buf.String()
+	}
+
+	// Output that is not a terminal is not colored in auto mode.
+	if got := write(ColorAuto); got != write(ColorNever) {
+		t.Fatalf("got colored output %q in auto mode", got)
+	}
+
+	got := write(ColorAlways)
+
+	if !strings.Contains(got, ansiBold+"id"+ansiReset) {
+		t.Fatalf("got %q, want a bold header", got)
+	}
+
+	if !strings.Contains(got, ansiNumber+"22.000000"+ansiReset) {
+		t.Fatalf("got %q, want a colored number", got)
+	}
+
+	if !strings.Contains(got, ansiBool+"false"+ansiReset) {
+		t.Fatalf("got %q, want a colored bool", got)
+	}
+
+	// The columns line up once the escape codes are removed.
+	plain := regexp.MustCompile("\x1b\\[[0-9]+m").ReplaceAllString(got, "")
+	want := "" +
+		"id         name   ok\n" +
+		"1.000000   alpha  true\n" +
+		"22.000000  ∅      false\n"
+
+	if plain != want {
+		t.Fatalf("got\n%s\nwant\n%s", plain, want)
+	}
+}
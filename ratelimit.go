@@ -0,0 +1,80 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// rateLimiter is a token bucket that holds up to one second of rows.
+type rateLimiter struct {
+	rate   float64
+	tokens float64
+	last   time.Time
+}
+
+// WithRateLimit configures the ListWriter and the Encoder to write at most
+// "rowsPerSecond" data rows per second to the Writer, for backends with API
+// quotas such as spreadsheets and HTTP ingestion endpoints. Up to one second
+// of rows is written in a burst, and the rows after it wait for the bucket to
+// refill. Waiting stops when the context of the write is done, in which case
+// the write fails with the context's error. The header and the footer are not
+// counted. The rows of the child tables of WithChildTables share the limit.
+func WithRateLimit(rowsPerSecond int) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.rateLimit = nil
+
+		if rowsPerSecond > 0 {
+			listWriter.rateLimit = &rateLimiter{
+				rate:   float64(rowsPerSecond),
+				tokens: float64(rowsPerSecond),
+			}
+		}
+	}
+}
+
+// wait will take a token from the bucket, waiting until one is available or
+// the context is done.
+func (lim *rateLimiter) wait(ctx context.Context) error {
+	now := time.Now()
+
+	if !lim.last.IsZero() {
+		lim.tokens += now.Sub(lim.last).Seconds() * lim.rate
+		if lim.tokens > lim.rate {
+			lim.tokens = lim.rate
+		}
+	}
+
+	lim.last = now
+
+	if lim.tokens >= 1 {
+		lim.tokens--
+
+		return nil
+	}
+
+	delay := time.Duration((1 - lim.tokens) / lim.rate * float64(time.Second))
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("failed to wait for rate limit: %w", ctx.Err())
+	case <-timer.C:
+	}
+
+	// The token that refilled while waiting is taken.
+	lim.tokens = 0
+	lim.last = now.Add(delay)
+
+	return nil
+}
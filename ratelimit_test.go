@@ -0,0 +1,81 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestWriteRateLimit(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1}, {"id": 2}, {"id": 3}, {"id": 4}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	start := time.Now()
+
+	// The rows fit in the burst of one second of rows.
+	if err := NewListWriter(&dst, WithRateLimit(20)).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("got %v for a burst, want less than a second", elapsed)
+	}
+
+	if len(dst.records) != 5 {
+		t.Fatalf("got %d records, want 5", len(dst.records))
+	}
+
+	// With an empty bucket, each row waits for it to refill.
+	lim := &rateLimiter{rate: 20, last: time.Now()}
+
+	start = time.Now()
+
+	for i := 0; i < 3; i++ {
+		if err := lim.wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("got %v for 3 rows at 20 per second, want at least 100ms", elapsed)
+	}
+}
+
+func TestWriteRateLimitCanceled(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1}, {"id": 2}, {"id": 3}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithRateLimit(1)).Write(ctx, list)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+	}
+
+	// The header and the first row were written.
+	if len(dst.records) != 2 {
+		t.Fatalf("got %d records, want 2", len(dst.records))
+	}
+}
@@ -0,0 +1,37 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WriteRaw writes each raw JSON message as one record, e.g. the rows of a jsonb
+// column, without the messages being joined into one JSON array first. A
+// message that is an array is written as a single record, not as a list of
+// records. An invalid message fails with ErrInvalidJSON before anything is
+// written.
+func (w *ListWriter) WriteRaw(ctx context.Context, msgs []json.RawMessage) error {
+	list := &structpb.ListValue{Values: make([]*structpb.Value, len(msgs))}
+
+	for i, msg := range msgs {
+		value, err := newJSONParser(msg).parse()
+		if err != nil {
+			return invalidJSON(fmt.Errorf("failed to unmarshal message %d: %w", i, err))
+		}
+
+		list.Values[i] = value
+	}
+
+	return w.Write(ctx, list)
+}
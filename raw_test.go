@@ -0,0 +1,66 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestWriteRaw(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		msgs []json.RawMessage
+		want [][]string
+		err  error
+	}{
+		{
+			name: "records",
+			msgs: []json.RawMessage{
+				json.RawMessage(`{"id": 1, "tags": ["a", "b"]}`),
+				json.RawMessage(` {"id": 2, "name": "x"} `),
+			},
+			want: [][]string{
+				{"id", "name", "tags"},
+				{"1.000000", "", "[a,b]"},
+				{"2.000000", "x", ""},
+			},
+		},
+		{
+			name: "invalid message",
+			msgs: []json.RawMessage{
+				json.RawMessage(`{"id": 1}`),
+				json.RawMessage(`{"id": }`),
+			},
+			err: ErrInvalidJSON,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			err := NewListWriter(&dst, WithAlphabetizeHeaders()).WriteRaw(context.Background(), tcase.msgs)
+			if !errors.Is(err, tcase.err) {
+				t.Fatalf("got error %v, want %v", err, tcase.err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
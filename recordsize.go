@@ -0,0 +1,85 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// RecordSize is the serialized size of a record.
+type RecordSize struct {
+	// Record is the index of the record among the records that were
+	// written, after any were left out, e.g. by WithFilter.
+	Record int `json:"record"`
+
+	// Bytes is the size of the record in the protobuf wire format.
+	Bytes int `json:"bytes"`
+}
+
+// recordSizes keeps the largest records of a write.
+type recordSizes struct {
+	n   int
+	top []RecordSize
+}
+
+// WithLargestRecords configures the ListWriter to measure the serialized size
+// of each record that is written and to keep the "n" largest, which are given
+// in Table.LargestRecords to the footer and in the Metadata of
+// WithMetadataSidecar. This helps to find the payloads that exceed downstream
+// row-size limits. The size is that of the record in the protobuf wire format,
+// which is computed without serializing it.
+func WithLargestRecords(n int) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.recordSizes = nil
+
+		if n > 0 {
+			listWriter.recordSizes = &recordSizes{n: n}
+		}
+	}
+}
+
+// observe will measure the records of the prepared list, replacing the largest
+// records of any earlier list.
+func (sizes *recordSizes) observe(list *structpb.ListValue) {
+	sizes.top = sizes.top[:0]
+
+	for i, record := range list.GetValues() {
+		sizes.add(RecordSize{Record: i, Bytes: proto.Size(record)})
+	}
+}
+
+// add will insert the size among the largest, which are kept in descending
+// order of size, with earlier records first among equal sizes.
+func (sizes *recordSizes) add(size RecordSize) {
+	pos := len(sizes.top)
+	for pos > 0 && sizes.top[pos-1].Bytes < size.Bytes {
+		pos--
+	}
+
+	if pos >= sizes.n {
+		return
+	}
+
+	if len(sizes.top) < sizes.n {
+		sizes.top = append(sizes.top, RecordSize{})
+	}
+
+	copy(sizes.top[pos+1:], sizes.top[pos:])
+	sizes.top[pos] = size
+}
+
+// largest will return a copy of the largest records.
+func (sizes *recordSizes) largest() []RecordSize {
+	if sizes == nil || len(sizes.top) == 0 {
+		return nil
+	}
+
+	return append([]RecordSize{}, sizes.top...)
+}
@@ -0,0 +1,73 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestWriteLargestRecords(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": "a"},
+		{"id": "abcdefghij"},
+		{"id": "b"},
+		{"id": "abcde"},
+		{"id": "abcdefghij"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sizes := make([]int, len(list.GetValues()))
+	for i, record := range list.GetValues() {
+		sizes[i] = proto.Size(record)
+	}
+
+	want := []RecordSize{
+		{Record: 1, Bytes: sizes[1]},
+		{Record: 4, Bytes: sizes[4]},
+		{Record: 3, Bytes: sizes[3]},
+	}
+
+	var (
+		footerGot []RecordSize
+		sidecar   bytes.Buffer
+	)
+
+	listWriter := NewListWriter(&recordWriter{}, WithLargestRecords(3), WithMetadataSidecar(&sidecar),
+		WithFooter(func(table Table) []string {
+			footerGot = table.LargestRecords
+
+			return nil
+		}))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(footerGot, want) {
+		t.Fatalf("got footer records %v, want %v", footerGot, want)
+	}
+
+	var meta Metadata
+	if err := json.Unmarshal(sidecar.Bytes(), &meta); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(meta.LargestRecords, want) {
+		t.Fatalf("got sidecar records %v, want %v", meta.LargestRecords, want)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+)
+
+// ErrIncompatibleSchema is returned by ListWriter.Write when the schema of the
+// table is rejected by the Check of the SchemaRegistry. The error of the
+// registry is wrapped.
+var ErrIncompatibleSchema = fmt.Errorf("incompatible schema")
+
+// SchemaRegistry gates the tables that are written on the compatibility of
+// their schemas, e.g. with a Confluent-style registry that rejects a column
+// that changed type since the last export.
+type SchemaRegistry interface {
+	// Check returns an error if the schema is not compatible with the
+	// schemas that were registered before.
+	Check(ctx context.Context, schema *Schema) error
+
+	// Register records the schema, once it has passed Check.
+	Register(ctx context.Context, schema *Schema) error
+}
+
+// WithSchemaRegistry configures the ListWriter to infer the Schema of each
+// table, as InferSchema does, and to check and register it with "reg" before
+// anything is written. If the check fails, nothing is written and Write returns
+// an error that wraps ErrIncompatibleSchema. The whole table is buffered to
+// infer its schema, as with WithFooter. The child tables of WithChildTables are
+// not checked, and the Encoder ignores this option.
+func WithSchemaRegistry(reg SchemaRegistry) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.registry = reg
+	}
+}
+
+// registerSchema will infer the schema of the table from the rows, and then
+// check and register it.
+func (w *ListWriter) registerSchema(ctx context.Context, header []string, rows rowIter) error {
+	types := make([]typeInference, len(header))
+
+	err := rows(func(row []string) error {
+		for i := range types {
+			if i < len(row) {
+				types[i].observe(row[i])
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	schema := &Schema{Columns: make([]SchemaColumn, len(header))}
+	for i, name := range header {
+		schema.Columns[i] = SchemaColumn{Name: name, Type: types[i].typ}
+	}
+
+	if err := w.registry.Check(ctx, schema); err != nil {
+		return &categoryError{
+			category: ErrIncompatibleSchema,
+			err:      fmt.Errorf("schema check failed: %w", err),
+		}
+	}
+
+	if err := w.registry.Register(ctx, schema); err != nil {
+		return fmt.Errorf("failed to register schema: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+var errTypeChanged = fmt.Errorf("column type changed")
+
+// typeRegistry is a SchemaRegistry that rejects columns whose type changed.
+type typeRegistry struct {
+	types   map[string]ColumnType
+	schemas []*Schema
+}
+
+func (reg *typeRegistry) Check(_ context.Context, schema *Schema) error {
+	for _, col := range schema.Columns {
+		if typ, ok := reg.types[col.Name]; ok && typ != col.Type {
+			return fmt.Errorf("%w: %q from %s to %s", errTypeChanged, col.Name, typ, col.Type)
+		}
+	}
+
+	return nil
+}
+
+func (reg *typeRegistry) Register(_ context.Context, schema *Schema) error {
+	for _, col := range schema.Columns {
+		reg.types[col.Name] = col.Type
+	}
+
+	reg.schemas = append(reg.schemas, schema)
+
+	return nil
+}
+
+func TestWriteSchemaRegistry(t *testing.T) {
+	t.Parallel()
+
+	reg := &typeRegistry{types: make(map[string]ColumnType)}
+
+	for _, tcase := range []struct {
+		data string
+		want [][]string
+		err  error
+	}{
+		{
+			data: `[{"id": 1, "name": "a"}, {"id": 2}]`,
+			want: [][]string{{"id", "name"}, {"1", "a"}, {"2", ""}},
+		},
+		{
+			data: `[{"id": 3, "ok": true}]`,
+			want: [][]string{{"id", "ok"}, {"3", "true"}},
+		},
+		{
+			data: `[{"id": "x"}]`,
+			err:  ErrIncompatibleSchema,
+		},
+	} {
+		list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var dst recordWriter
+
+		err = NewListWriter(&dst, WithAlphabetizeHeaders(), WithSchemaRegistry(reg),
+			WithRounding(0, RoundHalfUp)).Write(context.Background(), list)
+		if !errors.Is(err, tcase.err) {
+			t.Fatalf("got error %v, want %v", err, tcase.err)
+		}
+
+		if tcase.err != nil && !errors.Is(err, errTypeChanged) {
+			t.Fatalf("got error %v, want the registry's error wrapped", err)
+		}
+
+		if !reflect.DeepEqual(dst.records, tcase.want) {
+			t.Fatalf("got %q, want %q", dst.records, tcase.want)
+		}
+	}
+
+	want := []*Schema{
+		{Columns: []SchemaColumn{{Name: "id", Type: ColumnTypeInt}, {Name: "name", Type: ColumnTypeString}}},
+		{Columns: []SchemaColumn{{Name: "id", Type: ColumnTypeInt}, {Name: "ok", Type: ColumnTypeBool}}},
+	}
+
+	if !reflect.DeepEqual(reg.schemas, want) {
+		t.Fatalf("got registered %+v, want %+v", reg.schemas, want)
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// rejectHeader is the header of the rejected records.
+var rejectHeader = []string{"error", "record"}
+
+// rejectWriter writes the records that are rejected. A rejectWriter without a
+// Writer discards them, as when the write is only planned.
+type rejectWriter struct {
+	writer        Writer
+	headerWritten bool
+}
+
+// WithRejectWriter configures the ListWriter to write the records that fail
+// WithInputSchema, a WithFilter or WithComputedColumn expression, or a
+// WithCoercion of one of their cells to "w", and to leave them out of the
+// table, rather than failing the write or reporting them to the warning
+// handler. Each rejected record is written as a row with the error and the
+// record as JSON, as it would have been flattened, under the header
+// "error,record", which is written before the first rejected record.
+func WithRejectWriter(w Writer) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.rejects = &rejectWriter{writer: w}
+	}
+}
+
+// reject will write the record and the error that it failed with.
+func (w *ListWriter) reject(record *structpb.Value, err error) error {
+	rejects := w.rejects
+	if rejects.writer == nil {
+		return nil
+	}
+
+	data, jsonErr := json.Marshal(record.AsInterface())
+	if jsonErr != nil {
+		return fmt.Errorf("failed to marshal rejected record: %w", jsonErr)
+	}
+
+	if !rejects.headerWritten {
+		if err := writeHeaderRecord(rejects.writer, rejectHeader); err != nil {
+			return writerFailed(fmt.Errorf("failed to write reject header: %w", err))
+		}
+
+		rejects.headerWritten = true
+	}
+
+	if err := rejects.writer.Write([]string{err.Error(), string(data)}); err != nil {
+		return writerFailed(fmt.Errorf("failed to write rejected record: %w", err))
+	}
+
+	return nil
+}
+
+// rejectUncoercible will reject the records of the prepared list with a cell
+// that cannot be coerced, returning the records that remain.
+func (w *ListWriter) rejectUncoercible(list *structpb.ListValue) (*structpb.ListValue, error) {
+	// The cells are formatted as they will be written, but fail rather
+	// than being reported to the warning handler.
+	checker := *w
+	checker.warn = nil
+
+	var (
+		buf  []byte
+		kept *structpb.ListValue
+	)
+
+	for i, value := range list.GetValues() {
+		err := checker.checkCoercions(&buf, "", value)
+		if err == nil {
+			if kept != nil {
+				kept.Values = append(kept.Values, value)
+			}
+
+			continue
+		}
+
+		if !errors.Is(err, ErrUncoercible) {
+			return nil, err
+		}
+
+		if err := w.reject(value, fmt.Errorf("record %d: %w", i, err)); err != nil {
+			return nil, err
+		}
+
+		// Only copy the list if there is something to leave out.
+		if kept == nil {
+			kept = &structpb.ListValue{
+				Values: append([]*structpb.Value{}, list.GetValues()[:i]...),
+			}
+		}
+	}
+
+	if kept == nil {
+		return list, nil
+	}
+
+	return kept, nil
+}
+
+// checkCoercions will format the scalars of the value that are in coerced
+// columns, returning the first error. The elements of arrays are checked at
+// the path of the array.
+func (w *ListWriter) checkCoercions(buf *[]byte, path string, value *structpb.Value) error {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_StructValue:
+		for key, field := range valType.StructValue.GetFields() {
+			err := w.checkCoercions(buf, joinPath(path, w.keyEscaper.escapeKey(key)), field)
+			if err != nil {
+				return err
+			}
+		}
+	case *structpb.Value_ListValue:
+		for _, elem := range valType.ListValue.GetValues() {
+			if err := w.checkCoercions(buf, path, elem); err != nil {
+				return err
+			}
+		}
+	default:
+		if _, ok := w.coercions[path]; !ok {
+			return nil
+		}
+
+		if mapped, ok := w.mapValue(path, value); ok {
+			value = mapped
+		}
+
+		cell, err := w.appendCell((*buf)[:0], path, value)
+		if err != nil {
+			return err
+		}
+
+		*buf = cell
+	}
+
+	return nil
+}
@@ -0,0 +1,174 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWriteRejects(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name        string
+		data        string
+		opts        []ListWriterOption
+		want        [][]string
+		wantRejects []string
+	}{
+		{
+			name: "input schema",
+			data: `[{"id": 1}, {"id": "x"}]`,
+			opts: []ListWriterOption{
+				WithInputSchema([]byte(`{"type": "object", "properties": {"id": {"type": "number"}}}`)),
+			},
+			want:        [][]string{{"id"}, {"1"}},
+			wantRejects: []string{`{"id":"x"}`},
+		},
+		{
+			name:        "filter",
+			data:        `[{"id": 1, "age": 20}, {"id": 2}]`,
+			opts:        []ListWriterOption{WithFilter("item.age > 18")},
+			want:        [][]string{{"age", "id"}, {"20", "1"}},
+			wantRejects: []string{`{"id":2}`},
+		},
+		{
+			name:        "computed column",
+			data:        `[{"id": 1, "age": 20}, {"id": 2}]`,
+			opts:        []ListWriterOption{WithComputedColumn("adult", "item.age > 18")},
+			want:        [][]string{{"adult", "age", "id"}, {"true", "20", "1"}},
+			wantRejects: []string{`{"id":2}`},
+		},
+		{
+			name: "coercion",
+			data: `[{"id": 1, "n": "2"}, {"id": 2, "n": "x"}, {"id": 3, "n": {"m": "y"}}]`,
+			opts: []ListWriterOption{
+				WithCoercion("n", KindNumber),
+				WithCoercion("n.m", KindBool),
+			},
+			want:        [][]string{{"id", "n"}, {"1", "2"}},
+			wantRejects: []string{`{"id":2,"n":"x"}`, `{"id":3,"n":{"m":"y"}}`},
+		},
+		{
+			name: "nothing rejected",
+			data: `[{"id": 1}]`,
+			opts: []ListWriterOption{WithCoercion("id", KindString)},
+			want: [][]string{{"id"}, {"1"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst, rejects recordWriter
+
+			opts := append([]ListWriterOption{
+				WithAlphabetizeHeaders(),
+				WithRounding(0, RoundHalfUp),
+				WithRejectWriter(&rejects),
+			}, tcase.opts...)
+
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %v, want %v", dst.records, tcase.want)
+			}
+
+			if len(tcase.wantRejects) == 0 {
+				if len(rejects.records) != 0 {
+					t.Fatalf("got rejects %v, want none", rejects.records)
+				}
+
+				return
+			}
+
+			if !reflect.DeepEqual(rejects.records[0], []string{"error", "record"}) {
+				t.Fatalf("got reject header %v", rejects.records[0])
+			}
+
+			var got []string
+
+			for _, row := range rejects.records[1:] {
+				if !strings.HasPrefix(row[0], "record ") {
+					t.Fatalf("got reject error %q", row[0])
+				}
+
+				got = append(got, row[1])
+			}
+
+			if !reflect.DeepEqual(got, tcase.wantRejects) {
+				t.Fatalf("got rejects %v, want %v", got, tcase.wantRejects)
+			}
+		})
+	}
+}
+
+func TestWriteRejectsHeader(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"n": "x"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rejects recordWriter
+
+	// Redact finds its columns from the header, so it must be told which
+	// record is the header of the rejects.
+	listWriter := NewListWriter(&recordWriter{}, WithCoercion("n", KindNumber),
+		WithRejectWriter(WrapWriter(&rejects, Redact("***", "record"))))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rejects.records) != 2 {
+		t.Fatalf("got rejects %v, want a header and a record", rejects.records)
+	}
+
+	if got := rejects.records[1][1]; got != "***" {
+		t.Fatalf("got rejected record %q, want it redacted", got)
+	}
+}
+
+func TestPlanRejects(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"n": "1"}, {"n": "x"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rejects recordWriter
+
+	listWriter := NewListWriter(&recordWriter{}, WithCoercion("n", KindNumber), WithRejectWriter(&rejects))
+
+	plan, err := listWriter.Plan(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if plan.Records != 1 {
+		t.Fatalf("got %d records, want 1", plan.Records)
+	}
+
+	if len(rejects.records) != 0 {
+		t.Fatalf("got rejects %v, want none", rejects.records)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// ErrRetriesExhausted is returned by a RetryWriter when a record could not be
+// written within the maximum number of attempts. The error from the last
+// attempt is wrapped.
+var ErrRetriesExhausted = fmt.Errorf("retries exhausted")
+
+// Defaults for the zero fields of a Backoff.
+const (
+	DefaultMaxAttempts  = 5
+	DefaultInitialDelay = 100 * time.Millisecond
+	DefaultMultiplier   = 2
+)
+
+// Backoff is the policy of a RetryWriter. The zero value of each field is
+// replaced by its default.
+type Backoff struct {
+	// MaxAttempts is the number of times a record is written before giving
+	// up, including the first. The default is DefaultMaxAttempts.
+	MaxAttempts int
+
+	// InitialDelay is the delay before the second attempt. The default is
+	// DefaultInitialDelay.
+	InitialDelay time.Duration
+
+	// MaxDelay caps the delay between attempts. The default is no cap.
+	MaxDelay time.Duration
+
+	// Multiplier is the factor by which the delay grows after each
+	// attempt. The default is DefaultMultiplier.
+	Multiplier float64
+
+	// Retryable reports whether an error is transient and the write should
+	// be retried. By default, every error is retried.
+	Retryable func(error) bool
+
+	// Context stops the retries when it is done, ending the wait before
+	// the next attempt with its error. By default, the retries are only
+	// stopped by MaxAttempts.
+	Context context.Context //nolint:containedctx
+}
+
+// delay will return the delay after the given failed attempt, counting from 1.
+func (policy Backoff) delay(attempt int) time.Duration {
+	delay := float64(policy.InitialDelay)
+	for i := 1; i < attempt; i++ {
+		delay *= policy.Multiplier
+
+		if policy.MaxDelay > 0 && delay >= float64(policy.MaxDelay) {
+			return policy.MaxDelay
+		}
+	}
+
+	return time.Duration(delay)
+}
+
+// RetryWriter wraps "writer" so that records that fail to be written are
+// retried with exponential backoff, e.g. for Writers backed by a network
+// service. Errors that the policy does not consider retryable are returned
+// immediately, and if the last attempt fails, the error wraps both
+// ErrRetriesExhausted and the error from the attempt.
+//
+// Retrying is only safe if a failed Write has no effect, which is not true of
+// e.g. a csv.Writer, whose errors surface on Flush.
+func RetryWriter(writer Writer, policy Backoff) Writer {
+	if policy.MaxAttempts <= 0 {
+		policy.MaxAttempts = DefaultMaxAttempts
+	}
+
+	if policy.InitialDelay <= 0 {
+		policy.InitialDelay = DefaultInitialDelay
+	}
+
+	if policy.Multiplier <= 0 {
+		policy.Multiplier = DefaultMultiplier
+	}
+
+	if policy.Context == nil {
+		policy.Context = context.Background()
+	}
+
+	return middleware(writer, func(record []string, write func([]string) error) error {
+		for attempt := 1; ; attempt++ {
+			err := write(record)
+			if err == nil {
+				return nil
+			}
+
+			if policy.Retryable != nil && !policy.Retryable(err) {
+				return err
+			}
+
+			if attempt >= policy.MaxAttempts {
+				return &categoryError{
+					category: ErrRetriesExhausted,
+					err:      fmt.Errorf("%v after %d attempts: %w", ErrRetriesExhausted, attempt, err),
+				}
+			}
+
+			if ctxErr := policy.wait(attempt); ctxErr != nil {
+				return fmt.Errorf("stopped retrying after %d attempts (%v): %w", attempt, err, ctxErr)
+			}
+		}
+	})
+}
+
+// wait will wait out the delay after the given failed attempt, returning the
+// error of the context if it is done first.
+func (policy Backoff) wait(attempt int) error {
+	timer := time.NewTimer(policy.delay(attempt))
+	defer timer.Stop()
+
+	select {
+	case <-policy.Context.Done():
+		return policy.Context.Err()
+	case <-timer.C:
+		return nil
+	}
+}
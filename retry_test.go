@@ -0,0 +1,142 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRetryWriter(t *testing.T) {
+	t.Parallel()
+
+	errTransient := errors.New("transient")
+	errPermanent := errors.New("permanent")
+
+	for _, tcase := range []struct {
+		name     string
+		failures []error
+		policy   Backoff
+		wantErr  []error
+		attempts int
+	}{
+		{
+			name:     "success",
+			attempts: 1,
+		},
+		{
+			name:     "recovers",
+			failures: []error{errTransient, errTransient},
+			attempts: 3,
+		},
+		{
+			name:     "exhausted",
+			failures: []error{errTransient, errTransient, errTransient},
+			policy:   Backoff{MaxAttempts: 2},
+			wantErr:  []error{ErrRetriesExhausted, errTransient},
+			attempts: 2,
+		},
+		{
+			name:     "not retryable",
+			failures: []error{errPermanent},
+			policy: Backoff{Retryable: func(err error) bool {
+				return errors.Is(err, errTransient)
+			}},
+			wantErr:  []error{errPermanent},
+			attempts: 1,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			attempts := 0
+			writer := WriterFunc(func(record []string) error {
+				attempts++
+				if attempts <= len(tcase.failures) {
+					return tcase.failures[attempts-1]
+				}
+
+				return dst.Write(record)
+			})
+
+			policy := tcase.policy
+			policy.InitialDelay = time.Millisecond
+
+			err := RetryWriter(writer, policy).Write([]string{"a"})
+
+			for _, want := range tcase.wantErr {
+				if !errors.Is(err, want) {
+					t.Fatalf("got error %v, want %v", err, want)
+				}
+			}
+
+			if tcase.wantErr == nil && err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if attempts != tcase.attempts {
+				t.Fatalf("got %d attempts, want %d", attempts, tcase.attempts)
+			}
+		})
+	}
+}
+
+func TestRetryWriterContext(t *testing.T) {
+	t.Parallel()
+
+	errTransient := errors.New("transient")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts := 0
+	writer := WriterFunc(func([]string) error {
+		attempts++
+
+		return errTransient
+	})
+
+	// The delay would outlast the test if the wait were not stopped.
+	policy := Backoff{InitialDelay: time.Hour, Context: ctx}
+
+	err := RetryWriter(writer, policy).Write([]string{"a"})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got error %v, want %v", err, context.Canceled)
+	}
+
+	if attempts != 1 {
+		t.Fatalf("got %d attempts, want 1", attempts)
+	}
+}
+
+func TestBackoffDelay(t *testing.T) {
+	t.Parallel()
+
+	policy := Backoff{InitialDelay: time.Second, MaxDelay: 5 * time.Second, Multiplier: 2}
+
+	for _, tcase := range []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: time.Second},
+		{attempt: 2, want: 2 * time.Second},
+		{attempt: 3, want: 4 * time.Second},
+		{attempt: 4, want: 5 * time.Second},
+	} {
+		if got := policy.delay(tcase.attempt); got != tcase.want {
+			t.Errorf("attempt %d: got delay %v, want %v", tcase.attempt, got, tcase.want)
+		}
+	}
+}
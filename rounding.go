@@ -0,0 +1,210 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// ErrUnknownRoundMode is returned when a rounding mode name cannot be parsed.
+var ErrUnknownRoundMode = fmt.Errorf("unknown round mode")
+
+// RoundMode is how numbers are rounded by WithRounding.
+type RoundMode int32
+
+const (
+	// RoundHalfUp rounds to the nearest number, and ties away from zero,
+	// e.g. 2.5 to 3 and -2.5 to -3.
+	RoundHalfUp RoundMode = iota
+
+	// RoundHalfEven rounds to the nearest number, and ties to the even
+	// number, e.g. 2.5 to 2 and 3.5 to 4. It is also known as banker's
+	// rounding.
+	RoundHalfEven
+
+	// RoundTruncate rounds towards zero, e.g. 2.9 to 2 and -2.9 to -2.
+	RoundTruncate
+)
+
+var roundModeNames = map[RoundMode]string{
+	RoundHalfUp:   "halfUp",
+	RoundHalfEven: "halfEven",
+	RoundTruncate: "truncate",
+}
+
+// String returns the name of the rounding mode.
+func (m RoundMode) String() string {
+	if name, ok := roundModeNames[m]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("RoundMode(%d)", m)
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (m RoundMode) MarshalText() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, so that rounding modes
+// can be given by name in a Config.
+func (m *RoundMode) UnmarshalText(text []byte) error {
+	for mode, name := range roundModeNames {
+		if name == string(text) {
+			*m = mode
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %q", ErrUnknownRoundMode, text)
+}
+
+// rounding is the formatting of numeric cells.
+type rounding struct {
+	decimals int
+	mode     RoundMode
+}
+
+// WithRounding configures the ListWriter to write numbers, including the cells
+// of columns coerced to KindNumber, with exactly "decimals" digits after the
+// decimal point, rounded with the given mode. Negative decimals are treated as
+// 0.
+//
+// Numbers are rounded as they are written in decimal, rather than as their
+// binary approximation, so that e.g. 2.675 is rounded up to 2.68 by
+// RoundHalfUp.
+func WithRounding(decimals int, mode RoundMode) ListWriterOption {
+	if decimals < 0 {
+		decimals = 0
+	}
+
+	return func(listWriter *ListWriter) {
+		listWriter.rounding = &rounding{decimals: decimals, mode: mode}
+	}
+}
+
+// roundUp will return true if the digits dropped by rounding, "rest", mean the
+// last digit kept, "last", must be incremented.
+func (r *rounding) roundUp(last byte, rest []byte) bool {
+	if len(rest) == 0 {
+		return false
+	}
+
+	switch r.mode {
+	case RoundHalfUp:
+		return rest[0] >= '5'
+	case RoundHalfEven:
+		if rest[0] != '5' {
+			return rest[0] > '5'
+		}
+
+		for _, digit := range rest[1:] {
+			if digit != '0' {
+				return true
+			}
+		}
+
+		return (last-'0')%2 == 1
+	case RoundTruncate:
+		fallthrough
+	default:
+		return false
+	}
+}
+
+// appendNumber will append the number to the buffer, rounded.
+func (r *rounding) appendNumber(buf []byte, num float64) []byte {
+	return r.appendScaled(buf, num, 0)
+}
+
+// appendScaled will append the number multiplied by 10^shift to the buffer,
+// rounded. The number is shifted in decimal, so that e.g. 0.285 is scaled to
+// exactly 28.5.
+func (r *rounding) appendScaled(buf []byte, num float64, shift int) []byte {
+	if math.IsNaN(num) || math.IsInf(num, 0) {
+		return strconv.AppendFloat(buf, num, 'f', r.decimals, 64)
+	}
+
+	// The shortest decimal representation of the number, without its sign.
+	var scratch [64]byte
+
+	digits := strconv.AppendFloat(scratch[:0], math.Abs(num), 'f', -1, 64)
+
+	integer, fraction := digits, []byte(nil)
+
+	for i, digit := range digits {
+		if digit == '.' {
+			integer, fraction = digits[:i], digits[i+1:]
+
+			break
+		}
+	}
+
+	// Keep the integer digits and the first "decimals" fractional digits
+	// after shifting, padded with zeros. The leading zero is room for a
+	// carry.
+	kept := make([]byte, 0, len(integer)+shift+r.decimals+1)
+	kept = append(kept, '0')
+	kept = append(kept, integer...)
+
+	for i := 0; i < shift+r.decimals; i++ {
+		if i < len(fraction) {
+			kept = append(kept, fraction[i])
+		} else {
+			kept = append(kept, '0')
+		}
+	}
+
+	var rest []byte
+	if len(fraction) > shift+r.decimals {
+		rest = fraction[shift+r.decimals:]
+	}
+
+	if r.roundUp(kept[len(kept)-1], rest) {
+		i := len(kept) - 1
+		for ; kept[i] == '9'; i-- {
+			kept[i] = '0'
+		}
+
+		kept[i]++
+	}
+
+	// Drop the leading zeros of the integer digits, except the last.
+	intLen := len(kept) - r.decimals
+	for intLen > 1 && kept[0] == '0' {
+		kept = kept[1:]
+		intLen--
+	}
+
+	zero := true
+
+	for _, digit := range kept {
+		if digit != '0' {
+			zero = false
+
+			break
+		}
+	}
+
+	if num < 0 && !zero {
+		buf = append(buf, '-')
+	}
+
+	buf = append(buf, kept[:intLen]...)
+
+	if r.decimals > 0 {
+		buf = append(buf, '.')
+		buf = append(buf, kept[intLen:]...)
+	}
+
+	return buf
+}
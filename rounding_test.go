@@ -0,0 +1,80 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestRoundingAppendNumber(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		num      float64
+		decimals int
+		mode     RoundMode
+		want     string
+	}{
+		{num: 2.675, decimals: 2, mode: RoundHalfUp, want: "2.68"},
+		{num: 2.665, decimals: 2, mode: RoundHalfEven, want: "2.66"},
+		{num: 2.675, decimals: 2, mode: RoundHalfEven, want: "2.68"},
+		{num: 2.6651, decimals: 2, mode: RoundHalfEven, want: "2.67"},
+		{num: 2.679, decimals: 2, mode: RoundTruncate, want: "2.67"},
+		{num: 2.5, decimals: 0, mode: RoundHalfUp, want: "3"},
+		{num: 2.5, decimals: 0, mode: RoundHalfEven, want: "2"},
+		{num: 3.5, decimals: 0, mode: RoundHalfEven, want: "4"},
+		{num: -2.5, decimals: 0, mode: RoundHalfUp, want: "-3"},
+		{num: -2.9, decimals: 0, mode: RoundTruncate, want: "-2"},
+		{num: 9.995, decimals: 2, mode: RoundHalfUp, want: "10.00"},
+		{num: 99.5, decimals: 0, mode: RoundHalfUp, want: "100"},
+		{num: 1, decimals: 3, mode: RoundHalfUp, want: "1.000"},
+		{num: 0.004, decimals: 2, mode: RoundHalfUp, want: "0.00"},
+		{num: -0.004, decimals: 2, mode: RoundHalfUp, want: "0.00"},
+		{num: -0.005, decimals: 2, mode: RoundHalfUp, want: "-0.01"},
+		{num: 1e21, decimals: 1, mode: RoundHalfUp, want: "1000000000000000000000.0"},
+	} {
+		r := &rounding{decimals: tcase.decimals, mode: tcase.mode}
+		if got := string(r.appendNumber(nil, tcase.num)); got != tcase.want {
+			t.Errorf("%v rounded to %d decimals %s: got %q, want %q",
+				tcase.num, tcase.decimals, tcase.mode, got, tcase.want)
+		}
+	}
+}
+
+func TestWriteRounding(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"price": 1.005, "qty": "2.5", "name": "a"},
+		{"price": 10, "qty": 3, "name": "b"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithAlphabetizeHeaders(), WithRounding(2, RoundHalfEven),
+		WithCoercion("qty", KindNumber)).Write(context.Background(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"name", "price", "qty"},
+		{"a", "1.00", "2.50"},
+		{"b", "10.00", "3.00"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
@@ -0,0 +1,68 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "google.golang.org/protobuf/types/known/structpb"
+
+// sampler keeps each record with a fixed probability, drawn from a splitmix64
+// generator whose state is small enough to be copied with the ListWriter.
+type sampler struct {
+	rate  float64
+	seed  uint64
+	state uint64
+}
+
+// WithSample configures the ListWriter to keep each record with probability
+// "rate", e.g. 0.01 for about one record in a hundred, so that a quick
+// representative table can be written from a huge input. The sample is
+// deterministic: the same "seed" keeps the same records of the same input,
+// whether it is written as one list or as the lists of an Encoder. Records are sampled before any other
+// option is applied, so e.g. WithFilter only sees the sampled records.
+func WithSample(rate float64, seed int64) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.sample = &sampler{rate: rate, seed: uint64(seed), state: uint64(seed)}
+	}
+}
+
+// clone will return a copy of the sampler, so that it can be used without
+// advancing the original, or nil if there is no sampler.
+func (s *sampler) clone() *sampler {
+	if s == nil {
+		return nil
+	}
+
+	clone := *s
+
+	return &clone
+}
+
+// next will return the next number in [0, 1).
+func (s *sampler) next() float64 {
+	s.state += 0x9e3779b97f4a7c15
+
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	z ^= z >> 31
+
+	return float64(z>>11) / (1 << 53)
+}
+
+// apply will return the records of the list that are kept.
+func (s *sampler) apply(list *structpb.ListValue) *structpb.ListValue {
+	kept := &structpb.ListValue{}
+
+	for _, value := range list.GetValues() {
+		if s.next() < s.rate {
+			kept.Values = append(kept.Values, value)
+		}
+	}
+
+	return kept
+}
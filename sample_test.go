@@ -0,0 +1,58 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestWriteSample(t *testing.T) {
+	t.Parallel()
+
+	list := &structpb.ListValue{}
+	for i := 0; i < 1000; i++ {
+		obj, _ := structpb.NewStruct(map[string]interface{}{"id": float64(i)})
+		list.Values = append(list.Values, structpb.NewStructValue(obj))
+	}
+
+	write := func(seed int64) [][]string {
+		var dst recordWriter
+
+		listWriter := NewListWriter(&dst, WithSample(0.1, seed))
+
+		// Planning does not advance the sample.
+		if _, err := listWriter.Plan(list); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := listWriter.Write(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+
+		return dst.records
+	}
+
+	got := write(42)
+
+	if rows := len(got) - 1; rows < 50 || rows > 150 {
+		t.Fatalf("got %d rows, want about 100", rows)
+	}
+
+	if again := write(42); !reflect.DeepEqual(got, again) {
+		t.Fatal("got a different sample for the same seed")
+	}
+
+	if other := write(43); reflect.DeepEqual(got, other) {
+		t.Fatal("got the same sample for a different seed")
+	}
+}
@@ -0,0 +1,381 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+var (
+	// ErrInvalidSchema is returned when the schema given to WithInputSchema
+	// cannot be parsed.
+	ErrInvalidSchema = fmt.Errorf("invalid schema")
+
+	// ErrSchemaViolation is returned when a record does not conform to the
+	// schema given to WithInputSchema.
+	ErrSchemaViolation = fmt.Errorf("schema violation")
+)
+
+// jsonSchema is the subset of JSON Schema supported by WithInputSchema.
+type jsonSchema struct {
+	// never is set for the schema "false", which no value conforms to.
+	never bool
+
+	types                []string
+	properties           map[string]*jsonSchema
+	required             []string
+	additionalProperties *jsonSchema
+	items                *jsonSchema
+	enum                 []*structpb.Value
+	minimum              *float64
+	maximum              *float64
+	minLength            *int
+	maxLength            *int
+	minItems             *int
+	maxItems             *int
+	pattern              *regexp.Regexp
+}
+
+// UnmarshalJSON will parse a schema, which may be a boolean.
+func (schema *jsonSchema) UnmarshalJSON(data []byte) error {
+	switch string(bytes.TrimSpace(data)) {
+	case "true":
+		return nil
+	case "false":
+		schema.never = true
+
+		return nil
+	}
+
+	var raw struct {
+		Type                 json.RawMessage        `json:"type"`
+		Properties           map[string]*jsonSchema `json:"properties"`
+		Required             []string               `json:"required"`
+		AdditionalProperties *jsonSchema            `json:"additionalProperties"`
+		Items                *jsonSchema            `json:"items"`
+		Enum                 []any                  `json:"enum"`
+		Minimum              *float64               `json:"minimum"`
+		Maximum              *float64               `json:"maximum"`
+		MinLength            *int                   `json:"minLength"`
+		MaxLength            *int                   `json:"maxLength"`
+		MinItems             *int                   `json:"minItems"`
+		MaxItems             *int                   `json:"maxItems"`
+		Pattern              *string                `json:"pattern"`
+	}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	if len(raw.Type) > 0 {
+		var typ string
+		if err := json.Unmarshal(raw.Type, &typ); err == nil {
+			schema.types = []string{typ}
+		} else if err := json.Unmarshal(raw.Type, &schema.types); err != nil {
+			return fmt.Errorf("type must be a string or an array of strings")
+		}
+	}
+
+	for _, value := range raw.Enum {
+		enumValue, err := structpb.NewValue(value)
+		if err != nil {
+			return fmt.Errorf("invalid enum value: %w", err)
+		}
+
+		schema.enum = append(schema.enum, enumValue)
+	}
+
+	if raw.Pattern != nil {
+		pattern, err := regexp.Compile(*raw.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+
+		schema.pattern = pattern
+	}
+
+	schema.properties = raw.Properties
+	schema.required = raw.Required
+	schema.additionalProperties = raw.AdditionalProperties
+	schema.items = raw.Items
+	schema.minimum = raw.Minimum
+	schema.maximum = raw.Maximum
+	schema.minLength = raw.MinLength
+	schema.maxLength = raw.MaxLength
+	schema.minItems = raw.MinItems
+	schema.maxItems = raw.MaxItems
+
+	return nil
+}
+
+// parseJSONSchema will parse the JSON Schema document.
+func parseJSONSchema(data []byte) (*jsonSchema, error) {
+	schema := &jsonSchema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+	}
+
+	return schema, nil
+}
+
+// hasType will return true if the value is one of the JSON Schema types.
+func hasType(value *structpb.Value, types []string) bool {
+	for _, typ := range types {
+		switch value.Kind.(type) {
+		case *structpb.Value_NullValue:
+			if typ == "null" {
+				return true
+			}
+		case *structpb.Value_BoolValue:
+			if typ == "boolean" {
+				return true
+			}
+		case *structpb.Value_NumberValue:
+			num := value.GetNumberValue()
+			if typ == "number" || (typ == "integer" && num == math.Trunc(num)) {
+				return true
+			}
+		case *structpb.Value_StringValue:
+			if typ == "string" {
+				return true
+			}
+		case *structpb.Value_StructValue:
+			if typ == "object" {
+				return true
+			}
+		case *structpb.Value_ListValue:
+			if typ == "array" {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// violation will return an ErrSchemaViolation at the given path.
+func violation(path, format string, args ...any) error {
+	return fmt.Errorf("%w at %s: %s", ErrSchemaViolation, path, fmt.Sprintf(format, args...))
+}
+
+// validate will return an error for the first way in which the value at the
+// given path does not conform to the schema.
+func (schema *jsonSchema) validate(path string, value *structpb.Value) error {
+	if schema.never {
+		return violation(path, "no value is allowed")
+	}
+
+	if len(schema.types) > 0 && !hasType(value, schema.types) {
+		return violation(path, "want type %q", schema.types)
+	}
+
+	if len(schema.enum) > 0 {
+		found := false
+
+		for _, enumValue := range schema.enum {
+			if proto.Equal(value, enumValue) {
+				found = true
+
+				break
+			}
+		}
+
+		if !found {
+			return violation(path, "value is not in the enum")
+		}
+	}
+
+	switch kind := value.Kind.(type) {
+	case *structpb.Value_NumberValue:
+		if schema.minimum != nil && kind.NumberValue < *schema.minimum {
+			return violation(path, "%v is less than the minimum %v", kind.NumberValue, *schema.minimum)
+		}
+
+		if schema.maximum != nil && kind.NumberValue > *schema.maximum {
+			return violation(path, "%v is greater than the maximum %v", kind.NumberValue, *schema.maximum)
+		}
+	case *structpb.Value_StringValue:
+		length := utf8.RuneCountInString(kind.StringValue)
+
+		if schema.minLength != nil && length < *schema.minLength {
+			return violation(path, "length %d is less than %d", length, *schema.minLength)
+		}
+
+		if schema.maxLength != nil && length > *schema.maxLength {
+			return violation(path, "length %d is greater than %d", length, *schema.maxLength)
+		}
+
+		if schema.pattern != nil && !schema.pattern.MatchString(kind.StringValue) {
+			return violation(path, "value does not match %q", schema.pattern)
+		}
+	case *structpb.Value_StructValue:
+		return schema.validateObject(path, kind.StructValue)
+	case *structpb.Value_ListValue:
+		return schema.validateArray(path, kind.ListValue)
+	}
+
+	return nil
+}
+
+func (schema *jsonSchema) validateObject(path string, obj *structpb.Struct) error {
+	fields := obj.GetFields()
+
+	for _, key := range schema.required {
+		if _, ok := fields[key]; !ok {
+			return violation(path, "missing required property %q", key)
+		}
+	}
+
+	// Validate the fields in order, so the reported violation is stable.
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		child, ok := schema.properties[key]
+		if !ok {
+			child = schema.additionalProperties
+		}
+
+		if child == nil {
+			continue
+		}
+
+		if err := child.validate(path+"."+key, fields[key]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (schema *jsonSchema) validateArray(path string, list *structpb.ListValue) error {
+	values := list.GetValues()
+
+	if schema.minItems != nil && len(values) < *schema.minItems {
+		return violation(path, "%d items is less than %d", len(values), *schema.minItems)
+	}
+
+	if schema.maxItems != nil && len(values) > *schema.maxItems {
+		return violation(path, "%d items is greater than %d", len(values), *schema.maxItems)
+	}
+
+	if schema.items == nil {
+		return nil
+	}
+
+	for i, value := range values {
+		if err := schema.items.validate(fmt.Sprintf("%s[%d]", path, i), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WithInputSchema configures the ListWriter to validate each record against
+// the JSON Schema document before it is flattened. A record that does not
+// conform is an ErrSchemaViolation: it fails the write, or, if a warning
+// handler is set with WithWarningHandler, it is reported to the handler and
+// left out of the output. If the schema cannot be parsed, writes fail with
+// ErrInvalidSchema.
+//
+// The supported keywords are type, enum, properties, required,
+// additionalProperties, items, minimum, maximum, minLength, maxLength,
+// pattern, minItems, and maxItems, as well as the boolean schemas true and
+// false. Other keywords are ignored.
+func WithInputSchema(schema []byte) ListWriterOption {
+	parsed, err := parseJSONSchema(schema)
+
+	return func(listWriter *ListWriter) {
+		listWriter.inputSchema = parsed
+		listWriter.inputSchemaErr = err
+	}
+}
+
+// inputSchemaFromConfig will return the WithInputSchema option for the
+// InputSchema of a Config, reading the schema from the file if it is not
+// inline.
+func inputSchemaFromConfig(schema string) ListWriterOption {
+	if trimmed := strings.TrimSpace(schema); strings.HasPrefix(trimmed, "{") ||
+		trimmed == "true" || trimmed == "false" {
+		return WithInputSchema([]byte(trimmed))
+	}
+
+	data, err := os.ReadFile(schema)
+	if err != nil {
+		return func(listWriter *ListWriter) {
+			listWriter.inputSchema = nil
+			listWriter.inputSchemaErr = fmt.Errorf("%w: %v", ErrInvalidSchema, err)
+		}
+	}
+
+	return WithInputSchema(data)
+}
+
+// validateRecords will return the records of the list that conform to the
+// input schema, reporting the others to the warning handler.
+func (w *ListWriter) validateRecords(list *structpb.ListValue) (*structpb.ListValue, error) {
+	if w.inputSchemaErr != nil {
+		return nil, w.inputSchemaErr
+	}
+
+	var valid *structpb.ListValue
+
+	for i, value := range list.GetValues() {
+		err := w.inputSchema.validate("$", value)
+		if err == nil {
+			if valid != nil {
+				valid.Values = append(valid.Values, value)
+			}
+
+			continue
+		}
+
+		err = fmt.Errorf("record %d: %w", i, err)
+
+		switch {
+		case w.rejects != nil:
+			if err := w.reject(value, err); err != nil {
+				return nil, err
+			}
+		case w.warn == nil:
+			return nil, err
+		default:
+			w.warn(err)
+		}
+
+		// Only copy the list if there is something to leave out.
+		if valid == nil {
+			valid = &structpb.ListValue{
+				Values: append([]*structpb.Value{}, list.GetValues()[:i]...),
+			}
+		}
+	}
+
+	if valid == nil {
+		return list, nil
+	}
+
+	return valid, nil
+}
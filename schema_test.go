@@ -0,0 +1,115 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	t.Parallel()
+
+	schema := `{
+		"type": "object",
+		"required": ["id"],
+		"properties": {
+			"id": {"type": "integer", "minimum": 1},
+			"status": {"enum": ["active", "inactive"]},
+			"code": {"type": "string", "pattern": "^[A-Z]{2}$"},
+			"name": {"type": ["string", "null"], "maxLength": 3},
+			"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}}
+		},
+		"additionalProperties": false
+	}`
+
+	for _, tcase := range []struct {
+		name    string
+		data    string
+		wantErr error
+	}{
+		{
+			name: "valid",
+			data: `{"id": 1, "status": "active", "code": "CA", "name": null, "tags": ["a"]}`,
+		},
+		{name: "missing required", data: `{"status": "active"}`, wantErr: ErrSchemaViolation},
+		{name: "wrong type", data: `{"id": "1"}`, wantErr: ErrSchemaViolation},
+		{name: "not an integer", data: `{"id": 1.5}`, wantErr: ErrSchemaViolation},
+		{name: "below minimum", data: `{"id": 0}`, wantErr: ErrSchemaViolation},
+		{name: "not in enum", data: `{"id": 1, "status": "deleted"}`, wantErr: ErrSchemaViolation},
+		{name: "pattern", data: `{"id": 1, "code": "usa"}`, wantErr: ErrSchemaViolation},
+		{name: "max length", data: `{"id": 1, "name": "abcd"}`, wantErr: ErrSchemaViolation},
+		{name: "max items", data: `{"id": 1, "tags": ["a", "b", "c"]}`, wantErr: ErrSchemaViolation},
+		{name: "items", data: `{"id": 1, "tags": [1]}`, wantErr: ErrSchemaViolation},
+		{name: "additional property", data: `{"id": 1, "extra": true}`, wantErr: ErrSchemaViolation},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			parsed, err := parseJSONSchema([]byte(schema))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = parsed.validate("$", list.GetValues()[0])
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+		})
+	}
+}
+
+func TestWriteInputSchema(t *testing.T) {
+	t.Parallel()
+
+	schema := []byte(`{"required": ["id"]}`)
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": "1"}, {"name": "bad"}, {"id": "3"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithInputSchema(schema)).Write(context.Background(), list)
+	if !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("got error %v, want %v", err, ErrSchemaViolation)
+	}
+
+	var warnings []error
+
+	listWriter := NewListWriter(&dst, WithInputSchema(schema), WithWarningHandler(func(err error) {
+		warnings = append(warnings, err)
+	}))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := [][]string{{"id"}, {"1"}, {"3"}}; !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+
+	if len(warnings) != 1 || !errors.Is(warnings[0], ErrSchemaViolation) {
+		t.Fatalf("got warnings %v, want one %v", warnings, ErrSchemaViolation)
+	}
+
+	err = NewListWriter(&dst, WithInputSchema([]byte(`{"type": 1}`))).Write(context.Background(), list)
+	if !errors.Is(err, ErrInvalidSchema) {
+		t.Fatalf("got error %v, want %v", err, ErrInvalidSchema)
+	}
+}
@@ -0,0 +1,110 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Metadata describes a written table, for ingestion into a data catalog.
+type Metadata struct {
+	// Schema is the columns of the table, with the type inferred for each
+	// from the cells that were written.
+	Schema *Schema `json:"schema"`
+
+	// Fingerprint is the Fingerprint of the Schema.
+	Fingerprint string `json:"fingerprint"`
+
+	// Rows is the number of data rows, not counting the header or footer.
+	Rows int `json:"rows"`
+
+	// Nulls is the number of empty cells in each column, keyed by header.
+	Nulls map[string]int `json:"nulls"`
+
+	// LargestRecords are the largest records, largest first, if
+	// WithLargestRecords is used.
+	LargestRecords []RecordSize `json:"largestRecords,omitempty"`
+
+	// GeneratedAt is when the table was written.
+	GeneratedAt time.Time `json:"generatedAt"`
+}
+
+// sidecar collects the Metadata of the table as it is written.
+type sidecar struct {
+	writer io.Writer
+	now    func() time.Time
+	header []string
+	types  []typeInference
+	nulls  []int
+	rows   int
+}
+
+// WithMetadataSidecar configures the ListWriter to write the Metadata of each
+// table to "w" as JSON, once the table has been written, e.g. to a ".json" file
+// next to the CSV. The sidecar is written by ListWriter.Write, and not by the
+// Encoder, whose table is never complete.
+func WithMetadataSidecar(w io.Writer) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.sidecar = &sidecar{writer: w, now: time.Now}
+	}
+}
+
+// start will reset the metadata for a table with the given header.
+func (car *sidecar) start(header []string) {
+	car.header = header
+	car.types = make([]typeInference, len(header))
+	car.nulls = make([]int, len(header))
+	car.rows = 0
+}
+
+// observe will update the metadata with a data row.
+func (car *sidecar) observe(row []string) {
+	car.rows++
+
+	for i := range car.header {
+		if i >= len(row) || row[i] == "" {
+			car.nulls[i]++
+
+			continue
+		}
+
+		car.types[i].observe(row[i])
+	}
+}
+
+// emit will write the metadata of the table, with its largest records, as
+// JSON.
+func (car *sidecar) emit(largest []RecordSize) error {
+	meta := &Metadata{
+		Schema:         &Schema{Columns: make([]SchemaColumn, len(car.header))},
+		Rows:           car.rows,
+		Nulls:          make(map[string]int, len(car.header)),
+		LargestRecords: largest,
+		GeneratedAt:    car.now().UTC(),
+	}
+
+	for i, header := range car.header {
+		meta.Schema.Columns[i] = SchemaColumn{Name: header, Type: car.types[i].typ}
+		meta.Nulls[header] = car.nulls[i]
+	}
+
+	meta.Fingerprint = meta.Schema.Fingerprint()
+
+	enc := json.NewEncoder(car.writer)
+	enc.SetIndent("", "  ")
+
+	if err := enc.Encode(meta); err != nil {
+		return writerFailed(fmt.Errorf("failed to write metadata sidecar: %w", err))
+	}
+
+	return nil
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestWithMetadataSidecar(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+	}{
+		{name: "flat"},
+		{name: "columns", opts: []ListWriterOption{WithRecordID("record_id")}},
+		{name: "table", opts: []ListWriterOption{WithTotalsRow("n")}},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(`[
+				{"id": "a", "n": 1, "ok": true},
+				{"id": "b", "n": 2.5},
+				{"id": "c", "n": null, "ok": false}
+			]`))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var sidecar bytes.Buffer
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders(), WithMetadataSidecar(&sidecar)},
+				tcase.opts...)
+			listWriter := NewListWriter(&recordWriter{}, opts...)
+
+			generatedAt := time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)
+			listWriter.sidecar.now = func() time.Time { return generatedAt }
+
+			if err := listWriter.Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			var got Metadata
+			if err := json.Unmarshal(sidecar.Bytes(), &got); err != nil {
+				t.Fatalf("failed to parse sidecar: %v\n%s", err, sidecar.String())
+			}
+
+			want := Metadata{
+				Schema: &Schema{Columns: []SchemaColumn{
+					{Name: "id", Type: ColumnTypeString},
+					{Name: "n", Type: ColumnTypeFloat},
+					{Name: "ok", Type: ColumnTypeBool},
+				}},
+				Rows:        3,
+				Nulls:       map[string]int{"id": 0, "n": 1, "ok": 1},
+				GeneratedAt: generatedAt,
+			}
+
+			if tcase.name == "columns" {
+				want.Schema.Columns = append(want.Schema.Columns,
+					SchemaColumn{Name: "record_id", Type: ColumnTypeInt})
+				want.Nulls["record_id"] = 0
+			}
+
+			want.Fingerprint = want.Schema.Fingerprint()
+
+			if !reflect.DeepEqual(got, want) {
+				t.Fatalf("got %+v, want %+v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// tableData is a Table without its methods, so that gob does not call
+// MarshalBinary recursively.
+type tableData Table
+
+// MarshalBinary encodes the table with encoding/gob, e.g. to persist the
+// header of an Encoder returned by Snapshot between runs.
+func (t Table) MarshalBinary() ([]byte, error) {
+	var buf bytes.Buffer
+
+	data := tableData(t)
+	if err := gob.NewEncoder(&buf).Encode(&data); err != nil {
+		return nil, fmt.Errorf("failed to encode table: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalBinary decodes a table encoded by MarshalBinary.
+func (t *Table) UnmarshalBinary(data []byte) error {
+	var decoded tableData
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&decoded); err != nil {
+		return fmt.Errorf("failed to decode table: %w", err)
+	}
+
+	*t = Table(decoded)
+
+	return nil
+}
+
+// Snapshot returns the column model of the Encoder, which is a Table with the
+// header that has been written, or that was restored if none has been
+// written. It has no rows. With Restore, it keeps the column order stable
+// across the outputs of incremental exports.
+func (enc *Encoder) Snapshot() *Table {
+	header := enc.header
+	if header == nil {
+		header = enc.order
+	}
+
+	return &Table{Header: append([]string{}, header...)}
+}
+
+// Restore sets the column order of the tables that the Encoder starts from
+// now on to the header of the snapshot. The header of each new table has the
+// columns of the snapshot first, in order, whether or not its first list has
+// them, followed by the new columns of that list. The header is still written,
+// unlike when a checkpoint is resumed by WithCheckpoint.
+func (enc *Encoder) Restore(snapshot *Table) {
+	enc.order = append([]string{}, snapshot.Header...)
+}
+
+// orderHeader will return the header of a new table, with the restored
+// columns first.
+func (enc *Encoder) orderHeader(ordered []*column) []string {
+	header := append(make([]string, 0, len(enc.order)+len(ordered)), enc.order...)
+
+	restored := make(map[string]bool, len(enc.order))
+	for _, name := range enc.order {
+		restored[name] = true
+	}
+
+	for _, col := range ordered {
+		if !restored[col.header] {
+			header = append(header, col.header)
+		}
+	}
+
+	return header
+}
@@ -0,0 +1,97 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestTableMarshalBinary(t *testing.T) {
+	t.Parallel()
+
+	want := Table{
+		Header:         []string{"id", "name"},
+		Rows:           [][]string{{"1", "a"}, {"2", ""}},
+		Stats:          map[string]ColumnStats{"id": {Values: 2, Numbers: 2, Sum: 3}},
+		LargestRecords: []RecordSize{{Record: 0, Bytes: 12}},
+	}
+
+	data, err := want.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got Table
+	if err := got.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+
+	if err := got.UnmarshalBinary([]byte("not gob")); err == nil {
+		t.Fatal("got no error for invalid data")
+	}
+}
+
+func TestEncoderRestore(t *testing.T) {
+	t.Parallel()
+
+	encode := func(enc *Encoder, data string) {
+		t.Helper()
+
+		list, err := Decode(DecodeTypeJSON, []byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var first bytes.Buffer
+
+	enc := NewEncoder(&first, WithDeterministic(), WithRounding(0, RoundHalfUp))
+	encode(enc, `[{"x": 1, "b": 2}]`)
+
+	data, err := enc.Snapshot().MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next run writes a new file with the same column order.
+	var snapshot Table
+	if err := snapshot.UnmarshalBinary(data); err != nil {
+		t.Fatal(err)
+	}
+
+	var second bytes.Buffer
+
+	enc = NewEncoder(&second, WithDeterministic(), WithRounding(0, RoundHalfUp))
+	enc.Restore(&snapshot)
+
+	if got := enc.Snapshot().Header; !reflect.DeepEqual(got, []string{"b", "x"}) {
+		t.Fatalf("got restored header %q", got)
+	}
+
+	encode(enc, `[{"a": 3, "x": 4}]`)
+
+	if got, want := second.String(), "b,x,a\n,4,3\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if got := enc.Snapshot().Header; !reflect.DeepEqual(got, []string{"b", "x", "a"}) {
+		t.Fatalf("got header %q", got)
+	}
+}
@@ -0,0 +1,82 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"sort"
+	"strconv"
+)
+
+// WithSortBy configures the ListWriter to write the rows in ascending order of
+// the given columns, with ties broken by the next column and then by the
+// original order. Cells that are both numbers are compared numerically, and
+// other cells are compared as strings. With WithGroupBy, the groups are
+// sorted. Combined with WithSpill, the rows are sorted with an external merge
+// sort, so tables larger than the memory limit can still be ordered.
+func WithSortBy(columns ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.sortBy = columns
+	}
+}
+
+// compareCells will return a negative number if "a" sorts before "b", a
+// positive number if it sorts after, and zero if they are equal.
+func compareCells(a, b string) int {
+	if a == b {
+		return 0
+	}
+
+	numA, errA := strconv.ParseFloat(a, 64)
+	numB, errB := strconv.ParseFloat(b, 64)
+
+	switch {
+	case errA == nil && errB == nil && numA < numB:
+		return -1
+	case errA == nil && errB == nil && numA > numB:
+		return 1
+	case a < b:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// rowLess will return the ordering of rows with the given header by the sort
+// columns. Sort columns that are not in the header are ignored.
+func rowLess(header []string, sortBy []string) func(a, b []string) bool {
+	index := make(map[string]int, len(header))
+	for i, h := range header {
+		index[h] = i
+	}
+
+	var cols []int
+
+	for _, column := range sortBy {
+		if i, ok := index[column]; ok {
+			cols = append(cols, i)
+		}
+	}
+
+	return func(a, b []string) bool {
+		for _, i := range cols {
+			if cmp := compareCells(a[i], b[i]); cmp != 0 {
+				return cmp < 0
+			}
+		}
+
+		return false
+	}
+}
+
+// sortRows will stably sort the rows by "less".
+func sortRows(rows [][]string, less func(a, b []string) bool) {
+	sort.SliceStable(rows, func(i, j int) bool {
+		return less(rows[i], rows[j])
+	})
+}
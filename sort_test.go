@@ -0,0 +1,127 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestCompareCells(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		a, b string
+		want int
+	}{
+		{a: "1", b: "1", want: 0},
+		{a: "2", b: "10", want: -1},
+		{a: "10.5", b: "9", want: 1},
+		{a: "apple", b: "banana", want: -1},
+		{a: "", b: "a", want: -1},
+		{a: "b", b: "10", want: 1},
+	} {
+		if got := compareCells(tcase.a, tcase.b); got != tcase.want {
+			t.Errorf("compareCells(%q, %q) = %d, want %d", tcase.a, tcase.b, got, tcase.want)
+		}
+	}
+}
+
+func TestWriteSortBy(t *testing.T) {
+	t.Parallel()
+
+	records := make([]string, 50)
+	for i := range records {
+		records[i] = fmt.Sprintf(`{"group": "g%d", "n": %d, "i": "%02d"}`, i%3, (i*7)%10, i)
+	}
+
+	list, err := Decode(DecodeTypeJSON, []byte("["+strings.Join(records, ",")+"]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+	}{
+		{
+			name: "in memory",
+		},
+		{
+			name: "spilled",
+			opts: []ListWriterOption{WithSpill(t.TempDir(), 128)},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders(), WithSortBy("n", "group")},
+				tcase.opts...)
+
+			var dst recordWriter
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if got, want := len(dst.records), 51; got != want {
+				t.Fatalf("got %d records, want %d", got, want)
+			}
+
+			// The rows are sorted by "n" and "group", and stable by
+			// the original order in "i".
+			rows := dst.records[1:]
+			for k := 1; k < len(rows); k++ {
+				prev := rows[k-1][2] + rows[k-1][0] + rows[k-1][1]
+				cur := rows[k][2] + rows[k][0] + rows[k][1]
+
+				if prev > cur {
+					t.Fatalf("row %d %q sorts before row %d %q", k, rows[k], k-1, rows[k-1])
+				}
+			}
+		})
+	}
+}
+
+func TestWriteSortByGroupBy(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"group": "b", "n": 1},
+		{"group": "a", "n": 5},
+		{"group": "c", "n": 2},
+		{"group": "b", "n": 1}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst, WithSortBy("n"),
+		WithGroupBy([]string{"group"}, map[string]AggFunc{"n": AggSum}))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"group", "n"},
+		{"b", "2.000000"},
+		{"c", "2.000000"},
+		{"a", "5.000000"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
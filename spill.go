@@ -0,0 +1,365 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bufio"
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// rowIter calls "yield" with each row in order, stopping at the first error.
+type rowIter func(yield func(row []string) error) error
+
+// sliceRows will return an iterator over rows held in memory.
+func sliceRows(rows [][]string) rowIter {
+	return func(yield func(row []string) error) error {
+		for _, row := range rows {
+			if err := yield(row); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+}
+
+// WithSpill configures the ListWriter to move the table it buffers for
+// WithFooter, WithGroupBy, and WithSortBy to temporary files in "dir" once it
+// takes more than "memLimit" bytes. Both the columns that records are
+// flattened into and the formatted rows overflow: when the cells held by the
+// columns exceed the limit, their rows are formatted and moved out, and when
+// the formatted rows exceed it, they are written to a file. Only the header
+// and the statistics of the columns stay in memory. The rows are read back in
+// order, or merged in order with WithSortBy, when they are written, and the
+// files are removed afterwards. If the rows were spilled, the Table given to
+// the footer has no Rows, but its Header and Stats are complete.
+//
+// The list given to Write is not copied, so it is still held by the caller.
+func WithSpill(dir string, memLimit int64) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.spillDir = dir
+		listWriter.spillLimit = memLimit
+	}
+}
+
+// rowStore buffers rows in memory, spilling them to a new chunk file in "dir"
+// whenever they take more than "memLimit" bytes. A limit of zero never spills.
+// If "less" is set, each chunk is sorted before it is written and the chunks
+// are merged when they are read, which is an external merge sort.
+type rowStore struct {
+	dir      string
+	memLimit int64
+	less     func(a, b []string) bool
+
+	rows   [][]string
+	size   int64
+	chunks []string
+}
+
+// rowSize will estimate the memory taken by the row, including the string
+// headers.
+func rowSize(row []string) int64 {
+	size := int64(24 + 16*len(row))
+	for _, cell := range row {
+		size += int64(len(cell))
+	}
+
+	return size
+}
+
+func (store *rowStore) add(row []string) error {
+	store.rows = append(store.rows, row)
+	store.size += rowSize(row)
+
+	if store.memLimit > 0 && store.size > store.memLimit {
+		return store.spill()
+	}
+
+	return nil
+}
+
+// spilled will return true if any rows have been written to chunk files.
+func (store *rowStore) spilled() bool {
+	return len(store.chunks) > 0
+}
+
+// spill will write the buffered rows to a new chunk file. Each row is the
+// number of cells followed by each cell's length and bytes, as uvarints.
+func (store *rowStore) spill() error {
+	if store.less != nil {
+		sortRows(store.rows, store.less)
+	}
+
+	file, err := os.CreateTemp(store.dir, "csvpb-spill-*")
+	if err != nil {
+		return fmt.Errorf("failed to create spill file: %w", err)
+	}
+
+	store.chunks = append(store.chunks, file.Name())
+
+	buf := bufio.NewWriter(file)
+
+	var scratch []byte
+
+	for _, row := range store.rows {
+		scratch = binary.AppendUvarint(scratch[:0], uint64(len(row)))
+		for _, cell := range row {
+			scratch = binary.AppendUvarint(scratch, uint64(len(cell)))
+			scratch = append(scratch, cell...)
+		}
+
+		if _, err := buf.Write(scratch); err != nil {
+			file.Close()
+
+			return fmt.Errorf("failed to write spill file: %w", err)
+		}
+	}
+
+	if err := buf.Flush(); err != nil {
+		file.Close()
+
+		return fmt.Errorf("failed to write spill file: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to close spill file: %w", err)
+	}
+
+	store.rows = nil
+	store.size = 0
+
+	return nil
+}
+
+// readRow will read the next row of a chunk file, returning io.EOF at the end
+// of the file.
+func readRow(r *bufio.Reader) ([]string, error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return nil, err
+	}
+
+	row := make([]string, n)
+
+	for i := range row {
+		size, err := binary.ReadUvarint(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spill file: %w", io.ErrUnexpectedEOF)
+		}
+
+		cell := make([]byte, size)
+		if _, err := io.ReadFull(r, cell); err != nil {
+			return nil, fmt.Errorf("failed to read spill file: %w", err)
+		}
+
+		row[i] = string(cell)
+	}
+
+	return row, nil
+}
+
+// chunkReader reads the rows of a chunk file.
+type chunkReader struct {
+	file *os.File
+	r    *bufio.Reader
+}
+
+func openChunk(path string) (*chunkReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spill file: %w", err)
+	}
+
+	return &chunkReader{file: file, r: bufio.NewReader(file)}, nil
+}
+
+// next will return the next row, or nil at the end of the chunk.
+func (chunk *chunkReader) next() ([]string, error) {
+	row, err := readRow(chunk.r)
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+
+	return row, err
+}
+
+// finish will sort the rows that are still in memory, if the store is sorted.
+func (store *rowStore) finish() {
+	if store.less != nil {
+		sortRows(store.rows, store.less)
+	}
+}
+
+// iter will return an iterator over the rows, which are in the order they were
+// added, or sorted if "less" is set. The store must be finished first.
+func (store *rowStore) iter() rowIter {
+	return func(yield func(row []string) error) error {
+		chunks := make([]*chunkReader, 0, len(store.chunks))
+
+		defer func() {
+			for _, chunk := range chunks {
+				chunk.file.Close()
+			}
+		}()
+
+		for _, path := range store.chunks {
+			chunk, err := openChunk(path)
+			if err != nil {
+				return err
+			}
+
+			chunks = append(chunks, chunk)
+		}
+
+		if store.less != nil {
+			return mergeChunks(chunks, store.rows, store.less, yield)
+		}
+
+		for _, chunk := range chunks {
+			for {
+				row, err := chunk.next()
+				if err != nil {
+					return err
+				}
+
+				if row == nil {
+					break
+				}
+
+				if err := yield(row); err != nil {
+					return err
+				}
+			}
+		}
+
+		return sliceRows(store.rows)(yield)
+	}
+}
+
+// mergeCursor is the next row of one sorted run in a k-way merge.
+type mergeCursor struct {
+	row []string
+
+	// run is the position of the run, which breaks ties so that the
+	// merge is stable.
+	run  int
+	next func() ([]string, error)
+}
+
+// mergeHeap orders the cursors by their rows.
+type mergeHeap struct {
+	cursors []*mergeCursor
+	less    func(a, b []string) bool
+}
+
+func (h *mergeHeap) Len() int { return len(h.cursors) }
+
+func (h *mergeHeap) Less(i, j int) bool {
+	a, b := h.cursors[i], h.cursors[j]
+	if h.less(a.row, b.row) {
+		return true
+	}
+
+	if h.less(b.row, a.row) {
+		return false
+	}
+
+	return a.run < b.run
+}
+
+func (h *mergeHeap) Swap(i, j int) { h.cursors[i], h.cursors[j] = h.cursors[j], h.cursors[i] }
+
+func (h *mergeHeap) Push(x any) { h.cursors = append(h.cursors, x.(*mergeCursor)) }
+
+func (h *mergeHeap) Pop() any {
+	last := h.cursors[len(h.cursors)-1]
+	h.cursors = h.cursors[:len(h.cursors)-1]
+
+	return last
+}
+
+// mergeChunks will call "yield" with the rows of the sorted chunks and the
+// sorted in-memory rows, in order.
+func mergeChunks(chunks []*chunkReader, rows [][]string, less func(a, b []string) bool,
+	yield func(row []string) error,
+) error {
+	runs := make([]func() ([]string, error), 0, len(chunks)+1)
+	for _, chunk := range chunks {
+		runs = append(runs, chunk.next)
+	}
+
+	runs = append(runs, func() ([]string, error) {
+		if len(rows) == 0 {
+			return nil, nil
+		}
+
+		row := rows[0]
+		rows = rows[1:]
+
+		return row, nil
+	})
+
+	merge := &mergeHeap{less: less}
+
+	for i, next := range runs {
+		row, err := next()
+		if err != nil {
+			return err
+		}
+
+		if row != nil {
+			merge.cursors = append(merge.cursors, &mergeCursor{row: row, run: i, next: next})
+		}
+	}
+
+	heap.Init(merge)
+
+	for merge.Len() > 0 {
+		cursor := merge.cursors[0]
+		if err := yield(cursor.row); err != nil {
+			return err
+		}
+
+		row, err := cursor.next()
+		if err != nil {
+			return err
+		}
+
+		if row == nil {
+			heap.Pop(merge)
+
+			continue
+		}
+
+		cursor.row = row
+		heap.Fix(merge, 0)
+	}
+
+	return nil
+}
+
+// close will remove the chunk files.
+func (store *rowStore) close() error {
+	var firstErr error
+
+	for _, chunk := range store.chunks {
+		if err := os.Remove(chunk); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("failed to remove spill file: %w", err)
+		}
+	}
+
+	store.chunks = nil
+
+	return firstErr
+}
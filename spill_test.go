@@ -0,0 +1,177 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRowStore(t *testing.T) {
+	t.Parallel()
+
+	store := &rowStore{dir: t.TempDir(), memLimit: 64}
+
+	want := [][]string{
+		{"a", ""},
+		{"line\r\nbreak", "\x00"},
+		{strings.Repeat("x", 100), "b"},
+		{"c", "d"},
+	}
+
+	for _, row := range want {
+		if err := store.add(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if !store.spilled() {
+		t.Fatal("expected the rows to be spilled")
+	}
+
+	var got [][]string
+
+	err := store.iter()(func(row []string) error {
+		got = append(got, row)
+
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if err := store.close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(store.dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) != 0 {
+		t.Fatalf("got %d spill files after close, want 0", len(entries))
+	}
+}
+
+func TestWriteSpill(t *testing.T) {
+	t.Parallel()
+
+	records := make([]string, 100)
+	for i := range records {
+		records[i] = fmt.Sprintf(`{"group": "g%d", "n": %d}`, i%3, i)
+
+		// A column that only later records have is missing from the
+		// rows that were spilled before it was added.
+		if i >= 50 {
+			records[i] = fmt.Sprintf(`{"group": "g%d", "n": %d, "late": "x%d"}`, i%3, i, i%7)
+		}
+	}
+
+	list, err := Decode(DecodeTypeJSON, []byte("["+strings.Join(records, ",")+"]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+	}{
+		{
+			name: "totals",
+			opts: []ListWriterOption{WithTotalsRow("n")},
+		},
+		{
+			name: "group by",
+			opts: []ListWriterOption{WithGroupBy([]string{"group"}, map[string]AggFunc{"n": AggSum})},
+		},
+		{
+			name: "sort by",
+			opts: []ListWriterOption{WithSortBy("late", "n")},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			dir := t.TempDir()
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+
+			var want, got recordWriter
+
+			if err := NewListWriter(&want, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			spillOpts := append(opts, WithSpill(dir, 256))
+			if err := NewListWriter(&got, spillOpts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got.records, want.records) {
+				t.Fatalf("got %v, want %v", got.records, want.records)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(entries) != 0 {
+				t.Fatalf("got %d spill files after write, want 0", len(entries))
+			}
+		})
+	}
+}
+
+func TestColumnsSpill(t *testing.T) {
+	t.Parallel()
+
+	records := make([]string, 100)
+	for i := range records {
+		records[i] = fmt.Sprintf(`{"id": %d, "tags": [{"t": "a"}, {"t": "b"}]}`, i)
+	}
+
+	list, err := Decode(DecodeTypeJSON, []byte("["+strings.Join(records, ",")+"]"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listWriter := NewListWriter(nil, WithSpill(t.TempDir(), 256), WithFooter(func(Table) []string { return nil }))
+
+	columns, err := listWriter.columns(list, listWriter.spillOpts()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer columns.closeSpill(nil)
+
+	if !columns.spill.spilled() {
+		t.Fatal("expected the rows to be spilled")
+	}
+
+	// The columns hold no more cells than the limit, and those of the
+	// record that took them over it.
+	if held := columns.cells * columnCellSize; held > 256+2*2*columnCellSize {
+		t.Fatalf("got %d bytes of cells held, want at most the limit", held)
+	}
+
+	if columns.base == 0 || columns.rows != 200 {
+		t.Fatalf("got %d rows moved of %d, want most of 200", columns.base, columns.rows)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"strings"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// splitColumn is a column split into several by WithSplitColumn.
+type splitColumn struct {
+	column  string
+	sep     string
+	newCols []string
+}
+
+// SplitColumnConfig is a WithSplitColumn in a Config.
+type SplitColumnConfig struct {
+	Column  string   `json:"column" yaml:"column"`
+	Sep     string   `json:"sep" yaml:"sep"`
+	NewCols []string `json:"newCols" yaml:"newCols"`
+}
+
+// WithSplitColumn configures the ListWriter to split the delimited values of
+// "column", which may be a flattened path such as "address.code", into the
+// "newCols" columns, e.g. "US-CA-94016" split by "-" into country, state, and
+// zip columns. The value is split into at most as many parts as there are new
+// columns, so the last new column holds the rest of the value, separators
+// included, and the new columns without a part are empty. Numbers and bools
+// are split by their plain form, as with WithValueMap, and a missing or null
+// value leaves every new column empty. The split column is replaced by the new
+// columns.
+//
+// Splits are applied after lookups, in the order they are configured, so a
+// split can use the columns of a lookup or of an earlier split, and before the
+// field mask.
+func WithSplitColumn(column, sep string, newCols []string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.splits = append(listWriter.splits, &splitColumn{
+			column:  column,
+			sep:     sep,
+			newCols: newCols,
+		})
+	}
+}
+
+// deletePath will delete the value at the flattened path from the fields,
+// copying the nested objects on the path rather than modifying them.
+func deletePath(fields map[string]*structpb.Value, path string) {
+	key, rest, nested := strings.Cut(path, ".")
+	if !nested {
+		delete(fields, key)
+
+		return
+	}
+
+	obj := fields[key].GetStructValue()
+	if obj == nil {
+		return
+	}
+
+	copied := make(map[string]*structpb.Value, len(obj.GetFields()))
+	for k, v := range obj.GetFields() {
+		copied[k] = v
+	}
+
+	deletePath(copied, rest)
+
+	fields[key] = structpb.NewStructValue(&structpb.Struct{Fields: copied})
+}
+
+// split will replace the split column in "fields" with the new columns.
+func (split *splitColumn) split(fields map[string]*structpb.Value) {
+	var parts []string
+
+	if value := fieldByPath(&structpb.Struct{Fields: fields}, split.column); value != nil {
+		if plain, ok := plainKey(value); ok {
+			parts = strings.SplitN(plain, split.sep, len(split.newCols))
+		}
+	}
+
+	deletePath(fields, split.column)
+
+	for i, col := range split.newCols {
+		if i < len(parts) {
+			fields[col] = structpb.NewStringValue(parts[i])
+		} else {
+			fields[col] = structpb.NewNullValue()
+		}
+	}
+}
+
+// applySplits will return a list with the split columns of each object
+// replaced by their new columns.
+func (w *ListWriter) applySplits(list *structpb.ListValue) *structpb.ListValue {
+	return rewriteRecords(list, func(_ *structpb.Struct, fields map[string]*structpb.Value) {
+		for _, split := range w.splits {
+			split.split(fields)
+		}
+	})
+}
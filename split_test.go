@@ -0,0 +1,89 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWithSplitColumn(t *testing.T) {
+	t.Parallel()
+
+	for _, tcase := range []struct {
+		name string
+		data string
+		opts []ListWriterOption
+		want [][]string
+	}{
+		{
+			name: "split",
+			data: `[{"id": 1, "region": "US-CA-94016"}, {"id": 2, "region": "US-NY"}, {"id": 3}]`,
+			opts: []ListWriterOption{WithSplitColumn("region", "-", []string{"country", "state", "zip"})},
+			want: [][]string{
+				{"country", "id", "state", "zip"},
+				{"US", "1", "CA", "94016"},
+				{"US", "2", "NY", ""},
+				{"", "3", "", ""},
+			},
+		},
+		{
+			name: "rest in last column",
+			data: `[{"path": "a/b/c/d"}]`,
+			opts: []ListWriterOption{WithSplitColumn("path", "/", []string{"root", "rest"})},
+			want: [][]string{{"rest", "root"}, {"b/c/d", "a"}},
+		},
+		{
+			name: "nested",
+			data: `[{"address": {"code": "US-CA", "city": "SF"}}]`,
+			opts: []ListWriterOption{WithSplitColumn("address.code", "-", []string{"country", "state"})},
+			want: [][]string{{"address.city", "country", "state"}, {"SF", "US", "CA"}},
+		},
+		{
+			name: "number",
+			data: `[{"version": 1.25}]`,
+			opts: []ListWriterOption{WithSplitColumn("version", ".", []string{"major", "minor"})},
+			want: [][]string{{"major", "minor"}, {"1", "25"}},
+		},
+		{
+			name: "chained",
+			data: `[{"span": "09:30-17:00"}]`,
+			opts: []ListWriterOption{
+				WithSplitColumn("span", "-", []string{"start", "end"}),
+				WithSplitColumn("start", ":", []string{"start_hour", "start_minute"}),
+			},
+			want: [][]string{{"end", "start_hour", "start_minute"}, {"17:00", "09", "30"}},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := Decode(DecodeTypeJSON, []byte(tcase.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var dst recordWriter
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders(), WithRounding(0, RoundHalfUp)},
+				tcase.opts...)
+
+			if err := NewListWriter(&dst, opts...).Write(context.Background(), list); err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(dst.records, tcase.want) {
+				t.Fatalf("got %q, want %q", dst.records, tcase.want)
+			}
+		})
+	}
+}
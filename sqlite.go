@@ -0,0 +1,212 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+)
+
+const (
+	// sqliteMaxVariables is the default maximum number of host parameters
+	// in a single SQLite statement.
+	sqliteMaxVariables = 999
+
+	// sqliteInferRows is the number of rows buffered to infer the column
+	// types before the table is created.
+	sqliteInferRows = 1000
+)
+
+// SQLExecer executes SQL statements, e.g. a *sql.DB or *sql.Tx.
+type SQLExecer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// SQLiteWriter is a Writer that creates a SQLite table from the header and
+// bulk-inserts the rows into it. Column types are inferred from the first rows
+// that are written: columns of integers become INTEGER, columns of numbers
+// become REAL, and everything else becomes TEXT. Empty cells are inserted as
+// NULL.
+//
+// The SQLiteWriter does not depend on a driver, the caller opens the database
+// file with the driver of their choice. To insert atomically, give it a
+// *sql.Tx.
+type SQLiteWriter struct {
+	ctx          context.Context //nolint:containedctx
+	db           SQLExecer
+	table        string
+	header       []string
+	rows         [][]string
+	created      bool
+	maxVariables int
+}
+
+// SQLiteWriterOption is used to configure the SQLiteWriter.
+type SQLiteWriterOption func(*SQLiteWriter)
+
+// WithMaxVariables configures the SQLiteWriter with the maximum number of host
+// parameters in a statement, which is 999 by default, as in SQLite before
+// 3.32.0. Each row is inserted with one parameter per column, so a header with
+// more columns than the limit fails with ErrTooManyColumns.
+func WithMaxVariables(n int) SQLiteWriterOption {
+	return func(w *SQLiteWriter) {
+		w.maxVariables = n
+	}
+}
+
+// NewSQLiteWriter creates a SQLiteWriter that writes to the table with the
+// given name, creating it if it does not exist. Flush must be called after the
+// last record is written.
+func NewSQLiteWriter(ctx context.Context, db SQLExecer, table string, opts ...SQLiteWriterOption) *SQLiteWriter {
+	sqliteWriter := &SQLiteWriter{ctx: ctx, db: db, table: table, maxVariables: sqliteMaxVariables}
+
+	for _, opt := range opts {
+		opt(sqliteWriter)
+	}
+
+	return sqliteWriter
+}
+
+// quoteSQLIdent will quote the name as a SQL identifier.
+func quoteSQLIdent(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// sqliteType will return the SQLite type for the column at index "col", given
+// the buffered rows.
+func sqliteType(rows [][]string, col int) string {
+	switch inferCellType(rows, col) {
+	case ColumnTypeInt:
+		return "INTEGER"
+	case ColumnTypeFloat:
+		return "REAL"
+	case ColumnTypeString, ColumnTypeBool:
+		fallthrough
+	default:
+		return "TEXT"
+	}
+}
+
+// create will create the table, inferring the column types from the buffered
+// rows.
+func (w *SQLiteWriter) create() error {
+	defs := make([]string, len(w.header))
+	for i, header := range w.header {
+		defs[i] = fmt.Sprintf("%s %s", quoteSQLIdent(header), sqliteType(w.rows, i))
+	}
+
+	query := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)",
+		quoteSQLIdent(w.table), strings.Join(defs, ", "))
+
+	if _, err := w.db.ExecContext(w.ctx, query); err != nil {
+		return fmt.Errorf("failed to create sqlite table: %w", err)
+	}
+
+	w.created = true
+
+	return nil
+}
+
+// insert will insert the rows using multi-row INSERT statements.
+func (w *SQLiteWriter) insert(rows [][]string) error {
+	if len(rows) == 0 || len(w.header) == 0 {
+		return nil
+	}
+
+	cols := make([]string, len(w.header))
+	for i, header := range w.header {
+		cols[i] = quoteSQLIdent(header)
+	}
+
+	placeholders := "(" + strings.TrimSuffix(strings.Repeat("?, ", len(cols)), ", ") + ")"
+	perStmt := w.maxVariables / len(cols)
+
+	for start := 0; start < len(rows); start += perStmt {
+		end := start + perStmt
+		if end > len(rows) {
+			end = len(rows)
+		}
+
+		values := make([]string, 0, end-start)
+		args := make([]any, 0, (end-start)*len(cols))
+
+		for _, row := range rows[start:end] {
+			values = append(values, placeholders)
+
+			for i := range cols {
+				var arg any
+				if i < len(row) && row[i] != "" {
+					arg = row[i]
+				}
+
+				args = append(args, arg)
+			}
+		}
+
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", quoteSQLIdent(w.table),
+			strings.Join(cols, ", "), strings.Join(values, ", "))
+
+		if _, err := w.db.ExecContext(w.ctx, query, args...); err != nil {
+			return fmt.Errorf("failed to insert sqlite rows: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// Write stores the first record as the header and buffers the rest, inserting
+// them in bulk once enough rows are buffered.
+func (w *SQLiteWriter) Write(record []string) error {
+	if w.header == nil {
+		if len(record) > w.maxVariables {
+			return fmt.Errorf("%w: %d columns exceed the %d variables of a sqlite statement",
+				ErrTooManyColumns, len(record), w.maxVariables)
+		}
+
+		w.header = append([]string{}, record...)
+
+		return nil
+	}
+
+	w.rows = append(w.rows, append([]string{}, record...))
+
+	if !w.created && len(w.rows) < sqliteInferRows {
+		return nil
+	}
+
+	if w.created && len(w.rows)*len(w.header) < w.maxVariables {
+		return nil
+	}
+
+	return w.Flush()
+}
+
+// Flush creates the table, if it has not been created, and inserts any
+// buffered rows.
+func (w *SQLiteWriter) Flush() error {
+	if w.header == nil {
+		return nil
+	}
+
+	if !w.created {
+		if err := w.create(); err != nil {
+			return err
+		}
+	}
+
+	if err := w.insert(w.rows); err != nil {
+		return err
+	}
+
+	w.rows = w.rows[:0]
+
+	return nil
+}
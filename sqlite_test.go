@@ -0,0 +1,128 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// execRecorder is a SQLExecer that records every statement.
+type execRecorder struct {
+	queries []string
+	args    [][]any
+}
+
+func (rec *execRecorder) ExecContext(_ context.Context, query string, args ...any) (sql.Result, error) {
+	rec.queries = append(rec.queries, query)
+	rec.args = append(rec.args, args)
+
+	return nil, nil //nolint:nilnil
+}
+
+func TestSQLiteWriter(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "zip": "02134", "name": "a", "score": 1.5, "flag": true},
+		{"id": 2, "zip": "10001", "name": null, "score": 2, "flag": false}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var rec execRecorder
+
+	writer := NewSQLiteWriter(context.Background(), &rec, "users")
+
+	listWriter := NewListWriter(writer, WithAlphabetizeHeaders(),
+		WithCoercion("id", KindString))
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	wantQueries := []string{
+		`CREATE TABLE IF NOT EXISTS "users" ("flag" TEXT, "id" INTEGER, "name" TEXT, "score" REAL, "zip" TEXT)`,
+		`INSERT INTO "users" ("flag", "id", "name", "score", "zip") VALUES (?, ?, ?, ?, ?), (?, ?, ?, ?, ?)`,
+	}
+
+	if !reflect.DeepEqual(rec.queries, wantQueries) {
+		t.Fatalf("got queries %q, want %q", rec.queries, wantQueries)
+	}
+
+	wantArgs := []any{
+		"true", "1", "a", "1.500000", "02134",
+		"false", "2", nil, "2.000000", "10001",
+	}
+
+	if !reflect.DeepEqual(rec.args[1], wantArgs) {
+		t.Fatalf("got args %v, want %v", rec.args[1], wantArgs)
+	}
+}
+
+func TestSQLiteWriterMaxVariables(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"a": 1, "b": 2}, {"a": 3, "b": 4}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tcase := range []struct {
+		name        string
+		opts        []SQLiteWriterOption
+		wantErr     error
+		wantQueries int
+	}{
+		{
+			name:        "default",
+			wantQueries: 2,
+		},
+		{
+			name:        "one row per statement",
+			opts:        []SQLiteWriterOption{WithMaxVariables(3)},
+			wantQueries: 3,
+		},
+		{
+			name:    "too many columns",
+			opts:    []SQLiteWriterOption{WithMaxVariables(1)},
+			wantErr: ErrTooManyColumns,
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var rec execRecorder
+
+			writer := NewSQLiteWriter(context.Background(), &rec, "t", tcase.opts...)
+
+			err := NewListWriter(writer).Write(context.Background(), list)
+			if err == nil {
+				err = writer.Flush()
+			}
+
+			if !errors.Is(err, tcase.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tcase.wantErr)
+			}
+
+			if len(rec.queries) != tcase.wantQueries {
+				t.Fatalf("got queries %q, want %d", rec.queries, tcase.wantQueries)
+			}
+		})
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "google.golang.org/protobuf/types/known/structpb"
+
+// ColumnStats are the statistics collected for a column while the data is
+// flattened, so that summaries can be computed without re-parsing the cells.
+type ColumnStats struct {
+	// Values is the number of values written to the column, including
+	// nulls.
+	Values int
+
+	// Nulls is the number of null values written to the column.
+	Nulls int
+
+	// Numbers is the number of numeric values written to the column.
+	Numbers int
+
+	// Sum is the sum of the numeric values written to the column.
+	Sum float64
+
+	// Distinct is the number of distinct non-null values written to the
+	// column. It is only counted with WithCardinalityLimit, up to one more
+	// than the limit.
+	Distinct int
+}
+
+// observe will update the statistics with the given value.
+func (stats *ColumnStats) observe(value *structpb.Value) {
+	stats.Values++
+
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_NullValue:
+		stats.Nulls++
+	case *structpb.Value_NumberValue:
+		stats.Numbers++
+		stats.Sum += valType.NumberValue
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Table flattens the list into the Table that would be written, without
+// writing it, e.g. to join it with another by JoinTables. The records are
+// prepared and formatted as by Write, and the rows are sorted if WithSortBy is
+// used, but WithGroupBy and WithFooter are only applied when a table is
+// written. The rows are held in memory, even if they were spilled.
+func (w *ListWriter) Table(ctx context.Context, list *structpb.ListValue) (*Table, error) {
+	list, err := w.prepare(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+
+	if w.recordSizes != nil {
+		w.recordSizes.observe(list)
+	}
+
+	columns, err := w.columns(list, w.spillOpts()...)
+	if err != nil {
+		return nil, err
+	}
+
+	table, store, err := w.table(columns)
+	if err == nil && store.spilled() {
+		err = store.iter()(func(row []string) error {
+			table.Rows = append(table.Rows, row)
+
+			return nil
+		})
+	}
+
+	if closeErr := store.close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return table, nil
+}
+
+// WriteTable writes the header and rows of the table as they are, e.g. a
+// table returned by JoinTables. The rows are grouped by WithGroupBy, sorted by
+// WithSortBy, and followed by the footer of WithFooter, but the options that
+// flatten and format records do not apply.
+func (w *ListWriter) WriteTable(ctx context.Context, table *Table) error {
+	return w.measure(func() error {
+		w.rowIndex = 0
+
+		rows := table.Rows
+		if len(w.sortBy) > 0 && w.groupBy == nil {
+			rows = append([][]string{}, rows...)
+			sortRows(rows, rowLess(table.Header, w.sortBy))
+		}
+
+		if w.sidecar == nil {
+			return w.writeTable(ctx, table, sliceRows(rows))
+		}
+
+		w.sidecar.start(nil)
+
+		if err := w.writeTable(ctx, table, sliceRows(rows)); err != nil {
+			return err
+		}
+
+		return w.sidecar.emit(table.LargestRecords)
+	})
+}
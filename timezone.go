@@ -0,0 +1,91 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"fmt"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// ErrUnknownTimeZone is returned when a time zone name cannot be loaded.
+var ErrUnknownTimeZone = fmt.Errorf("unknown time zone")
+
+// TimeZone is a time zone given by its IANA name, e.g. "Europe/Berlin", so
+// that WithTimeZone can be configured in a Config.
+type TimeZone struct {
+	*time.Location
+}
+
+// MarshalText implements encoding.TextMarshaler.
+func (tz TimeZone) MarshalText() ([]byte, error) {
+	return []byte(tz.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, loading the time zone
+// by its name.
+func (tz *TimeZone) UnmarshalText(text []byte) error {
+	loc, err := time.LoadLocation(string(text))
+	if err != nil {
+		return fmt.Errorf("%w: %q: %v", ErrUnknownTimeZone, text, err)
+	}
+
+	tz.Location = loc
+
+	return nil
+}
+
+// WithTimeZone configures the ListWriter to convert the RFC 3339 timestamps in
+// the given columns to "loc" before they are written, e.g. to report
+// everything in local business time. The converted timestamps are written in
+// RFC 3339 with the offset of "loc", or in Excel's layout with
+// WithExcelProfile. If no columns are given, every column is converted. Cells
+// that are not timestamps are written unchanged.
+func WithTimeZone(loc *time.Location, cols ...string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if len(cols) == 0 {
+			listWriter.timeZone = loc
+
+			return
+		}
+
+		if listWriter.timeZones == nil {
+			listWriter.timeZones = make(map[string]*time.Location, len(cols))
+		}
+
+		for _, col := range cols {
+			listWriter.timeZones[col] = loc
+		}
+	}
+}
+
+// convertTimeZone will rewrite the string cell that starts at "start" in the
+// buffer in the time zone of its column, if it is a timestamp.
+func (w *ListWriter) convertTimeZone(buf []byte, start int, path string, value *structpb.Value) []byte {
+	loc, ok := w.timeZones[path]
+	if !ok {
+		loc = w.timeZone
+	}
+
+	if loc == nil {
+		return buf
+	}
+
+	if _, ok := value.GetKind().(*structpb.Value_StringValue); !ok {
+		return buf
+	}
+
+	ts, ok := parseTimestamp(buf[start:])
+	if !ok {
+		return buf
+	}
+
+	return ts.In(loc).AppendFormat(buf[:start], time.RFC3339Nano)
+}
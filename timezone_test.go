@@ -0,0 +1,100 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestWithTimeZone(t *testing.T) {
+	t.Parallel()
+
+	newYork := time.FixedZone("EST", -5*60*60)
+	tokyo := time.FixedZone("JST", 9*60*60)
+
+	record := map[string]any{
+		"created": "2023-01-02T15:04:05Z",
+		"updated": "2023-01-02T15:04:05.5+01:00",
+		"name":    "2023",
+	}
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want []string
+	}{
+		{
+			name: "listed columns",
+			opts: []ListWriterOption{WithTimeZone(newYork, "created")},
+			want: []string{"2023-01-02T10:04:05-05:00", "2023", "2023-01-02T15:04:05.5+01:00"},
+		},
+		{
+			name: "all columns",
+			opts: []ListWriterOption{WithTimeZone(newYork)},
+			want: []string{"2023-01-02T10:04:05-05:00", "2023", "2023-01-02T09:04:05.5-05:00"},
+		},
+		{
+			name: "listed columns override all columns",
+			opts: []ListWriterOption{WithTimeZone(newYork), WithTimeZone(tokyo, "updated")},
+			want: []string{"2023-01-02T10:04:05-05:00", "2023", "2023-01-02T23:04:05.5+09:00"},
+		},
+		{
+			name: "excel",
+			opts: []ListWriterOption{WithTimeZone(tokyo), WithExcelProfile()},
+			want: []string{"2023-01-03 00:04:05", "2023", "2023-01-02 23:04:05.500"},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			list, err := structpb.NewList([]any{record})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var rows [][]string
+
+			opts := append([]ListWriterOption{WithAlphabetizeHeaders()}, tcase.opts...)
+			writer := WriterFunc(func(row []string) error {
+				rows = append(rows, row)
+
+				return nil
+			})
+
+			if err := NewListWriter(writer, opts...).Write(context.Background(), list); err != nil {
+				t.Fatalf("failed to write: %v", err)
+			}
+
+			if !reflect.DeepEqual(rows[1], tcase.want) {
+				t.Fatalf("got %q, want %q", rows[1], tcase.want)
+			}
+		})
+	}
+}
+
+func TestTimeZoneUnmarshalText(t *testing.T) {
+	t.Parallel()
+
+	var tz TimeZone
+	if err := tz.UnmarshalText([]byte("UTC")); err != nil || tz.Location != time.UTC {
+		t.Fatalf("got %v, %v", tz, err)
+	}
+
+	if err := tz.UnmarshalText([]byte("Nowhere/Atlantis")); !errors.Is(err, ErrUnknownTimeZone) {
+		t.Fatalf("got error %v, want %v", err, ErrUnknownTimeZone)
+	}
+}
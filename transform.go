@@ -0,0 +1,62 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import "strings"
+
+// TransformUpper converts the cell to upper case.
+func TransformUpper(cell string) string {
+	return strings.ToUpper(cell)
+}
+
+// TransformLower converts the cell to lower case.
+func TransformLower(cell string) string {
+	return strings.ToLower(cell)
+}
+
+// TransformTrim removes the leading and trailing white space of the cell.
+func TransformTrim(cell string) string {
+	return strings.TrimSpace(cell)
+}
+
+// TransformCollapseSpaces replaces each run of white space in the cell with a
+// single space, and removes the leading and trailing white space.
+func TransformCollapseSpaces(cell string) string {
+	return strings.Join(strings.Fields(cell), " ")
+}
+
+// WithColumnTransform configures the ListWriter to rewrite the cells of the
+// column with "fn", e.g. TransformTrim, after they are formatted. Transforms of
+// the same column are applied in the order they are given. Cells that are
+// missing from a record are not transformed, but empty and null cells are.
+func WithColumnTransform(column string, fn func(string) string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if listWriter.columnTransforms == nil {
+			listWriter.columnTransforms = make(map[string][]func(string) string)
+		}
+
+		listWriter.columnTransforms[column] = append(listWriter.columnTransforms[column], fn)
+	}
+}
+
+// transformCell will rewrite the cell that starts at "start" in the buffer with
+// the transforms of its column.
+func (w *ListWriter) transformCell(buf []byte, start int, path string) []byte {
+	fns, ok := w.columnTransforms[path]
+	if !ok {
+		return buf
+	}
+
+	cell := string(buf[start:])
+	for _, fn := range fns {
+		cell = fn(cell)
+	}
+
+	return append(buf[:start], cell...)
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWriteColumnTransform(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"name": "  Ada   Lovelace ", "code": " ab ", "tag": "X", "n": 1},
+		{"name": "grace\thopper", "code": null, "tag": "y"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	err = NewListWriter(&dst, WithAlphabetizeHeaders(),
+		WithColumnTransform("name", TransformCollapseSpaces),
+		WithColumnTransform("code", TransformTrim),
+		WithColumnTransform("code", TransformUpper),
+		WithColumnTransform("tag", TransformLower),
+		WithColumnTransform("n", func(cell string) string { return "#" + cell }),
+	).Write(context.Background(), list)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"code", "n", "name", "tag"},
+		{"AB", "#1.000000", "Ada Lovelace", "x"},
+		{"", "", "grace hopper", "y"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %q, want %q", dst.records, want)
+	}
+}
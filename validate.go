@@ -0,0 +1,123 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Validate runs the checks of Write on the list without writing anything, so
+// that bad input can be rejected before any output is created. It returns
+// every problem found, in the order that they are found, or nil if the list
+// can be written without an error or a warning.
+//
+// The checks are those of the input schema, the CEL filters and computed
+// columns, the flattening of each record, including the limit set by
+// WithMaxColumns, the header, including WithDuplicateHeaderError, and the
+// formatting of each cell, including coercions. The
+// child tables of WithChildTables are validated the same way. The footer is
+// not computed. Problems that are warnings when a warning handler is set are
+// reported whether or not one is.
+func (w *ListWriter) Validate(list *structpb.ListValue) []error {
+	var problems []error
+
+	validator := *w
+	validator.writer = nil
+	validator.sidecar = nil
+	validator.sample = w.sample.clone()
+	validator.rejects = nil
+	validator.warn = func(err error) {
+		problems = append(problems, err)
+	}
+
+	list, err := validator.prepare(context.Background(), list)
+	if err != nil {
+		return append(problems, err)
+	}
+
+	if validator.arrayPolicy != ArrayPolicyChildTable {
+		return append(problems, validator.validateList(list)...)
+	}
+
+	list, children := splitChildren(list, validator.keyEscaper)
+	problems = append(problems, validator.validateList(list)...)
+
+	names := make([]string, 0, len(children))
+	for name := range children {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	// The null thresholds only apply to the parent table.
+	child := validator
+	child.nullThresholds = nil
+
+	for _, name := range names {
+		for _, err := range child.validateList(children[name]) {
+			problems = append(problems, fmt.Errorf("child table %q: %w", name, err))
+		}
+	}
+
+	return problems
+}
+
+// validateList will flatten and format the prepared list, returning the
+// problems found.
+func (w *ListWriter) validateList(list *structpb.ListValue) []error {
+	var problems []error
+
+	cols := newColumns(w.columnsOpts(list)...)
+
+	for _, value := range list.GetValues() {
+		err := cols.addValue("", value)
+		if err == nil {
+			continue
+		}
+
+		problems = append(problems, err)
+
+		// Every later record with a new column would exceed the limit
+		// again.
+		if errors.Is(err, ErrTooManyColumns) {
+			return problems
+		}
+
+		// Skip the record, leaving any cells that it added in a row of
+		// their own.
+		cols.rows++
+		cols.records++
+	}
+
+	problems = append(problems, w.nullRateErrors(cols)...)
+
+	ordered := cols.ordered()
+
+	header := make([]string, len(ordered))
+	for i, column := range ordered {
+		header[i] = column.header
+	}
+
+	if _, err := w.outputHeader(header); err != nil {
+		problems = append(problems, err)
+	}
+
+	for i := 0; i < cols.rows; i++ {
+		if _, err := cols.formatRow(ordered, i); err != nil {
+			problems = append(problems, fmt.Errorf("failed to format row %d: %w", i, err))
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,117 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "active": "yes"},
+		{"id": "two", "active": "maybe"},
+		{"id": 3, "active": "perhaps", "extra": {"a": 1, "b": 2}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schema := []byte(`{"type": "object", "properties": {"id": {"type": "number"}}}`)
+
+	for _, tcase := range []struct {
+		name string
+		opts []ListWriterOption
+		want []error
+	}{
+		{
+			name: "valid",
+		},
+		{
+			name: "all problems",
+			opts: []ListWriterOption{WithInputSchema(schema), WithBoolColumns("active")},
+			want: []error{ErrSchemaViolation, ErrUncoercible},
+		},
+		{
+			name: "too many columns",
+			opts: []ListWriterOption{WithMaxColumns(3)},
+			want: []error{ErrTooManyColumns},
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			var dst recordWriter
+
+			problems := NewListWriter(&dst, tcase.opts...).Validate(list)
+			if len(problems) != len(tcase.want) {
+				t.Fatalf("got problems %v, want %v", problems, tcase.want)
+			}
+
+			for i, want := range tcase.want {
+				if !errors.Is(problems[i], want) {
+					t.Fatalf("got problem %v, want %v", problems[i], want)
+				}
+			}
+
+			if len(dst.records) != 0 {
+				t.Fatalf("unexpected records: %v", dst.records)
+			}
+		})
+	}
+}
+
+func TestValidateDuplicateHeader(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"café": 1, "cafe": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	listWriter := NewListWriter(&recordWriter{}, WithASCIIHeaders(), WithDuplicateHeaderError())
+
+	problems := listWriter.Validate(list)
+	if len(problems) != 1 || !errors.Is(problems[0], ErrDuplicateHeader) {
+		t.Fatalf("got problems %v, want %v", problems, ErrDuplicateHeader)
+	}
+
+	if err := listWriter.Write(context.Background(), list); !errors.Is(err, ErrDuplicateHeader) {
+		t.Fatalf("got error %v from Write, want %v", err, ErrDuplicateHeader)
+	}
+}
+
+func TestValidateSkipsBadRecords(t *testing.T) {
+	t.Parallel()
+
+	list := &structpb.ListValue{Values: []*structpb.Value{
+		structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{"a": {}}}),
+		structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{"a": structpb.NewNumberValue(1)}}),
+		structpb.NewStructValue(&structpb.Struct{Fields: map[string]*structpb.Value{"a": {}}}),
+	}}
+
+	problems := NewListWriter(&recordWriter{}).Validate(list)
+	if len(problems) != 2 {
+		t.Fatalf("got problems %v, want 2", problems)
+	}
+
+	for i, record := range []int{0, 2} {
+		var valueErr *ValueError
+		if !errors.As(problems[i], &valueErr) || valueErr.Record != record {
+			t.Fatalf("got problem %v, want one in record %d", problems[i], record)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ValueError is returned when a value in a record cannot be flattened, e.g.
+// because its type is not supported. It locates the value within the list that
+// was written.
+type ValueError struct {
+	// Record is the index of the record in the list, not counting any
+	// records that were left out, e.g. by WithFilter.
+	Record int
+
+	// Path is the location of the value within the record, e.g.
+	// "foo.bar[3].baz".
+	Path string
+
+	Err error
+}
+
+func (e *ValueError) Error() string {
+	return fmt.Sprintf("record %d at %q: %v", e.Record, e.Path, e.Err)
+}
+
+func (e *ValueError) Unwrap() error {
+	return e.Err
+}
+
+// pathSegment is an object key or a list index in the path to a value.
+type pathSegment struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// pathError carries the path to a value that could not be flattened while the
+// error is returned through the enclosing objects and lists, which add their
+// segments in reverse.
+type pathError struct {
+	segments []pathSegment
+	err      error
+}
+
+func (e *pathError) Error() string {
+	return e.err.Error()
+}
+
+func (e *pathError) Unwrap() error {
+	return e.err
+}
+
+// withPathSegment will prepend the segment to the path of the error.
+func withPathSegment(err error, segment pathSegment) error {
+	var pathErr *pathError
+	if !errors.As(err, &pathErr) {
+		pathErr = &pathError{err: err}
+	}
+
+	pathErr.segments = append(pathErr.segments, segment)
+
+	return pathErr
+}
+
+// newValueError will return a ValueError for the record, whose path starts
+// with "key".
+func newValueError(record int, key string, err error) error {
+	var path strings.Builder
+
+	path.WriteString(key)
+
+	var pathErr *pathError
+	if errors.As(err, &pathErr) {
+		err = pathErr.err
+
+		for i := len(pathErr.segments) - 1; i >= 0; i-- {
+			segment := pathErr.segments[i]
+
+			switch {
+			case segment.isIndex:
+				path.WriteString("[" + strconv.Itoa(segment.index) + "]")
+			case path.Len() > 0:
+				path.WriteString("." + segment.key)
+			default:
+				path.WriteString(segment.key)
+			}
+		}
+	}
+
+	return &ValueError{Record: record, Path: path.String(), Err: err}
+}
@@ -0,0 +1,90 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestValueError(t *testing.T) {
+	t.Parallel()
+
+	// A value without a kind is not supported.
+	invalid := &structpb.Value{}
+
+	object := func(fields map[string]*structpb.Value) *structpb.Value {
+		return structpb.NewStructValue(&structpb.Struct{Fields: fields})
+	}
+
+	list := func(values ...*structpb.Value) *structpb.Value {
+		return structpb.NewListValue(&structpb.ListValue{Values: values})
+	}
+
+	for _, tcase := range []struct {
+		name       string
+		record     *structpb.Value
+		wantPath   string
+		wantRecord int
+	}{
+		{
+			name:     "field",
+			record:   object(map[string]*structpb.Value{"foo": invalid}),
+			wantPath: "foo",
+		},
+		{
+			name: "nested list",
+			record: object(map[string]*structpb.Value{
+				"foo": object(map[string]*structpb.Value{
+					"bar": list(
+						object(nil), object(nil), object(nil),
+						object(map[string]*structpb.Value{"baz": invalid}),
+					),
+				}),
+			}),
+			wantPath: "foo.bar[3].baz",
+		},
+		{
+			name: "scalar list",
+			record: object(map[string]*structpb.Value{
+				"tags": list(structpb.NewStringValue("a"), invalid),
+			}),
+			wantPath: "tags[1]",
+		},
+	} {
+		tcase := tcase
+
+		t.Run(tcase.name, func(t *testing.T) {
+			t.Parallel()
+
+			records := &structpb.ListValue{Values: []*structpb.Value{
+				object(map[string]*structpb.Value{"ok": structpb.NewBoolValue(true)}),
+				tcase.record,
+			}}
+
+			err := NewListWriter(&recordWriter{}).Write(context.Background(), records)
+
+			var valueErr *ValueError
+			if !errors.As(err, &valueErr) {
+				t.Fatalf("got error %v, want a ValueError", err)
+			}
+
+			if !errors.Is(err, ErrUnsupportedValueType) {
+				t.Fatalf("got error %v, want %v", err, ErrUnsupportedValueType)
+			}
+
+			if valueErr.Record != 1 || valueErr.Path != tcase.wantPath {
+				t.Fatalf("got record %d at %q, want record 1 at %q", valueErr.Record, valueErr.Path, tcase.wantPath)
+			}
+		})
+	}
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// WithValueMap configures the ListWriter to translate the coded values of the
+// column, e.g. "1" to "active" and "2" to "disabled". Values are looked up by
+// their plain form: numbers without trailing zeros, booleans as "true" and
+// "false", and strings as they are. Values that are not in the mapping are
+// written unchanged. The translated values are written as strings, so they can
+// still be coerced with WithCoercion.
+func WithValueMap(column string, mapping map[string]string) ListWriterOption {
+	return func(listWriter *ListWriter) {
+		if listWriter.valueMaps == nil {
+			listWriter.valueMaps = make(map[string]map[string]string)
+		}
+
+		listWriter.valueMaps[column] = mapping
+	}
+}
+
+// plainKey will return the plain form of a scalar value, by which it is looked
+// up in a value map or lookup table.
+func plainKey(value *structpb.Value) (string, bool) {
+	switch valType := value.Kind.(type) {
+	case *structpb.Value_StringValue:
+		return valType.StringValue, true
+	case *structpb.Value_NumberValue:
+		return strconv.FormatFloat(valType.NumberValue, 'f', -1, 64), true
+	case *structpb.Value_BoolValue:
+		return strconv.FormatBool(valType.BoolValue), true
+	default:
+		return "", false
+	}
+}
+
+// mapValue will return the translation of the value in the column's value map.
+func (w *ListWriter) mapValue(path string, value *structpb.Value) (*structpb.Value, bool) {
+	mapping, ok := w.valueMaps[path]
+	if !ok {
+		return nil, false
+	}
+
+	key, ok := plainKey(value)
+	if !ok {
+		return nil, false
+	}
+
+	mapped, ok := mapping[key]
+	if !ok {
+		return nil, false
+	}
+
+	return structpb.NewStringValue(mapped), true
+}
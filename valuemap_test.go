@@ -0,0 +1,52 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestWithValueMap(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"status": 1, "code": "a", "flag": true},
+		{"status": "2", "code": "b", "flag": false},
+		{"status": 3, "code": null}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var dst recordWriter
+
+	listWriter := NewListWriter(&dst,
+		WithAlphabetizeHeaders(),
+		WithValueMap("status", map[string]string{"1": "active", "2": "disabled"}),
+		WithValueMap("code", map[string]string{"a": "yes", "b": "no"}),
+		WithValueMap("flag", map[string]string{"true": "on"}),
+		WithBoolColumns("code"))
+
+	if err := listWriter.Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := [][]string{
+		{"code", "flag", "status"},
+		{"true", "on", "active"},
+		{"false", "false", "disabled"},
+		{"", "", "3.000000"},
+	}
+
+	if !reflect.DeepEqual(dst.records, want) {
+		t.Fatalf("got %v, want %v", dst.records, want)
+	}
+}
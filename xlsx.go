@@ -0,0 +1,357 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"archive/zip"
+	"bufio"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+const (
+	// xlsxMaxRows and xlsxMaxColumns are the limits of a worksheet.
+	xlsxMaxRows    = 1 << 20
+	xlsxMaxColumns = 1 << 14
+
+	// xlsxMaxSheetName is the maximum length of a sheet name.
+	xlsxMaxSheetName = 31
+
+	// xlsxBlankPartition is the sheet of the records without a partition
+	// value.
+	xlsxBlankPartition = "(blank)"
+)
+
+// ErrSheetTooLarge is returned when a sheet has more rows or columns than a
+// worksheet can hold.
+var ErrSheetTooLarge = fmt.Errorf("sheet too large")
+
+// xlsxNumber matches the cells that are written as numbers, which excludes
+// numbers with leading zeros, such as zip codes, that would lose them.
+var xlsxNumber = regexp.MustCompile(`^-?(0|[1-9][0-9]*)(\.[0-9]+)?([eE][+-]?[0-9]+)?$`)
+
+// xlsxSheetNameReplacer replaces the characters that a sheet name cannot
+// contain.
+var xlsxSheetNameReplacer = strings.NewReplacer(
+	"[", "_", "]", "_", ":", "_", "*", "_", "?", "_", "/", "_", "\\", "_")
+
+// xlsxSheet is a worksheet of an XLSXWriter.
+type xlsxSheet struct {
+	name string
+	rows [][]string
+	err  error
+}
+
+// Write appends the record to the sheet as a row.
+func (sheet *xlsxSheet) Write(record []string) error {
+	if sheet.err != nil {
+		return sheet.err
+	}
+
+	if len(sheet.rows) >= xlsxMaxRows || len(record) > xlsxMaxColumns {
+		sheet.err = fmt.Errorf("%w: %q", ErrSheetTooLarge, sheet.name)
+
+		return sheet.err
+	}
+
+	sheet.rows = append(sheet.rows, append([]string{}, record...))
+
+	return nil
+}
+
+// XLSXWriter writes a workbook of one or more sheets, each of which is a
+// Writer for a ListWriter or an Encoder. Cells that are plain decimal numbers
+// are written as numbers, and every other cell as text. The sheets are held in
+// memory until Flush writes the workbook.
+type XLSXWriter struct {
+	writer io.Writer
+	sheets []*xlsxSheet
+	names  map[string]*xlsxSheet
+}
+
+// NewXLSXWriter creates an XLSXWriter that writes the workbook to "writer".
+// Flush must be called after the last record is written.
+func NewXLSXWriter(writer io.Writer) *XLSXWriter {
+	return &XLSXWriter{writer: writer, names: make(map[string]*xlsxSheet)}
+}
+
+// xlsxSheetName will return the name as a valid sheet name.
+func xlsxSheetName(name string) string {
+	name = xlsxSheetNameReplacer.Replace(strings.Trim(name, "'"))
+	if name == "" {
+		name = "Sheet"
+	}
+
+	for utf8.RuneCountInString(name) > xlsxMaxSheetName {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+
+	return name
+}
+
+// Sheet returns the sheet with the name, adding it after the existing sheets
+// if there is none. Sheet names are shortened to 31 characters and the
+// characters that Excel does not allow, such as "/", are replaced with "_".
+// Names that differ only in case refer to the same sheet.
+func (w *XLSXWriter) Sheet(name string) Writer {
+	name = xlsxSheetName(name)
+	key := strings.ToLower(name)
+
+	if sheet, ok := w.names[key]; ok {
+		return sheet
+	}
+
+	sheet := &xlsxSheet{name: name}
+	w.sheets = append(w.sheets, sheet)
+	w.names[key] = sheet
+
+	return sheet
+}
+
+// WriteSheets writes each top-level array of the object to its own sheet,
+// named by its key, in alphabetical order, e.g. the "users" and "orders" of an
+// API response. Each array is written by a ListWriter with the options. Keys
+// whose values are not arrays are ignored.
+func (w *XLSXWriter) WriteSheets(ctx context.Context, obj *structpb.Struct,
+	opts ...ListWriterOption,
+) error {
+	keys := make([]string, 0, len(obj.GetFields()))
+	for key, value := range obj.GetFields() {
+		if value.GetListValue() != nil {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		err := NewListWriter(w.Sheet(key), opts...).Write(ctx, obj.GetFields()[key].GetListValue())
+		if err != nil {
+			return fmt.Errorf("failed to write sheet %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// WritePartitions writes the records of the list to one sheet per distinct
+// value of "column", which may be a flattened path such as "user.country", in
+// the order the values are first seen. Values are compared by their plain
+// form, as with WithValueMap, and records without a scalar value are written
+// to the "(blank)" sheet. Each sheet is written by a ListWriter with the
+// options.
+func (w *XLSXWriter) WritePartitions(ctx context.Context, list *structpb.ListValue, column string,
+	opts ...ListWriterOption,
+) error {
+	var order []string
+
+	partitions := make(map[string]*structpb.ListValue)
+
+	for _, record := range list.GetValues() {
+		key := xlsxBlankPartition
+
+		if value := fieldByPath(record.GetStructValue(), column); value != nil {
+			if plain, ok := plainKey(value); ok && plain != "" {
+				key = plain
+			}
+		}
+
+		partition, ok := partitions[key]
+		if !ok {
+			partition = &structpb.ListValue{}
+			partitions[key] = partition
+			order = append(order, key)
+		}
+
+		partition.Values = append(partition.Values, record)
+	}
+
+	for _, key := range order {
+		if err := NewListWriter(w.Sheet(key), opts...).Write(ctx, partitions[key]); err != nil {
+			return fmt.Errorf("failed to write sheet %q: %w", key, err)
+		}
+	}
+
+	return nil
+}
+
+// xlsxColumn will return the letters of the column at the zero-based index.
+func xlsxColumn(index int) string {
+	var letters []byte
+
+	for index++; index > 0; index = (index - 1) / 26 {
+		letters = append([]byte{byte('A' + (index-1)%26)}, letters...)
+	}
+
+	return string(letters)
+}
+
+// writeXML will write the text, escaped for XML.
+func writeXML(w *bufio.Writer, text string) {
+	// Writes to a bufio.Writer only fail when it is flushed.
+	_ = xml.EscapeText(w, []byte(text))
+}
+
+// writeSheet will write the worksheet XML of the sheet.
+func writeSheet(out io.Writer, sheet *xlsxSheet) error {
+	w := bufio.NewWriter(out)
+
+	w.WriteString(xml.Header)
+	w.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`)
+
+	for i, row := range sheet.rows {
+		ref := strconv.Itoa(i + 1)
+
+		w.WriteString(`<row r="` + ref + `">`)
+
+		for j, cell := range row {
+			if cell == "" {
+				continue
+			}
+
+			w.WriteString(`<c r="` + xlsxColumn(j) + ref + `"`)
+
+			if xlsxNumber.MatchString(cell) {
+				w.WriteString(`><v>` + cell + `</v></c>`)
+
+				continue
+			}
+
+			w.WriteString(` t="inlineStr"><is><t xml:space="preserve">`)
+			writeXML(w, cell)
+			w.WriteString(`</t></is></c>`)
+		}
+
+		w.WriteString(`</row>`)
+	}
+
+	w.WriteString(`</sheetData></worksheet>`)
+
+	return w.Flush()
+}
+
+// writeZipFile will add the file to the archive with the content written by
+// "write".
+func writeZipFile(archive *zip.Writer, name string, write func(w io.Writer) error) error {
+	file, err := archive.Create(name)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", name, err)
+	}
+
+	if err := write(file); err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// xlsxString will return a function that writes the string.
+func xlsxString(str string) func(w io.Writer) error {
+	return func(w io.Writer) error {
+		_, err := io.WriteString(w, str)
+
+		return err
+	}
+}
+
+// Flush writes the workbook, with the sheets in the order they were added. A
+// workbook without sheets is written with one empty sheet, since a workbook
+// must have at least one.
+func (w *XLSXWriter) Flush() error {
+	sheets := w.sheets
+	if len(sheets) == 0 {
+		sheets = []*xlsxSheet{{name: "Sheet"}}
+	}
+
+	for _, sheet := range sheets {
+		if sheet.err != nil {
+			return sheet.err
+		}
+	}
+
+	var contentTypes, workbook, rels strings.Builder
+
+	contentTypes.WriteString(xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ` +
+		`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>`)
+	workbook.WriteString(xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" ` +
+		`xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">`)
+
+	for i, sheet := range sheets {
+		id := strconv.Itoa(i + 1)
+
+		contentTypes.WriteString(`<Override PartName="/xl/worksheets/sheet` + id + `.xml" ` +
+			`ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`)
+
+		var name strings.Builder
+		_ = xml.EscapeText(&name, []byte(sheet.name))
+
+		workbook.WriteString(`<sheet name="` + name.String() + `" sheetId="` + id + `" r:id="rId` + id + `"/>`)
+		rels.WriteString(`<Relationship Id="rId` + id + `" ` +
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" ` +
+			`Target="worksheets/sheet` + id + `.xml"/>`)
+	}
+
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+
+	archive := zip.NewWriter(w.writer)
+
+	files := []struct {
+		name  string
+		write func(w io.Writer) error
+	}{
+		{name: "[Content_Types].xml", write: xlsxString(contentTypes.String())},
+		{name: "_rels/.rels", write: xlsxString(xml.Header +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId1" ` +
+			`Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" ` +
+			`Target="xl/workbook.xml"/></Relationships>`)},
+		{name: "xl/workbook.xml", write: xlsxString(workbook.String())},
+		{name: "xl/_rels/workbook.xml.rels", write: xlsxString(rels.String())},
+	}
+
+	for i, sheet := range sheets {
+		sheet := sheet
+
+		files = append(files, struct {
+			name  string
+			write func(w io.Writer) error
+		}{
+			name:  "xl/worksheets/sheet" + strconv.Itoa(i+1) + ".xml",
+			write: func(w io.Writer) error { return writeSheet(w, sheet) },
+		})
+	}
+
+	for _, file := range files {
+		if err := writeZipFile(archive, file.name, file.write); err != nil {
+			return writerFailed(err)
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return writerFailed(fmt.Errorf("failed to close workbook: %w", err))
+	}
+
+	return nil
+}
@@ -0,0 +1,227 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// xlsxCell is a cell of a worksheet read back by readWorkbook.
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+// readWorkbook will read the sheet names of the workbook and the cells of
+// each sheet, with numbers prefixed by "#".
+func readWorkbook(t *testing.T, data []byte) ([]string, map[string][][]string) {
+	t.Helper()
+
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	read := func(name string, v any) {
+		file, err := archive.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		body, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := xml.Unmarshal(body, v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var workbook struct {
+		Sheets []struct {
+			Name string `xml:"name,attr"`
+		} `xml:"sheets>sheet"`
+	}
+
+	read("xl/workbook.xml", &workbook)
+
+	names := make([]string, len(workbook.Sheets))
+	sheets := make(map[string][][]string)
+
+	for i, sheet := range workbook.Sheets {
+		names[i] = sheet.Name
+
+		var worksheet struct {
+			Rows []struct {
+				Cells []xlsxCell `xml:"c"`
+			} `xml:"sheetData>row"`
+		}
+
+		read("xl/worksheets/sheet"+string(rune('1'+i))+".xml", &worksheet)
+
+		for _, row := range worksheet.Rows {
+			var cells []string
+
+			for _, cell := range row.Cells {
+				if cell.Type == "inlineStr" {
+					cells = append(cells, cell.Ref+"="+cell.Inline)
+				} else {
+					cells = append(cells, cell.Ref+"=#"+cell.Value)
+				}
+			}
+
+			sheets[sheet.Name] = append(sheets[sheet.Name], cells)
+		}
+	}
+
+	return names, sheets
+}
+
+func TestXLSXWriterWriteSheets(t *testing.T) {
+	t.Parallel()
+
+	value, err := structpb.NewValue(map[string]any{
+		"users":  []any{map[string]any{"id": 1, "zip": "02134"}, map[string]any{"id": 2, "zip": "a&b"}},
+		"orders": []any{map[string]any{"total": 9.5}},
+		"count":  3,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	writer := NewXLSXWriter(&buf)
+	if err := writer.WriteSheets(context.Background(), value.GetStructValue(), WithAlphabetizeHeaders()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, sheets := readWorkbook(t, buf.Bytes())
+
+	if want := []string{"orders", "users"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got sheets %q, want %q", names, want)
+	}
+
+	want := map[string][][]string{
+		"orders": {{"A1=total"}, {"A2=#9.500000"}},
+		"users":  {{"A1=id", "B1=zip"}, {"A2=#1.000000", "B2=02134"}, {"A3=#2.000000", "B3=a&b"}},
+	}
+
+	if !reflect.DeepEqual(sheets, want) {
+		t.Fatalf("got %q, want %q", sheets, want)
+	}
+}
+
+func TestXLSXWriterWritePartitions(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "user": {"country": "US"}},
+		{"id": 2, "user": {"country": "DE"}},
+		{"id": 3, "user": {"country": "US"}},
+		{"id": 4, "user": {}}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	writer := NewXLSXWriter(&buf)
+	if err := writer.WritePartitions(context.Background(), list, "user.country", WithAlphabetizeHeaders()); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, sheets := readWorkbook(t, buf.Bytes())
+
+	if want := []string{"US", "DE", "(blank)"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("got sheets %q, want %q", names, want)
+	}
+
+	want := map[string][][]string{
+		"US":      {{"A1=id", "B1=user.country"}, {"A2=#1.000000", "B2=US"}, {"A3=#3.000000", "B3=US"}},
+		"DE":      {{"A1=id", "B1=user.country"}, {"A2=#2.000000", "B2=DE"}},
+		"(blank)": {{"A1=id"}, {"A2=#4.000000"}},
+	}
+
+	if !reflect.DeepEqual(sheets, want) {
+		t.Fatalf("got %q, want %q", sheets, want)
+	}
+}
+
+func TestXLSXWriterSheet(t *testing.T) {
+	t.Parallel()
+
+	writer := NewXLSXWriter(io.Discard)
+
+	for _, tcase := range []struct {
+		name string
+		want string
+	}{
+		{name: "a/b:c", want: "a_b_c"},
+		{name: "", want: "Sheet"},
+		{name: strings.Repeat("x", 40), want: strings.Repeat("x", 31)},
+	} {
+		sheet, ok := writer.Sheet(tcase.name).(*xlsxSheet)
+		if !ok || sheet.name != tcase.want {
+			t.Fatalf("got sheet %q for %q, want %q", sheet.name, tcase.name, tcase.want)
+		}
+	}
+
+	if writer.Sheet("Users") != writer.Sheet("users") {
+		t.Fatal("got different sheets for names that differ in case")
+	}
+}
+
+func TestXLSXWriterTooLarge(t *testing.T) {
+	t.Parallel()
+
+	writer := NewXLSXWriter(io.Discard)
+
+	err := writer.Sheet("wide").Write(make([]string, xlsxMaxColumns+1))
+	if !errors.Is(err, ErrSheetTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrSheetTooLarge)
+	}
+
+	if err := writer.Flush(); !errors.Is(err, ErrSheetTooLarge) {
+		t.Fatalf("got error %v, want %v", err, ErrSheetTooLarge)
+	}
+}
+
+func TestXLSXColumn(t *testing.T) {
+	t.Parallel()
+
+	for index, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 701: "ZZ", 702: "AAA"} {
+		if got := xlsxColumn(index); got != want {
+			t.Fatalf("got column %q for %d, want %q", got, index, want)
+		}
+	}
+}
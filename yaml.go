@@ -0,0 +1,100 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// plainYAMLKey matches keys that can be written as plain YAML scalars.
+var plainYAMLKey = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.\-]*$`)
+
+// reservedYAMLWords are plain scalars that YAML would not read as strings.
+var reservedYAMLWords = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true,
+	"off": true, "null": true, "y": true, "n": true,
+}
+
+// quoteYAML will quote the string as a YAML double-quoted scalar. JSON strings
+// are valid YAML double-quoted scalars.
+func quoteYAML(str string) string {
+	quoted, _ := json.Marshal(str)
+
+	return string(quoted)
+}
+
+// yamlKey will format the header as a YAML mapping key.
+func yamlKey(header string) string {
+	if plainYAMLKey.MatchString(header) && !reservedYAMLWords[strings.ToLower(header)] {
+		return header
+	}
+
+	return quoteYAML(header)
+}
+
+// YAMLWriter is a Writer that writes records as a YAML sequence of mappings,
+// one mapping per row keyed by the header. Every cell is written as a quoted
+// string so that it is read back exactly as it was written.
+type YAMLWriter struct {
+	writer io.Writer
+	header []string
+}
+
+// NewYAMLWriter creates a YAMLWriter that writes to "writer". The first record
+// written is treated as the header.
+func NewYAMLWriter(writer io.Writer) *YAMLWriter {
+	return &YAMLWriter{writer: writer}
+}
+
+// Write writes the record as a YAML mapping, or stores it as the header if it
+// is the first record.
+func (w *YAMLWriter) Write(record []string) error {
+	if w.header == nil {
+		w.header = make([]string, len(record))
+		for i, header := range record {
+			w.header[i] = yamlKey(header)
+		}
+
+		return nil
+	}
+
+	var buf strings.Builder
+
+	if len(w.header) == 0 {
+		buf.WriteString("- {}\n")
+	}
+
+	for i, key := range w.header {
+		if i == 0 {
+			buf.WriteString("- ")
+		} else {
+			buf.WriteString("  ")
+		}
+
+		cell := ""
+		if i < len(record) {
+			cell = record[i]
+		}
+
+		buf.WriteString(key)
+		buf.WriteString(": ")
+		buf.WriteString(quoteYAML(cell))
+		buf.WriteString("\n")
+	}
+
+	if _, err := io.WriteString(w.writer, buf.String()); err != nil {
+		return fmt.Errorf("failed to write yaml: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+func TestYAMLWriter(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[
+		{"id": 1, "name": "test", "yes": true, "a b": {"c": "line\nbreak"}},
+		{"id": 2, "name": "it's"}
+	]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+
+	if err := NewListWriter(NewYAMLWriter(&buf), WithAlphabetizeHeaders()).Write(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	want := `- "a b.c": "line\nbreak"
+  id: "1.000000"
+  name: "test"
+  "yes": "true"
+- "a b.c": ""
+  id: "2.000000"
+  name: "it's"
+  "yes": ""
+`
+
+	if got := buf.String(); got != want {
+		t.Fatalf("got:\n%s\nwant:\n%s", got, want)
+	}
+}
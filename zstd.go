@@ -0,0 +1,56 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// zstdMagic is the magic number that starts a zstd frame.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// decompress will return a reader of the decompressed data if the data read
+// from "in" is zstd-compressed, which is detected by its magic number, and of
+// the data as it is otherwise. The returned function releases the decoder.
+func decompress(in io.Reader) (io.Reader, func(), error) {
+	buffered := bufio.NewReader(in)
+
+	// A short input is not compressed, and is left to be decoded.
+	magic, err := buffered.Peek(len(zstdMagic))
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, nil, fmt.Errorf("failed to read input: %w", err)
+	}
+
+	if !bytes.Equal(magic, zstdMagic) {
+		return buffered, func() {}, nil
+	}
+
+	dec, err := zstd.NewReader(buffered, zstd.WithDecoderConcurrency(1))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create zstd reader: %w", err)
+	}
+
+	return dec, dec.Close, nil
+}
+
+// WithZstd configures the Encoder to compress its output with zstd. The
+// compressed stream is flushed after each list, and ended by Close, or by
+// Reset before the Encoder writes to the next io.Writer. The ListWriter ignores
+// this option.
+func WithZstd() ListWriterOption {
+	return func(listWriter *ListWriter) {
+		listWriter.zstd = true
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2023 The CSVPB Authors.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//    http://www.apache.org/licenses/LICENSE-2.0
+
+package csvpb
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func compressZstd(t *testing.T, data string) []byte {
+	t.Helper()
+
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return enc.EncodeAll([]byte(data), nil)
+}
+
+// decompressZstd will decompress the data, which is a stream that has not been
+// ended unless "ended" is true.
+func decompressZstd(t *testing.T, data []byte, ended bool) string {
+	t.Helper()
+
+	dec, err := zstd.NewReader(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer dec.Close()
+
+	got, err := io.ReadAll(dec)
+	if !ended && errors.Is(err, io.ErrUnexpectedEOF) {
+		err = nil
+	}
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(got)
+}
+
+func TestConvertZstd(t *testing.T) {
+	t.Parallel()
+
+	in := compressZstd(t, `[{"id": 1}, {"id": 2}]`)
+
+	var out bytes.Buffer
+	if err := Convert(context.Background(), DecodeTypeJSON, bytes.NewReader(in), &out); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := out.String(), "id\n1.000000\n2.000000\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+func TestEncoderZstd(t *testing.T) {
+	t.Parallel()
+
+	list, err := Decode(DecodeTypeJSON, []byte(`[{"id": 1}, {"id": 2}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var first, second bytes.Buffer
+
+	enc := NewEncoder(&first, WithZstd())
+
+	for i := 0; i < 2; i++ {
+		if err := enc.Encode(context.Background(), list); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Each list is flushed, so the stream can be read before it is
+	// ended.
+	if got, want := decompressZstd(t, first.Bytes(), false), "id\n1.000000\n2.000000\n1.000000\n2.000000\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	enc.Reset(&second)
+
+	// Reset ends the stream of the first writer.
+	if got, want := decompressZstd(t, first.Bytes(), true), "id\n1.000000\n2.000000\n1.000000\n2.000000\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+
+	if err := enc.Encode(context.Background(), list); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := decompressZstd(t, second.Bytes(), true), "id\n1.000000\n2.000000\n"; got != want {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}